@@ -3,6 +3,7 @@ package handler
 import (
 	"12305/enum"
 	"12305/model"
+	"12305/query"
 	"12305/response"
 	"12305/service"
 	"12305/utils"
@@ -12,7 +13,9 @@ import (
 )
 
 type OrderHandler struct {
-	OrderService service.OrderSrv
+	OrderService   service.OrderSrv
+	PaymentService service.PaymentSrv
+	TicketService  service.TicketSrv
 }
 
 func (h *OrderHandler) GetEntity(order model.Order) response.Order {
@@ -20,27 +23,114 @@ func (h *OrderHandler) GetEntity(order model.Order) response.Order {
 		ID:          utils.GetUUID(),
 		Key:         utils.GetUUID(),
 		OrderId:     order.OrderId,
-		User:        order.User,
-		Ticket:      h.convertTicket(order.Ticket),
+		UserId:      order.UserId,
+		User:        convertOrderUser(order.User),
+		Items:       convertOrderItems(order.Items),
+		Changes:     convertOrderChanges(order.Changes),
+		Events:      convertOrderEvents(order.Events),
+		Version:     order.Version,
 		TotalPrice:  order.TotalPrice,
 		OrderStatus: order.OrderStatus,
+		ExpireAt:    order.ExpireTime,
 		CreatedAt:   order.CreateTime,
 		UpdatedAt:   order.UpdateTime,
 	}
 }
 
-func (h *OrderHandler) convertTicket(ticket model.Ticket) response.Ticket {
-	return response.Ticket{
+// 下单账号信息，不返回密码
+func convertOrderUser(user *model.User) *response.User {
+	if user == nil {
+		return nil
+	}
+	return &response.User{
 		ID:           utils.GetUUID(),
 		Key:          utils.GetUUID(),
-		TicketId:     ticket.TicketId,
-		TicketNumber: ticket.TicketNumber,
-		TicketTag:    ticket.TicketTag.String(),
-		TicketPrice:  ticket.TicketPrice,
-		CreateTime:   ticket.CreateTime,
-		UpdateTime:   ticket.UpdateTime,
-		DeleteTime:   ticket.DeleteTime,
+		UserId:       user.UserId,
+		UserIdentity: user.UserIdentity,
+		IdType:       user.IdType,
+		VerifyStatus: user.VerifyStatus,
+		UserPhone:    user.UserPhone,
+		UserName:     user.UserName,
+		CreatedAt:    user.CreateTime,
+		UpdatedAt:    user.UpdateTime,
+	}
+}
+
+func convertOrderEvents(events []model.OrderEvent) []response.OrderEvent {
+	result := make([]response.OrderEvent, 0, len(events))
+	for _, event := range events {
+		result = append(result, response.OrderEvent{
+			EventType:  string(event.EventType),
+			FromStatus: event.FromStatus,
+			ToStatus:   event.ToStatus,
+			Version:    event.Version,
+			Remark:     event.Remark,
+			CreatedAt:  event.CreateTime,
+		})
 	}
+	return result
+}
+
+func convertOrderChanges(changes []model.OrderChange) []response.OrderChange {
+	result := make([]response.OrderChange, 0, len(changes))
+	for _, change := range changes {
+		result = append(result, response.OrderChange{
+			ChangeNo:       change.ChangeNo,
+			OrderItemId:    change.OrderItemId,
+			PassengerName:  change.PassengerName,
+			OldTicketTag:   change.OldTicketTag.String(),
+			OldRunDate:     change.OldRunDate,
+			OldFromStation: change.OldDeparture,
+			OldToStation:   change.OldDestination,
+			NewTicketTag:   change.NewTicketTag.String(),
+			NewRunDate:     change.NewRunDate,
+			NewFromStation: change.NewDeparture,
+			NewToStation:   change.NewDestination,
+			PriceDiff:      change.PriceDiff,
+			ChangeStatus:   change.ChangeStatus,
+			PaymentNo:      change.PaymentNo,
+			ChangedAt:      change.CreateTime,
+		})
+	}
+	return result
+}
+
+// 转换订单明细，购票与订单查询共用
+func convertOrderItems(items []model.OrderItem) []response.OrderItem {
+	result := make([]response.OrderItem, 0, len(items))
+	for _, item := range items {
+		result = append(result, response.OrderItem{
+			OrderItemId:   item.OrderItemId,
+			TicketId:      item.TicketId,
+			PassengerId:   item.PassengerId,
+			PassengerName: item.PassengerName,
+			PassengerType: item.PassengerType,
+			TicketTag:     item.TicketTag.String(),
+			RunDate:       item.RunDate,
+			CarriageNo:    item.CarriageNo,
+			SeatClass:     item.SeatClass,
+			SeatRow:       item.SeatRow,
+			SeatLetter:    item.SeatLetter,
+			FromStation:   item.Departure,
+			ToStation:     item.Destination,
+			DepartureTime: item.DepartureTime,
+			ArrivalTime:   item.ArrivalTime,
+			UnitPrice:     item.UnitPrice,
+			ItemPrice:     item.TotalPrice,
+			ItemStatus:    item.ItemStatus,
+			Ticket:        convertItemTicket(item.Ticket),
+		})
+	}
+	return result
+}
+
+func convertItemTicket(ticket *model.Ticket) *response.Ticket {
+	if ticket == nil {
+		return nil
+	}
+	result := (&TicketHandler{}).GetEntity(*ticket)
+	result.TicketStatus = ticket.TicketStatus
+	return &result
 }
 
 func (h *OrderHandler) OrderInfoHandler(c *gin.Context) {
@@ -51,22 +141,45 @@ func (h *OrderHandler) OrderInfoHandler(c *gin.Context) {
 		Data:  nil,
 	}
 
-	orderId := c.Param("order_id")
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	orderId := c.Query("order_id")
 	if orderId == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
 		return
 	}
 	order := model.Order{
 		OrderId: orderId,
 	}
 
-	result, err := h.OrderService.Get(c, &order)
+	// 用户和座位信息从数据库加载，不使用下单消息中的数据
+	result, err := h.OrderService.Get(c.Request.Context(), &order)
 	if err != nil {
 		entity.Code = int(enum.OperateFailed)
 		entity.Msg = enum.OperateFailed.String()
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
+	if result == nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单不存在"
+		c.JSON(http.StatusNotFound, gin.H{"entity": entity})
+		return
+	}
+	if result.UserId != userInfo.UserId {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单不属于当前账号"
+		c.JSON(http.StatusForbidden, gin.H{"entity": entity})
+		return
+	}
 
 	r := h.GetEntity(*result)
 	entity.Data = r
@@ -74,7 +187,123 @@ func (h *OrderHandler) OrderInfoHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
 
-// 支付
+// 当前用户的订单列表，支持按状态、乘车日期、车次、乘车人筛选，游标分页
+func (h *OrderHandler) OrderListHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var req query.OrderListQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "请求参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	orders, total, next, err := h.OrderService.List(c.Request.Context(), userInfo.UserId, &req)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询订单失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = h.getPage(orders, next)
+	entity.Total = int(total)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 后台订单搜索：按订单号、下单手机号或证件号码跨用户查询
+func (h *OrderHandler) OrderSearchHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var req query.OrderSearchQuery
+	if err := c.ShouldBindQuery(&req); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "请求参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	orders, total, next, err := h.OrderService.Search(c.Request.Context(), &req)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询订单失败: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = h.getPage(orders, next)
+	entity.Total = int(total)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *OrderHandler) getPage(orders []*model.Order, next string) response.OrderPage {
+	page := response.OrderPage{
+		Orders:     make([]response.Order, 0, len(orders)),
+		NextCursor: next,
+	}
+	for _, order := range orders {
+		page.Orders = append(page.Orders, h.GetEntity(*order))
+	}
+	return page
+}
+
+// 订单时间线：按时间顺序返回订单的全部状态变更事件
+func (h *OrderHandler) OrderEventsHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	orderId := c.Query("order_id")
+	if orderId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	events, err := h.OrderService.ListEvents(c.Request.Context(), orderId)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	result := make([]model.OrderEvent, 0, len(events))
+	for _, event := range events {
+		result = append(result, *event)
+	}
+	entity.Data = convertOrderEvents(result)
+	entity.Total = len(result)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 支付：为未支付订单发起支付，返回支付地址，支付结果以支付渠道回调为准
 func (h *OrderHandler) OrderPayHandler(c *gin.Context) {
 	entity := response.Entity{
 		Code:  int(enum.OperateOK),
@@ -82,6 +311,112 @@ func (h *OrderHandler) OrderPayHandler(c *gin.Context) {
 		Total: 0,
 		Data:  nil,
 	}
-	//支付相关
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var req struct {
+		OrderId string `json:"order_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.OrderId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	payment, err := h.PaymentService.Pay(c.Request.Context(), userInfo.UserId, req.OrderId)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "发起支付失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = payment
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 退票：按距发车时间收取手续费，剩余金额原路退回，座位恢复可售
+func (h *OrderHandler) OrderRefundHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var req struct {
+		OrderId string `json:"order_id"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.OrderId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	refund, err := h.TicketService.RefundOrder(c.Request.Context(), userInfo.UserId, req.OrderId)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "退票失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = refund
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 改签：改到其他车次、日期或座位，差价原路退还或返回补差价支付流水号
+func (h *OrderHandler) OrderChangeHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var req query.ChangeTicketQuery
+	if err := c.ShouldBindJSON(&req); err != nil || req.OrderId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "订单ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	order, err := h.TicketService.ChangeTicket(c.Request.Context(), userInfo.UserId, &req)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "改签失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = h.GetEntity(*order)
+	entity.Msg = "success"
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
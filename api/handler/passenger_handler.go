@@ -0,0 +1,217 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/middleware"
+	"12305/model"
+	"12305/response"
+	"12305/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PassengerHandler struct {
+	PassengerService service.PassengerSrv
+}
+
+// 从上下文获取当前登录用户，由登录校验中间件写入
+func currentUser(c *gin.Context) (response.User, bool) {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		return response.User{}, false
+	}
+	user := principal.User
+	return response.User{
+		UserId:       user.UserId,
+		UserIdentity: user.UserIdentity,
+		IdType:       user.IdType,
+		VerifyStatus: user.VerifyStatus,
+		UserPhone:    user.UserPhone,
+		UserName:     user.UserName,
+		CreatedAt:    user.CreateTime,
+		UpdatedAt:    user.UpdateTime,
+	}, true
+}
+
+func (h *PassengerHandler) PassengerListHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:      int(enum.OperateOK),
+		Msg:       enum.OperateOK.String(),
+		Total:     0,
+		TotalPage: 1,
+		Data:      nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	passengers, err := h.PassengerService.List(c, userInfo.UserId)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = passengers
+	entity.Total = len(passengers)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *PassengerHandler) PassengerCreateHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var passenger model.Passenger
+	if err := c.ShouldBindJSON(&passenger); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.PassengerService.Create(c, userInfo.UserId, &passenger)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "添加乘车人失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if result == nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "乘车人已存在"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = result
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *PassengerHandler) PassengerEditHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var passenger model.Passenger
+	if err := c.ShouldBindJSON(&passenger); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	passenger.PassengerId = c.Param("passenger_id")
+
+	b, err := h.PassengerService.Edit(c, userInfo.UserId, &passenger)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "修改乘车人失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *PassengerHandler) PassengerDeleteHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	b, err := h.PassengerService.Delete(c, userInfo.UserId, c.Param("passenger_id"))
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "删除乘车人失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 重新核验乘车人，添加时核验服务不可用或核验未通过时使用
+func (h *PassengerHandler) PassengerVerifyHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	passenger, err := h.PassengerService.Verify(c, userInfo.UserId, c.Param("passenger_id"))
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		entity.Data = passenger
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = passenger
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
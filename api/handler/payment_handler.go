@@ -0,0 +1,117 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/payment"
+	"12305/response"
+	"12305/service"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PaymentHandler struct {
+	PaymentService service.PaymentSrv
+	// 是否注册模拟支付接口，仅开发联调环境开启
+	MockEnabled bool
+}
+
+// 支付渠道异步回调，处理成功返回 success，否则渠道会重试
+func (h *PaymentHandler) PaymentCallbackHandler(c *gin.Context) {
+	var payload payment.CallbackPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		c.String(http.StatusBadRequest, "fail")
+		return
+	}
+
+	if err := h.PaymentService.HandleCallback(c.Request.Context(), payload); err != nil {
+		c.String(http.StatusBadRequest, "fail: "+err.Error())
+		return
+	}
+	c.String(http.StatusOK, "success")
+}
+
+// 查询支付结果
+func (h *PaymentHandler) PaymentQueryHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	paymentNo := c.Query("payment_no")
+	if paymentNo == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "支付流水号不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.PaymentService.Query(c.Request.Context(), userInfo.UserId, paymentNo)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询支付结果失败: " + err.Error()
+		if errors.Is(err, service.ErrPaymentNotOwned) {
+			c.JSON(http.StatusForbidden, gin.H{"entity": entity})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = result
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 模拟支付渠道完成支付，离线联调使用；仅开启 payment.mock_enabled 时注册，
+// 只能完成当前账号的支付，请求须携带渠道密钥生成的 sign
+func (h *PaymentHandler) PaymentMockCompleteHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	paymentNo := c.Query("payment_no")
+	if paymentNo == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "支付流水号不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	status := c.DefaultQuery("status", payment.TradeStatusSuccess)
+	if err := h.PaymentService.MockComplete(c.Request.Context(), userInfo.UserId, paymentNo, status, c.Query("sign")); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "模拟支付失败: " + err.Error()
+		if errors.Is(err, service.ErrPaymentNotOwned) || errors.Is(err, payment.ErrInvalidSignature) {
+			c.JSON(http.StatusForbidden, gin.H{"entity": entity})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
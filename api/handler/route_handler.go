@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/response"
+	"12305/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type RouteHandler struct {
+	RouteService service.RouteSrv
+}
+
+// 按车次查询线路及停靠站
+func (h *RouteHandler) RouteInfoHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	ticketTag := c.Query("ticket_tag")
+	if ticketTag == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车次不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	route, err := h.RouteService.GetByTicketTag(c, ticketTag)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询线路失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = route
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *RouteHandler) RouteCreateHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var route model.Route
+	if err := c.ShouldBindJSON(&route); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.RouteService.Create(c, &route)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "创建线路失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if result == nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "线路已存在"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = result
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
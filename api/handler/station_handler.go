@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/response"
+	"12305/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type StationHandler struct {
+	StationService service.StationSrv
+}
+
+func (h *StationHandler) StationListHandler(c *gin.Context) {
+	var q query.ListQuery
+	entity := response.Entity{
+		Code:      int(enum.OperateOK),
+		Msg:       enum.OperateOK.String(),
+		Total:     0,
+		TotalPage: 1,
+		Data:      nil,
+	}
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	stations, err := h.StationService.List(c, &q)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = stations
+	entity.Total = len(stations)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *StationHandler) StationCreateHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var station model.Station
+	if err := c.ShouldBindJSON(&station); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.StationService.Create(c, &station)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "创建车站失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if result == nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车站已存在"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = result
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
@@ -3,7 +3,7 @@ package handler
 import (
 	"12305/enum"
 	"12305/model"
-	"12305/repository"
+	"12305/query"
 	"12305/response"
 	"12305/service"
 	"12305/utils"
@@ -14,8 +14,6 @@ import (
 
 type TicketHandler struct {
 	TicketService service.TicketSrv
-	RedisRepo     repository.RedisRepository
-	LocalRepo     repository.LocalRepository
 }
 
 func (h *TicketHandler) GetEntity(ticket model.Ticket) response.Ticket {
@@ -25,6 +23,11 @@ func (h *TicketHandler) GetEntity(ticket model.Ticket) response.Ticket {
 		TicketId:     ticket.TicketId,
 		TicketNumber: ticket.TicketNumber,
 		TicketTag:    ticket.TicketTag.String(),
+		RunDate:      ticket.RunDate,
+		CarriageNo:   ticket.CarriageNo,
+		SeatClass:    ticket.SeatClass,
+		SeatRow:      ticket.SeatRow,
+		SeatLetter:   ticket.SeatLetter,
 		TicketPrice:  ticket.TicketPrice,
 		CreateTime:   ticket.CreateTime,
 		UpdateTime:   ticket.UpdateTime,
@@ -71,25 +74,24 @@ func (h *TicketHandler) TicketBuyHandler(c *gin.Context) {
 		Data:  nil,
 	}
 
-	var ticket model.Ticket
-	if err := c.ShouldBindJSON(&ticket); err != nil {
+	var q query.BuyTicketQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
 		entity.Code = int(enum.OperateFailed)
 		entity.Msg = "参数错误: " + err.Error()
 		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
 		return
 	}
 
-	user, ok := c.Get("user")
+	userInfo, ok := currentUser(c)
 	if !ok {
 		entity.Code = int(enum.OperateFailed)
 		entity.Msg = "用户信息获取失败"
 		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
 		return
 	}
-	userInfo := user.(response.User)
 
-	// 抢票
-	result, err := h.TicketService.BuyTicketWriteThrough(c.Request.Context(), &ticket, userInfo)
+	// 抢票，所有座位全部成功或全部失败
+	order, err := h.TicketService.BuyTicketWriteThrough(c.Request.Context(), &q, userInfo)
 	if err != nil {
 		entity.Code = int(enum.OperateFailed)
 		entity.Msg = "抢票失败: " + err.Error()
@@ -97,19 +99,17 @@ func (h *TicketHandler) TicketBuyHandler(c *gin.Context) {
 		return
 	}
 
-	if result {
-		entity.Msg = "抢票成功"
-		entity.Data = gin.H{
-			"ticket_id": ticket.TicketId,
-			"user_id":   userInfo.UserId,
-			"status":    "success",
-		}
-		c.JSON(http.StatusOK, gin.H{"entity": entity})
-	} else {
-		entity.Code = int(enum.OperateFailed)
-		entity.Msg = "抢票失败，票已售出或不可用"
-		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+	entity.Msg = "抢票成功"
+	entity.Total = len(order.Items)
+	entity.Data = gin.H{
+		"order_id":     order.OrderId,
+		"user_id":      userInfo.UserId,
+		"order_status": order.OrderStatus,
+		"total_price":  order.TotalPrice,
+		"expire_at":    order.ExpireTime,
+		"items":        convertOrderItems(order.Items),
 	}
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
 
 // 缓存预热接口
@@ -155,9 +155,121 @@ func (h *TicketHandler) GetCacheStats(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
 
+// 管理后台：新增座位，座位需属于已登记车次某一天的开行计划
+func (h *TicketHandler) TicketCreateHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var ticket model.Ticket
+	if err := c.ShouldBindJSON(&ticket); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.TicketService.Create(c.Request.Context(), &ticket)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "新增座位失败: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if result == nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "座位已存在"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = h.GetEntity(*result)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 管理后台：修改座位的车次、座位号与席别，票价按席别重新计算
+func (h *TicketHandler) TicketEditHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var ticket model.Ticket
+	if err := c.ShouldBindJSON(&ticket); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if ticket.TicketId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "座位ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	b, err := h.TicketService.Edit(c.Request.Context(), &ticket)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "修改座位失败: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "座位不存在"
+		c.JSON(http.StatusNotFound, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 管理后台：删除座位，已售出的座位不能删除
+func (h *TicketHandler) TicketDeleteHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	ticketId := c.Query("ticket_id")
+	if ticketId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "座位ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	b, err := h.TicketService.Delete(c.Request.Context(), &model.Ticket{TicketId: ticketId})
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "删除座位失败: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "座位不存在"
+		c.JSON(http.StatusNotFound, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
 // Read-Through模式查询车票
 func (h *TicketHandler) TicketListReadThroughHandler(c *gin.Context) {
-	var tickettag string
+	var q query.TicketQuery
 	entity := response.Entity{
 		Code:      int(enum.OperateOK),
 		Msg:       enum.OperateOK.String(),
@@ -166,12 +278,12 @@ func (h *TicketHandler) TicketListReadThroughHandler(c *gin.Context) {
 		Data:      nil,
 	}
 
-	if err := c.ShouldBindQuery(&tickettag); err != nil {
+	if err := c.ShouldBindQuery(&q); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
 
-	tickets, err := h.TicketService.ListByTicketTagReadThrough(c, tickettag)
+	tickets, err := h.TicketService.ListByTicketTagReadThrough(c, q.TicketTag, q.RunDate, q.FromStation, q.ToStation)
 	if err != nil {
 		entity.Code = int(enum.OperateFailed)
 		entity.Msg = "查询失败: " + err.Error()
@@ -180,10 +292,43 @@ func (h *TicketHandler) TicketListReadThroughHandler(c *gin.Context) {
 	}
 
 	entity.Data = tickets
+	entity.Total = len(tickets)
 	entity.Msg = "Read-Through模式查询成功"
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
 
+// 座位图查询
+func (h *TicketHandler) TicketSeatMapHandler(c *gin.Context) {
+	var q query.TicketQuery
+	entity := response.Entity{
+		Code:      int(enum.OperateOK),
+		Msg:       enum.OperateOK.String(),
+		Total:     0,
+		TotalPage: 1,
+		Data:      nil,
+	}
+
+	if err := c.ShouldBindQuery(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	seatMap, err := h.TicketService.GetSeatMap(c, q.TicketTag, q.RunDate, q.FromStation, q.ToStation)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询座位图失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = seatMap
+	entity.Total = len(seatMap)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
 // 查询抢票结果
 func (h *TicketHandler) TicketBuyResultHandler(c *gin.Context) {
 	taskId := c.Param("task_id")
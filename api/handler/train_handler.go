@@ -0,0 +1,210 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/response"
+	"12305/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrainHandler struct {
+	TrainService service.TrainSrv
+}
+
+func (h *TrainHandler) TrainListHandler(c *gin.Context) {
+	var q query.ListQuery
+	entity := response.Entity{
+		Code:      int(enum.OperateOK),
+		Msg:       enum.OperateOK.String(),
+		Total:     0,
+		TotalPage: 1,
+		Data:      nil,
+	}
+	if err := c.ShouldBindQuery(&q); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	trains, err := h.TrainService.List(c, &q)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = trains
+	entity.Total = len(trains)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *TrainHandler) TrainCreateHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var train model.Train
+	if err := c.ShouldBindJSON(&train); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.TrainService.Create(c, &train)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "登记车次失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if result == nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车次已存在"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = result
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *TrainHandler) TrainEditHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var train model.Train
+	if err := c.ShouldBindJSON(&train); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	b, err := h.TrainService.Edit(c, &train)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "修改车次失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func (h *TrainHandler) TrainRetireHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	trainId := c.Query("train_id")
+	if trainId == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车次ID不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	b, err := h.TrainService.Retire(c, &model.Train{TrainId: trainId})
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "停运车次失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车次已停运"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 查询车次编组
+func (h *TrainHandler) TrainConsistHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	ticketTag := c.Query("ticket_tag")
+	if ticketTag == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车次不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	carriages, err := h.TrainService.GetConsist(c, ticketTag)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询编组失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = carriages
+	entity.Total = len(carriages)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 设置车次编组，仅影响之后生成的开行计划
+func (h *TrainHandler) TrainSetConsistHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var req struct {
+		TicketTag string            `json:"ticket_tag"`
+		Carriages []*model.Carriage `json:"carriages"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	if err := h.TrainService.SetConsist(c, req.TicketTag, req.Carriages); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "设置编组失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = req.Carriages
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
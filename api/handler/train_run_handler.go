@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/response"
+	"12305/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+type TrainRunHandler struct {
+	TrainRunService service.TrainRunSrv
+}
+
+// 查询车次从某天起的开行计划
+func (h *TrainRunHandler) TrainRunListHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:      int(enum.OperateOK),
+		Msg:       enum.OperateOK.String(),
+		Total:     0,
+		TotalPage: 1,
+		Data:      nil,
+	}
+
+	ticketTag := c.Query("ticket_tag")
+	if ticketTag == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "车次不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	runs, err := h.TrainRunService.ListFromDate(c, ticketTag, c.Query("from_date"))
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询开行计划失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = runs
+	entity.Total = len(runs)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 手动触发生成开行计划及库存
+func (h *TrainRunHandler) TrainRunMaterializeHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	days, _ := strconv.Atoi(c.Query("days"))
+	created, err := h.TrainRunService.MaterializeRuns(c.Request.Context(), days)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "生成开行计划失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = gin.H{"created": created}
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
@@ -2,29 +2,39 @@ package handler
 
 import (
 	"12305/enum"
+	"12305/middleware"
 	"12305/model"
+	"12305/query"
 	"12305/response"
 	"12305/service"
 	"12305/utils"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 )
 
 type UserHandler struct {
 	UserService service.UserSrv
+	AuthService service.AuthSrv
+	SmsService  service.SmsSrv
 }
 
 func (h *UserHandler) GetEntity(user model.User) response.User {
 	return response.User{
-		ID:        utils.GetUUID(),
-		Key:       utils.GetUUID(),
-		UserId:    user.UserId,
-		UserPhone: user.UserPhone,
-		UserName:  user.UserName,
-		UserPwd:   user.UserPwd,
-		CreatedAt: user.CreateTime,
-		UpdatedAt: user.UpdateTime,
+		ID:           utils.GetUUID(),
+		Key:          utils.GetUUID(),
+		UserId:       user.UserId,
+		UserIdentity: user.UserIdentity,
+		IdType:       user.IdType,
+		VerifyStatus: user.VerifyStatus,
+		UserPhone:    user.UserPhone,
+		UserName:     user.UserName,
+		CreatedAt:    user.CreateTime,
+		UpdatedAt:    user.UpdateTime,
 	}
 }
 
@@ -36,23 +46,16 @@ func (h *UserHandler) UserInfoHandler(c *gin.Context) {
 		Data:  nil,
 	}
 
-	userId := c.Param("user_id")
-	if userId == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
-		return
-	}
-	user := model.User{
-		UserId: userId,
-	}
-	result, err := h.UserService.Get(c, &user)
-	if err != nil {
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
 		entity.Code = int(enum.OperateFailed)
-		entity.Msg = enum.OperateFailed.String()
-		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
 		return
 	}
 
-	r := h.GetEntity(*result)
+	r := h.GetEntity(*principal.User)
+	r.Roles = roleNames(principal.Roles)
 	entity.Data = r
 	entity.Msg = "success"
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
@@ -102,6 +105,7 @@ func (h *UserHandler) UserInfoHandler(c *gin.Context) {
 
 // }
 
+// 注册：手机号须通过注册验证码校验
 func (h *UserHandler) UserCreateHandler(c *gin.Context) {
 	entity := response.Entity{
 		Code:  int(enum.OperateOK),
@@ -110,14 +114,38 @@ func (h *UserHandler) UserCreateHandler(c *gin.Context) {
 		Data:  nil,
 	}
 
-	var user model.User
-	if err := c.ShouldBindJSON(&user); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+	var q query.RegisterQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	// 先校验密码，避免验证码因其他参数错误被作废
+	if err := utils.ValidatePassword(q.UserPwd); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if err := h.SmsService.VerifyCode(c, enum.SmsSceneRegister, q.UserPhone, q.SmsCode); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		c.JSON(smsCodeStatus(err, http.StatusBadRequest), gin.H{"entity": entity})
 		return
 	}
 
+	user := model.User{
+		UserPhone:    q.UserPhone,
+		UserPwd:      q.UserPwd,
+		UserName:     q.UserName,
+		IdType:       enum.IdType(q.IdType),
+		UserIdentity: q.UserIdentity,
+	}
 	_, err := h.UserService.Create(c, &user)
 	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
@@ -126,7 +154,8 @@ func (h *UserHandler) UserCreateHandler(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
 
-func (h *UserHandler) UserEditHandler(c *gin.Context) {
+// 发送短信验证码
+func (h *UserHandler) UserSmsSendHandler(c *gin.Context) {
 	entity := response.Entity{
 		Code:  int(enum.OperateOK),
 		Msg:   enum.OperateOK.String(),
@@ -134,13 +163,169 @@ func (h *UserHandler) UserEditHandler(c *gin.Context) {
 		Data:  nil,
 	}
 
-	var user model.User
-	if err := c.ShouldBindJSON(&user); err != nil {
+	var q query.SmsSendQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if err := h.SmsService.SendCode(c, enum.SmsScene(q.Scene), q.UserPhone, c.ClientIP()); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		status := http.StatusBadRequest
+		if errors.Is(err, service.ErrSmsTooFrequent) {
+			status = http.StatusTooManyRequests
+		}
+		c.JSON(status, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "验证码已发送"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 验证码登录
+func (h *UserHandler) UserSmsLoginHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var q query.SmsLoginQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if err := h.SmsService.VerifyCode(c, enum.SmsSceneLogin, q.UserPhone, q.SmsCode); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		c.JSON(smsCodeStatus(err, http.StatusUnauthorized), gin.H{"entity": entity})
+		return
+	}
+	result, err := h.UserService.GetByUserPhone(c, q.UserPhone)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "登录失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+	h.respondToken(c, entity, result)
+}
+
+// 通过验证码重置密码，重置后注销该用户的全部登录
+func (h *UserHandler) UserPasswordResetHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var q query.ResetPasswordQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if err := utils.ValidatePassword(q.UserPwd); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if err := h.SmsService.VerifyCode(c, enum.SmsSceneResetPassword, q.UserPhone, q.SmsCode); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		c.JSON(smsCodeStatus(err, http.StatusBadRequest), gin.H{"entity": entity})
+		return
+	}
+	user, err := h.UserService.ResetPassword(c, q.UserPhone, q.UserPwd)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
-	b, err := h.UserService.Edit(c, &user)
+	if err := h.AuthService.RevokeUserSessions(c, user.UserId); err != nil {
+		fmt.Printf("注销用户 %s 的登录会话失败: %v\n", user.UserId, err)
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 验证码错误返回 status，其他错误（如 Redis 不可用）返回 500
+func smsCodeStatus(err error, status int) int {
+	if errors.Is(err, service.ErrSmsCodeInvalid) || errors.Is(err, service.ErrSmsCodeExpired) || errors.Is(err, service.ErrSmsCodeExhausted) {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *UserHandler) UserEditHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var q query.UserEditQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	// 先校验新密码，避免验证码因其他参数错误被作废
+	if q.UserPwd != "" {
+		if err := utils.ValidatePassword(q.UserPwd); err != nil {
+			entity.Code = int(enum.OperateFailed)
+			entity.Msg = err.Error()
+			c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+			return
+		}
+	}
+	// 更换手机号须通过新手机号的验证码证明持有该号码
+	if q.UserPhone != "" && q.UserPhone != principal.User.UserPhone {
+		if err := service.ValidatePhone(q.UserPhone); err != nil {
+			entity.Code = int(enum.OperateFailed)
+			entity.Msg = err.Error()
+			c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+			return
+		}
+		if err := h.SmsService.VerifyCode(c, enum.SmsSceneChangePhone, q.UserPhone, q.SmsCode); err != nil {
+			entity.Code = int(enum.OperateFailed)
+			entity.Msg = err.Error()
+			c.JSON(smsCodeStatus(err, http.StatusBadRequest), gin.H{"entity": entity})
+			return
+		}
+	}
+	// 只能修改当前登录用户
+	user := model.User{
+		UserId:    principal.UserId,
+		UserName:  q.UserName,
+		UserPhone: q.UserPhone,
+		UserPwd:   q.UserPwd,
+	}
+	b, err := h.UserService.Edit(c, &user, q.OldPwd)
 	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
@@ -150,6 +335,12 @@ func (h *UserHandler) UserEditHandler(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
+	// 修改密码后注销该用户的全部登录
+	if user.UserPwd != "" {
+		if err := h.AuthService.RevokeUserSessions(c, user.UserId); err != nil {
+			fmt.Printf("注销用户 %s 的登录会话失败: %v\n", user.UserId, err)
+		}
+	}
 
 	entity.Msg = "success"
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
@@ -162,19 +353,25 @@ func (h *UserHandler) UserDeleteHandler(c *gin.Context) {
 		Total: 0,
 		Data:  nil,
 	}
-	userId := c.Param("user_id")
-	if userId == "" {
-		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
 		return
 	}
+	// 注销当前登录用户的账号
 	user := model.User{
-		UserId: userId,
+		UserId: principal.UserId,
 	}
 	_, err := h.UserService.Delete(c, &user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
+	if err := h.AuthService.RevokeUserSessions(c, user.UserId); err != nil {
+		fmt.Printf("注销用户 %s 的登录会话失败: %v\n", user.UserId, err)
+	}
 
 	entity.Msg = "success"
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
@@ -187,24 +384,301 @@ func (h *UserHandler) UserLoginHandler(c *gin.Context) {
 		Total: 0,
 		Data:  nil,
 	}
-	var user model.User
-	err := c.ShouldBindJSON(&user)
+	var q query.LoginQuery
+	err := c.ShouldBindJSON(&q)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
-	result, err := h.UserService.Login(c, &user)
+	result, err := h.UserService.Login(c, &model.User{UserPhone: q.UserPhone, UserPwd: q.UserPwd})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
 	if result == nil {
 		entity.Code = int(enum.OperateFailed)
-		entity.Msg = enum.OperateFailed.String()
+		entity.Msg = "手机号或密码错误"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+	h.respondToken(c, entity, result)
+}
+
+// 为登录成功的用户签发令牌
+func (h *UserHandler) respondToken(c *gin.Context, entity response.Entity, result *model.User) {
+	token, err := h.AuthService.IssueTokens(c, result)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
 		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
 		return
 	}
-	entity.Data = h.GetEntity(*result)
+	user := h.GetEntity(*result)
+	token.User = &user
+	entity.Data = token
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 使用刷新令牌换取新令牌，旧刷新令牌作废
+func (h *UserHandler) UserTokenRefreshHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+	var q query.TokenQuery
+	if err := c.ShouldBindJSON(&q); err != nil || q.RefreshToken == "" {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "刷新令牌不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	token, err := h.AuthService.Refresh(c, q.RefreshToken)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenRevoked) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"entity": entity})
+		return
+	}
+	entity.Data = token
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 退出登录：注销刷新令牌或访问令牌所属的会话
+func (h *UserHandler) UserLogoutHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+	var q query.TokenQuery
+	_ = c.ShouldBindJSON(&q)
+	token := q.RefreshToken
+	if token == "" {
+		token = strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	}
+	if err := h.AuthService.Logout(c, token); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		status := http.StatusInternalServerError
+		if errors.Is(err, service.ErrInvalidToken) {
+			status = http.StatusUnauthorized
+		}
+		c.JSON(status, gin.H{"entity": entity})
+		return
+	}
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 当前账号实名核验
+func (h *UserHandler) UserVerifyHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	principal, ok := middleware.CurrentPrincipal(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var q query.UserVerifyQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	user, err := h.UserService.Verify(c, principal.UserId, q.UserName, enum.IdType(q.IdType), q.UserIdentity)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		if user != nil {
+			entity.Data = h.GetEntity(*user)
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = h.GetEntity(*user)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+func roleNames(roles []enum.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name())
+	}
+	return names
+}
+
+// 管理后台：用户列表
+func (h *UserHandler) AdminUserListHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var q query.ListQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	list, err := h.UserService.List(c, &q)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询用户失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	total, err := h.UserService.GetTotal(c, &q)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询用户失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	totalPage := total / q.PageSize
+	if total%q.PageSize > 0 {
+		totalPage++
+	}
+
+	users := make([]response.User, 0, len(list))
+	for _, v := range list {
+		users = append(users, h.GetEntity(*v))
+	}
+	entity.Total = total
+	entity.TotalPage = totalPage
+	entity.Data = users
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 管理后台：用户信息及角色
+func (h *UserHandler) AdminUserInfoHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	// 按用户ID或证件号码查询
+	var (
+		user *model.User
+		err  error
+	)
+	if userId := c.Query("user_id"); userId != "" {
+		user, err = h.UserService.Get(c, &model.User{UserId: userId})
+	} else if userIdentity := c.Query("user_identity"); userIdentity != "" {
+		user, err = h.UserService.GetByUserIdentity(c, userIdentity)
+	} else {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户ID或证件号码不能为空"
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			entity.Msg = "用户不存在"
+			c.JSON(http.StatusNotFound, gin.H{"entity": entity})
+			return
+		}
+		entity.Msg = "查询用户失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	roles, err := h.UserService.GetRoles(c, user.UserId)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询用户角色失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	r := h.GetEntity(*user)
+	r.Roles = roleNames(roles)
+	entity.Data = r
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 管理后台：设置用户角色，覆盖原有角色
+func (h *UserHandler) AdminUserRolesHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	var q query.UserRolesQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+	roles := make([]enum.Role, 0, len(q.Roles))
+	for _, name := range q.Roles {
+		role, ok := enum.ParseRole(name)
+		if !ok {
+			entity.Code = int(enum.OperateFailed)
+			entity.Msg = "无效的角色: " + name
+			c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+			return
+		}
+		roles = append(roles, role)
+	}
+	// 不能撤销自己的管理员角色，避免系统失去管理员
+	if principal, ok := middleware.CurrentPrincipal(c); ok && principal.UserId == q.UserId && principal.HasRole(enum.RoleAdmin) {
+		keepAdmin := false
+		for _, role := range roles {
+			if role == enum.RoleAdmin {
+				keepAdmin = true
+			}
+		}
+		if !keepAdmin {
+			entity.Code = int(enum.OperateFailed)
+			entity.Msg = "不能撤销自己的管理员角色"
+			c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+			return
+		}
+	}
+
+	result, err := h.UserService.SetRoles(c, q.UserId, roles)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = gin.H{
+		"user_id": q.UserId,
+		"roles":   roleNames(result),
+	}
 	entity.Msg = "success"
 	c.JSON(http.StatusOK, gin.H{"entity": entity})
 }
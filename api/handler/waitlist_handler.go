@@ -0,0 +1,155 @@
+package handler
+
+import (
+	"12305/enum"
+	"12305/query"
+	"12305/response"
+	"12305/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+type WaitlistHandler struct {
+	WaitlistService service.WaitlistSrv
+}
+
+// 登记候补
+func (h *WaitlistHandler) WaitlistCreateHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	var q query.WaitlistQuery
+	if err := c.ShouldBindJSON(&q); err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "参数错误: " + err.Error()
+		c.JSON(http.StatusBadRequest, gin.H{"entity": entity})
+		return
+	}
+
+	result, err := h.WaitlistService.Create(c.Request.Context(), userInfo, &q)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "登记候补失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = result
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 查询本账号的候补订单
+func (h *WaitlistHandler) WaitlistListHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:      int(enum.OperateOK),
+		Msg:       enum.OperateOK.String(),
+		Total:     0,
+		TotalPage: 1,
+		Data:      nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	waitlists, err := h.WaitlistService.List(c, userInfo.UserId)
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = enum.OperateFailed.String()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = waitlists
+	entity.Total = len(waitlists)
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 查询候补排名
+func (h *WaitlistHandler) WaitlistPositionHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	waitlist, position, err := h.WaitlistService.Position(c, userInfo.UserId, c.Query("waitlist_id"))
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "查询候补排名失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Data = gin.H{
+		"waitlist_id":     waitlist.WaitlistId,
+		"waitlist_status": waitlist.WaitlistStatus,
+		"position":        position,
+		"order_id":        waitlist.OrderId,
+	}
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
+
+// 取消候补
+func (h *WaitlistHandler) WaitlistCancelHandler(c *gin.Context) {
+	entity := response.Entity{
+		Code:  int(enum.OperateOK),
+		Msg:   enum.OperateOK.String(),
+		Total: 0,
+		Data:  nil,
+	}
+
+	userInfo, ok := currentUser(c)
+	if !ok {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "用户信息获取失败"
+		c.JSON(http.StatusUnauthorized, gin.H{"entity": entity})
+		return
+	}
+
+	b, err := h.WaitlistService.Cancel(c.Request.Context(), userInfo.UserId, c.Query("waitlist_id"))
+	if err != nil {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "取消候补失败: " + err.Error()
+		c.JSON(http.StatusInternalServerError, gin.H{"entity": entity})
+		return
+	}
+	if !b {
+		entity.Code = int(enum.OperateFailed)
+		entity.Msg = "候补订单已兑现或已结束"
+		c.JSON(http.StatusConflict, gin.H{"entity": entity})
+		return
+	}
+
+	entity.Msg = "success"
+	c.JSON(http.StatusOK, gin.H{"entity": entity})
+}
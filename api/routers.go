@@ -2,42 +2,147 @@ package api
 
 import (
 	"12305/api/handler"
+	"12305/enum"
+	"12305/middleware"
+	"12305/service"
 
 	"github.com/gin-gonic/gin"
 )
 
-func InitRouter(UserHandler *handler.UserHandler, TicketHandler *handler.TicketHandler, OrderHandler *handler.OrderHandler) *gin.Engine {
+// 无需登录即可访问的接口，键为 "方法 路由"；其余接口均需携带访问令牌
+var publicRoutes = map[string]bool{
+	"POST /user/register":       true,
+	"POST /user/sms/send":       true,
+	"POST /user/login":          true,
+	"POST /user/login/sms":      true,
+	"POST /user/password/reset": true,
+	"POST /user/token/refresh":  true,
+	"POST /user/logout":         true, //使用请求体中的刷新令牌注销
+	"GET /ticket/list":          true,
+	"GET /ticket/seatmap":       true,
+	"GET /station/list":         true,
+	"GET /route/info":           true,
+	"GET /train/list":           true,
+	"GET /train/runs":           true,
+	"GET /train/consist":        true,
+	"POST /payment/callback":    true, //支付渠道回调，通过签名校验
+}
+
+func InitRouter(AuthService service.AuthSrv, UserHandler *handler.UserHandler, TicketHandler *handler.TicketHandler, OrderHandler *handler.OrderHandler, StationHandler *handler.StationHandler, RouteHandler *handler.RouteHandler, TrainHandler *handler.TrainHandler, TrainRunHandler *handler.TrainRunHandler, PassengerHandler *handler.PassengerHandler, WaitlistHandler *handler.WaitlistHandler, PaymentHandler *handler.PaymentHandler) *gin.Engine {
 	router := gin.Default()
 	//router.Use(cors.Default())//跨域
 	router.Use(gin.Recovery())
 	router.Use(gin.Logger())
-	//router.Use(middleware.JwtAuth()) //事实上涉及支付使用session+cookie更安全
+	auth := middleware.Auth(AuthService, publicRoutes)
 
 	// 用户相关路由
-	userGroup := router.Group("/user")
+	userGroup := router.Group("/user", auth)
 	{
 		userGroup.POST("/register", UserHandler.UserCreateHandler)
+		userGroup.POST("/sms/send", UserHandler.UserSmsSendHandler)
 		userGroup.POST("/login", UserHandler.UserLoginHandler)
+		userGroup.POST("/login/sms", UserHandler.UserSmsLoginHandler)
+		userGroup.POST("/password/reset", UserHandler.UserPasswordResetHandler)
+		userGroup.POST("/token/refresh", UserHandler.UserTokenRefreshHandler)
+		userGroup.POST("/logout", UserHandler.UserLogoutHandler)
 		userGroup.GET("/info", UserHandler.UserInfoHandler)
 		userGroup.PUT("/edit", UserHandler.UserEditHandler)
 		userGroup.DELETE("/delete", UserHandler.UserDeleteHandler)
+		userGroup.POST("/verify", UserHandler.UserVerifyHandler)
+		// 常用乘车人
+		userGroup.GET("/passengers", PassengerHandler.PassengerListHandler)
+		userGroup.POST("/passengers", PassengerHandler.PassengerCreateHandler)
+		userGroup.PUT("/passengers/:passenger_id", PassengerHandler.PassengerEditHandler)
+		userGroup.DELETE("/passengers/:passenger_id", PassengerHandler.PassengerDeleteHandler)
+		userGroup.POST("/passengers/:passenger_id/verify", PassengerHandler.PassengerVerifyHandler)
 	}
 
 	// 票务相关路由
-	ticketGroup := router.Group("/ticket")
+	ticketGroup := router.Group("/ticket", auth)
 	{
 		ticketGroup.GET("/list", TicketHandler.TicketListReadThroughHandler)
+		ticketGroup.GET("/seatmap", TicketHandler.TicketSeatMapHandler)
 		ticketGroup.POST("/buy", TicketHandler.TicketBuyHandler)
-		// 新增：缓存管理路由
-		ticketGroup.POST("/cache/warmup", TicketHandler.WarmUpCache)
-		ticketGroup.GET("/cache/stats", TicketHandler.GetCacheStats)
+	}
+
+	// 候补相关路由
+	waitlistGroup := router.Group("/waitlist", auth)
+	{
+		waitlistGroup.POST("/create", WaitlistHandler.WaitlistCreateHandler)
+		waitlistGroup.GET("/list", WaitlistHandler.WaitlistListHandler)
+		waitlistGroup.GET("/position", WaitlistHandler.WaitlistPositionHandler)
+		waitlistGroup.POST("/cancel", WaitlistHandler.WaitlistCancelHandler)
+	}
+
+	// 车站相关路由
+	stationGroup := router.Group("/station", auth)
+	{
+		stationGroup.GET("/list", StationHandler.StationListHandler)
+		stationGroup.POST("/create", middleware.RequirePermission(enum.PermissionStationManage), StationHandler.StationCreateHandler)
+	}
+
+	// 线路相关路由
+	routeGroup := router.Group("/route", auth)
+	{
+		routeGroup.GET("/info", RouteHandler.RouteInfoHandler)
+		routeGroup.POST("/create", middleware.RequirePermission(enum.PermissionStationManage), RouteHandler.RouteCreateHandler)
+	}
+
+	// 车次相关路由
+	trainGroup := router.Group("/train", auth)
+	{
+		trainGroup.GET("/list", TrainHandler.TrainListHandler)
+		trainGroup.GET("/runs", TrainRunHandler.TrainRunListHandler)
+		trainGroup.GET("/consist", TrainHandler.TrainConsistHandler)
+	}
+
+	// 管理后台路由，按角色权限逐项授权
+	adminGroup := router.Group("/admin", auth)
+	{
+		ticketAdmin := adminGroup.Group("/ticket", middleware.RequirePermission(enum.PermissionTicketManage))
+		ticketAdmin.POST("/create", TicketHandler.TicketCreateHandler)
+		ticketAdmin.PUT("/edit", TicketHandler.TicketEditHandler)
+		ticketAdmin.DELETE("/delete", TicketHandler.TicketDeleteHandler)
+
+		trainAdmin := adminGroup.Group("/train", middleware.RequirePermission(enum.PermissionTrainManage))
+		trainAdmin.POST("/create", TrainHandler.TrainCreateHandler)
+		trainAdmin.PUT("/edit", TrainHandler.TrainEditHandler)
+		trainAdmin.POST("/retire", TrainHandler.TrainRetireHandler)
+		trainAdmin.PUT("/consist", TrainHandler.TrainSetConsistHandler)
+		trainAdmin.POST("/runs/materialize", TrainRunHandler.TrainRunMaterializeHandler)
+
+		adminGroup.GET("/order/search", middleware.RequirePermission(enum.PermissionOrderSearch), OrderHandler.OrderSearchHandler)
+
+		userAdmin := adminGroup.Group("/user", middleware.RequirePermission(enum.PermissionUserManage))
+		userAdmin.GET("/list", UserHandler.AdminUserListHandler)
+		userAdmin.GET("/info", UserHandler.AdminUserInfoHandler)
+		userAdmin.PUT("/roles", UserHandler.AdminUserRolesHandler)
+
+		cacheAdmin := adminGroup.Group("/cache", middleware.RequirePermission(enum.PermissionCacheManage))
+		cacheAdmin.POST("/warmup", TicketHandler.WarmUpCache)
+		cacheAdmin.GET("/stats", TicketHandler.GetCacheStats)
 	}
 
 	// 订单相关路由
-	orderGroup := router.Group("/order")
+	orderGroup := router.Group("/order", auth)
 	{
+		orderGroup.GET("/list", OrderHandler.OrderListHandler)
 		orderGroup.GET("/info", OrderHandler.OrderInfoHandler)
+		orderGroup.GET("/events", OrderHandler.OrderEventsHandler)
 		orderGroup.POST("/pay", OrderHandler.OrderPayHandler)
+		orderGroup.POST("/refund", OrderHandler.OrderRefundHandler)
+		orderGroup.POST("/change", OrderHandler.OrderChangeHandler)
+	}
+
+	// 支付相关路由
+	paymentGroup := router.Group("/payment", auth)
+	{
+		paymentGroup.POST("/callback", PaymentHandler.PaymentCallbackHandler)
+		paymentGroup.GET("/query", PaymentHandler.PaymentQueryHandler)
+		// 模拟支付仅在开发联调环境注册
+		if PaymentHandler.MockEnabled {
+			paymentGroup.POST("/mock/complete", PaymentHandler.PaymentMockCompleteHandler)
+		}
 	}
 
 	return router
@@ -0,0 +1,328 @@
+package app
+
+import (
+	"12305/api"
+	"12305/api/handler"
+	"12305/identity"
+	"12305/mq"
+	"12305/mq/receiver"
+	"12305/mq/sender"
+	"12305/payment"
+	"12305/repository"
+	"12305/service"
+	"12305/sms"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	amqp "github.com/rabbitmq/amqp091-go"
+	"github.com/redis/go-redis/v9"
+	"github.com/spf13/viper"
+	"gorm.io/gorm"
+)
+
+// 外部依赖的连接
+type Infra struct {
+	DB       *gorm.DB
+	Redis    *redis.Client
+	RabbitMQ *amqp.Connection
+	Queue    *mq.MemoryQueue //不为空时订单消息使用进程内队列
+}
+
+// 各仓储的实现，测试时可替换为其他实现或模拟实现
+type Repositories struct {
+	User      repository.UserRepoInterface
+	Ticket    repository.TicketRepoInterface
+	Redis     repository.RedisRepoInterface
+	Local     repository.LocalRepoInterface
+	Station   repository.StationRepoInterface
+	Route     repository.RouteRepoInterface
+	Train     repository.TrainRepoInterface
+	TrainRun  repository.TrainRunRepoInterface
+	Carriage  repository.CarriageRepoInterface
+	Passenger repository.PassengerRepoInterface
+	Order     repository.OrderRepoInterface
+	Payment   repository.PaymentRepoInterface
+	Waitlist  repository.WaitlistRepoInterface
+	Sender    sender.Sender
+}
+
+// 基于数据库、Redis和消息队列的仓储实现
+func NewRepositories(infra Infra) *Repositories {
+	redisRepo := &repository.RedisRepository{Rdb: infra.Redis, DB: infra.DB}
+	return &Repositories{
+		User:      &repository.UserRepository{DB: infra.DB},
+		Ticket:    &repository.TicketRepository{DB: infra.DB, Rdb: infra.Redis},
+		Redis:     redisRepo,
+		Local:     &repository.LocalRepository{DB: infra.DB, RedisRepo: redisRepo},
+		Station:   &repository.StationRepository{DB: infra.DB},
+		Route:     &repository.RouteRepository{DB: infra.DB},
+		Train:     &repository.TrainRepository{DB: infra.DB},
+		TrainRun:  &repository.TrainRunRepository{DB: infra.DB},
+		Carriage:  &repository.CarriageRepository{DB: infra.DB},
+		Passenger: &repository.PassengerRepository{DB: infra.DB},
+		Order:     &repository.OrderRepository{DB: infra.DB},
+		Payment:   &repository.PaymentRepository{DB: infra.DB},
+		Waitlist:  &repository.WaitlistRepository{DB: infra.DB},
+		Sender:    &sender.SenderStruct{Conn: infra.RabbitMQ, Queue: infra.Queue},
+	}
+}
+
+// 业务配置
+type Options struct {
+	Allocator      string        //服务端选座策略
+	PaymentWindow  time.Duration //订单支付时限
+	RefundFeeTiers []service.RefundFeeTier
+	Gateway        payment.PaymentGateway
+	MockPayment    bool              //是否开放模拟支付接口，仅开发联调环境开启
+	Verifier       identity.Verifier //实名核验渠道，为空时使用离线模拟核验
+	SmsSender      sms.SMSSender     //短信渠道，为空时输出到日志
+	SmsPolicy      service.SmsPolicy //验证码有效期与发送频率限制
+	TrustedProxies []string          //可信反向代理地址或网段
+	// 登录令牌签名密钥与有效期
+	JwtSecret       []byte
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+// 从配置文件读取业务配置，渠道名称无效时返回错误，不以模拟渠道代替
+func OptionsFromConfig() (Options, error) {
+	// 未配置实名核验渠道时仅 embedded 本地联调模式使用离线模拟核验
+	verifierName := viper.GetString("identity.verifier")
+	if verifierName == "" && viper.GetBool("embedded") {
+		verifierName = "fake"
+	}
+	verifier, err := identity.NewVerifier(verifierName)
+	if err != nil {
+		return Options{}, err
+	}
+	opts := Options{
+		Allocator:      viper.GetString("ticket.allocator"),
+		PaymentWindow:  time.Duration(viper.GetInt("order.payment_window_minutes")) * time.Minute,
+		Gateway:        payment.NewMockGateway(viper.GetString("payment.mock_secret")),
+		MockPayment:    viper.GetBool("payment.mock_enabled"),
+		Verifier:       verifier,
+		TrustedProxies: viper.GetStringSlice("trusted_proxies"),
+	}
+	if err := viper.UnmarshalKey("order.refund_fee_tiers", &opts.RefundFeeTiers); err != nil {
+		log.Printf("读取退票手续费配置失败，使用默认档位: %v", err)
+	}
+	// 未配置短信渠道时仅 embedded 本地联调模式输出到日志
+	senderName := viper.GetString("sms.sender")
+	if senderName == "" && viper.GetBool("embedded") {
+		senderName = "console"
+	}
+	opts.SmsSender, err = sms.NewSender(senderName, viper.GetString("sms.file_path"))
+	if err != nil {
+		return Options{}, err
+	}
+	opts.SmsPolicy = service.SmsPolicy{
+		CodeTTL:         time.Duration(viper.GetInt("sms.code_ttl_minutes")) * time.Minute,
+		MaxAttempts:     viper.GetInt("sms.max_attempts"),
+		ResendInterval:  time.Duration(viper.GetInt("sms.resend_interval_seconds")) * time.Second,
+		PhoneDailyLimit: viper.GetInt64("sms.phone_daily_limit"),
+		IPHourlyLimit:   viper.GetInt64("sms.ip_hourly_limit"),
+	}
+	opts.AccessTokenTTL = time.Duration(viper.GetInt("auth.access_token_minutes")) * time.Minute
+	opts.RefreshTokenTTL = time.Duration(viper.GetInt("auth.refresh_token_hours")) * time.Hour
+	// 环境变量 JWT_SECRET 优先于配置文件
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		secret = viper.GetString("auth.jwt_secret")
+	}
+	if secret != "" {
+		opts.JwtSecret = []byte(secret)
+	}
+	return opts, nil
+}
+
+func randomSecret() []byte {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic(fmt.Sprintf("生成随机密钥失败: %v", err))
+	}
+	return secret
+}
+
+type Services struct {
+	User      service.UserSrv
+	Auth      service.AuthSrv
+	Sms       service.SmsSrv
+	Ticket    service.TicketSrv
+	Station   service.StationSrv
+	Route     service.RouteSrv
+	Train     service.TrainSrv
+	TrainRun  service.TrainRunSrv
+	Passenger service.PassengerSrv
+	Waitlist  service.WaitlistSrv
+	Payment   service.PaymentSrv
+	Order     service.OrderSrv
+}
+
+type Handlers struct {
+	User      handler.UserHandler
+	Ticket    handler.TicketHandler
+	Order     handler.OrderHandler
+	Station   handler.StationHandler
+	Route     handler.RouteHandler
+	Train     handler.TrainHandler
+	TrainRun  handler.TrainRunHandler
+	Passenger handler.PassengerHandler
+	Waitlist  handler.WaitlistHandler
+	Payment   handler.PaymentHandler
+}
+
+type App struct {
+	Repos    *Repositories
+	Services Services
+	Handlers Handlers
+	// 可信反向代理，仅信任来自这些地址的 X-Forwarded-For，为空时客户端IP取连接对端地址
+	TrustedProxies []string
+}
+
+// 组装服务与处理器，服务之间的依赖（退票退款、座位释放通知候补）在此连接
+func New(repos *Repositories, opts Options) *App {
+	if len(opts.JwtSecret) == 0 {
+		log.Println("未配置 auth.jwt_secret，使用随机密钥，重启后已签发的令牌失效")
+		opts.JwtSecret = randomSecret()
+	}
+	if opts.Verifier == nil {
+		opts.Verifier = identity.NewFakeVerifier()
+	}
+	if opts.SmsSender == nil {
+		opts.SmsSender = &sms.ConsoleSender{}
+	}
+	ticketService := &service.TicketService{
+		TicketRepo:     repos.Ticket,
+		RedisRepo:      repos.Redis,
+		LocalRepo:      repos.Local,
+		RouteRepo:      repos.Route,
+		TrainRepo:      repos.Train,
+		TrainRunRepo:   repos.TrainRun,
+		PassengerRepo:  repos.Passenger,
+		OrderRepo:      repos.Order,
+		WaitlistRepo:   repos.Waitlist,
+		RabbitmqRepo:   repos.Sender,
+		Allocator:      service.NewSeatAllocator(opts.Allocator),
+		PaymentWindow:  opts.PaymentWindow,
+		RefundFeeTiers: opts.RefundFeeTiers,
+		Verifier:       opts.Verifier,
+	}
+
+	// 座位释放时通知候补兑现
+	waitlistService := &service.WaitlistService{
+		WaitlistRepo:  repos.Waitlist,
+		PassengerRepo: repos.Passenger,
+		RouteRepo:     repos.Route,
+		TrainRepo:     repos.Train,
+		TrainRunRepo:  repos.TrainRun,
+		RedisRepo:     repos.Redis,
+		TicketService: ticketService,
+	}
+	ticketService.ReleaseListener = waitlistService
+
+	// 退票、改签通过支付服务退款；候补预付款支付成功后通知兑现
+	paymentService := &service.PaymentService{
+		PaymentRepo:      repos.Payment,
+		OrderRepo:        repos.Order,
+		WaitlistRepo:     repos.Waitlist,
+		RedisRepo:        repos.Redis,
+		Gateway:          opts.Gateway,
+		WaitlistListener: waitlistService,
+		ChangeListener:   ticketService,
+	}
+	ticketService.PaymentService = paymentService
+	waitlistService.PaymentService = paymentService
+
+	services := Services{
+		User: &service.UserService{
+			UserRepo: repos.User,
+			Verifier: opts.Verifier,
+		},
+		Auth: &service.AuthService{
+			UserRepo:        repos.User,
+			RedisRepo:       repos.Redis,
+			Secret:          opts.JwtSecret,
+			AccessTokenTTL:  opts.AccessTokenTTL,
+			RefreshTokenTTL: opts.RefreshTokenTTL,
+		},
+		Sms: &service.SmsService{
+			RedisRepo: repos.Redis,
+			UserRepo:  repos.User,
+			Sender:    opts.SmsSender,
+			Policy:    opts.SmsPolicy,
+		},
+		Ticket:  ticketService,
+		Station: &service.StationService{StationRepo: repos.Station},
+		Route: &service.RouteService{
+			RouteRepo:   repos.Route,
+			StationRepo: repos.Station,
+			TicketRepo:  repos.Ticket,
+		},
+		Train: &service.TrainService{
+			TrainRepo:    repos.Train,
+			CarriageRepo: repos.Carriage,
+			RedisRepo:    repos.Redis,
+		},
+		TrainRun: &service.TrainRunService{
+			TrainRunRepo: repos.TrainRun,
+			TrainRepo:    repos.Train,
+			CarriageRepo: repos.Carriage,
+		},
+		Passenger: &service.PassengerService{
+			PassengerRepo: repos.Passenger,
+			Verifier:      opts.Verifier,
+		},
+		Waitlist: waitlistService,
+		Payment:  paymentService,
+		Order:    &service.OrderService{OrderRepo: repos.Order},
+	}
+
+	return &App{
+		Repos:          repos,
+		Services:       services,
+		TrustedProxies: opts.TrustedProxies,
+		Handlers: Handlers{
+			User: handler.UserHandler{
+				UserService: services.User,
+				AuthService: services.Auth,
+				SmsService:  services.Sms,
+			},
+			Ticket:    handler.TicketHandler{TicketService: services.Ticket},
+			Station:   handler.StationHandler{StationService: services.Station},
+			Route:     handler.RouteHandler{RouteService: services.Route},
+			Train:     handler.TrainHandler{TrainService: services.Train},
+			TrainRun:  handler.TrainRunHandler{TrainRunService: services.TrainRun},
+			Passenger: handler.PassengerHandler{PassengerService: services.Passenger},
+			Waitlist:  handler.WaitlistHandler{WaitlistService: services.Waitlist},
+			Payment:   handler.PaymentHandler{PaymentService: services.Payment, MockEnabled: opts.MockPayment},
+			Order: handler.OrderHandler{
+				OrderService:   services.Order,
+				PaymentService: services.Payment,
+				TicketService:  services.Ticket,
+			},
+		},
+	}
+}
+
+func (a *App) Router() *gin.Engine {
+	h := &a.Handlers
+	router := api.InitRouter(a.Services.Auth, &h.User, &h.Ticket, &h.Order, &h.Station, &h.Route, &h.Train, &h.TrainRun, &h.Passenger, &h.Waitlist, &h.Payment)
+	// gin 默认信任所有代理，客户端可伪造 X-Forwarded-For 绕过按IP的频率限制
+	if err := router.SetTrustedProxies(a.TrustedProxies); err != nil {
+		log.Printf("可信代理配置无效，不信任任何代理: %v", err)
+		router.SetTrustedProxies(nil)
+	}
+	return router
+}
+
+// 订单消息消费者，消息落库使用同一个订单仓储
+func (a *App) OrderReceiver(infra Infra) *receiver.ReceiverStruct {
+	if infra.Queue != nil {
+		return receiver.NewMemoryReceiver(infra.Queue, a.Repos.Order)
+	}
+	return receiver.NewReceiver(infra.RabbitMQ, a.Repos.Order)
+}
@@ -2,8 +2,13 @@ package db
 
 import (
 	"12305/model"
+	"12305/mq"
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/alicebob/miniredis/v2"
+	"github.com/glebarez/sqlite"
 	amqp "github.com/rabbitmq/amqp091-go"
 	"github.com/redis/go-redis/v9"
 	"github.com/spf13/viper"
@@ -11,36 +16,80 @@ import (
 	"gorm.io/gorm"
 )
 
+const (
+	DriverMySQL  = "mysql"
+	DriverSQLite = "sqlite"
+)
+
 var (
 	DB       *gorm.DB
 	Redis    *redis.Client
 	RabbitMQ *amqp.Connection
+	// embedded 模式下的进程内 Redis 与消息队列
+	EmbeddedRedis *miniredis.Miniredis
+	Queue         *mq.MemoryQueue
 )
 
+// embedded 模式下 Redis 与 RabbitMQ 使用进程内实现，不连接外部服务
+func Embedded() bool {
+	return viper.GetBool("embedded")
+}
+
 func InitDatabase() {
 	conf := &model.DBConf{
+		Driver:   viper.GetString("database.driver"),
 		Host:     viper.GetString("database.host"),
 		Port:     viper.GetString("database.port"),
 		User:     viper.GetString("database.username"),
 		Password: viper.GetString("database.password"),
 		DBName:   viper.GetString("database.name"),
 	}
-
-	config := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
-		conf.User,
-		conf.Password,
-		conf.Host,
-		conf.Port,
-		conf.DBName,
-	)
 	var err error
-	DB, err = gorm.Open(mysql.Open(config), &gorm.Config{})
+	DB, err = OpenDatabase(conf)
 	if err != nil {
-		panic("failed to connect database")
+		panic(fmt.Sprintf("failed to connect database: %v", err))
+	}
+}
+
+// 按驱动打开数据库连接，driver 为空时使用 MySQL
+func OpenDatabase(conf *model.DBConf) (*gorm.DB, error) {
+	switch conf.Driver {
+	case "", DriverMySQL:
+		dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4&parseTime=True&loc=Local",
+			conf.User,
+			conf.Password,
+			conf.Host,
+			conf.Port,
+			conf.DBName,
+		)
+		return gorm.Open(mysql.Open(dsn), &gorm.Config{})
+	case DriverSQLite:
+		return openSQLite(conf.DBName)
+	default:
+		return nil, fmt.Errorf("不支持的数据库驱动: %s", conf.Driver)
+	}
+}
+
+// SQLite 以数据库名作为文件路径。写事务开始即加写锁并等待其他写入完成，
+// 避免事务中途升级写锁失败；WAL 模式下读不阻塞写
+func openSQLite(path string) (*gorm.DB, error) {
+	if path == "" {
+		return nil, errors.New("SQLite 数据库文件路径不能为空")
 	}
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_time_format=sqlite&_pragma=busy_timeout(10000)&_pragma=journal_mode(WAL)", path)
+	return gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 }
 
 func InitRedis() {
+	if Embedded() {
+		var err error
+		Redis, EmbeddedRedis, err = NewEmbeddedRedis()
+		if err != nil {
+			panic(fmt.Sprintf("failed to start embedded redis: %v", err))
+		}
+		go advanceEmbeddedRedisClock(EmbeddedRedis)
+		return
+	}
 	conf := &model.RedisConf{
 		Host:     viper.GetString("redis.host"),
 		Port:     viper.GetString("redis.port"),
@@ -52,7 +101,33 @@ func InitRedis() {
 	})
 }
 
+// miniredis 不会随时间自动过期键，按实际流逝的时间推进，使验证码、登录会话等键按 TTL 过期
+func advanceEmbeddedRedisClock(server *miniredis.Miniredis) {
+	last := time.Now()
+	for range time.Tick(time.Second) {
+		now := time.Now()
+		server.FastForward(now.Sub(last))
+		last = now
+	}
+}
+
+// 启动进程内 Redis 兼容服务并返回连接它的客户端，支持 Lua 脚本与有序集合
+func NewEmbeddedRedis() (*redis.Client, *miniredis.Miniredis, error) {
+	server, err := miniredis.Run()
+	if err != nil {
+		return nil, nil, err
+	}
+	client := redis.NewClient(&redis.Options{
+		Addr: server.Addr(),
+	})
+	return client, server, nil
+}
+
 func InitRabbitMQ() {
+	if Embedded() {
+		Queue = mq.NewMemoryQueue(viper.GetInt("rabbitmq.embedded_queue_size"))
+		return
+	}
 	conf := &model.RabbitMQConf{
 		Host:     viper.GetString("rabbitmq.host"),
 		Port:     viper.GetString("rabbitmq.port"),
@@ -0,0 +1,174 @@
+package migration
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 一次数据库结构变更。Up/Down 只能使用迁移文件内定义的表结构快照，
+// 不能引用 model 包，否则后续修改 model 会改变已发布迁移的行为
+type Migration struct {
+	Version string //版本号，按字典序执行，如 0001
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// 已执行的迁移记录
+type SchemaMigration struct {
+	Version   string    `gorm:"column:version;primaryKey;size:32"`
+	Name      string    `gorm:"column:name;size:128"`
+	AppliedAt time.Time `gorm:"column:applied_at"`
+}
+
+func (SchemaMigration) TableName() string {
+	return "schema_migrations"
+}
+
+// 迁移执行状态
+type Status struct {
+	Version   string
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+}
+
+var registry []*Migration
+
+// 在迁移文件的 init 中注册
+func register(m *Migration) {
+	for _, exist := range registry {
+		if exist.Version == m.Version {
+			panic(fmt.Sprintf("迁移版本 %s 重复注册", m.Version))
+		}
+	}
+	registry = append(registry, m)
+	sort.Slice(registry, func(i, j int) bool {
+		return registry[i].Version < registry[j].Version
+	})
+}
+
+// 全部已注册的迁移，按版本号升序
+func Migrations() []*Migration {
+	result := make([]*Migration, len(registry))
+	copy(result, registry)
+	return result
+}
+
+type Migrator struct {
+	DB         *gorm.DB
+	Migrations []*Migration
+}
+
+func NewMigrator(db *gorm.DB) *Migrator {
+	return &Migrator{
+		DB:         db,
+		Migrations: Migrations(),
+	}
+}
+
+func (m *Migrator) ensureTable() error {
+	return m.DB.AutoMigrate(&SchemaMigration{})
+}
+
+func (m *Migrator) applied() (map[string]SchemaMigration, error) {
+	if err := m.ensureTable(); err != nil {
+		return nil, fmt.Errorf("创建迁移记录表失败: %v", err)
+	}
+	var records []SchemaMigration
+	if err := m.DB.Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("查询迁移记录失败: %v", err)
+	}
+	result := make(map[string]SchemaMigration, len(records))
+	for _, record := range records {
+		result[record.Version] = record
+	}
+	return result, nil
+}
+
+// 按版本号顺序执行全部未执行的迁移，返回本次执行的迁移
+func (m *Migrator) Up() ([]*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []*Migration
+	for _, mig := range m.Migrations {
+		if _, ok := applied[mig.Version]; ok {
+			continue
+		}
+		// MySQL 的 DDL 会隐式提交，事务只能保证迁移记录与 DML 一致，迁移本身需可重复执行
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := mig.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&SchemaMigration{
+				Version:   mig.Version,
+				Name:      mig.Name,
+				AppliedAt: time.Now(),
+			}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("执行迁移 %s_%s 失败: %v", mig.Version, mig.Name, err)
+		}
+		fmt.Printf("已执行迁移 %s_%s\n", mig.Version, mig.Name)
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// 按版本号倒序回滚最近执行的 steps 个迁移
+func (m *Migrator) Down(steps int) ([]*Migration, error) {
+	if steps <= 0 {
+		return nil, errors.New("回滚步数必须大于0")
+	}
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	var done []*Migration
+	for i := len(m.Migrations) - 1; i >= 0 && len(done) < steps; i-- {
+		mig := m.Migrations[i]
+		if _, ok := applied[mig.Version]; !ok {
+			continue
+		}
+		if mig.Down == nil {
+			return done, fmt.Errorf("迁移 %s_%s 不支持回滚", mig.Version, mig.Name)
+		}
+		err := m.DB.Transaction(func(tx *gorm.DB) error {
+			if err := mig.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version=?", mig.Version).Delete(&SchemaMigration{}).Error
+		})
+		if err != nil {
+			return done, fmt.Errorf("回滚迁移 %s_%s 失败: %v", mig.Version, mig.Name, err)
+		}
+		fmt.Printf("已回滚迁移 %s_%s\n", mig.Version, mig.Name)
+		done = append(done, mig)
+	}
+	return done, nil
+}
+
+// 全部迁移的执行状态，按版本号升序
+func (m *Migrator) Status() ([]Status, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	result := make([]Status, 0, len(m.Migrations))
+	for _, mig := range m.Migrations {
+		record, ok := applied[mig.Version]
+		result = append(result, Status{
+			Version:   mig.Version,
+			Name:      mig.Name,
+			Applied:   ok,
+			AppliedAt: record.AppliedAt,
+		})
+	}
+	return result, nil
+}
@@ -0,0 +1,328 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 初始表结构。表结构为 0001 版本的快照，之后的结构变更需新增迁移
+func init() {
+	register(&Migration{
+		Version: "0001",
+		Name:    "init_schema",
+		Up: func(tx *gorm.DB) error {
+			if err := renameLegacyColumns(tx, v0001Tables()); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(v0001Tables()...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(v0001Tables()...)
+		},
+	})
+}
+
+// 早期手工建表使用的列名，与代码不一致，已有的表先改名再补齐
+var legacyColumns = map[string]string{
+	"create_time": "create_at",
+	"update_time": "update_at",
+	"delete_time": "delete_at",
+	"TicketTag":   "ticket_tag",
+}
+
+func renameLegacyColumns(tx *gorm.DB, tables []interface{}) error {
+	migrator := tx.Migrator()
+	for _, table := range tables {
+		if !migrator.HasTable(table) {
+			continue
+		}
+		for from, to := range legacyColumns {
+			if !migrator.HasColumn(table, from) || migrator.HasColumn(table, to) {
+				continue
+			}
+			if err := migrator.RenameColumn(table, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func v0001Tables() []interface{} {
+	return []interface{}{
+		&v0001User{},
+		&v0001Passenger{},
+		&v0001Station{},
+		&v0001Train{},
+		&v0001Carriage{},
+		&v0001TrainRun{},
+		&v0001Route{},
+		&v0001RouteStop{},
+		&v0001Ticket{},
+		&v0001Order{},
+		&v0001OrderItem{},
+		&v0001OrderChange{},
+		&v0001OrderEvent{},
+		&v0001Payment{},
+		&v0001Waitlist{},
+		&v0001WaitlistPassenger{},
+	}
+}
+
+type v0001User struct {
+	UserId       string    `gorm:"column:user_id;primaryKey;size:64"`
+	UserIdentity string    `gorm:"column:user_identity;size:32"`
+	UserName     string    `gorm:"column:user_name;size:64"`
+	UserPwd      string    `gorm:"column:user_pwd;size:128"`
+	UserPhone    string    `gorm:"column:user_phone;size:20;index"`
+	CreateTime   time.Time `gorm:"column:create_at"`
+	UpdateTime   time.Time `gorm:"column:update_at"`
+	DeleteTime   time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001User) TableName() string { return "users" }
+
+type v0001Passenger struct {
+	PassengerId   string    `gorm:"column:passenger_id;primaryKey;size:64"`
+	UserId        string    `gorm:"column:user_id;size:64;uniqueIndex:idx_passenger_document"`
+	PassengerName string    `gorm:"column:passenger_name;size:64"`
+	IdType        int       `gorm:"column:id_type;uniqueIndex:idx_passenger_document"`
+	IdNumber      string    `gorm:"column:id_number;size:32;uniqueIndex:idx_passenger_document"`
+	PassengerType int       `gorm:"column:passenger_type"`
+	CreateTime    time.Time `gorm:"column:create_at"`
+	UpdateTime    time.Time `gorm:"column:update_at"`
+}
+
+func (v0001Passenger) TableName() string { return "passengers" }
+
+type v0001Station struct {
+	StationId   string    `gorm:"column:station_id;primaryKey;size:64"`
+	StationName string    `gorm:"column:station_name;size:64"`
+	StationCode string    `gorm:"column:station_code;size:16"`
+	City        string    `gorm:"column:city;size:64"`
+	CreateTime  time.Time `gorm:"column:create_at"`
+	UpdateTime  time.Time `gorm:"column:update_at"`
+	DeleteTime  time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001Station) TableName() string { return "stations" }
+
+type v0001Train struct {
+	TrainId          string    `gorm:"column:train_id;primaryKey;size:64"`
+	TicketTag        string    `gorm:"column:ticket_tag;size:32;uniqueIndex"`
+	TrainType        string    `gorm:"column:train_type;size:8"`
+	Operator         string    `gorm:"column:operator;size:64"`
+	CarriageCount    int       `gorm:"column:carriage_count"`
+	SeatsPerCarriage int       `gorm:"column:seats_per_carriage"`
+	BasePrice        float64   `gorm:"column:base_price"`
+	TrainStatus      int       `gorm:"column:train_status"`
+	CreateTime       time.Time `gorm:"column:create_at"`
+	UpdateTime       time.Time `gorm:"column:update_at"`
+	DeleteTime       time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001Train) TableName() string { return "trains" }
+
+type v0001Carriage struct {
+	CarriageId string    `gorm:"column:carriage_id;primaryKey;size:64"`
+	TicketTag  string    `gorm:"column:ticket_tag;size:32;index"`
+	CarriageNo int       `gorm:"column:carriage_no"`
+	SeatClass  int       `gorm:"column:seat_class"`
+	RowCount   int       `gorm:"column:row_count"`
+	CreateTime time.Time `gorm:"column:create_at"`
+	UpdateTime time.Time `gorm:"column:update_at"`
+}
+
+func (v0001Carriage) TableName() string { return "carriages" }
+
+type v0001TrainRun struct {
+	RunId      string    `gorm:"column:run_id;primaryKey;size:64"`
+	TicketTag  string    `gorm:"column:ticket_tag;size:32;uniqueIndex:idx_train_run"`
+	RunDate    string    `gorm:"column:run_date;size:10;uniqueIndex:idx_train_run"`
+	SeatCount  int       `gorm:"column:seat_count"`
+	RunStatus  int       `gorm:"column:run_status"`
+	CreateTime time.Time `gorm:"column:create_at"`
+	UpdateTime time.Time `gorm:"column:update_at"`
+	DeleteTime time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001TrainRun) TableName() string { return "train_runs" }
+
+type v0001Route struct {
+	RouteId    string    `gorm:"column:route_id;primaryKey;size:64"`
+	TicketTag  string    `gorm:"column:ticket_tag;size:32;index"`
+	CreateTime time.Time `gorm:"column:create_at"`
+	UpdateTime time.Time `gorm:"column:update_at"`
+	DeleteTime time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001Route) TableName() string { return "routes" }
+
+type v0001RouteStop struct {
+	RouteStopId string `gorm:"column:route_stop_id;primaryKey;size:64"`
+	RouteId     string `gorm:"column:route_id;size:64;index"`
+	StationId   string `gorm:"column:station_id;size:64"`
+	Seq         int    `gorm:"column:seq"`
+	ArriveTime  string `gorm:"column:arrive_time;size:5"`
+	DepartTime  string `gorm:"column:depart_time;size:5"`
+	DayOffset   int    `gorm:"column:day_offset"`
+	Distance    int    `gorm:"column:distance"`
+}
+
+func (v0001RouteStop) TableName() string { return "route_stops" }
+
+type v0001Ticket struct {
+	TicketId     string    `gorm:"column:ticket_id;primaryKey;size:64"`
+	TicketNumber int       `gorm:"column:ticket_number"`
+	CarriageNo   int       `gorm:"column:carriage_no"`
+	SeatClass    int       `gorm:"column:seat_class"`
+	SeatRow      int       `gorm:"column:seat_row"`
+	SeatLetter   string    `gorm:"column:seat_letter;size:4"`
+	SeatPosition int       `gorm:"column:seat_position"`
+	TicketTag    string    `gorm:"column:ticket_tag;size:32;index:idx_ticket_run"`
+	RunId        string    `gorm:"column:run_id;size:64"`
+	RunDate      string    `gorm:"column:run_date;size:10;index:idx_ticket_run"`
+	TicketPrice  float64   `gorm:"column:ticket_price"`
+	TicketStatus int       `gorm:"column:status"`
+	SoldMask     int64     `gorm:"column:sold_mask;default:0"`
+	Version      int64     `gorm:"column:version;default:0"`
+	CreateTime   time.Time `gorm:"column:create_at"`
+	UpdateTime   time.Time `gorm:"column:update_at"`
+	DeleteTime   time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001Ticket) TableName() string { return "tickets" }
+
+type v0001Order struct {
+	OrderId     string    `gorm:"column:order_id;primaryKey;size:64"`
+	UserId      string    `gorm:"column:user_id;size:64;index"`
+	OrderStatus int       `gorm:"column:order_status"`
+	Version     int64     `gorm:"column:version"`
+	TotalPrice  float64   `gorm:"column:total_price"`
+	ExpireTime  time.Time `gorm:"column:expire_at"`
+	CreateTime  time.Time `gorm:"column:create_at"`
+	UpdateTime  time.Time `gorm:"column:update_at"`
+	DeleteTime  time.Time `gorm:"column:delete_at"`
+}
+
+func (v0001Order) TableName() string { return "orders" }
+
+type v0001OrderItem struct {
+	OrderItemId       string    `gorm:"column:order_item_id;primaryKey;size:64"`
+	OrderId           string    `gorm:"column:order_id;size:64;index"`
+	TicketId          string    `gorm:"column:ticket_id;size:64;index"`
+	PassengerId       string    `gorm:"column:passenger_id;size:64"`
+	PassengerName     string    `gorm:"column:passenger_name;size:64"`
+	IdType            int       `gorm:"column:id_type"`
+	PassengerIdentity string    `gorm:"column:passenger_identity;size:32;index"`
+	PassengerType     int       `gorm:"column:passenger_type"`
+	TicketTag         string    `gorm:"column:ticket_tag;size:32"`
+	RunDate           string    `gorm:"column:run_date;size:10"`
+	CarriageNo        int       `gorm:"column:carriage_no"`
+	SeatClass         int       `gorm:"column:seat_class"`
+	SeatRow           int       `gorm:"column:seat_row"`
+	SeatLetter        string    `gorm:"column:seat_letter;size:4"`
+	SegmentMask       int64     `gorm:"column:segment_mask"`
+	ItemStatus        int       `gorm:"column:item_status"`
+	UnitPrice         float64   `gorm:"column:unit_price"`
+	Quantity          int       `gorm:"column:quantity"`
+	TotalPrice        float64   `gorm:"column:total_price"`
+	Departure         string    `gorm:"column:departure;size:64"`
+	Destination       string    `gorm:"column:destination;size:64"`
+	DepartureTime     time.Time `gorm:"column:departure_time"`
+	ArrivalTime       time.Time `gorm:"column:arrival_time"`
+	CreateTime        time.Time `gorm:"column:create_at"`
+	UpdateTime        time.Time `gorm:"column:update_at"`
+}
+
+func (v0001OrderItem) TableName() string { return "order_items" }
+
+type v0001OrderChange struct {
+	ChangeId       string    `gorm:"column:change_id;primaryKey;size:64"`
+	ChangeNo       string    `gorm:"column:change_no;size:64;index"`
+	OrderId        string    `gorm:"column:order_id;size:64;index"`
+	OrderItemId    string    `gorm:"column:order_item_id;size:64"`
+	PassengerName  string    `gorm:"column:passenger_name;size:64"`
+	OldTicketId    string    `gorm:"column:old_ticket_id;size:64"`
+	OldTicketTag   string    `gorm:"column:old_ticket_tag;size:32"`
+	OldRunDate     string    `gorm:"column:old_run_date;size:10"`
+	OldDeparture   string    `gorm:"column:old_departure;size:64"`
+	OldDestination string    `gorm:"column:old_destination;size:64"`
+	OldPrice       float64   `gorm:"column:old_price"`
+	NewTicketId    string    `gorm:"column:new_ticket_id;size:64"`
+	NewTicketTag   string    `gorm:"column:new_ticket_tag;size:32"`
+	NewRunDate     string    `gorm:"column:new_run_date;size:10"`
+	NewDeparture   string    `gorm:"column:new_departure;size:64"`
+	NewDestination string    `gorm:"column:new_destination;size:64"`
+	NewPrice       float64   `gorm:"column:new_price"`
+	PriceDiff      float64   `gorm:"column:price_diff"`
+	ChangeStatus   int       `gorm:"column:change_status"`
+	PaymentNo      string    `gorm:"column:payment_no;size:64"`
+	CreateTime     time.Time `gorm:"column:create_at"`
+	UpdateTime     time.Time `gorm:"column:update_at"`
+}
+
+func (v0001OrderChange) TableName() string { return "order_changes" }
+
+type v0001OrderEvent struct {
+	EventId    string    `gorm:"column:event_id;primaryKey;size:64"`
+	OrderId    string    `gorm:"column:order_id;size:64;index"`
+	EventType  string    `gorm:"column:event_type;size:32"`
+	FromStatus int       `gorm:"column:from_status"`
+	ToStatus   int       `gorm:"column:to_status"`
+	Version    int64     `gorm:"column:version"`
+	Remark     string    `gorm:"column:remark;size:255"`
+	CreateTime time.Time `gorm:"column:create_at"`
+}
+
+func (v0001OrderEvent) TableName() string { return "order_events" }
+
+type v0001Payment struct {
+	PaymentId     string    `gorm:"column:payment_id;primaryKey;size:64"`
+	PaymentNo     string    `gorm:"column:payment_no;size:64;uniqueIndex"`
+	OrderId       string    `gorm:"column:order_id;size:64;index"`
+	ChangeNo      string    `gorm:"column:change_no;size:64"`
+	UserId        string    `gorm:"column:user_id;size:64"`
+	Amount        float64   `gorm:"column:amount"`
+	Channel       string    `gorm:"column:channel;size:32"`
+	TradeNo       string    `gorm:"column:trade_no;size:64"`
+	PayUrl        string    `gorm:"column:pay_url;size:512"`
+	PaymentStatus int       `gorm:"column:status"`
+	PaidTime      time.Time `gorm:"column:paid_at"`
+	RefundNo      string    `gorm:"column:refund_no;size:64"`
+	RefundAmount  float64   `gorm:"column:refund_amount"`
+	RefundFee     float64   `gorm:"column:refund_fee"`
+	RefundTime    time.Time `gorm:"column:refund_at"`
+	CreateTime    time.Time `gorm:"column:create_at"`
+	UpdateTime    time.Time `gorm:"column:update_at"`
+}
+
+func (v0001Payment) TableName() string { return "payments" }
+
+type v0001Waitlist struct {
+	WaitlistId     string    `gorm:"column:waitlist_id;primaryKey;size:64"`
+	UserId         string    `gorm:"column:user_id;size:64;index"`
+	TicketTag      string    `gorm:"column:ticket_tag;size:32;index:idx_waitlist_run"`
+	RunDate        string    `gorm:"column:run_date;size:10;index:idx_waitlist_run"`
+	FromStation    string    `gorm:"column:from_station;size:64"`
+	ToStation      string    `gorm:"column:to_station;size:64"`
+	SeatClass      int       `gorm:"column:seat_class"`
+	Deadline       time.Time `gorm:"column:deadline"`
+	Prepayment     float64   `gorm:"column:prepayment"`
+	WaitlistStatus int       `gorm:"column:status"`
+	OrderId        string    `gorm:"column:order_id;size:64"`
+	CreateTime     time.Time `gorm:"column:create_at"`
+	UpdateTime     time.Time `gorm:"column:update_at"`
+}
+
+func (v0001Waitlist) TableName() string { return "waitlists" }
+
+type v0001WaitlistPassenger struct {
+	WaitlistPassengerId string `gorm:"column:waitlist_passenger_id;primaryKey;size:64"`
+	WaitlistId          string `gorm:"column:waitlist_id;size:64;index"`
+	PassengerId         string `gorm:"column:passenger_id;size:64"`
+	PassengerName       string `gorm:"column:passenger_name;size:64"`
+}
+
+func (v0001WaitlistPassenger) TableName() string { return "waitlist_passengers" }
@@ -0,0 +1,29 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 用户角色表。旅客角色为默认角色，不写入此表
+func init() {
+	register(&Migration{
+		Version: "0002",
+		Name:    "user_roles",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v0002UserRole{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v0002UserRole{})
+		},
+	})
+}
+
+type v0002UserRole struct {
+	UserId     string    `gorm:"column:user_id;primaryKey;size:64"`
+	Role       int       `gorm:"column:role;primaryKey"`
+	CreateTime time.Time `gorm:"column:create_at"`
+}
+
+func (v0002UserRole) TableName() string { return "user_roles" }
@@ -0,0 +1,54 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 账号与常用乘车人的实名核验状态。已有数据为未核验，需重新核验后才能购票
+func init() {
+	register(&Migration{
+		Version: "0003",
+		Name:    "identity_verification",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v0003User{}, &v0003Passenger{}); err != nil {
+				return err
+			}
+			// 早期登记的证件号码均为居民身份证
+			return tx.Model(&v0003User{}).Where("id_type=? AND user_identity<>?", 0, "").Update("id_type", 1).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			migrator := tx.Migrator()
+			for _, column := range []string{"id_type", "verify_status", "verify_at"} {
+				if err := migrator.DropColumn(&v0003User{}, column); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"verify_status", "verify_at"} {
+				if err := migrator.DropColumn(&v0003Passenger{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	})
+}
+
+type v0003User struct {
+	UserId       string     `gorm:"column:user_id;primaryKey;size:64"`
+	UserIdentity string     `gorm:"column:user_identity;size:32"`
+	IdType       int        `gorm:"column:id_type;default:0"`
+	VerifyStatus int        `gorm:"column:verify_status;default:0"`
+	VerifyTime   *time.Time `gorm:"column:verify_at"`
+}
+
+func (v0003User) TableName() string { return "users" }
+
+type v0003Passenger struct {
+	PassengerId  string     `gorm:"column:passenger_id;primaryKey;size:64"`
+	VerifyStatus int        `gorm:"column:verify_status;default:0"`
+	VerifyTime   *time.Time `gorm:"column:verify_at"`
+}
+
+func (v0003Passenger) TableName() string { return "passengers" }
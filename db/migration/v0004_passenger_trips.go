@@ -0,0 +1,84 @@
+package migration
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// 乘车人行程占用表，购票时在事务内同步占用，替代按异步落库的订单明细判断行程冲突。
+// 按已有的锁定、已售订单明细回填
+func init() {
+	register(&Migration{
+		Version: "0004",
+		Name:    "passenger_trips",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v0004PassengerTrip{}); err != nil {
+				return err
+			}
+			var items []v0004OrderItem
+			// 1:已售，4：已锁定
+			if err := tx.Where("item_status IN ?", []int{1, 4}).Find(&items).Error; err != nil {
+				return err
+			}
+			type tripKey struct {
+				idType                       int
+				idNumber, ticketTag, runDate string
+			}
+			trips := make(map[tripKey]*v0004PassengerTrip)
+			var ordered []*v0004PassengerTrip
+			now := time.Now()
+			for _, item := range items {
+				key := tripKey{item.IdType, item.PassengerIdentity, item.TicketTag, item.RunDate}
+				trip, ok := trips[key]
+				if !ok {
+					trip = &v0004PassengerTrip{
+						TripId:     uuid.NewString(),
+						IdType:     item.IdType,
+						IdNumber:   item.PassengerIdentity,
+						TicketTag:  item.TicketTag,
+						RunDate:    item.RunDate,
+						CreateTime: now,
+						UpdateTime: now,
+					}
+					trips[key] = trip
+					ordered = append(ordered, trip)
+				}
+				trip.OccupiedMask |= item.SegmentMask
+			}
+			if len(ordered) == 0 {
+				return nil
+			}
+			return tx.CreateInBatches(ordered, 100).Error
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v0004PassengerTrip{})
+		},
+	})
+}
+
+type v0004PassengerTrip struct {
+	TripId       string    `gorm:"column:trip_id;primaryKey;size:64"`
+	IdType       int       `gorm:"column:id_type;uniqueIndex:idx_passenger_trip"`
+	IdNumber     string    `gorm:"column:id_number;size:32;uniqueIndex:idx_passenger_trip"`
+	TicketTag    string    `gorm:"column:ticket_tag;size:32;uniqueIndex:idx_passenger_trip"`
+	RunDate      string    `gorm:"column:run_date;size:10;uniqueIndex:idx_passenger_trip"`
+	OccupiedMask int64     `gorm:"column:occupied_mask;default:0"`
+	CreateTime   time.Time `gorm:"column:create_at"`
+	UpdateTime   time.Time `gorm:"column:update_at"`
+}
+
+func (v0004PassengerTrip) TableName() string { return "passenger_trips" }
+
+type v0004OrderItem struct {
+	OrderItemId       string `gorm:"column:order_item_id;primaryKey"`
+	IdType            int    `gorm:"column:id_type"`
+	PassengerIdentity string `gorm:"column:passenger_identity"`
+	TicketTag         string `gorm:"column:ticket_tag"`
+	RunDate           string `gorm:"column:run_date"`
+	SegmentMask       int64  `gorm:"column:segment_mask"`
+	ItemStatus        int    `gorm:"column:item_status"`
+}
+
+func (v0004OrderItem) TableName() string { return "order_items" }
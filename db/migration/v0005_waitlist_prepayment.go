@@ -0,0 +1,40 @@
+package migration
+
+import (
+	"gorm.io/gorm"
+)
+
+// 候补预付款：候补订单登记时通过支付服务收取预付款，支付流水记录所属的候补订单
+func init() {
+	register(&Migration{
+		Version: "0005",
+		Name:    "waitlist_prepayment",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v0005Waitlist{}, &v0005Payment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			migrator := tx.Migrator()
+			if err := migrator.DropColumn(&v0005Waitlist{}, "payment_no"); err != nil {
+				return err
+			}
+			if err := migrator.DropIndex(&v0005Payment{}, "idx_payments_waitlist_id"); err != nil {
+				return err
+			}
+			return migrator.DropColumn(&v0005Payment{}, "waitlist_id")
+		},
+	})
+}
+
+type v0005Waitlist struct {
+	WaitlistId string `gorm:"column:waitlist_id;primaryKey;size:64"`
+	PaymentNo  string `gorm:"column:payment_no;size:64"`
+}
+
+func (v0005Waitlist) TableName() string { return "waitlists" }
+
+type v0005Payment struct {
+	PaymentId  string `gorm:"column:payment_id;primaryKey;size:64"`
+	WaitlistId string `gorm:"column:waitlist_id;size:64;index"`
+}
+
+func (v0005Payment) TableName() string { return "payments" }
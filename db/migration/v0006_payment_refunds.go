@@ -0,0 +1,35 @@
+package migration
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 部分退款记录表：改签退还差价等部分退款先在业务事务中登记，提交后再调用支付渠道退款
+func init() {
+	register(&Migration{
+		Version: "0006",
+		Name:    "payment_refunds",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v0006PaymentRefund{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v0006PaymentRefund{})
+		},
+	})
+}
+
+type v0006PaymentRefund struct {
+	RefundId     string    `gorm:"column:refund_id;primaryKey;size:64"`
+	RefundNo     string    `gorm:"column:refund_no;size:64;uniqueIndex"`
+	PaymentNo    string    `gorm:"column:payment_no;size:64;index"`
+	OrderId      string    `gorm:"column:order_id;size:64;index"`
+	Amount       float64   `gorm:"column:amount"`
+	Reason       string    `gorm:"column:reason;size:255"`
+	RefundStatus int       `gorm:"column:status;index"`
+	CreateTime   time.Time `gorm:"column:create_at"`
+	UpdateTime   time.Time `gorm:"column:update_at"`
+}
+
+func (v0006PaymentRefund) TableName() string { return "payment_refunds" }
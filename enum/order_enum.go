@@ -3,13 +3,35 @@ package enum
 type OrderStatus int
 
 const (
-	OrderStatusNormal OrderStatus = iota //0:未支付，1：已支付，2：已退,3:已删除,4:生成中
+	OrderStatusNormal OrderStatus = iota //0:未支付，1：已支付，2：已退,3:已删除,4:生成中,5:已取消,6:已出行
 	OrderStatusPaid
 	OrderStatusRefunded
 	OrderStatusDeleted
 	OrderStatusPending
+	OrderStatusCancelled
+	OrderStatusUsed
 )
 
+// 订单状态机：生成中 → 未支付 → 已支付 → 已出行/已退，未支付可取消，终态订单可删除
+var orderTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:   {OrderStatusNormal, OrderStatusCancelled},
+	OrderStatusNormal:    {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusUsed, OrderStatusRefunded},
+	OrderStatusUsed:      {OrderStatusDeleted},
+	OrderStatusRefunded:  {OrderStatusDeleted},
+	OrderStatusCancelled: {OrderStatusDeleted},
+}
+
+// 是否允许从当前状态变更为to
+func (s OrderStatus) CanTransitionTo(to OrderStatus) bool {
+	for _, next := range orderTransitions[s] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
 func (s OrderStatus) String() string {
 	switch s {
 	case OrderStatusNormal:
@@ -22,6 +44,48 @@ func (s OrderStatus) String() string {
 		return "已删除"
 	case OrderStatusPending:
 		return "生成中"
+	case OrderStatusCancelled:
+		return "已取消"
+	case OrderStatusUsed:
+		return "已出行"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// 订单事件，每次状态变更或改签记录一条
+type OrderEventType string
+
+const (
+	OrderEventCreated  OrderEventType = "created"  //订单落库
+	OrderEventPaid     OrderEventType = "paid"     //支付成功
+	OrderEventTimeout  OrderEventType = "timeout"  //超时未支付取消
+	OrderEventRefunded OrderEventType = "refunded" //退票
+	OrderEventChanged  OrderEventType = "changed"  //改签
+	OrderEventUsed     OrderEventType = "used"     //已出行
+	OrderEventDeleted  OrderEventType = "deleted"  //删除
+)
+
+// 改签状态
+type ChangeStatus int
+
+const (
+	ChangeStatusCompleted ChangeStatus = iota + 1 //1:已完成，2：待补差价，3：已补差价（待换座），4：已撤销（超时未补差价）
+	ChangeStatusAwaitingPayment
+	ChangeStatusPaid
+	ChangeStatusReverted
+)
+
+func (s ChangeStatus) String() string {
+	switch s {
+	case ChangeStatusCompleted:
+		return "已完成"
+	case ChangeStatusAwaitingPayment:
+		return "待补差价"
+	case ChangeStatusPaid:
+		return "已补差价"
+	case ChangeStatusReverted:
+		return "已撤销"
 	default:
 		return "UNKNOWN"
 	}
@@ -0,0 +1,50 @@
+package enum
+
+type IdType int
+type PassengerType int
+
+const (
+	IdTypeResidentCard IdType = iota + 1 //1:居民身份证，2：护照，3：港澳居民来往内地通行证
+	IdTypePassport
+	IdTypeHKMacauPermit
+)
+
+const (
+	PassengerTypeAdult PassengerType = iota + 1 //1:成人，2：儿童，3：学生
+	PassengerTypeChild
+	PassengerTypeStudent
+)
+
+func (t IdType) String() string {
+	switch t {
+	case IdTypeResidentCard:
+		return "居民身份证"
+	case IdTypePassport:
+		return "护照"
+	case IdTypeHKMacauPermit:
+		return "港澳居民来往内地通行证"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (t IdType) IsValid() bool {
+	return t >= IdTypeResidentCard && t <= IdTypeHKMacauPermit
+}
+
+func (t PassengerType) String() string {
+	switch t {
+	case PassengerTypeAdult:
+		return "成人"
+	case PassengerTypeChild:
+		return "儿童"
+	case PassengerTypeStudent:
+		return "学生"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (t PassengerType) IsValid() bool {
+	return t >= PassengerTypeAdult && t <= PassengerTypeStudent
+}
@@ -0,0 +1,31 @@
+package enum
+
+type PaymentStatus int
+
+const (
+	PaymentStatusCreated PaymentStatus = iota //0:待支付，1：支付成功，2：支付失败，3：已关闭，4：已退款，5：退款中
+	PaymentStatusSucceeded
+	PaymentStatusFailed
+	PaymentStatusClosed
+	PaymentStatusRefunded
+	PaymentStatusRefunding
+)
+
+func (s PaymentStatus) String() string {
+	switch s {
+	case PaymentStatusCreated:
+		return "待支付"
+	case PaymentStatusSucceeded:
+		return "支付成功"
+	case PaymentStatusFailed:
+		return "支付失败"
+	case PaymentStatusClosed:
+		return "已关闭"
+	case PaymentStatusRefunded:
+		return "已退款"
+	case PaymentStatusRefunding:
+		return "退款中"
+	default:
+		return "UNKNOWN"
+	}
+}
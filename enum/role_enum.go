@@ -0,0 +1,114 @@
+package enum
+
+type Role int
+
+const (
+	RolePassenger    Role = iota + 1 //1:旅客
+	RoleStationAgent                 //2:车站售票员
+	RoleOperator                     //3:运营人员
+	RoleAdmin                        //4:管理员
+)
+
+func (r Role) String() string {
+	switch r {
+	case RolePassenger:
+		return "旅客"
+	case RoleStationAgent:
+		return "车站售票员"
+	case RoleOperator:
+		return "运营人员"
+	case RoleAdmin:
+		return "管理员"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (r Role) IsValid() bool {
+	return r >= RolePassenger && r <= RoleAdmin
+}
+
+// 角色的英文名，用于命令行与接口参数
+func (r Role) Name() string {
+	switch r {
+	case RolePassenger:
+		return "passenger"
+	case RoleStationAgent:
+		return "station_agent"
+	case RoleOperator:
+		return "operator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return ""
+	}
+}
+
+// 按英文名解析角色
+func ParseRole(name string) (Role, bool) {
+	for r := RolePassenger; r <= RoleAdmin; r++ {
+		if r.Name() == name {
+			return r, true
+		}
+	}
+	return 0, false
+}
+
+func (r Role) HasPermission(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+type Permission int
+
+const (
+	PermissionTicketManage  Permission = iota + 1 //1:座位库存管理
+	PermissionTrainManage                         //2:车次与开行计划管理
+	PermissionStationManage                       //3:车站与线路管理
+	PermissionOrderSearch                         //4:查询全部订单
+	PermissionUserManage                          //5:用户与角色管理
+	PermissionCacheManage                         //6:缓存预热与统计
+)
+
+func (p Permission) String() string {
+	switch p {
+	case PermissionTicketManage:
+		return "座位库存管理"
+	case PermissionTrainManage:
+		return "车次管理"
+	case PermissionStationManage:
+		return "车站线路管理"
+	case PermissionOrderSearch:
+		return "订单查询"
+	case PermissionUserManage:
+		return "用户管理"
+	case PermissionCacheManage:
+		return "缓存管理"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// 各角色拥有的权限，旅客只能访问自己的数据，不需要额外权限
+var rolePermissions = map[Role][]Permission{
+	RoleStationAgent: {PermissionOrderSearch},
+	RoleOperator: {
+		PermissionTicketManage,
+		PermissionTrainManage,
+		PermissionStationManage,
+		PermissionOrderSearch,
+		PermissionCacheManage,
+	},
+	RoleAdmin: {
+		PermissionTicketManage,
+		PermissionTrainManage,
+		PermissionStationManage,
+		PermissionOrderSearch,
+		PermissionUserManage,
+		PermissionCacheManage,
+	},
+}
@@ -0,0 +1,120 @@
+package enum
+
+type SeatClass int
+type SeatPosition int
+
+const (
+	SeatClassSecond SeatClass = iota //0:二等座，1：一等座，2：商务座，3：软卧，4：硬卧，5：无座
+	SeatClassFirst
+	SeatClassBusiness
+	SeatClassSoftSleeper
+	SeatClassHardSleeper
+	SeatClassStanding
+)
+
+const (
+	SeatPositionNone SeatPosition = iota //0:无，1：靠窗，2：过道，3：中间，4：下铺，5：中铺，6：上铺
+	SeatPositionWindow
+	SeatPositionAisle
+	SeatPositionMiddle
+	SeatPositionLowerBerth
+	SeatPositionMiddleBerth
+	SeatPositionUpperBerth
+)
+
+func (c SeatClass) String() string {
+	switch c {
+	case SeatClassSecond:
+		return "二等座"
+	case SeatClassFirst:
+		return "一等座"
+	case SeatClassBusiness:
+		return "商务座"
+	case SeatClassSoftSleeper:
+		return "软卧"
+	case SeatClassHardSleeper:
+		return "硬卧"
+	case SeatClassStanding:
+		return "无座"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (c SeatClass) IsValid() bool {
+	return c >= SeatClassSecond && c <= SeatClassStanding
+}
+
+// 相对车次基础票价的倍率
+func (c SeatClass) PriceRate() float64 {
+	switch c {
+	case SeatClassFirst:
+		return 1.6
+	case SeatClassBusiness:
+		return 3.0
+	case SeatClassSoftSleeper:
+		return 1.8
+	case SeatClassHardSleeper:
+		return 1.2
+	default:
+		return 1.0
+	}
+}
+
+// 每排座位号，卧铺为 下/中/上 铺，无座没有座位号
+func (c SeatClass) SeatLetters() []string {
+	switch c {
+	case SeatClassSecond:
+		return []string{"A", "B", "C", "D", "F"}
+	case SeatClassFirst:
+		return []string{"A", "C", "D", "F"}
+	case SeatClassBusiness:
+		return []string{"A", "C", "F"}
+	case SeatClassSoftSleeper:
+		return []string{"L", "U"}
+	case SeatClassHardSleeper:
+		return []string{"L", "M", "U"}
+	default:
+		return []string{""}
+	}
+}
+
+// 根据座位号判断座位位置：A/F 靠窗，C/D 过道，B 中间
+func (c SeatClass) SeatPositionOf(letter string) SeatPosition {
+	switch letter {
+	case "A", "F":
+		return SeatPositionWindow
+	case "C", "D":
+		return SeatPositionAisle
+	case "B":
+		return SeatPositionMiddle
+	case "L":
+		return SeatPositionLowerBerth
+	case "M":
+		return SeatPositionMiddleBerth
+	case "U":
+		return SeatPositionUpperBerth
+	}
+	return SeatPositionNone
+}
+
+func (p SeatPosition) String() string {
+	switch p {
+	case SeatPositionNone:
+		return "无"
+	case SeatPositionWindow:
+		return "靠窗"
+	case SeatPositionAisle:
+		return "过道"
+	case SeatPositionMiddle:
+		return "中间"
+	case SeatPositionLowerBerth:
+		return "下铺"
+	case SeatPositionMiddleBerth:
+		return "中铺"
+	case SeatPositionUpperBerth:
+		return "上铺"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,35 @@
+package enum
+
+// 短信验证码用途，不同用途的验证码互不通用
+type SmsScene string
+
+const (
+	SmsSceneRegister      SmsScene = "register"       //注册
+	SmsSceneLogin         SmsScene = "login"          //验证码登录
+	SmsSceneResetPassword SmsScene = "reset_password" //重置密码
+	SmsSceneChangePhone   SmsScene = "change_phone"   //更换手机号，发送到新手机号
+)
+
+func (s SmsScene) String() string {
+	switch s {
+	case SmsSceneRegister:
+		return "注册"
+	case SmsSceneLogin:
+		return "登录"
+	case SmsSceneResetPassword:
+		return "重置密码"
+	case SmsSceneChangePhone:
+		return "更换手机号"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (s SmsScene) IsValid() bool {
+	return s == SmsSceneRegister || s == SmsSceneLogin || s == SmsSceneResetPassword || s == SmsSceneChangePhone
+}
+
+// 注册和更换手机号的验证码发送到尚未注册的手机号，其余用途发送到已注册的手机号
+func (s SmsScene) ForNewPhone() bool {
+	return s == SmsSceneRegister || s == SmsSceneChangePhone
+}
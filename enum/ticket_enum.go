@@ -1,20 +1,18 @@
 package enum
 
 type TicketStatus int
+
+// 车次tag，如 G101，由车次登记表(Train)维护，不再硬编码
 type TicketTag string
 
 const (
-	TicketStatusNormal TicketStatus = iota //0:未售，1：已售，2：已退，3:已删除
+	TicketStatusNormal TicketStatus = iota //0:未售，1：已售，2：已退，3:已删除，4：已锁定(待支付)，5：已释放(超时未支付)，6：已出行(仅订单明细)
 	TicketStatusSold
 	TicketStatusRefund
 	TicketStatusDeleted
-)
-
-// 简化为枚举表示车次，前端可以按照枚举值查询或是修改车次并显示为详细信息
-const (
-	G101 TicketTag = "G101" //8-9点左右 成都到河南
-	G102 TicketTag = "G102" //12-13点左右 河南到成都
-	G103 TicketTag = "G103" //18-19点左右 河南到杭州
+	TicketStatusHeld
+	TicketStatusReleased
+	TicketStatusUsed
 )
 
 func (s TicketStatus) String() string {
@@ -23,22 +21,21 @@ func (s TicketStatus) String() string {
 		return "未售"
 	case TicketStatusSold:
 		return "已售"
+	case TicketStatusRefund:
+		return "已退"
 	case TicketStatusDeleted:
 		return "已删除"
+	case TicketStatusHeld:
+		return "已锁定"
+	case TicketStatusReleased:
+		return "已释放"
+	case TicketStatusUsed:
+		return "已出行"
 	default:
 		return "UNKNOWN"
 	}
 }
 
 func (s TicketTag) String() string {
-	switch s {
-	case G101:
-		return "G101"
-	case G102:
-		return "G102"
-	case G103:
-		return "G103"
-	default:
-		return "UNKNOWN"
-	}
+	return string(s)
 }
@@ -0,0 +1,65 @@
+package enum
+
+type TrainType string
+type TrainStatus int
+
+const (
+	TrainTypeG TrainType = "G" //高速动车组
+	TrainTypeD TrainType = "D" //动车组
+	TrainTypeK TrainType = "K" //快速列车
+)
+
+const (
+	TrainStatusActive TrainStatus = iota //0:运营中，1：已停运
+	TrainStatusRetired
+)
+
+func (t TrainType) String() string {
+	switch t {
+	case TrainTypeG:
+		return "高速动车组"
+	case TrainTypeD:
+		return "动车组"
+	case TrainTypeK:
+		return "快速列车"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+func (t TrainType) IsValid() bool {
+	switch t {
+	case TrainTypeG, TrainTypeD, TrainTypeK:
+		return true
+	}
+	return false
+}
+
+func (s TrainStatus) String() string {
+	switch s {
+	case TrainStatusActive:
+		return "运营中"
+	case TrainStatusRetired:
+		return "已停运"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+type RunStatus int
+
+const (
+	RunStatusScheduled RunStatus = iota //0:正常开行，1：停开
+	RunStatusCancelled
+)
+
+func (s RunStatus) String() string {
+	switch s {
+	case RunStatusScheduled:
+		return "正常开行"
+	case RunStatusCancelled:
+		return "停开"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,22 @@
+package enum
+
+type VerifyStatus int
+
+const (
+	VerifyStatusUnverified VerifyStatus = iota //0:未核验，1：已核验，2：核验未通过
+	VerifyStatusVerified
+	VerifyStatusFailed
+)
+
+func (s VerifyStatus) String() string {
+	switch s {
+	case VerifyStatusUnverified:
+		return "未核验"
+	case VerifyStatusVerified:
+		return "已核验"
+	case VerifyStatusFailed:
+		return "核验未通过"
+	default:
+		return "UNKNOWN"
+	}
+}
@@ -0,0 +1,28 @@
+package enum
+
+type WaitlistStatus int
+
+const (
+	WaitlistStatusWaiting WaitlistStatus = iota //0:候补中，1：已兑现，2：已取消，3：已过期，4：待支付预付款
+	WaitlistStatusFulfilled
+	WaitlistStatusCancelled
+	WaitlistStatusExpired
+	WaitlistStatusPending
+)
+
+func (s WaitlistStatus) String() string {
+	switch s {
+	case WaitlistStatusWaiting:
+		return "候补中"
+	case WaitlistStatusFulfilled:
+		return "已兑现"
+	case WaitlistStatusCancelled:
+		return "已取消"
+	case WaitlistStatusExpired:
+		return "已过期"
+	case WaitlistStatusPending:
+		return "待支付预付款"
+	default:
+		return "UNKNOWN"
+	}
+}
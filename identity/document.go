@@ -0,0 +1,101 @@
+package identity
+
+import (
+	"12305/enum"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	passportPattern      = regexp.MustCompile(`^[A-Z0-9]{5,17}$`)
+	hkMacauPermitPattern = regexp.MustCompile(`^[HM][0-9]{8}([0-9]{2})?$`)
+)
+
+// 居民身份证校验码：前17位加权求和模11
+var (
+	residentIdWeights    = []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	residentIdCheckCodes = "10X98765432"
+)
+
+// 身份证前两位的省级行政区划代码，71/81/82 为港澳台居民居住证
+var provinceCodes = map[string]bool{
+	"11": true, "12": true, "13": true, "14": true, "15": true,
+	"21": true, "22": true, "23": true,
+	"31": true, "32": true, "33": true, "34": true, "35": true, "36": true, "37": true,
+	"41": true, "42": true, "43": true, "44": true, "45": true, "46": true,
+	"50": true, "51": true, "52": true, "53": true, "54": true,
+	"61": true, "62": true, "63": true, "64": true, "65": true,
+	"71": true, "81": true, "82": true,
+}
+
+// 统一证件号码格式：去除空白并转为大写
+func Normalize(number string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(number), ""))
+}
+
+// 校验证件号码格式，number 需先经过 Normalize
+func Validate(idType enum.IdType, number string) error {
+	if number == "" {
+		return errors.New("证件号码不能为空")
+	}
+	switch idType {
+	case enum.IdTypeResidentCard:
+		return validateResidentId(number)
+	case enum.IdTypePassport:
+		if !passportPattern.MatchString(number) {
+			return errors.New("护照号码格式错误")
+		}
+		return nil
+	case enum.IdTypeHKMacauPermit:
+		// H/M 开头，新版8位数字，旧版10位数字
+		if !hkMacauPermitPattern.MatchString(number) {
+			return errors.New("港澳居民来往内地通行证号码格式错误")
+		}
+		return nil
+	default:
+		return fmt.Errorf("无效的证件类型: %d", idType)
+	}
+}
+
+// 18位居民身份证：6位行政区划代码 + 8位出生日期 + 3位顺序码 + 1位校验码
+func validateResidentId(number string) error {
+	if len(number) != 18 {
+		return errors.New("身份证号码应为18位")
+	}
+	sum := 0
+	for i := 0; i < 17; i++ {
+		c := number[i]
+		if c < '0' || c > '9' {
+			return errors.New("身份证号码格式错误")
+		}
+		sum += int(c-'0') * residentIdWeights[i]
+	}
+	if number[17] != residentIdCheckCodes[sum%11] {
+		return errors.New("身份证号码校验码错误")
+	}
+	if !provinceCodes[number[:2]] || number[2:6] == "0000" {
+		return errors.New("身份证号码行政区划代码无效")
+	}
+	if _, err := BirthDate(number); err != nil {
+		return err
+	}
+	return nil
+}
+
+// 身份证号码中的出生日期
+func BirthDate(number string) (time.Time, error) {
+	if len(number) != 18 {
+		return time.Time{}, errors.New("身份证号码应为18位")
+	}
+	birth, err := time.ParseInLocation("20060102", number[6:14], time.Local)
+	if err != nil {
+		return time.Time{}, errors.New("身份证号码出生日期无效")
+	}
+	if birth.Year() < 1900 || birth.After(time.Now()) {
+		return time.Time{}, errors.New("身份证号码出生日期无效")
+	}
+	return birth, nil
+}
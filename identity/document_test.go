@@ -0,0 +1,52 @@
+package identity
+
+import (
+	"12305/enum"
+	"context"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		idType enum.IdType
+		number string
+		valid  bool
+	}{
+		{"身份证", enum.IdTypeResidentCard, "11010519491231002X", true},
+		{"身份证小写校验码", enum.IdTypeResidentCard, Normalize("11010519491231002x"), true},
+		{"身份证校验码错误", enum.IdTypeResidentCard, "110105194912310021", false},
+		{"身份证位数错误", enum.IdTypeResidentCard, "11010519491231002", false},
+		{"身份证行政区划无效", enum.IdTypeResidentCard, "990105194912310023", false},
+		{"身份证出生日期无效", enum.IdTypeResidentCard, "110105194913310021", false},
+		{"身份证出生日期在未来", enum.IdTypeResidentCard, "110105299912310020", false},
+		{"护照", enum.IdTypePassport, "E12345678", true},
+		{"护照含符号", enum.IdTypePassport, "E1234-5678", false},
+		{"港澳通行证", enum.IdTypeHKMacauPermit, "H12345678", true},
+		{"港澳通行证旧版", enum.IdTypeHKMacauPermit, "M1234567890", true},
+		{"港澳通行证前缀错误", enum.IdTypeHKMacauPermit, "C12345678", false},
+		{"证件类型无效", enum.IdType(9), "E12345678", false},
+		{"号码为空", enum.IdTypePassport, "", false},
+	}
+	for _, c := range cases {
+		err := Validate(c.idType, c.number)
+		if (err == nil) != c.valid {
+			t.Errorf("%s: Validate(%d, %q) = %v, 期望有效 %v", c.name, c.idType, c.number, err, c.valid)
+		}
+	}
+}
+
+func TestFakeVerifier(t *testing.T) {
+	verifier := NewFakeVerifier()
+	verifier.Reject("h12345678", "姓名与证件不一致")
+	ctx := context.Background()
+
+	result, err := verifier.Verify(ctx, VerifyRequest{Name: "张三", IdType: enum.IdTypeResidentCard, IdNumber: "11010519491231002X"})
+	if err != nil || !result.Matched {
+		t.Fatalf("格式正确的证件应核验通过: %+v, %v", result, err)
+	}
+	result, err = verifier.Verify(ctx, VerifyRequest{Name: "李四", IdType: enum.IdTypeHKMacauPermit, IdNumber: "H12345678"})
+	if err != nil || result.Matched {
+		t.Fatalf("指定拒绝的证件应核验不通过: %+v, %v", result, err)
+	}
+}
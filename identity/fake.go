@@ -0,0 +1,49 @@
+package identity
+
+import (
+	"context"
+	"sync"
+)
+
+// 离线可用的模拟核验渠道：格式正确的证件均视为与姓名一致，
+// 可通过 Reject 指定核验不通过的证件号码，用于联调与测试
+type FakeVerifier struct {
+	mu       sync.RWMutex
+	rejected map[string]string
+}
+
+func NewFakeVerifier() *FakeVerifier {
+	return &FakeVerifier{
+		rejected: make(map[string]string),
+	}
+}
+
+func (v *FakeVerifier) Name() string {
+	return "fake"
+}
+
+func (v *FakeVerifier) Verify(ctx context.Context, req VerifyRequest) (*VerifyResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.Name == "" {
+		return &VerifyResult{Reason: "姓名不能为空"}, nil
+	}
+	if err := Validate(req.IdType, req.IdNumber); err != nil {
+		return &VerifyResult{Reason: err.Error()}, nil
+	}
+	v.mu.RLock()
+	reason, rejected := v.rejected[req.IdNumber]
+	v.mu.RUnlock()
+	if rejected {
+		return &VerifyResult{Reason: reason}, nil
+	}
+	return &VerifyResult{Matched: true}, nil
+}
+
+// 指定证件号码核验不通过
+func (v *FakeVerifier) Reject(idNumber string, reason string) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rejected[Normalize(idNumber)] = reason
+}
@@ -0,0 +1,40 @@
+package identity
+
+import (
+	"12305/enum"
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 实名核验请求，证件号码已经过 Normalize 与 Validate
+type VerifyRequest struct {
+	Name     string
+	IdType   enum.IdType
+	IdNumber string
+}
+
+type VerifyResult struct {
+	Matched bool   //姓名与证件号码是否一致
+	Reason  string //不一致时的原因
+}
+
+// 实名核验渠道，如公安身份核验、出入境证件核验服务，新增渠道实现该接口即可。
+// 返回 error 表示核验服务不可用，调用方不应据此判定证件不一致
+type Verifier interface {
+	Name() string
+	Verify(ctx context.Context, req VerifyRequest) (*VerifyResult, error)
+}
+
+// 按名称创建核验渠道，目前只有离线模拟实现 fake；名称为空或不支持时返回错误，
+// 避免配置写错时实名核验悄悄变成全部通过
+func NewVerifier(name string) (Verifier, error) {
+	switch name {
+	case "fake":
+		return NewFakeVerifier(), nil
+	case "":
+		return nil, errors.New("未配置实名核验渠道")
+	default:
+		return nil, fmt.Errorf("不支持的实名核验渠道: %s", name)
+	}
+}
@@ -0,0 +1,15 @@
+package identity
+
+import "testing"
+
+func TestNewVerifier(t *testing.T) {
+	if v, err := NewVerifier("fake"); err != nil || v.Name() != "fake" {
+		t.Errorf("NewVerifier(fake) = %v, %v，应返回离线模拟核验", v, err)
+	}
+	// 名称为空或写错时不能退化为全部通过的模拟核验
+	for _, name := range []string{"", "police", "Fake"} {
+		if v, err := NewVerifier(name); err == nil {
+			t.Errorf("NewVerifier(%q) = %v，应返回错误", name, v)
+		}
+	}
+}
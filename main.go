@@ -1,18 +1,16 @@
 package main
 
 import (
-	"12305/api"
-	"12305/api/handler"
+	"12305/app"
 	"12305/config"
 	"12305/db"
-	"12305/mq/receiver"
-	"12305/mq/sender"
-	"12305/repository"
-	"12305/service"
+	"12305/db/migration"
 	"context"
 	"fmt"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/spf13/viper"
 )
@@ -23,75 +21,66 @@ func initViper() {
 	}
 }
 
-var (
-	UserHandler   handler.UserHandler
-	TicketHandler handler.TicketHandler
-	OrderHandler  handler.OrderHandler
-)
+func init() {
+	initViper()
+	db.InitDatabase()
+}
 
-func initHandler() {
-	// 初始化用户处理器
-	UserHandler = handler.UserHandler{
-		UserService: &service.UserService{
-			UserRepo: repository.UserRepository{
-				DB: db.DB,
-			},
-		},
+func main() {
+	// 数据库迁移命令只需要数据库连接
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
 	}
-
-	// 初始化票务处理器
-	TicketHandler = handler.TicketHandler{
-		TicketService: &service.TicketService{
-			TicketRepo: repository.TicketRepository{
-				DB:  db.DB,
-				Rdb: db.Redis,
-			},
-			RedisRepo: repository.RedisRepository{
-				Rdb: db.Redis,
-			},
-			LocalRepo: repository.LocalRepository{},
-			RabbitmqRepo: sender.SenderStruct{
-				Conn: db.RabbitMQ,
-			},
-		},
-		RedisRepo: repository.RedisRepository{
-			Rdb: db.Redis,
-		},
-		LocalRepo: repository.LocalRepository{},
+	if viper.GetBool("database.auto_migrate") {
+		if _, err := migration.NewMigrator(db.DB).Up(); err != nil {
+			log.Fatalf("数据库迁移失败: %v", err)
+		}
 	}
-
-	// 初始化订单处理器
-	OrderHandler = handler.OrderHandler{
-		OrderService: &service.OrderService{
-			OrderRepo: repository.OrderRepository{
-				DB: db.DB,
-			},
-		},
+	// 角色管理命令只需要数据库连接
+	if len(os.Args) > 1 && os.Args[1] == "role" {
+		os.Exit(runRole(os.Args[2:]))
 	}
-}
 
-func init() {
-	initViper()
-	db.InitDatabase()
 	db.InitRedis()
 	db.InitRabbitMQ()
-	initHandler()
-}
 
-func main() {
+	// 组装仓储、服务与处理器
+	infra := app.Infra{
+		DB:       db.DB,
+		Redis:    db.Redis,
+		RabbitMQ: db.RabbitMQ,
+		Queue:    db.Queue,
+	}
+	opts, err := app.OptionsFromConfig()
+	if err != nil {
+		log.Fatalf("读取业务配置失败: %v", err)
+	}
+	application := app.New(app.NewRepositories(infra), opts)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	// 启动消息队列消费者
 	go func() {
-		receiver := receiver.NewReceiver(db.RabbitMQ, &repository.OrderRepository{DB: db.DB})
-		if err := receiver.StartOrderConsumer(ctx); err != nil {
+		if err := application.OrderReceiver(infra).StartOrderConsumer(ctx); err != nil {
 			log.Printf("启动订单消费者失败: %v", err)
 		}
 	}()
 
+	services := application.Services
+	// 启动开行计划库存生成任务
+	go services.TrainRun.StartInventoryJob(ctx, viper.GetInt("inventory.advance_days"), 24*time.Hour)
+	// 启动超时未支付订单释放任务
+	go services.Ticket.StartHoldReleaseJob(ctx, time.Duration(viper.GetInt("order.hold_scan_interval_seconds"))*time.Second)
+	// 启动已出行订单处理任务
+	go services.Order.StartTravelCompleteJob(ctx, time.Duration(viper.GetInt("order.travel_scan_interval_minutes"))*time.Minute)
+	// 启动候补兑现任务
+	go services.Waitlist.StartMatcherJob(ctx, time.Duration(viper.GetInt("waitlist.match_interval_seconds"))*time.Second)
+	// 启动退款重试任务
+	go services.Payment.StartRefundJob(ctx, time.Duration(viper.GetInt("payment.refund_retry_interval_seconds"))*time.Second)
+
 	// 初始化路由
-	router := api.InitRouter(&UserHandler, &TicketHandler, &OrderHandler)
+	router := application.Router()
 
 	// 获取端口配置
 	port := viper.GetString("port")
@@ -104,13 +93,31 @@ func main() {
 	log.Printf("服务器运行在端口: %s", port)
 	log.Printf("访问地址: http://localhost:%s", port)
 	log.Printf("API 文档:")
+	log.Printf("   - 发送验证码: POST http://localhost:%s/user/sms/send", port)
 	log.Printf("   - 用户注册: POST http://localhost:%s/user/register", port)
 	log.Printf("   - 用户登录: POST http://localhost:%s/user/login", port)
+	log.Printf("   - 验证码登录: POST http://localhost:%s/user/login/sms", port)
+	log.Printf("   - 重置密码: POST http://localhost:%s/user/password/reset", port)
 	log.Printf("   - 用户信息: GET http://localhost:%s/user/info", port)
+	log.Printf("   - 常用乘车人: GET http://localhost:%s/user/passengers", port)
 	log.Printf("   - 票务列表: GET http://localhost:%s/ticket/list", port)
+	log.Printf("   - 座位图: GET http://localhost:%s/ticket/seatmap", port)
 	log.Printf("   - 购买车票: POST http://localhost:%s/ticket/buy", port)
+	log.Printf("   - 登记候补: POST http://localhost:%s/waitlist/create", port)
+	log.Printf("   - 车站列表: GET http://localhost:%s/station/list", port)
+	log.Printf("   - 车次线路: GET http://localhost:%s/route/info", port)
+	log.Printf("   - 车次列表: GET http://localhost:%s/train/list", port)
+	log.Printf("   - 开行计划: GET http://localhost:%s/train/runs", port)
+	log.Printf("   - 登记车次: POST http://localhost:%s/admin/train/create", port)
+	log.Printf("   - 新增座位: POST http://localhost:%s/admin/ticket/create", port)
+	log.Printf("   - 用户角色: PUT http://localhost:%s/admin/user/roles", port)
+	log.Printf("   - 缓存预热: POST http://localhost:%s/admin/cache/warmup", port)
+	log.Printf("   - 订单列表: GET http://localhost:%s/order/list", port)
 	log.Printf("   - 订单信息: GET http://localhost:%s/order/info", port)
 	log.Printf("   - 订单支付: POST http://localhost:%s/order/pay", port)
+	log.Printf("   - 订单退票: POST http://localhost:%s/order/refund", port)
+	log.Printf("   - 订单改签: POST http://localhost:%s/order/change", port)
+	log.Printf("   - 支付回调: POST http://localhost:%s/payment/callback", port)
 
 	if err := router.Run(fmt.Sprintf(":%s", port)); err != nil && err != http.ErrServerClosed {
 		log.Fatalf("启动服务器失败: %v", err)
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"12305/enum"
+	"12305/response"
+	"12305/service"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 上下文中保存当前登录主体的键
+const PrincipalKey = "principal"
+
+// 登录校验：解析 Authorization: Bearer <访问令牌> 并加载用户。
+// publicRoutes 中的接口（"方法 路由"，如 "GET /ticket/list"）无需登录，携带有效令牌时同样解析登录主体
+func Auth(authService service.AuthSrv, publicRoutes map[string]bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		public := publicRoutes[c.Request.Method+" "+c.FullPath()]
+		token := bearerToken(c)
+		if token == "" {
+			if public {
+				c.Next()
+				return
+			}
+			abortAuth(c, http.StatusUnauthorized, "请先登录")
+			return
+		}
+
+		principal, err := authService.Authenticate(c.Request.Context(), token)
+		if err != nil {
+			if public {
+				c.Next()
+				return
+			}
+			if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrTokenRevoked) {
+				abortAuth(c, http.StatusUnauthorized, err.Error())
+				return
+			}
+			abortAuth(c, http.StatusInternalServerError, "登录校验失败")
+			return
+		}
+		c.Set(PrincipalKey, principal)
+		c.Next()
+	}
+}
+
+// 权限校验，需在 Auth 之后使用：未登录返回 401，角色不具备该权限返回 403
+func RequirePermission(permission enum.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := CurrentPrincipal(c)
+		if !ok {
+			abortAuth(c, http.StatusUnauthorized, "请先登录")
+			return
+		}
+		if !principal.Can(permission) {
+			abortAuth(c, http.StatusForbidden, "没有"+permission.String()+"权限")
+			return
+		}
+		c.Next()
+	}
+}
+
+// 当前登录主体，未登录时返回 false
+func CurrentPrincipal(c *gin.Context) (*service.Principal, bool) {
+	value, ok := c.Get(PrincipalKey)
+	if !ok {
+		return nil, false
+	}
+	principal, ok := value.(*service.Principal)
+	return principal, ok && principal != nil
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+func abortAuth(c *gin.Context, status int, msg string) {
+	entity := response.Entity{
+		Code: int(enum.OperateFailed),
+		Msg:  msg,
+	}
+	c.AbortWithStatusJSON(status, gin.H{"entity": entity})
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"12305/db"
+	"12305/db/migration"
+	"fmt"
+	"strconv"
+)
+
+const migrateUsage = `用法: 12305 migrate <up|down|status>
+  up          执行全部未执行的迁移
+  down [n]    回滚最近执行的 n 个迁移，默认 1
+  status      查看迁移执行状态`
+
+// 数据库迁移命令，返回进程退出码
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Println(migrateUsage)
+		return 2
+	}
+	migrator := migration.NewMigrator(db.DB)
+	switch args[0] {
+	case "up":
+		done, err := migrator.Up()
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("没有需要执行的迁移")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil {
+				fmt.Println("回滚步数无效:", args[1])
+				return 2
+			}
+			steps = n
+		}
+		done, err := migrator.Down(steps)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		if len(done) == 0 {
+			fmt.Println("没有可回滚的迁移")
+		}
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		for _, status := range statuses {
+			if status.Applied {
+				fmt.Printf("%s_%s\t已执行\t%s\n", status.Version, status.Name, status.AppliedAt.Format("2006-01-02 15:04:05"))
+			} else {
+				fmt.Printf("%s_%s\t未执行\n", status.Version, status.Name)
+			}
+		}
+	default:
+		fmt.Println(migrateUsage)
+		return 2
+	}
+	return 0
+}
@@ -0,0 +1,17 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 车次编组中的一节车厢，作为生成座位库存的模板
+type Carriage struct {
+	CarriageId string         `json:"carriage_id" gorm:"column:carriage_id;primaryKey"`
+	TicketTag  enum.TicketTag `json:"ticket_tag" gorm:"column:ticket_tag"`
+	CarriageNo int            `json:"carriage_no" gorm:"column:carriage_no"` //车厢号，从1开始
+	SeatClass  enum.SeatClass `json:"seat_class" gorm:"column:seat_class"`
+	RowCount   int            `json:"row_count" gorm:"column:row_count"` //座位排数，无座车厢为定员数
+	CreateTime time.Time      `json:"create_at" gorm:"column:create_at"`
+	UpdateTime time.Time      `json:"update_at" gorm:"column:update_at"`
+}
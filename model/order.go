@@ -2,17 +2,22 @@ package model
 
 import (
 	"12305/enum"
-	"12305/response"
 	"time"
 )
 
+// 订单头，明细、改签记录和事件通过OrderId关联
 type Order struct {
-	OrderId     string           `json:"order_id" gorm:"column:order_id"`
-	OrderStatus enum.OrderStatus `json:"order_status" gorm:"column:order_status"` //0:未支付，1：已支付，2：已退,3:已删除
+	OrderId     string           `json:"order_id" gorm:"column:order_id;primaryKey"`
+	UserId      string           `json:"user_id" gorm:"column:user_id;index"`     //下单账号
+	OrderStatus enum.OrderStatus `json:"order_status" gorm:"column:order_status"` //0:未支付，1：已支付，2：已退,3:已删除,4:生成中,5:已取消,6:已出行
+	Version     int64            `json:"version" gorm:"column:version"`           //乐观锁版本号，每次状态变更或改签加1
 	TotalPrice  float64          `json:"total_price" gorm:"column:total_price"`
+	ExpireTime  time.Time        `json:"expire_at" gorm:"column:expire_at"` //支付截止时间，超时未支付自动取消并释放座位
 	CreateTime  time.Time        `json:"create_at" gorm:"column:create_at"`
 	UpdateTime  time.Time        `json:"update_at" gorm:"column:update_at"`
 	DeleteTime  time.Time        `json:"delete_at" gorm:"column:delete_at"`
-	User        response.User    `json:"user" gorm:"foreignKey:UserId"`
-	Ticket      Ticket           `json:"ticket" gorm:"foreignKey:TicketId"`
+	User        *User            `json:"-" gorm:"foreignKey:UserId;references:UserId"` //下单账号，查询时从数据库加载，不随消息传递
+	Items       []OrderItem      `json:"items" gorm:"foreignKey:OrderId;references:OrderId"`
+	Changes     []OrderChange    `json:"changes" gorm:"foreignKey:OrderId;references:OrderId"`
+	Events      []OrderEvent     `json:"events" gorm:"foreignKey:OrderId;references:OrderId"`
 }
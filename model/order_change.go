@@ -0,0 +1,32 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 改签记录，一名乘车人的一次改签一条；同一次改签的记录ChangeNo相同，共用一笔补差价支付
+type OrderChange struct {
+	ChangeId       string            `json:"change_id" gorm:"column:change_id;primaryKey"`
+	ChangeNo       string            `json:"change_no" gorm:"column:change_no;index"`
+	OrderId        string            `json:"order_id" gorm:"column:order_id;index"`
+	OrderItemId    string            `json:"order_item_id" gorm:"column:order_item_id"`
+	PassengerName  string            `json:"passenger_name" gorm:"column:passenger_name"`
+	OldTicketId    string            `json:"old_ticket_id" gorm:"column:old_ticket_id"`
+	OldTicketTag   enum.TicketTag    `json:"old_ticket_tag" gorm:"column:old_ticket_tag"`
+	OldRunDate     string            `json:"old_run_date" gorm:"column:old_run_date"`
+	OldDeparture   string            `json:"old_departure" gorm:"column:old_departure"`
+	OldDestination string            `json:"old_destination" gorm:"column:old_destination"`
+	OldPrice       float64           `json:"old_price" gorm:"column:old_price"`
+	NewTicketId    string            `json:"new_ticket_id" gorm:"column:new_ticket_id"`
+	NewTicketTag   enum.TicketTag    `json:"new_ticket_tag" gorm:"column:new_ticket_tag"`
+	NewRunDate     string            `json:"new_run_date" gorm:"column:new_run_date"`
+	NewDeparture   string            `json:"new_departure" gorm:"column:new_departure"`
+	NewDestination string            `json:"new_destination" gorm:"column:new_destination"`
+	NewPrice       float64           `json:"new_price" gorm:"column:new_price"`
+	PriceDiff      float64           `json:"price_diff" gorm:"column:price_diff"` //新票价减原票价，为正需补差价，为负退还差价
+	ChangeStatus   enum.ChangeStatus `json:"change_status" gorm:"column:change_status"`
+	PaymentNo      string            `json:"payment_no" gorm:"column:payment_no"` //补差价支付流水号
+	CreateTime     time.Time         `json:"create_at" gorm:"column:create_at"`
+	UpdateTime     time.Time         `json:"update_at" gorm:"column:update_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 订单事件，记录订单每次状态变更，用于查看订单完整时间线
+type OrderEvent struct {
+	EventId    string              `json:"event_id" gorm:"column:event_id;primaryKey"`
+	OrderId    string              `json:"order_id" gorm:"column:order_id;index"`
+	EventType  enum.OrderEventType `json:"event_type" gorm:"column:event_type"`
+	FromStatus enum.OrderStatus    `json:"from_status" gorm:"column:from_status"`
+	ToStatus   enum.OrderStatus    `json:"to_status" gorm:"column:to_status"`
+	Version    int64               `json:"version" gorm:"column:version"` //变更后的订单版本号
+	Remark     string              `json:"remark" gorm:"column:remark"`
+	CreateTime time.Time           `json:"create_at" gorm:"column:create_at"`
+}
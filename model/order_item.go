@@ -1,16 +1,67 @@
 package model
 
-import "time"
+import (
+	"12305/enum"
+	"time"
+)
 
+// 订单明细，一个乘车人占用一个座位的一个区间；乘车人和票价为下单时的快照，
+// 之后修改常用乘车人或调整票价不影响已有订单
 type OrderItem struct {
-	OrderItemId   string    `json:"order_item_id"`
-	TicketId      string    `json:"ticket_id"`
-	Quantity      int       `json:"quantity"`
-	TotalPrice    float64   `json:"total_price"`
-	Departure     string    `json:"departure"`
-	Destination   string    `json:"destination"`
-	DepartureTime time.Time `json:"departure_time"`
-	ArrivalTime   time.Time `json:"arrival_time"`
-	CreateTime    time.Time `json:"create_at"`
-	UpdateTime    time.Time `json:"update_at"`
+	OrderItemId       string `json:"order_item_id" gorm:"column:order_item_id;primaryKey"`
+	OrderId           string `json:"order_id" gorm:"column:order_id;index"`
+	TicketId          string `json:"ticket_id" gorm:"column:ticket_id;index"`
+	PassengerSnapshot `gorm:"embedded"`
+	TicketTag         enum.TicketTag    `json:"ticket_tag" gorm:"column:ticket_tag"`
+	RunDate           string            `json:"run_date" gorm:"column:run_date"`
+	CarriageNo        int               `json:"carriage_no" gorm:"column:carriage_no"`
+	SeatClass         enum.SeatClass    `json:"seat_class" gorm:"column:seat_class"`
+	SeatRow           int               `json:"seat_row" gorm:"column:seat_row"`
+	SeatLetter        string            `json:"seat_letter" gorm:"column:seat_letter"`
+	SegmentMask       int64             `json:"segment_mask" gorm:"column:segment_mask"` //占用的区间位，退票时据此释放
+	ItemStatus        enum.TicketStatus `json:"item_status" gorm:"column:item_status"`
+	PriceSnapshot     `gorm:"embedded"`
+	Departure         string    `json:"departure" gorm:"column:departure"`     //上车站ID
+	Destination       string    `json:"destination" gorm:"column:destination"` //下车站ID
+	DepartureTime     time.Time `json:"departure_time" gorm:"column:departure_time"`
+	ArrivalTime       time.Time `json:"arrival_time" gorm:"column:arrival_time"`
+	CreateTime        time.Time `json:"create_at" gorm:"column:create_at"`
+	UpdateTime        time.Time `json:"update_at" gorm:"column:update_at"`
+	Ticket            *Ticket   `json:"-" gorm:"foreignKey:TicketId;references:TicketId"` //座位当前信息，查询时从数据库加载
+}
+
+// 乘车人快照，PassengerId为空表示下单时直接填写的乘车人
+type PassengerSnapshot struct {
+	PassengerId       string             `json:"passenger_id" gorm:"column:passenger_id"`
+	PassengerName     string             `json:"passenger_name" gorm:"column:passenger_name"`
+	IdType            enum.IdType        `json:"id_type" gorm:"column:id_type"`
+	PassengerIdentity string             `json:"passenger_identity" gorm:"column:passenger_identity;index"` //证件号码
+	PassengerType     enum.PassengerType `json:"passenger_type" gorm:"column:passenger_type"`
+}
+
+// 票价快照
+type PriceSnapshot struct {
+	UnitPrice  float64 `json:"unit_price" gorm:"column:unit_price"` //下单时座位票价
+	Quantity   int     `json:"quantity" gorm:"column:quantity"`
+	TotalPrice float64 `json:"total_price" gorm:"column:total_price"`
+}
+
+// 按下单时的乘车人生成快照
+func NewPassengerSnapshot(passenger *Passenger) PassengerSnapshot {
+	return PassengerSnapshot{
+		PassengerId:       passenger.PassengerId,
+		PassengerName:     passenger.PassengerName,
+		IdType:            passenger.IdType,
+		PassengerIdentity: passenger.IdNumber,
+		PassengerType:     passenger.PassengerType,
+	}
+}
+
+// 按座位票价生成单张车票的票价快照
+func NewPriceSnapshot(unitPrice float64) PriceSnapshot {
+	return PriceSnapshot{
+		UnitPrice:  unitPrice,
+		Quantity:   1,
+		TotalPrice: unitPrice,
+	}
 }
@@ -0,0 +1,20 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 常用乘车人，归属于某个账号
+type Passenger struct {
+	PassengerId   string             `json:"passenger_id" gorm:"column:passenger_id;primaryKey"`
+	UserId        string             `json:"user_id" gorm:"column:user_id;uniqueIndex:idx_passenger_document"`
+	PassengerName string             `json:"passenger_name" gorm:"column:passenger_name"`
+	IdType        enum.IdType        `json:"id_type" gorm:"column:id_type;uniqueIndex:idx_passenger_document"`
+	IdNumber      string             `json:"id_number" gorm:"column:id_number;uniqueIndex:idx_passenger_document"`
+	PassengerType enum.PassengerType `json:"passenger_type" gorm:"column:passenger_type"`
+	VerifyStatus  enum.VerifyStatus  `json:"verify_status" gorm:"column:verify_status;default:0"` //实名核验状态，核验通过才能购票
+	VerifyTime    *time.Time         `json:"verify_at,omitempty" gorm:"column:verify_at"`         //核验通过时间，未核验为空
+	CreateTime    time.Time          `json:"create_at" gorm:"column:create_at"`
+	UpdateTime    time.Time          `json:"update_at" gorm:"column:update_at"`
+}
@@ -0,0 +1,19 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 乘车人行程占用：同一证件在同一开行计划上已持有（锁定或已售）的区间位图，
+// 与座位的SoldMask一样在购票事务中同步更新，保证同一证件不会持有区间重叠的两张车票
+type PassengerTrip struct {
+	TripId       string         `json:"trip_id" gorm:"column:trip_id;primaryKey"`
+	IdType       enum.IdType    `json:"id_type" gorm:"column:id_type;uniqueIndex:idx_passenger_trip"`
+	IdNumber     string         `json:"id_number" gorm:"column:id_number;uniqueIndex:idx_passenger_trip"`
+	TicketTag    enum.TicketTag `json:"ticket_tag" gorm:"column:ticket_tag;uniqueIndex:idx_passenger_trip"`
+	RunDate      string         `json:"run_date" gorm:"column:run_date;uniqueIndex:idx_passenger_trip"`
+	OccupiedMask int64          `json:"occupied_mask" gorm:"column:occupied_mask;default:0"` //第i位表示已持有第i个区间的车票
+	CreateTime   time.Time      `json:"create_at" gorm:"column:create_at"`
+	UpdateTime   time.Time      `json:"update_at" gorm:"column:update_at"`
+}
@@ -0,0 +1,42 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 支付流水，一个订单可能有多次支付尝试，最多一笔支付成功
+type Payment struct {
+	PaymentId     string             `json:"payment_id" gorm:"column:payment_id;primaryKey"`
+	PaymentNo     string             `json:"payment_no" gorm:"column:payment_no;uniqueIndex"` //本系统支付流水号，传给支付渠道
+	OrderId       string             `json:"order_id" gorm:"column:order_id;index"`
+	ChangeNo      string             `json:"change_no" gorm:"column:change_no"`           //改签补差价时为改签批次号，订单支付为空
+	WaitlistId    string             `json:"waitlist_id" gorm:"column:waitlist_id;index"` //候补预付款时为候补订单ID，兑现后关联到订单
+	UserId        string             `json:"user_id" gorm:"column:user_id"`
+	Amount        float64            `json:"amount" gorm:"column:amount"`
+	Channel       string             `json:"channel" gorm:"column:channel"`   //支付渠道
+	TradeNo       string             `json:"trade_no" gorm:"column:trade_no"` //支付渠道交易号
+	PayUrl        string             `json:"pay_url" gorm:"column:pay_url"`
+	PaymentStatus enum.PaymentStatus `json:"payment_status" gorm:"column:status"`
+	PaidTime      time.Time          `json:"paid_at" gorm:"column:paid_at"`
+	RefundNo      string             `json:"refund_no" gorm:"column:refund_no"`
+	RefundAmount  float64            `json:"refund_amount" gorm:"column:refund_amount"` //累计退款金额，含退款中的部分退款
+	RefundFee     float64            `json:"refund_fee" gorm:"column:refund_fee"`       //退票手续费
+	RefundTime    time.Time          `json:"refund_at" gorm:"column:refund_at"`
+	CreateTime    time.Time          `json:"create_at" gorm:"column:create_at"`
+	UpdateTime    time.Time          `json:"update_at" gorm:"column:update_at"`
+}
+
+// 部分退款记录（改签退还差价、候补预付款退还多余部分），在业务事务中登记为退款中，
+// 提交后按退款单号调用支付渠道退款，失败由退款重试任务补偿
+type PaymentRefund struct {
+	RefundId     string             `json:"refund_id" gorm:"column:refund_id;primaryKey"`
+	RefundNo     string             `json:"refund_no" gorm:"column:refund_no;uniqueIndex"` //传给支付渠道的退款单号，渠道按此去重
+	PaymentNo    string             `json:"payment_no" gorm:"column:payment_no;index"`
+	OrderId      string             `json:"order_id" gorm:"column:order_id;index"`
+	Amount       float64            `json:"amount" gorm:"column:amount"`
+	Reason       string             `json:"reason" gorm:"column:reason"`
+	RefundStatus enum.PaymentStatus `json:"refund_status" gorm:"column:status"` //退款中或已退款
+	CreateTime   time.Time          `json:"create_at" gorm:"column:create_at"`
+	UpdateTime   time.Time          `json:"update_at" gorm:"column:update_at"`
+}
@@ -0,0 +1,56 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 车次运行线路，一个车次对应一条线路
+type Route struct {
+	RouteId    string         `json:"route_id" gorm:"column:route_id;primaryKey"`
+	TicketTag  enum.TicketTag `json:"ticket_tag" gorm:"column:ticket_tag"` //车次tag
+	Stops      []RouteStop    `json:"stops" gorm:"foreignKey:RouteId;references:RouteId"`
+	CreateTime time.Time      `json:"create_at" gorm:"column:create_at"`
+	UpdateTime time.Time      `json:"update_at" gorm:"column:update_at"`
+	DeleteTime time.Time      `json:"delete_at" gorm:"column:delete_at"`
+}
+
+// 线路停靠站，按Seq排序，相邻两站之间为一个区间
+type RouteStop struct {
+	RouteStopId string `json:"route_stop_id" gorm:"column:route_stop_id;primaryKey"`
+	RouteId     string `json:"route_id" gorm:"column:route_id"`
+	StationId   string `json:"station_id" gorm:"column:station_id"`
+	Seq         int    `json:"seq" gorm:"column:seq"`                 //停靠顺序，从0开始
+	ArriveTime  string `json:"arrive_time" gorm:"column:arrive_time"` //到站时间 HH:MM，始发站为空
+	DepartTime  string `json:"depart_time" gorm:"column:depart_time"` //发车时间 HH:MM，终到站为空
+	DayOffset   int    `json:"day_offset" gorm:"column:day_offset"`   //相对始发日期的天数偏移
+	Distance    int    `json:"distance" gorm:"column:distance"`       //距始发站里程(km)
+}
+
+// 一次购票的乘车区间
+type Segment struct {
+	FromStation string `json:"from_station"`
+	ToStation   string `json:"to_station"`
+	FromSeq     int    `json:"from_seq"`
+	ToSeq       int    `json:"to_seq"`
+	Mask        int64  `json:"mask"`      //本区间覆盖的区间位
+	FullMask    int64  `json:"full_mask"` //整条线路的区间位
+	DepartTime  string `json:"depart_time"`
+	DepartDay   int    `json:"depart_day"` //上车站相对始发日期的天数偏移
+	ArriveTime  string `json:"arrive_time"`
+	ArriveDay   int    `json:"arrive_day"` //下车站相对始发日期的天数偏移
+}
+
+// 计算 [fromSeq, toSeq) 覆盖的区间位，第i位表示第i站到第i+1站
+func SegmentMask(fromSeq, toSeq int) int64 {
+	var mask int64
+	for i := fromSeq; i < toSeq; i++ {
+		mask |= 1 << uint(i)
+	}
+	return mask
+}
+
+// 座位在该区间内是否全程空闲
+func (t *Ticket) IsSegmentFree(seg *Segment) bool {
+	return t.SoldMask&seg.Mask == 0
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// 登录会话，保存在 Redis 中；退出登录或修改密码时删除，访问令牌与刷新令牌随之失效
+type Session struct {
+	SessionId  string    `json:"session_id"`
+	UserId     string    `json:"user_id"`
+	RefreshId  string    `json:"refresh_id"` //当前有效的刷新令牌ID，每次刷新后轮换
+	CreateTime time.Time `json:"create_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type Station struct {
+	StationId   string    `json:"station_id" gorm:"column:station_id;primaryKey"`
+	StationName string    `json:"station_name" gorm:"column:station_name"` //站名，如 成都东
+	StationCode string    `json:"station_code" gorm:"column:station_code"` //电报码，如 ICW
+	City        string    `json:"city" gorm:"column:city"`
+	CreateTime  time.Time `json:"create_at" gorm:"column:create_at"`
+	UpdateTime  time.Time `json:"update_at" gorm:"column:update_at"`
+	DeleteTime  time.Time `json:"delete_at" gorm:"column:delete_at"`
+}
@@ -8,10 +8,18 @@ import (
 type Ticket struct {
 	TicketId     string            `json:"ticket_id" gorm:"column:ticket_id;primaryKey"`
 	TicketNumber int               `json:"ticket_number" gorm:"column:ticket_number"` //座位号，按照顺序编号
+	CarriageNo   int               `json:"carriage_no" gorm:"column:carriage_no"`     //车厢号
+	SeatClass    enum.SeatClass    `json:"seat_class" gorm:"column:seat_class"`       //席别
+	SeatRow      int               `json:"seat_row" gorm:"column:seat_row"`           //排号
+	SeatLetter   string            `json:"seat_letter" gorm:"column:seat_letter"`     //座位号 A/B/C/D/F，卧铺为 L/M/U
+	SeatPosition enum.SeatPosition `json:"seat_position" gorm:"column:seat_position"` //靠窗/过道等
 	TicketTag    enum.TicketTag    `json:"ticket_tag" gorm:"column:ticket_tag"`       //车次tag
+	RunId        string            `json:"run_id" gorm:"column:run_id"`               //开行计划ID
+	RunDate      string            `json:"run_date" gorm:"column:run_date"`           //始发日期 2006-01-02
 	TicketPrice  float64           `json:"ticket_price" gorm:"column:ticket_price"`
-	TicketStatus enum.TicketStatus `json:"status" gorm:"column:status"`             //0:未售，1：已售，2：已退, 3:已删除
-	Version      int64             `json:"version" gorm:"column:version;default:0"` // 乐观锁版本号
+	TicketStatus enum.TicketStatus `json:"status" gorm:"column:status"`                 //0:未售，1：已售，2：已退, 3:已删除
+	SoldMask     int64             `json:"sold_mask" gorm:"column:sold_mask;default:0"` //区间占用位图，第i位表示第i个区间已售
+	Version      int64             `json:"version" gorm:"column:version;default:0"`     // 乐观锁版本号
 	CreateTime   time.Time         `json:"create_at" gorm:"column:create_at"`
 	UpdateTime   time.Time         `json:"update_at" gorm:"column:update_at"`
 	DeleteTime   time.Time         `json:"delete_at" gorm:"column:delete_at"`
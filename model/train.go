@@ -0,0 +1,21 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 车次登记表
+type Train struct {
+	TrainId          string           `json:"train_id" gorm:"column:train_id;primaryKey"`
+	TicketTag        enum.TicketTag   `json:"ticket_tag" gorm:"column:ticket_tag;uniqueIndex"` //车次tag，如 G101
+	TrainType        enum.TrainType   `json:"train_type" gorm:"column:train_type"`             //G/D/K
+	Operator         string           `json:"operator" gorm:"column:operator"`                 //运营单位，如 成都局
+	CarriageCount    int              `json:"carriage_count" gorm:"column:carriage_count"`     //默认编组车厢数
+	SeatsPerCarriage int              `json:"seats_per_carriage" gorm:"column:seats_per_carriage"`
+	BasePrice        float64          `json:"base_price" gorm:"column:base_price"`     //全程基础票价
+	TrainStatus      enum.TrainStatus `json:"train_status" gorm:"column:train_status"` //0:运营中，1：已停运
+	CreateTime       time.Time        `json:"create_at" gorm:"column:create_at"`
+	UpdateTime       time.Time        `json:"update_at" gorm:"column:update_at"`
+	DeleteTime       time.Time        `json:"delete_at" gorm:"column:delete_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 车次某一天的开行计划，座位库存按开行计划生成
+type TrainRun struct {
+	RunId      string         `json:"run_id" gorm:"column:run_id;primaryKey"`
+	TicketTag  enum.TicketTag `json:"ticket_tag" gorm:"column:ticket_tag;uniqueIndex:idx_train_run"`
+	RunDate    string         `json:"run_date" gorm:"column:run_date;uniqueIndex:idx_train_run"` //始发日期 2006-01-02
+	SeatCount  int            `json:"seat_count" gorm:"column:seat_count"`
+	RunStatus  enum.RunStatus `json:"run_status" gorm:"column:run_status"` //0:正常开行，1：停开
+	CreateTime time.Time      `json:"create_at" gorm:"column:create_at"`
+	UpdateTime time.Time      `json:"update_at" gorm:"column:update_at"`
+	DeleteTime time.Time      `json:"delete_at" gorm:"column:delete_at"`
+}
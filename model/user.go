@@ -1,16 +1,20 @@
 package model
 
 import (
+	"12305/enum"
 	"time"
 )
 
 type User struct {
-	UserId       string    `json:"user_id" gorm:"column:user_id;primaryKey"`
-	UserIdentity string    `json:"user_identity" gorm:"column:user_identity"`
-	UserName     string    `json:"user_name" gorm:"column:user_name"`
-	UserPwd      string    `json:"user_pwd" gorm:"column:user_pwd"`
-	UserPhone    string    `json:"user_phone" gorm:"column:user_phone"`
-	CreateTime   time.Time `json:"create_at" gorm:"column:create_at"`
-	UpdateTime   time.Time `json:"update_at" gorm:"column:update_at"`
-	DeleteTime   time.Time `json:"delete_at" gorm:"column:delete_at"`
+	UserId       string            `json:"user_id" gorm:"column:user_id;primaryKey"`
+	UserIdentity string            `json:"user_identity" gorm:"column:user_identity"` //证件号码
+	IdType       enum.IdType       `json:"id_type" gorm:"column:id_type"`             //证件类型
+	UserName     string            `json:"user_name" gorm:"column:user_name"`
+	UserPwd      string            `json:"user_pwd" gorm:"column:user_pwd"`
+	UserPhone    string            `json:"user_phone" gorm:"column:user_phone"`
+	VerifyStatus enum.VerifyStatus `json:"verify_status" gorm:"column:verify_status;default:0"` //实名核验状态
+	VerifyTime   *time.Time        `json:"verify_at,omitempty" gorm:"column:verify_at"`         //核验通过时间，未核验为空
+	CreateTime   time.Time         `json:"create_at" gorm:"column:create_at"`
+	UpdateTime   time.Time         `json:"update_at" gorm:"column:update_at"`
+	DeleteTime   time.Time         `json:"delete_at" gorm:"column:delete_at"`
 }
@@ -0,0 +1,13 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 用户被授予的角色，旅客角色为默认角色，不保存
+type UserRole struct {
+	UserId     string    `json:"user_id" gorm:"column:user_id;primaryKey"`
+	Role       enum.Role `json:"role" gorm:"column:role;primaryKey"`
+	CreateTime time.Time `json:"create_at" gorm:"column:create_at"`
+}
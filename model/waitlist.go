@@ -0,0 +1,34 @@
+package model
+
+import (
+	"12305/enum"
+	"time"
+)
+
+// 候补订单：座位售罄时登记购票需求，有座位释放时按登记顺序兑现
+type Waitlist struct {
+	WaitlistId     string              `json:"waitlist_id" gorm:"column:waitlist_id;primaryKey"`
+	UserId         string              `json:"user_id" gorm:"column:user_id;index"`
+	TicketTag      enum.TicketTag      `json:"ticket_tag" gorm:"column:ticket_tag;index:idx_waitlist_run"`
+	RunDate        string              `json:"run_date" gorm:"column:run_date;index:idx_waitlist_run"`
+	FromStation    string              `json:"from_station" gorm:"column:from_station"`
+	ToStation      string              `json:"to_station" gorm:"column:to_station"`
+	SeatClass      enum.SeatClass      `json:"seat_class" gorm:"column:seat_class"`
+	Deadline       time.Time           `json:"deadline" gorm:"column:deadline"`     //截止兑现时间
+	Prepayment     float64             `json:"prepayment" gorm:"column:prepayment"` //预付款，按席别票价计算
+	PaymentNo      string              `json:"payment_no" gorm:"column:payment_no"` //预付款支付流水号，支付后进入候补队列
+	WaitlistStatus enum.WaitlistStatus `json:"waitlist_status" gorm:"column:status"`
+	OrderId        string              `json:"order_id" gorm:"column:order_id"` //兑现后生成的订单
+	Passengers     []WaitlistPassenger `json:"passengers" gorm:"foreignKey:WaitlistId;references:WaitlistId"`
+	Payment        *Payment            `json:"payment,omitempty" gorm:"-"` //登记时返回预付款支付信息
+	CreateTime     time.Time           `json:"create_at" gorm:"column:create_at"`
+	UpdateTime     time.Time           `json:"update_at" gorm:"column:update_at"`
+}
+
+// 候补乘车人，引用账号下的常用乘车人
+type WaitlistPassenger struct {
+	WaitlistPassengerId string `json:"waitlist_passenger_id" gorm:"column:waitlist_passenger_id;primaryKey"`
+	WaitlistId          string `json:"waitlist_id" gorm:"column:waitlist_id;index"`
+	PassengerId         string `json:"passenger_id" gorm:"column:passenger_id"`
+	PassengerName       string `json:"passenger_name" gorm:"column:passenger_name"`
+}
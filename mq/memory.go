@@ -0,0 +1,91 @@
+package mq
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// 订单消息队列名
+const OrderQueue = "order"
+
+var ErrQueueClosed = errors.New("消息队列已关闭")
+
+// 进程内消息队列，embedded 模式下代替 RabbitMQ；消息不持久化，进程退出即丢失
+type MemoryQueue struct {
+	// 发送持读锁、关闭持写锁，避免向已关闭的队列发送
+	mu        sync.RWMutex
+	closed    bool
+	done      chan struct{}
+	closeOnce sync.Once
+
+	qmu    sync.Mutex
+	size   int
+	queues map[string]chan []byte
+}
+
+// size 为每个队列的缓冲消息数，队列满时发送方阻塞
+func NewMemoryQueue(size int) *MemoryQueue {
+	if size <= 0 {
+		size = 1024
+	}
+	return &MemoryQueue{
+		done:   make(chan struct{}),
+		size:   size,
+		queues: make(map[string]chan []byte),
+	}
+}
+
+func (q *MemoryQueue) queue(name string) chan []byte {
+	q.qmu.Lock()
+	defer q.qmu.Unlock()
+	ch, ok := q.queues[name]
+	if !ok {
+		ch = make(chan []byte, q.size)
+		q.queues[name] = ch
+	}
+	return ch
+}
+
+func (q *MemoryQueue) Publish(ctx context.Context, name string, body []byte) error {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return ErrQueueClosed
+	}
+	msg := make([]byte, len(body))
+	copy(msg, body)
+	select {
+	case q.queue(name) <- msg:
+		return nil
+	case <-q.done:
+		return ErrQueueClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// 多个消费者共享同一队列时每条消息只投递给其中一个
+func (q *MemoryQueue) Consume(name string) (<-chan []byte, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return nil, ErrQueueClosed
+	}
+	return q.queue(name), nil
+}
+
+// 关闭全部队列，消费者读完剩余消息后退出
+func (q *MemoryQueue) Close() {
+	q.closeOnce.Do(func() {
+		close(q.done)
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		q.closed = true
+		q.qmu.Lock()
+		defer q.qmu.Unlock()
+		for _, ch := range q.queues {
+			close(ch)
+		}
+	})
+}
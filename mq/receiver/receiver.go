@@ -2,9 +2,11 @@ package receiver
 
 import (
 	"12305/model"
+	"12305/mq"
 	"12305/repository"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -12,14 +14,16 @@ import (
 
 type ReceiverStruct struct {
 	conn      *amqp.Connection
+	queue     *mq.MemoryQueue
 	orderRepo repository.OrderRepoInterface
 }
 
 type Receiver interface {
-	ReceiveOrder(ctx context.Context)
 	StartOrderConsumer(ctx context.Context) error
 }
 
+var _ Receiver = (*ReceiverStruct)(nil)
+
 func NewReceiver(conn *amqp.Connection, orderRepo repository.OrderRepoInterface) *ReceiverStruct {
 	return &ReceiverStruct{
 		conn:      conn,
@@ -27,8 +31,19 @@ func NewReceiver(conn *amqp.Connection, orderRepo repository.OrderRepoInterface)
 	}
 }
 
+// embedded 模式下从进程内队列消费订单消息
+func NewMemoryReceiver(queue *mq.MemoryQueue, orderRepo repository.OrderRepoInterface) *ReceiverStruct {
+	return &ReceiverStruct{
+		queue:     queue,
+		orderRepo: orderRepo,
+	}
+}
+
 // StartOrderConsumer 启动订单消息消费者
 func (r *ReceiverStruct) StartOrderConsumer(ctx context.Context) error {
+	if r.queue != nil {
+		return r.consumeMemory(ctx)
+	}
 	ch, err := r.conn.Channel()
 	if err != nil {
 		return err
@@ -36,7 +51,7 @@ func (r *ReceiverStruct) StartOrderConsumer(ctx context.Context) error {
 	defer ch.Close()
 
 	q, err := ch.QueueDeclare(
-		"order",
+		mq.OrderQueue,
 		false,
 		false,
 		false,
@@ -67,20 +82,50 @@ func (r *ReceiverStruct) StartOrderConsumer(ctx context.Context) error {
 		case <-ctx.Done():
 			log.Println("订单消费者已停止")
 			return nil
-		case d := <-msgs:
-			var order model.Order
-			if err := json.Unmarshal(d.Body, &order); err != nil {
-				log.Printf("解析订单消息失败: %v", err)
-				continue
+		case d, ok := <-msgs:
+			if !ok {
+				return errors.New("订单消息队列连接已关闭")
 			}
+			r.handleOrder(ctx, d.Body)
+		}
+	}
+}
 
-			// 将消息存储到数据库
-			if err := r.orderRepo.ProcessOrderFromMQ(ctx, &order); err != nil {
-				log.Printf("处理订单消息失败: %v", err)
-				continue
-			}
+func (r *ReceiverStruct) consumeMemory(ctx context.Context) error {
+	msgs, err := r.queue.Consume(mq.OrderQueue)
+	if err != nil {
+		return err
+	}
 
-			log.Printf("成功处理订单: %s", order.OrderId)
+	log.Println("开始监听进程内订单消息队列...")
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("订单消费者已停止")
+			return nil
+		case body, ok := <-msgs:
+			if !ok {
+				log.Println("订单消息队列已关闭")
+				return nil
+			}
+			r.handleOrder(ctx, body)
 		}
 	}
 }
+
+func (r *ReceiverStruct) handleOrder(ctx context.Context, body []byte) {
+	var order model.Order
+	if err := json.Unmarshal(body, &order); err != nil {
+		log.Printf("解析订单消息失败: %v", err)
+		return
+	}
+
+	// 将消息存储到数据库
+	if err := r.orderRepo.ProcessOrderFromMQ(ctx, &order); err != nil {
+		log.Printf("处理订单消息失败: %v", err)
+		return
+	}
+
+	log.Printf("成功处理订单: %s", order.OrderId)
+}
@@ -2,6 +2,7 @@ package sender
 
 import (
 	"12305/model"
+	"12305/mq"
 	"context"
 	"encoding/json"
 
@@ -9,21 +10,31 @@ import (
 )
 
 type SenderStruct struct {
-	Conn *amqp.Connection
+	Conn  *amqp.Connection
+	Queue *mq.MemoryQueue //embedded 模式下使用进程内队列，不连接 RabbitMQ
 }
 
 type Sender interface {
-	SendOrder(ctx context.Context, body model.Order)
+	SendOrder(ctx context.Context, body model.Order) error
 }
 
+var _ Sender = (*SenderStruct)(nil)
+
 func (s *SenderStruct) SendOrder(ctx context.Context, body model.Order) error {
+	if s.Queue != nil {
+		jsonBody, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		return s.Queue.Publish(ctx, mq.OrderQueue, jsonBody)
+	}
 	ch, err := s.Conn.Channel()
 	if err != nil {
 		return err
 	}
 	defer ch.Close()
 	q, err := ch.QueueDeclare(
-		"order",
+		mq.OrderQueue,
 		false,
 		false,
 		false,
@@ -0,0 +1,68 @@
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+// 回调中的支付结果
+const (
+	TradeStatusSuccess = "SUCCESS"
+	TradeStatusFailed  = "FAILED"
+	TradeStatusClosed  = "CLOSED"
+	TradeStatusPending = "PENDING"
+)
+
+// 回调验签失败
+var ErrInvalidSignature = errors.New("支付回调签名无效")
+
+// 发起支付请求，PaymentNo 为本系统的支付流水号
+type CreateRequest struct {
+	PaymentNo string
+	OrderId   string
+	Amount    float64
+	Subject   string
+}
+
+type CreateResult struct {
+	TradeNo string `json:"trade_no"` //支付渠道交易号
+	PayUrl  string `json:"pay_url"`  //用户跳转支付的地址
+}
+
+type QueryResult struct {
+	PaymentNo string  `json:"payment_no"`
+	TradeNo   string  `json:"trade_no"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+}
+
+type RefundRequest struct {
+	PaymentNo string
+	RefundNo  string
+	Amount    float64
+	Reason    string
+}
+
+type RefundResult struct {
+	RefundNo string `json:"refund_no"`
+	Status   string `json:"status"`
+}
+
+// 支付渠道异步通知
+type CallbackPayload struct {
+	PaymentNo string  `json:"payment_no"`
+	TradeNo   string  `json:"trade_no"`
+	Amount    float64 `json:"amount"`
+	Status    string  `json:"status"`
+	Timestamp int64   `json:"timestamp"`
+	Sign      string  `json:"sign"`
+}
+
+// 支付渠道，新增渠道实现该接口即可
+type PaymentGateway interface {
+	Name() string
+	CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error)
+	QueryPayment(ctx context.Context, paymentNo string) (*QueryResult, error)
+	Refund(ctx context.Context, req RefundRequest) (*RefundResult, error)
+	VerifyCallback(ctx context.Context, payload CallbackPayload) error
+}
@@ -0,0 +1,150 @@
+package payment
+
+import (
+	"12305/utils"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// 离线可用的模拟支付渠道，交易记录保存在内存中，回调使用HMAC-SHA256签名
+type MockGateway struct {
+	Secret string
+	mu     sync.Mutex
+	trades map[string]*QueryResult
+	// 每笔支付累计退款金额，支持多次部分退款
+	refunded map[string]float64
+	// 已处理的退款单号，同一退款单号重复请求只退一次
+	refunds map[string]bool
+}
+
+func NewMockGateway(secret string) *MockGateway {
+	return &MockGateway{
+		Secret:   secret,
+		trades:   make(map[string]*QueryResult),
+		refunded: make(map[string]float64),
+		refunds:  make(map[string]bool),
+	}
+}
+
+func (g *MockGateway) Name() string {
+	return "mock"
+}
+
+func (g *MockGateway) CreatePayment(ctx context.Context, req CreateRequest) (*CreateResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	trade, ok := g.trades[req.PaymentNo]
+	if !ok {
+		trade = &QueryResult{
+			PaymentNo: req.PaymentNo,
+			TradeNo:   "MOCK" + utils.GetUUID(),
+			Amount:    req.Amount,
+			Status:    TradeStatusPending,
+		}
+		g.trades[req.PaymentNo] = trade
+	}
+	return &CreateResult{
+		TradeNo: trade.TradeNo,
+		PayUrl:  fmt.Sprintf("mock://pay/%s", req.PaymentNo),
+	}, nil
+}
+
+func (g *MockGateway) QueryPayment(ctx context.Context, paymentNo string) (*QueryResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	trade, ok := g.trades[paymentNo]
+	if !ok {
+		return nil, fmt.Errorf("支付流水 %s 不存在", paymentNo)
+	}
+	result := *trade
+	return &result, nil
+}
+
+func (g *MockGateway) Refund(ctx context.Context, req RefundRequest) (*RefundResult, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	trade, ok := g.trades[req.PaymentNo]
+	if !ok {
+		return nil, fmt.Errorf("支付流水 %s 不存在", req.PaymentNo)
+	}
+	if g.refunds[req.RefundNo] {
+		return &RefundResult{RefundNo: req.RefundNo, Status: TradeStatusSuccess}, nil
+	}
+	if trade.Status != TradeStatusSuccess {
+		return nil, fmt.Errorf("支付流水 %s 未支付成功，不能退款", req.PaymentNo)
+	}
+	if req.Amount <= 0 || req.Amount > trade.Amount-g.refunded[req.PaymentNo]+0.005 {
+		return nil, fmt.Errorf("退款金额无效: %.2f", req.Amount)
+	}
+	g.refunded[req.PaymentNo] += req.Amount
+	g.refunds[req.RefundNo] = true
+	return &RefundResult{RefundNo: req.RefundNo, Status: TradeStatusSuccess}, nil
+}
+
+func (g *MockGateway) VerifyCallback(ctx context.Context, payload CallbackPayload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	expected := g.sign(payload)
+	if !hmac.Equal([]byte(expected), []byte(payload.Sign)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// 模拟用户完成支付，返回渠道发出的已签名回调，离线联调时使用；
+// 请求须携带 SignComplete 生成的签名
+func (g *MockGateway) Complete(paymentNo string, status string, sign string) (*CallbackPayload, error) {
+	if !hmac.Equal([]byte(g.SignComplete(paymentNo, status)), []byte(sign)) {
+		return nil, ErrInvalidSignature
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	trade, ok := g.trades[paymentNo]
+	if !ok {
+		return nil, fmt.Errorf("支付流水 %s 不存在", paymentNo)
+	}
+	trade.Status = status
+	payload := &CallbackPayload{
+		PaymentNo: trade.PaymentNo,
+		TradeNo:   trade.TradeNo,
+		Amount:    trade.Amount,
+		Status:    status,
+		Timestamp: time.Now().Unix(),
+	}
+	payload.Sign = g.sign(*payload)
+	return payload, nil
+}
+
+// 模拟完成支付请求的签名，联调工具持有渠道密钥生成
+func (g *MockGateway) SignComplete(paymentNo string, status string) string {
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write([]byte(fmt.Sprintf("payment_no=%s&status=%s", paymentNo, status)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (g *MockGateway) sign(payload CallbackPayload) string {
+	content := fmt.Sprintf("amount=%.2f&payment_no=%s&status=%s&timestamp=%d&trade_no=%s",
+		payload.Amount, payload.PaymentNo, payload.Status, payload.Timestamp, payload.TradeNo)
+	mac := hmac.New(sha256.New, []byte(g.Secret))
+	mac.Write([]byte(content))
+	return hex.EncodeToString(mac.Sum(nil))
+}
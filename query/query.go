@@ -1,6 +1,168 @@
 package query
 
+import "time"
+
 type ListQuery struct {
-	Page     int `json:"page"`
-	PageSize int `json:"page_size"`
+	Page     int `json:"page" form:"page"`
+	PageSize int `json:"page_size" form:"page_size"`
+}
+
+// 设置用户角色，roles 为角色英文名，如 station_agent、operator、admin；旅客角色无需填写
+type UserRolesQuery struct {
+	UserId string   `json:"user_id" binding:"required"`
+	Roles  []string `json:"roles"`
+}
+
+// 登录请求
+type LoginQuery struct {
+	UserPhone string `json:"user_phone"`
+	UserPwd   string `json:"user_pwd"`
+}
+
+// 账号实名核验，id_type 为空时视为居民身份证
+type UserVerifyQuery struct {
+	UserName     string `json:"user_name"`
+	IdType       int    `json:"id_type"`
+	UserIdentity string `json:"user_identity"` //证件号码
+}
+
+// 发送短信验证码，scene 为 register、login 或 reset_password
+type SmsSendQuery struct {
+	UserPhone string `json:"user_phone"`
+	Scene     string `json:"scene"`
+}
+
+// 注册，需先获取注册验证码
+type RegisterQuery struct {
+	UserPhone    string `json:"user_phone"`
+	SmsCode      string `json:"sms_code"`
+	UserPwd      string `json:"user_pwd"`
+	UserName     string `json:"user_name"`
+	IdType       int    `json:"id_type"`
+	UserIdentity string `json:"user_identity"` //证件号码，可为空，之后通过实名核验补充
+}
+
+// 验证码登录
+type SmsLoginQuery struct {
+	UserPhone string `json:"user_phone"`
+	SmsCode   string `json:"sms_code"`
+}
+
+// 通过验证码重置密码
+type ResetPasswordQuery struct {
+	UserPhone string `json:"user_phone"`
+	SmsCode   string `json:"sms_code"`
+	UserPwd   string `json:"user_pwd"` //新密码
+}
+
+// 修改当前账号信息，为空的字段不修改；更换手机号须先向新手机号获取更换手机号验证码，修改密码须提供原密码
+type UserEditQuery struct {
+	UserName  string `json:"user_name"`
+	UserPhone string `json:"user_phone"` //新手机号
+	SmsCode   string `json:"sms_code"`   //新手机号收到的更换手机号验证码
+	OldPwd    string `json:"old_pwd"`
+	UserPwd   string `json:"user_pwd"` //新密码
+}
+
+// 刷新令牌或退出登录
+type TokenQuery struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// 当前用户的订单列表，cursor为上一页返回的next_cursor，为空时从最新订单开始
+type OrderListQuery struct {
+	Status     *int   `form:"status"`      //订单状态，为空不限（不含已删除）
+	TravelFrom string `form:"travel_from"` //乘车日期范围 2006-01-02
+	TravelTo   string `form:"travel_to"`
+	TicketTag  string `form:"ticket_tag"`
+	Passenger  string `form:"passenger"` //乘车人姓名或证件号码
+	Cursor     string `form:"cursor"`
+	PageSize   int    `form:"page_size"`
+}
+
+// 后台跨用户搜索订单，条件至少一项
+type OrderSearchQuery struct {
+	OrderId  string `form:"order_id"`
+	Phone    string `form:"phone"`     //下单账号手机号
+	IdNumber string `form:"id_number"` //乘车人或下单账号的证件号码
+	Cursor   string `form:"cursor"`
+	PageSize int    `form:"page_size"`
+}
+
+// 订单查询条件，由列表和搜索请求转换而来；CursorTime、CursorId为上一页最后一个订单
+type OrderFilter struct {
+	UserId         string
+	Statuses       []int
+	ExcludeDeleted bool
+	TravelFrom     time.Time
+	TravelTo       time.Time //不含
+	TicketTag      string
+	Passenger      string
+	OrderId        string
+	Phone          string
+	IdNumber       string
+	CursorTime     time.Time
+	CursorId       string
+	Limit          int
+}
+
+// 按车次及乘车区间查询余票
+type TicketQuery struct {
+	TicketTag   string `json:"ticket_tag" form:"ticket_tag"`
+	RunDate     string `json:"run_date" form:"run_date"`         //乘车日期 2006-01-02，为空表示当天
+	FromStation string `json:"from_station" form:"from_station"` //上车站ID，为空表示始发站
+	ToStation   string `json:"to_station" form:"to_station"`     //下车站ID，为空表示终到站
+}
+
+// 购票请求，一个订单可为多名乘车人购买同一车次同一区间的多个座位
+type BuyTicketQuery struct {
+	TicketId    string               `json:"ticket_id"` //兼容单座购票，Items为空时为当前用户购买该座位
+	TicketTag   string               `json:"ticket_tag"`
+	RunDate     string               `json:"run_date"`
+	FromStation string               `json:"from_station"`
+	ToStation   string               `json:"to_station"`
+	SeatClass   int                  `json:"seat_class"` //自动选座时的席别
+	Items       []BuyTicketItemQuery `json:"items"`
+}
+
+// 购票明细，一个乘车人对应一个座位；指定passenger_id时使用常用乘车人信息，
+// ticket_id为空时由服务端按seat_class选座
+type BuyTicketItemQuery struct {
+	TicketId          string `json:"ticket_id"`
+	PassengerId       string `json:"passenger_id"`
+	PassengerName     string `json:"passenger_name"`
+	IdType            int    `json:"id_type"`            //为空时视为居民身份证
+	PassengerIdentity string `json:"passenger_identity"` //证件号码
+	PassengerType     int    `json:"passenger_type"`     //为空时视为成人
+	SeatPreference    int    `json:"seat_preference"`    //自动选座偏好 1：靠窗，2：过道，为空不限
+}
+
+// 改签请求：将订单中的乘车人改到新的车次、日期或区间；items为空时改签订单全部乘车人，
+// 车次、区间、席别为空时沿用原车票
+type ChangeTicketQuery struct {
+	OrderId     string                  `json:"order_id"`
+	TicketTag   string                  `json:"ticket_tag"`
+	RunDate     string                  `json:"run_date"`
+	FromStation string                  `json:"from_station"`
+	ToStation   string                  `json:"to_station"`
+	SeatClass   int                     `json:"seat_class"`
+	Items       []ChangeTicketItemQuery `json:"items"`
+}
+
+// 改签明细，ticket_id为空时由服务端选座；同一次改签要么全部指定座位，要么全部自动选座
+type ChangeTicketItemQuery struct {
+	OrderItemId    string `json:"order_item_id"`
+	TicketId       string `json:"ticket_id"`
+	SeatPreference int    `json:"seat_preference"`
+}
+
+// 候补登记请求，乘车人须为账号下的常用乘车人
+type WaitlistQuery struct {
+	TicketTag    string    `json:"ticket_tag"`
+	RunDate      string    `json:"run_date"`
+	FromStation  string    `json:"from_station"`
+	ToStation    string    `json:"to_station"`
+	SeatClass    int       `json:"seat_class"`
+	PassengerIds []string  `json:"passenger_ids"`
+	Deadline     time.Time `json:"deadline"` //截止兑现时间，为空或晚于发车时间时取发车时间
 }
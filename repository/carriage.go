@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+
+	"gorm.io/gorm"
+)
+
+type CarriageRepository struct {
+	DB *gorm.DB
+}
+
+type CarriageRepoInterface interface {
+	ListByTicketTag(ctx context.Context, ticketTag enum.TicketTag) ([]*model.Carriage, error)
+	// 整体替换车次编组
+	ReplaceByTicketTag(ctx context.Context, ticketTag enum.TicketTag, carriages []*model.Carriage) error
+}
+
+var _ CarriageRepoInterface = (*CarriageRepository)(nil)
+
+func (repo *CarriageRepository) ListByTicketTag(ctx context.Context, ticketTag enum.TicketTag) ([]*model.Carriage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var carriages []*model.Carriage
+	err := db.Where("ticket_tag=?", ticketTag).Order("carriage_no asc").Find(&carriages).Error
+	if err != nil {
+		return nil, err
+	}
+	return carriages, nil
+}
+
+func (repo *CarriageRepository) ReplaceByTicketTag(ctx context.Context, ticketTag enum.TicketTag, carriages []*model.Carriage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("ticket_tag=?", ticketTag).Delete(&model.Carriage{}).Error; err != nil {
+			return err
+		}
+		if len(carriages) == 0 {
+			return nil
+		}
+		return tx.Create(&carriages).Error
+	})
+}
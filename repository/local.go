@@ -11,19 +11,21 @@ import (
 
 type LocalRepository struct {
 	DB        *gorm.DB
-	RedisRepo *RedisRepository
+	RedisRepo RedisRepoInterface
 }
 
 type LocalRepoInterface interface {
 	Get(ctx context.Context, key string) ([]*model.Ticket, error)
-	GetByTicketTag(ctx context.Context, tickettag string) ([]*model.Ticket, error)
+	GetByTicketTag(ctx context.Context, tickettag string, runDate string) ([]*model.Ticket, error)
 	Decr(ctx context.Context, tickettag string, ticket model.Ticket) ([]*model.Ticket, error)
-	RefreshCache(ctx context.Context, tickettag string) error
-	InvalidateCache(ctx context.Context, tickettag string) error
+	RefreshCache(ctx context.Context, tickettag string, runDate string) error
+	InvalidateCache(ctx context.Context, tickettag string, runDate string) error
 	// 新增：缓存统计
 	GetCacheStats(ctx context.Context) (map[string]interface{}, error)
 }
 
+var _ LocalRepoInterface = (*LocalRepository)(nil)
+
 var localCache = utils.GetCache()
 
 // 获取本地缓存
@@ -32,49 +34,49 @@ func (repo *LocalRepository) Get(ctx context.Context, key string) ([]*model.Tick
 }
 
 func (repo *LocalRepository) Decr(ctx context.Context, tickettag string, ticket model.Ticket) ([]*model.Ticket, error) {
-	if tickets, err := repo.GetByTicketTag(ctx, tickettag); err == nil {
+	if tickets, err := repo.GetByTicketTag(ctx, tickettag, ticket.RunDate); err == nil {
 		if len(tickets) > 0 {
-			localCache.Edit(ctx, tickettag, &ticket)
+			localCache.Edit(ctx, TicketCacheKey(tickettag, ticket.RunDate), &ticket)
 			return tickets, nil
 		}
 	}
 	return nil, nil
 }
 
-// 本地获取同车次票（只读）
-func (repo *LocalRepository) GetByTicketTag(ctx context.Context, tickettag string) ([]*model.Ticket, error) {
-	value, err := localCache.Get(ctx, tickettag)
+// 本地获取某车次某天开行的票（只读）
+func (repo *LocalRepository) GetByTicketTag(ctx context.Context, tickettag string, runDate string) ([]*model.Ticket, error) {
+	value, err := localCache.Get(ctx, TicketCacheKey(tickettag, runDate))
 	if err != nil {
 		// 本地缓存未命中，从Redis加载
-		return repo.refreshFromRedis(ctx, tickettag)
+		return repo.refreshFromRedis(ctx, tickettag, runDate)
 	}
 	return value, nil
 }
 
 // 从Redis刷新本地缓存
-func (repo *LocalRepository) refreshFromRedis(ctx context.Context, tickettag string) ([]*model.Ticket, error) {
-	tickets, err := repo.RedisRepo.GetByTicketTag(ctx, tickettag)
+func (repo *LocalRepository) refreshFromRedis(ctx context.Context, tickettag string, runDate string) ([]*model.Ticket, error) {
+	tickets, err := repo.RedisRepo.GetByTicketTag(ctx, tickettag, runDate)
 	if err != nil {
 		return nil, err
 	}
 
 	// 更新本地缓存
 	if len(tickets) > 0 {
-		localCache.Set(ctx, tickettag, tickets, 30*time.Second) // 本地缓存30秒
+		localCache.Set(ctx, TicketCacheKey(tickettag, runDate), tickets, 30*time.Second) // 本地缓存30秒
 	}
 
 	return tickets, nil
 }
 
 // 刷新缓存
-func (repo *LocalRepository) RefreshCache(ctx context.Context, tickettag string) error {
-	_, err := repo.refreshFromRedis(ctx, tickettag)
+func (repo *LocalRepository) RefreshCache(ctx context.Context, tickettag string, runDate string) error {
+	_, err := repo.refreshFromRedis(ctx, tickettag, runDate)
 	return err
 }
 
 // 使缓存失效
-func (repo *LocalRepository) InvalidateCache(ctx context.Context, tickettag string) error {
-	return localCache.Del(ctx, tickettag)
+func (repo *LocalRepository) InvalidateCache(ctx context.Context, tickettag string, runDate string) error {
+	return localCache.Del(ctx, TicketCacheKey(tickettag, runDate))
 }
 
 // 获取本地缓存统计信息
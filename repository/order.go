@@ -1,68 +1,157 @@
 package repository
 
 import (
+	"12305/enum"
 	"12305/model"
 	"12305/query"
 	"12305/utils"
 	"context"
+	"errors"
+	"fmt"
 	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// 订单状态变更不符合状态机
+var ErrIllegalOrderTransition = errors.New("非法的订单状态变更")
+
 type OrderRepository struct {
 	DB *gorm.DB
 }
 
 type OrderRepoInterface interface {
-	List(ctx context.Context, req *query.ListQuery) ([]*model.Order, error)
-	GetTotal(ctx context.Context, req *query.ListQuery) (int64, error)
+	// 按条件查询订单，按下单时间倒序，从游标之后开始
+	List(ctx context.Context, filter *query.OrderFilter) ([]*model.Order, error)
+	// 按条件统计订单数，不考虑游标
+	GetTotal(ctx context.Context, filter *query.OrderFilter) (int64, error)
 	Get(ctx context.Context, order model.Order) (*model.Order, error)
 	Exist(ctx context.Context, order *model.Order) (bool, error)
 	CreateOrder(ctx context.Context, order *model.Order) (*model.Order, error)
 	Edit(ctx context.Context, order *model.Order) (bool, error)
 	Delete(ctx context.Context, order *model.Order) (bool, error)
-	//开启事务
-	ExecuteTransaction(fn func(ctx context.Context) error) error
+	//开启事务，事务内通过WithDB(tx)取得绑定事务的仓储
+	ExecuteTransaction(fn func(tx *gorm.DB) error) error
+	// 使用指定连接（通常为事务）的仓储
+	WithDB(db *gorm.DB) OrderRepoInterface
 	// 处理消息队列数据
 	ProcessOrderFromMQ(ctx context.Context, order *model.Order) error
 	BatchProcessOrdersFromMQ(ctx context.Context, orders []*model.Order) error
+	// 按状态机以乐观锁变更订单状态，同时更新明细状态并记录订单事件；非法变更返回ErrIllegalOrderTransition
+	TransitionWithOptimisticLock(ctx context.Context, order *model.Order, to enum.OrderStatus, itemStatus enum.TicketStatus, eventType enum.OrderEventType, remark string) (bool, error)
+	// 带重试的乐观锁状态变更，仅当订单处于from状态时变更，返回是否变更成功
+	TransitionWithOptimisticLockRetry(ctx context.Context, orderId string, from enum.OrderStatus, to enum.OrderStatus, itemStatus enum.TicketStatus, eventType enum.OrderEventType, remark string, maxRetries int) (bool, error)
+	// 订单事件时间线
+	ListEvents(ctx context.Context, orderId string) ([]*model.OrderEvent, error)
+	// 已支付且全部乘车人已到站的订单
+	ListPaidArrivedBefore(ctx context.Context, before time.Time, limit int) ([]string, error)
+	// 为同一证件占用开行计划上的区间，已持有与mask重叠的区间时返回false；须在购票事务内调用
+	ClaimTrip(ctx context.Context, idType enum.IdType, idNumber string, ticketTag enum.TicketTag, runDate string, mask int64) (bool, error)
+	// 退票、超时释放、改签时释放证件占用的区间
+	ReleaseTrip(ctx context.Context, idType enum.IdType, idNumber string, ticketTag enum.TicketTag, runDate string, mask int64) error
+	// 改签：仅当订单已支付且版本号仍为调用方读取的version时更新明细和总价并登记改签记录，返回是否更新成功
+	ChangeItems(ctx context.Context, orderId string, version int64, items []model.OrderItem, changes []model.OrderChange, totalPrice float64) (bool, error)
+	// 同一次改签的改签记录
+	ListChanges(ctx context.Context, changeNo string) ([]*model.OrderChange, error)
+	// 仅当改签记录处于from状态时变更，返回是否变更成功
+	UpdateChangeStatus(ctx context.Context, changeNo string, from enum.ChangeStatus, to enum.ChangeStatus) (bool, error)
+	// 补差价后换座：仅当改签已补差价时更新明细、总价加上差价diff并完成改签，返回是否更新成功
+	CompleteChange(ctx context.Context, orderId string, changeNo string, items []model.OrderItem, diff float64) (bool, error)
 }
 
-func (repo *OrderRepository) List(ctx context.Context, req *query.ListQuery) ([]*model.Order, error) {
+var _ OrderRepoInterface = (*OrderRepository)(nil)
+
+func (repo *OrderRepository) List(ctx context.Context, filter *query.OrderFilter) ([]*model.Order, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	db := repo.DB
-	limit, offset := utils.GetLimitAndOffset(req.Page, req.PageSize)
+	db := repo.filterOrders(filter)
+	if !filter.CursorTime.IsZero() {
+		db = db.Where("orders.create_at < ? OR (orders.create_at = ? AND orders.order_id < ?)", filter.CursorTime, filter.CursorTime, filter.CursorId)
+	}
+	limit, _ := utils.GetLimitAndOffset(0, filter.Limit)
 	var orders []*model.Order
-	err := db.Order("id desc").Limit(limit).Offset(offset).Find(&orders).Error
+	err := db.Preload("User").Preload("Items").
+		Order("orders.create_at desc, orders.order_id desc").
+		Limit(limit).
+		Find(&orders).Error
 	if err != nil {
 		return nil, err
 	}
 	return orders, nil
 }
 
-func (repo *OrderRepository) GetTotal(ctx context.Context, req *query.ListQuery) (int64, error) {
+func (repo *OrderRepository) GetTotal(ctx context.Context, filter *query.OrderFilter) (int64, error) {
 	if err := ctx.Err(); err != nil {
 		return 0, err
 	}
-	db := repo.DB
 	var total int64
-	err := db.Find(&model.Order{}).Count(&total).Error
+	err := repo.filterOrders(filter).Count(&total).Error
 	if err != nil {
 		return 0, err
 	}
 	return total, nil
 }
 
+// 订单查询条件，乘车日期、车次、乘车人按订单明细匹配
+func (repo *OrderRepository) filterOrders(filter *query.OrderFilter) *gorm.DB {
+	db := repo.DB.Model(&model.Order{})
+	if filter.UserId != "" {
+		db = db.Where("orders.user_id=?", filter.UserId)
+	}
+	if filter.OrderId != "" {
+		db = db.Where("orders.order_id=?", filter.OrderId)
+	}
+	if len(filter.Statuses) > 0 {
+		db = db.Where("orders.order_status IN ?", filter.Statuses)
+	} else if filter.ExcludeDeleted {
+		db = db.Where("orders.order_status<>?", enum.OrderStatusDeleted)
+	}
+
+	items := repo.DB.Model(&model.OrderItem{}).Select("1").Where("order_items.order_id = orders.order_id")
+	matchItems := false
+	if !filter.TravelFrom.IsZero() {
+		items = items.Where("order_items.departure_time >= ?", filter.TravelFrom)
+		matchItems = true
+	}
+	if !filter.TravelTo.IsZero() {
+		items = items.Where("order_items.departure_time < ?", filter.TravelTo)
+		matchItems = true
+	}
+	if filter.TicketTag != "" {
+		items = items.Where("order_items.ticket_tag=?", filter.TicketTag)
+		matchItems = true
+	}
+	if filter.Passenger != "" {
+		items = items.Where("order_items.passenger_name=? OR order_items.passenger_identity=?", filter.Passenger, filter.Passenger)
+		matchItems = true
+	}
+	if matchItems {
+		db = db.Where("EXISTS (?)", items)
+	}
+
+	if filter.Phone != "" {
+		db = db.Where("orders.user_id IN (?)", repo.DB.Model(&model.User{}).Select("user_id").Where("user_phone=?", filter.Phone))
+	}
+	if filter.IdNumber != "" {
+		byPassenger := repo.DB.Model(&model.OrderItem{}).Select("1").
+			Where("order_items.order_id = orders.order_id AND order_items.passenger_identity=?", filter.IdNumber)
+		byUser := repo.DB.Model(&model.User{}).Select("user_id").Where("user_identity=?", filter.IdNumber)
+		db = db.Where("EXISTS (?) OR orders.user_id IN (?)", byPassenger, byUser)
+	}
+	return db
+}
+
 func (repo *OrderRepository) Get(ctx context.Context, order model.Order) (*model.Order, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
 	db := repo.DB
 	Order := model.Order{}
-	err := db.Where("order_id=?", order.OrderId).First(&Order).Error
+	err := db.Preload("User").Preload("Items.Ticket").Preload("Changes").Preload("Events", func(db *gorm.DB) *gorm.DB {
+		return db.Order("create_at asc")
+	}).Where("order_id=?", order.OrderId).First(&Order).Error
 	if err != nil {
 		return nil, err
 	}
@@ -74,19 +163,24 @@ func (repo *OrderRepository) Exist(ctx context.Context, order *model.Order) (boo
 		return false, err
 	}
 	db := repo.DB
-	err := db.Where("order_id=?", order.OrderId).First(&order).Error
+	var count int64
+	err := db.Model(&model.Order{}).Where("order_id=?", order.OrderId).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return count > 0, nil
 }
 
 func (repo *OrderRepository) CreateOrder(ctx context.Context, order *model.Order) (*model.Order, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	db := repo.DB
-	err := db.Create(order).Error
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("User", "Events").Create(order).Error; err != nil {
+			return err
+		}
+		return tx.Create(newOrderEvent(order.OrderId, enum.OrderEventCreated, enum.OrderStatusPending, order.OrderStatus, order.Version, "")).Error
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -98,12 +192,10 @@ func (repo *OrderRepository) Edit(ctx context.Context, order *model.Order) (bool
 		return false, err
 	}
 	db := repo.DB
+	// 订单状态只能通过状态机变更
 	err := db.Model(&order).Where("order_id=?", order.OrderId).Updates(map[string]interface{}{
-		"order_status": order.OrderStatus,
-		"update_time":  time.Now(),
-		"total_price":  order.TotalPrice,
-		"user":         order.User,
-		"ticket":       order.Ticket,
+		"total_price": order.TotalPrice,
+		"update_at":   time.Now(),
 	}).Error
 	if err != nil {
 		return false, err
@@ -123,10 +215,12 @@ func (repo *OrderRepository) Delete(ctx context.Context, order *model.Order) (bo
 	return true, nil
 }
 
-func (repo *OrderRepository) ExecuteTransaction(fn func(ctx context.Context) error) error {
-	return repo.DB.Transaction(func(tx *gorm.DB) error {
-		return fn(context.Background())
-	})
+func (repo *OrderRepository) ExecuteTransaction(fn func(tx *gorm.DB) error) error {
+	return repo.DB.Transaction(fn)
+}
+
+func (repo *OrderRepository) WithDB(db *gorm.DB) OrderRepoInterface {
+	return &OrderRepository{DB: db}
 }
 
 // ProcessOrderFromMQ 处理来自消息队列的订单数据
@@ -142,9 +236,9 @@ func (repo *OrderRepository) ProcessOrderFromMQ(ctx context.Context, order *mode
 	}
 
 	if exists {
-		// 如果订单已存在，更新订单状态
-		_, err := repo.Edit(ctx, order)
-		return err
+		// 重复投递的消息，订单落库后状态只能通过状态机变更，不能被消息覆盖
+		fmt.Printf("订单 %s 已存在，忽略重复消息\n", order.OrderId)
+		return nil
 	} else {
 		// 如果订单不存在，创建新订单
 		_, err := repo.CreateOrder(ctx, order)
@@ -158,12 +252,322 @@ func (repo *OrderRepository) BatchProcessOrdersFromMQ(ctx context.Context, order
 		return err
 	}
 
-	return repo.ExecuteTransaction(func(ctx context.Context) error {
+	return repo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := repo.WithDB(tx)
 		for _, order := range orders {
-			if err := repo.ProcessOrderFromMQ(ctx, order); err != nil {
+			if err := r.ProcessOrderFromMQ(ctx, order); err != nil {
 				return err
 			}
 		}
 		return nil
 	})
 }
+
+func (repo *OrderRepository) ClaimTrip(ctx context.Context, idType enum.IdType, idNumber string, ticketTag enum.TicketTag, runDate string, mask int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	now := time.Now()
+	// 区间全部空闲时原子地置位，并发占用同一区间只有一个能成功
+	result := db.Model(&model.PassengerTrip{}).
+		Where("id_type=? AND id_number=? AND ticket_tag=? AND run_date=?", idType, idNumber, ticketTag, runDate).
+		Where("(occupied_mask & ?) = 0", mask).
+		Updates(map[string]interface{}{
+			"occupied_mask": gorm.Expr("occupied_mask | ?", mask),
+			"update_at":     now,
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected > 0 {
+		return true, nil
+	}
+
+	var count int64
+	err := db.Model(&model.PassengerTrip{}).
+		Where("id_type=? AND id_number=? AND ticket_tag=? AND run_date=?", idType, idNumber, ticketTag, runDate).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+	// 首次乘坐该开行计划，并发创建时由唯一索引保证只有一个成功
+	err = db.Create(&model.PassengerTrip{
+		TripId:       utils.GetUUID(),
+		IdType:       idType,
+		IdNumber:     idNumber,
+		TicketTag:    ticketTag,
+		RunDate:      runDate,
+		OccupiedMask: mask,
+		CreateTime:   now,
+		UpdateTime:   now,
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (repo *OrderRepository) ReleaseTrip(ctx context.Context, idType enum.IdType, idNumber string, ticketTag enum.TicketTag, runDate string, mask int64) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	db := repo.DB
+	return db.Model(&model.PassengerTrip{}).
+		Where("id_type=? AND id_number=? AND ticket_tag=? AND run_date=?", idType, idNumber, ticketTag, runDate).
+		Updates(map[string]interface{}{
+			"occupied_mask": gorm.Expr("occupied_mask & ?", ^mask),
+			"update_at":     time.Now(),
+		}).Error
+}
+
+func (repo *OrderRepository) TransitionWithOptimisticLock(ctx context.Context, order *model.Order, to enum.OrderStatus, itemStatus enum.TicketStatus, eventType enum.OrderEventType, remark string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	from := order.OrderStatus
+	if !from.CanTransitionTo(to) {
+		return false, fmt.Errorf("%w: %s → %s", ErrIllegalOrderTransition, from, to)
+	}
+
+	updated := false
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.Order{}).
+			Where("order_id = ? AND version = ? AND order_status = ?", order.OrderId, order.Version, from).
+			Updates(map[string]interface{}{
+				"order_status": to,
+				"version":      order.Version + 1,
+				"update_at":    time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		updated = true
+		err := tx.Model(&model.OrderItem{}).
+			Where("order_id=?", order.OrderId).
+			Updates(map[string]interface{}{
+				"item_status": itemStatus,
+				"update_at":   time.Now(),
+			}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Create(newOrderEvent(order.OrderId, eventType, from, to, order.Version+1, remark)).Error
+	})
+	if err != nil || !updated {
+		return false, err
+	}
+
+	order.OrderStatus = to
+	order.Version++
+	return true, nil
+}
+
+func (repo *OrderRepository) TransitionWithOptimisticLockRetry(ctx context.Context, orderId string, from enum.OrderStatus, to enum.OrderStatus, itemStatus enum.TicketStatus, eventType enum.OrderEventType, remark string, maxRetries int) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if !from.CanTransitionTo(to) {
+		return false, fmt.Errorf("%w: %s → %s", ErrIllegalOrderTransition, from, to)
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		current := model.Order{}
+		err := repo.DB.Select("order_id", "order_status", "version").Where("order_id=?", orderId).First(&current).Error
+		if err != nil {
+			return false, err
+		}
+		// 订单已不处于from状态，由调用方决定如何处理
+		if current.OrderStatus != from {
+			return false, nil
+		}
+
+		success, err := repo.TransitionWithOptimisticLock(ctx, &current, to, itemStatus, eventType, remark)
+		if err != nil {
+			return false, err
+		}
+		if success {
+			return true, nil
+		}
+
+		// 版本冲突，等待一小段时间后重试
+		if i < maxRetries-1 {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return false, ctx.Err()
+			}
+		}
+	}
+	return false, nil
+}
+
+func (repo *OrderRepository) ListEvents(ctx context.Context, orderId string) ([]*model.OrderEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var events []*model.OrderEvent
+	err := db.Where("order_id=?", orderId).Order("create_at asc").Find(&events).Error
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (repo *OrderRepository) ListPaidArrivedBefore(ctx context.Context, before time.Time, limit int) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var orderIds []string
+	err := db.Model(&model.OrderItem{}).
+		Joins("JOIN orders ON orders.order_id = order_items.order_id").
+		Where("orders.order_status=?", enum.OrderStatusPaid).
+		Group("order_items.order_id").
+		Having("MAX(order_items.arrival_time) < ?", before).
+		Limit(limit).
+		Pluck("order_items.order_id", &orderIds).Error
+	if err != nil {
+		return nil, err
+	}
+	return orderIds, nil
+}
+
+func newOrderEvent(orderId string, eventType enum.OrderEventType, from enum.OrderStatus, to enum.OrderStatus, version int64, remark string) *model.OrderEvent {
+	return &model.OrderEvent{
+		EventId:    utils.GetUUID(),
+		OrderId:    orderId,
+		EventType:  eventType,
+		FromStatus: from,
+		ToStatus:   to,
+		Version:    version,
+		Remark:     remark,
+		CreateTime: time.Now(),
+	}
+}
+
+func (repo *OrderRepository) ChangeItems(ctx context.Context, orderId string, version int64, items []model.OrderItem, changes []model.OrderChange, totalPrice float64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	updated := false
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		// 以调用方读取订单时的版本号为条件，读取后订单有任何变更（包括其他改签）都不能覆盖
+		result := tx.Model(&model.Order{}).
+			Where("order_id = ? AND version = ? AND order_status = ?", orderId, version, enum.OrderStatusPaid).
+			Updates(map[string]interface{}{
+				"total_price": totalPrice,
+				"version":     version + 1,
+				"update_at":   time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		updated = true
+		for i := range items {
+			// 关联的座位只读，避免用查询时加载的原座位覆盖新的ticket_id
+			if err := tx.Omit(clause.Associations).Save(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Create(&changes).Error; err != nil {
+			return err
+		}
+		remark := fmt.Sprintf("改签 %d 名乘车人", len(changes))
+		if len(changes) > 0 && changes[0].ChangeStatus == enum.ChangeStatusAwaitingPayment {
+			remark += "，待补差价"
+		}
+		return tx.Create(newOrderEvent(orderId, enum.OrderEventChanged, enum.OrderStatusPaid, enum.OrderStatusPaid, version+1, remark)).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated, nil
+}
+
+func (repo *OrderRepository) ListChanges(ctx context.Context, changeNo string) ([]*model.OrderChange, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var changes []*model.OrderChange
+	if err := repo.DB.Where("change_no=?", changeNo).Order("create_at asc").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+func (repo *OrderRepository) UpdateChangeStatus(ctx context.Context, changeNo string, from enum.ChangeStatus, to enum.ChangeStatus) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := repo.DB.Model(&model.OrderChange{}).
+		Where("change_no=? AND change_status=?", changeNo, from).
+		Updates(map[string]interface{}{
+			"change_status": to,
+			"update_at":     time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *OrderRepository) CompleteChange(ctx context.Context, orderId string, changeNo string, items []model.OrderItem, diff float64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	updated := false
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&model.OrderChange{}).
+			Where("change_no=? AND change_status=?", changeNo, enum.ChangeStatusPaid).
+			Updates(map[string]interface{}{
+				"change_status": enum.ChangeStatusCompleted,
+				"update_at":     time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+		current := model.Order{}
+		if err := tx.Select("order_id", "order_status", "version").Where("order_id=?", orderId).First(&current).Error; err != nil {
+			return err
+		}
+		result = tx.Model(&model.Order{}).
+			Where("order_id = ? AND version = ? AND order_status = ?", orderId, current.Version, enum.OrderStatusPaid).
+			Updates(map[string]interface{}{
+				"total_price": gorm.Expr("total_price + ?", diff),
+				"version":     current.Version + 1,
+				"update_at":   time.Now(),
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return fmt.Errorf("订单%s，不能完成改签", current.OrderStatus)
+		}
+		updated = true
+		for i := range items {
+			if err := tx.Omit(clause.Associations).Save(&items[i]).Error; err != nil {
+				return err
+			}
+		}
+		remark := fmt.Sprintf("补差价后改签 %d 名乘车人", len(items))
+		return tx.Create(newOrderEvent(orderId, enum.OrderEventChanged, enum.OrderStatusPaid, enum.OrderStatusPaid, current.Version+1, remark)).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return updated, nil
+}
@@ -0,0 +1,74 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// 待支付订单的支付截止时间，score 为截止时间戳，member 为订单ID
+const orderHoldKey = "order_hold_expiry"
+
+// 待补差价改签的支付截止时间，score 为截止时间戳，member 为改签批次号
+const changeHoldKey = "change_hold_expiry"
+
+// 登记待支付订单的支付截止时间
+func (repo *RedisRepository) AddOrderHold(ctx context.Context, orderId string, expireAt time.Time) error {
+	return repo.Rdb.ZAdd(ctx, orderHoldKey, redis.Z{
+		Score:  float64(expireAt.Unix()),
+		Member: orderId,
+	}).Err()
+}
+
+// 订单支付或取消后移除
+func (repo *RedisRepository) RemoveOrderHold(ctx context.Context, orderId string) error {
+	return repo.Rdb.ZRem(ctx, orderHoldKey, orderId).Err()
+}
+
+// 取出已到期的订单，通过ZREM认领，多个实例同时扫描时每个订单只会被一个实例取到
+func (repo *RedisRepository) PopExpiredOrderHolds(ctx context.Context, now time.Time, limit int64) ([]string, error) {
+	return repo.popExpiredHolds(ctx, orderHoldKey, now, limit)
+}
+
+// 登记待补差价改签的支付截止时间
+func (repo *RedisRepository) AddChangeHold(ctx context.Context, changeNo string, expireAt time.Time) error {
+	return repo.Rdb.ZAdd(ctx, changeHoldKey, redis.Z{
+		Score:  float64(expireAt.Unix()),
+		Member: changeNo,
+	}).Err()
+}
+
+// 改签完成或撤销后移除
+func (repo *RedisRepository) RemoveChangeHold(ctx context.Context, changeNo string) error {
+	return repo.Rdb.ZRem(ctx, changeHoldKey, changeNo).Err()
+}
+
+// 取出已到期的改签，认领方式同PopExpiredOrderHolds
+func (repo *RedisRepository) PopExpiredChangeHolds(ctx context.Context, now time.Time, limit int64) ([]string, error) {
+	return repo.popExpiredHolds(ctx, changeHoldKey, now, limit)
+}
+
+func (repo *RedisRepository) popExpiredHolds(ctx context.Context, key string, now time.Time, limit int64) ([]string, error) {
+	members, err := repo.Rdb.ZRangeByScore(ctx, key, &redis.ZRangeBy{
+		Min:   "-inf",
+		Max:   fmt.Sprintf("%d", now.Unix()),
+		Count: limit,
+	}).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	claimed := make([]string, 0, len(members))
+	for _, member := range members {
+		removed, err := repo.Rdb.ZRem(ctx, key, member).Result()
+		if err != nil {
+			return claimed, err
+		}
+		if removed > 0 {
+			claimed = append(claimed, member)
+		}
+	}
+	return claimed, nil
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PassengerRepository struct {
+	DB *gorm.DB
+}
+
+type PassengerRepoInterface interface {
+	ListByUserId(ctx context.Context, userId string) ([]*model.Passenger, error)
+	Get(ctx context.Context, passenger *model.Passenger) (*model.Passenger, error)
+	// 按ID批量查询某账号下的乘车人
+	GetByPassengerIds(ctx context.Context, userId string, passengerIds []string) ([]*model.Passenger, error)
+	// 同一账号下证件是否已登记，excludeId用于修改时排除自身
+	ExistByDocument(ctx context.Context, userId string, idType enum.IdType, idNumber string, excludeId string) (bool, error)
+	CreatePassenger(ctx context.Context, passenger *model.Passenger) (*model.Passenger, error)
+	Edit(ctx context.Context, passenger *model.Passenger) (bool, error)
+	UpdateVerifyStatus(ctx context.Context, passengerId string, status enum.VerifyStatus, verifyTime *time.Time) error
+	Delete(ctx context.Context, passenger *model.Passenger) (bool, error)
+}
+
+var _ PassengerRepoInterface = (*PassengerRepository)(nil)
+
+func (repo *PassengerRepository) ListByUserId(ctx context.Context, userId string) ([]*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var passengers []*model.Passenger
+	err := db.Where("user_id=?", userId).Order("create_at asc").Find(&passengers).Error
+	if err != nil {
+		return nil, err
+	}
+	return passengers, nil
+}
+
+func (repo *PassengerRepository) Get(ctx context.Context, passenger *model.Passenger) (*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Passenger := model.Passenger{}
+	err := db.Where("passenger_id=?", passenger.PassengerId).First(&Passenger).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Passenger, nil
+}
+
+func (repo *PassengerRepository) GetByPassengerIds(ctx context.Context, userId string, passengerIds []string) ([]*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var passengers []*model.Passenger
+	err := db.Where("user_id=? AND passenger_id IN ?", userId, passengerIds).Find(&passengers).Error
+	if err != nil {
+		return nil, err
+	}
+	return passengers, nil
+}
+
+func (repo *PassengerRepository) ExistByDocument(ctx context.Context, userId string, idType enum.IdType, idNumber string, excludeId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB.Model(&model.Passenger{}).Where("user_id=? AND id_type=? AND id_number=?", userId, idType, idNumber)
+	if excludeId != "" {
+		db = db.Where("passenger_id<>?", excludeId)
+	}
+	var count int64
+	if err := db.Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (repo *PassengerRepository) CreatePassenger(ctx context.Context, passenger *model.Passenger) (*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	if err := db.Create(passenger).Error; err != nil {
+		return nil, err
+	}
+	return passenger, nil
+}
+
+func (repo *PassengerRepository) Edit(ctx context.Context, passenger *model.Passenger) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	err := db.Model(&model.Passenger{}).Where("passenger_id=?", passenger.PassengerId).Updates(map[string]interface{}{
+		"passenger_name": passenger.PassengerName,
+		"id_type":        passenger.IdType,
+		"id_number":      passenger.IdNumber,
+		"passenger_type": passenger.PassengerType,
+		"verify_status":  passenger.VerifyStatus,
+		"verify_at":      passenger.VerifyTime,
+		"update_at":      time.Now(),
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (repo *PassengerRepository) UpdateVerifyStatus(ctx context.Context, passengerId string, status enum.VerifyStatus, verifyTime *time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Model(&model.Passenger{}).Where("passenger_id=?", passengerId).Updates(map[string]interface{}{
+		"verify_status": status,
+		"verify_at":     verifyTime,
+		"update_at":     time.Now(),
+	}).Error
+}
+
+func (repo *PassengerRepository) Delete(ctx context.Context, passenger *model.Passenger) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	err := db.Where("passenger_id=?", passenger.PassengerId).Delete(&model.Passenger{}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,276 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type PaymentRepository struct {
+	DB *gorm.DB
+}
+
+type PaymentRepoInterface interface {
+	GetByPaymentNo(ctx context.Context, paymentNo string) (*model.Payment, error)
+	// 获取订单待支付或已支付成功的支付流水，不含改签补差价
+	GetActiveByOrderId(ctx context.Context, orderId string) (*model.Payment, error)
+	// 订单所有支付成功的流水（含改签补差价），按支付先后排序
+	ListSucceededByOrderId(ctx context.Context, orderId string) ([]*model.Payment, error)
+	CreatePayment(ctx context.Context, payment *model.Payment) (*model.Payment, error)
+	// 仅当支付流水处于from中的某个状态时更新，返回是否更新成功
+	UpdateStatus(ctx context.Context, paymentNo string, from []enum.PaymentStatus, to enum.PaymentStatus, tradeNo string) (bool, error)
+	// 部分退款，累加退款金额，流水仍为支付成功；剩余可退金额不足时不更新
+	AddRefund(ctx context.Context, paymentNo string, amount float64) (bool, error)
+	// 关闭订单所有待支付的流水
+	CloseUnpaid(ctx context.Context, orderId string) error
+	// 候补兑现：支付成功且尚未关联订单的预付款流水关联到兑现的订单，返回是否更新成功
+	AttachOrder(ctx context.Context, paymentNo string, orderId string) (bool, error)
+	// 退票时在事务中登记待退款：支付成功的流水置为退款中并记录退款单号和手续费，返回是否更新成功
+	MarkRefunding(ctx context.Context, paymentNo string, refundNo string, refundFee float64) (bool, error)
+	// 退款中的流水，orderId为空时查询所有订单，按更新时间排序
+	ListRefunding(ctx context.Context, orderId string, limit int) ([]*model.Payment, error)
+	// 仅当支付流水已支付成功或退款中时登记退款，返回是否更新成功
+	MarkRefunded(ctx context.Context, paymentNo string, refundNo string, refundAmount float64, refundFee float64) (bool, error)
+	// 登记部分退款记录，须与AddRefund在同一事务中调用
+	CreateRefund(ctx context.Context, refund *model.PaymentRefund) error
+	// 退款中的部分退款记录，orderId为空时查询所有订单，按创建时间排序
+	ListPendingRefunds(ctx context.Context, orderId string, limit int) ([]*model.PaymentRefund, error)
+	// 仅当部分退款记录仍为退款中时置为已退款，返回是否更新成功
+	MarkRefundSettled(ctx context.Context, refundNo string) (bool, error)
+	//开启事务，事务内通过WithDB(tx)取得绑定事务的仓储
+	ExecuteTransaction(fn func(tx *gorm.DB) error) error
+	// 使用指定连接（通常为事务）的仓储
+	WithDB(db *gorm.DB) PaymentRepoInterface
+}
+
+var _ PaymentRepoInterface = (*PaymentRepository)(nil)
+
+func (repo *PaymentRepository) GetByPaymentNo(ctx context.Context, paymentNo string) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Payment := model.Payment{}
+	err := db.Where("payment_no=?", paymentNo).First(&Payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Payment, nil
+}
+
+func (repo *PaymentRepository) GetActiveByOrderId(ctx context.Context, orderId string) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Payment := model.Payment{}
+	err := db.Where("order_id=? AND change_no='' AND status IN ?", orderId, []enum.PaymentStatus{enum.PaymentStatusCreated, enum.PaymentStatusSucceeded}).
+		Order("create_at desc").
+		First(&Payment).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Payment, nil
+}
+
+func (repo *PaymentRepository) ListSucceededByOrderId(ctx context.Context, orderId string) ([]*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var payments []*model.Payment
+	err := db.Where("order_id=? AND status=?", orderId, enum.PaymentStatusSucceeded).
+		Order("paid_at asc").
+		Find(&payments).Error
+	if err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (repo *PaymentRepository) CreatePayment(ctx context.Context, payment *model.Payment) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	if err := db.Create(payment).Error; err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+func (repo *PaymentRepository) UpdateStatus(ctx context.Context, paymentNo string, from []enum.PaymentStatus, to enum.PaymentStatus, tradeNo string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	updates := map[string]interface{}{
+		"status":    to,
+		"update_at": time.Now(),
+	}
+	if tradeNo != "" {
+		updates["trade_no"] = tradeNo
+	}
+	if to == enum.PaymentStatusSucceeded {
+		updates["paid_at"] = time.Now()
+	}
+	result := repo.DB.Model(&model.Payment{}).
+		Where("payment_no=? AND status IN ?", paymentNo, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *PaymentRepository) AddRefund(ctx context.Context, paymentNo string, amount float64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := repo.DB.Model(&model.Payment{}).
+		Where("payment_no=? AND status=? AND amount-refund_amount>=?", paymentNo, enum.PaymentStatusSucceeded, amount-0.005).
+		Updates(map[string]interface{}{
+			"refund_amount": gorm.Expr("refund_amount+?", amount),
+			"refund_at":     time.Now(),
+			"update_at":     time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *PaymentRepository) CloseUnpaid(ctx context.Context, orderId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Model(&model.Payment{}).
+		Where("order_id=? AND status=?", orderId, enum.PaymentStatusCreated).
+		Updates(map[string]interface{}{
+			"status":    enum.PaymentStatusClosed,
+			"update_at": time.Now(),
+		}).Error
+}
+
+func (repo *PaymentRepository) AttachOrder(ctx context.Context, paymentNo string, orderId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := repo.DB.Model(&model.Payment{}).
+		Where("payment_no=? AND status=? AND order_id=''", paymentNo, enum.PaymentStatusSucceeded).
+		Updates(map[string]interface{}{
+			"order_id":  orderId,
+			"update_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *PaymentRepository) MarkRefunding(ctx context.Context, paymentNo string, refundNo string, refundFee float64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := repo.DB.Model(&model.Payment{}).
+		Where("payment_no=? AND status=?", paymentNo, enum.PaymentStatusSucceeded).
+		Updates(map[string]interface{}{
+			"status":     enum.PaymentStatusRefunding,
+			"refund_no":  refundNo,
+			"refund_fee": refundFee,
+			"update_at":  time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *PaymentRepository) ListRefunding(ctx context.Context, orderId string, limit int) ([]*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB.Where("status=?", enum.PaymentStatusRefunding)
+	if orderId != "" {
+		db = db.Where("order_id=?", orderId)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	var payments []*model.Payment
+	if err := db.Order("update_at asc").Find(&payments).Error; err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+func (repo *PaymentRepository) MarkRefunded(ctx context.Context, paymentNo string, refundNo string, refundAmount float64, refundFee float64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := repo.DB.Model(&model.Payment{}).
+		Where("payment_no=? AND status IN ?", paymentNo, []enum.PaymentStatus{enum.PaymentStatusSucceeded, enum.PaymentStatusRefunding}).
+		Updates(map[string]interface{}{
+			"status":        enum.PaymentStatusRefunded,
+			"refund_no":     refundNo,
+			"refund_amount": refundAmount,
+			"refund_fee":    refundFee,
+			"refund_at":     time.Now(),
+			"update_at":     time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *PaymentRepository) CreateRefund(ctx context.Context, refund *model.PaymentRefund) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Create(refund).Error
+}
+
+func (repo *PaymentRepository) ListPendingRefunds(ctx context.Context, orderId string, limit int) ([]*model.PaymentRefund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB.Where("status=?", enum.PaymentStatusRefunding)
+	if orderId != "" {
+		db = db.Where("order_id=?", orderId)
+	}
+	if limit > 0 {
+		db = db.Limit(limit)
+	}
+	var refunds []*model.PaymentRefund
+	if err := db.Order("create_at asc").Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+func (repo *PaymentRepository) MarkRefundSettled(ctx context.Context, refundNo string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	result := repo.DB.Model(&model.PaymentRefund{}).
+		Where("refund_no=? AND status=?", refundNo, enum.PaymentStatusRefunding).
+		Updates(map[string]interface{}{
+			"status":    enum.PaymentStatusRefunded,
+			"update_at": time.Now(),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *PaymentRepository) ExecuteTransaction(fn func(tx *gorm.DB) error) error {
+	return repo.DB.Transaction(fn)
+}
+
+func (repo *PaymentRepository) WithDB(db *gorm.DB) PaymentRepoInterface {
+	return &PaymentRepository{DB: db}
+}
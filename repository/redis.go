@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"12305/enum"
 	"12305/model"
 	"12305/utils"
 	"context"
@@ -33,9 +34,9 @@ func init() {
 
 // 预热布隆过滤器
 func (repo *RedisRepository) WarmUpBloomFilter(ctx context.Context) error {
-	// 从数据库获取所有车次标签
+	// 从车次登记表获取所有运营中的车次标签
 	var ticketTags []string
-	err := repo.DB.Model(&model.Ticket{}).Distinct("ticket_tag").Pluck("ticket_tag", &ticketTags).Error
+	err := repo.DB.Model(&model.Train{}).Where("train_status=?", enum.TrainStatusActive).Pluck("ticket_tag", &ticketTags).Error
 	if err != nil {
 		return fmt.Errorf("获取车次标签失败: %v", err)
 	}
@@ -49,6 +50,11 @@ func (repo *RedisRepository) WarmUpBloomFilter(ctx context.Context) error {
 	return nil
 }
 
+// 新登记车次加入布隆过滤器
+func (repo *RedisRepository) AddToBloomFilter(ticketTag string) {
+	bloomFilter.Add(ticketTag)
+}
+
 // 获取布隆过滤器统计信息
 func (repo *RedisRepository) GetBloomFilterStats(ctx context.Context) (map[string]interface{}, error) {
 	return bloomFilter.GetStats(), nil
@@ -60,41 +66,82 @@ type RedisRepository struct {
 }
 
 type RedisRepoInterface interface {
-	GetByTicketTag(ctx context.Context, tickettag string) ([]*model.Ticket, error)
+	GetByTicketTag(ctx context.Context, tickettag string, runDate string) ([]*model.Ticket, error)
 	//cache aside模式
 	//DecrStock(ctx context.Context, ticket *model.Ticket, remotstock *model.RemotStock) (*model.RemotStock, error)
 	//AddByTicketTag(ctx context.Context, tickettag string, remotstock *model.RemotStock) (*model.RemotStock, error)
 	// 分布式锁和库存一致性管理 write/read through模式
-	AcquireTicketLock(ctx context.Context, ticketId string, expireTime time.Duration) (bool, string, error)
-	AcquireTicketLockWithRetry(ctx context.Context, ticketId string, expireTime time.Duration, maxRetries int, retryDelay time.Duration) (bool, string, error)
+	AcquireTicketLock(ctx context.Context, ticketId string, expireTime time.Duration, maxRetries int, retryDelay time.Duration) (bool, string, error)
 	ReleaseTicketLock(ctx context.Context, ticketId string, lockValue string) (bool, error)
 	RenewTicketLock(ctx context.Context, ticketId string, lockValue string, expireTime time.Duration) (bool, error)
-	NewSafeDistributedLock(ticketId string, expireTime time.Duration) *SafeDistributedLock
+	NewSafeDistributedLock(ticketId string, expireTime time.Duration) DistributedLock
+	// 非票务的分布式锁，lockKey 为完整的键名，不能以 ticket_lock_ 开头，避免混入票务锁统计
+	NewSafeLock(lockKey string, expireTime time.Duration) DistributedLock
+	// 整体写入某车次某天开行的全部座位；单个座位的同步只更新已整体写入的缓存
+	LoadRunToCache(ctx context.Context, tickettag string, runDate string, tickets []*model.Ticket) error
 	SyncTicketToCache(ctx context.Context, ticket *model.Ticket) error
-	InvalidateTicketCache(ctx context.Context, ticketTag string) error
+	RemoveTicketFromCache(ctx context.Context, ticket *model.Ticket) error
 	// 新增：缓存统计
 	GetCacheStats(ctx context.Context) (map[string]interface{}, error)
 	// 新增：锁统计
 	GetLockStats(ctx context.Context) (map[string]interface{}, error)
 	// 新增：布隆过滤器相关
 	WarmUpBloomFilter(ctx context.Context) error
+	AddToBloomFilter(ticketTag string)
 	GetBloomFilterStats(ctx context.Context) (map[string]interface{}, error)
+	// 待支付订单到期释放
+	AddOrderHold(ctx context.Context, orderId string, expireAt time.Time) error
+	RemoveOrderHold(ctx context.Context, orderId string) error
+	PopExpiredOrderHolds(ctx context.Context, now time.Time, limit int64) ([]string, error)
+	// 待补差价改签到期撤销
+	AddChangeHold(ctx context.Context, changeNo string, expireAt time.Time) error
+	RemoveChangeHold(ctx context.Context, changeNo string) error
+	PopExpiredChangeHolds(ctx context.Context, now time.Time, limit int64) ([]string, error)
+	// 登录会话
+	SaveSession(ctx context.Context, session *model.Session, ttl time.Duration) error
+	GetSession(ctx context.Context, sessionId string) (*model.Session, error)
+	RotateSessionRefresh(ctx context.Context, session *model.Session, oldRefreshId string, newRefreshId string, ttl time.Duration) (bool, error)
+	DeleteSession(ctx context.Context, session *model.Session) error
+	DeleteUserSessions(ctx context.Context, userId string) error
+	// 短信验证码与发送频率
+	SaveSmsCode(ctx context.Context, scene string, phone string, code string, ttl time.Duration) error
+	CheckSmsCode(ctx context.Context, scene string, phone string, code string, maxAttempts int) (SmsCodeCheck, error)
+	IncrSmsLimit(ctx context.Context, kind string, subject string, window time.Duration) (int64, error)
+}
+
+var _ RedisRepoInterface = (*RedisRepository)(nil)
+
+func ticketLockKey(ticketId string) string {
+	return fmt.Sprintf("ticket_lock_%s", ticketId)
 }
 
 // 获取票务分布式锁（自旋锁）
 func (repo *RedisRepository) AcquireTicketLock(ctx context.Context, ticketId string, expireTime time.Duration, maxRetries int, retryDelay time.Duration) (bool, string, error) {
-	lockKey := fmt.Sprintf("ticket_lock_%s", ticketId)
+	return repo.acquireLock(ctx, ticketLockKey(ticketId), expireTime, maxRetries, retryDelay)
+}
+
+func (repo *RedisRepository) acquireLock(ctx context.Context, lockKey string, expireTime time.Duration, maxRetries int, retryDelay time.Duration) (bool, string, error) {
 	lockValue := utils.GetUUID()
 
 	for i := 0; i < maxRetries; i++ {
 		result, err := repo.Rdb.SetNX(ctx, lockKey, lockValue, expireTime).Result()
 		if err != nil {
+			// 超时等错误时服务端可能已经加锁，按锁值尝试释放，避免锁残留到过期
+			releaseCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+			if _, releaseErr := repo.releaseLock(releaseCtx, lockKey, lockValue); releaseErr != nil {
+				fmt.Printf("释放可能已获取的锁失败: %v\n", releaseErr)
+			}
+			cancel()
 			return false, "", err
 		}
 
 		if result {
 			return true, lockValue, nil
 		}
+		// 客户端在读超时后会自动重发命令，之前发出的 SETNX 可能已经加锁成功
+		if current, err := repo.Rdb.Get(ctx, lockKey).Result(); err == nil && current == lockValue {
+			return true, lockValue, nil
+		}
 
 		// 如果不是最后一次重试，则等待后重试
 		if i < maxRetries-1 {
@@ -112,7 +159,10 @@ func (repo *RedisRepository) AcquireTicketLock(ctx context.Context, ticketId str
 
 // 释放票务分布式锁
 func (repo *RedisRepository) ReleaseTicketLock(ctx context.Context, ticketId string, lockValue string) (bool, error) {
-	lockKey := fmt.Sprintf("ticket_lock_%s", ticketId)
+	return repo.releaseLock(ctx, ticketLockKey(ticketId), lockValue)
+}
+
+func (repo *RedisRepository) releaseLock(ctx context.Context, lockKey string, lockValue string) (bool, error) {
 
 	// 使用Lua脚本确保原子性释放锁，只有锁值匹配才能释放
 	script := `
@@ -139,7 +189,10 @@ func (repo *RedisRepository) ReleaseTicketLock(ctx context.Context, ticketId str
 
 // 续期分布式锁
 func (repo *RedisRepository) RenewTicketLock(ctx context.Context, ticketId string, lockValue string, expireTime time.Duration) (bool, error) {
-	lockKey := fmt.Sprintf("ticket_lock_%s", ticketId)
+	return repo.renewLock(ctx, ticketLockKey(ticketId), lockValue, expireTime)
+}
+
+func (repo *RedisRepository) renewLock(ctx context.Context, lockKey string, lockValue string, expireTime time.Duration) (bool, error) {
 
 	// 使用Lua脚本确保原子性续期，只有锁值匹配才能续期
 	script := `
@@ -162,42 +215,84 @@ func (repo *RedisRepository) RenewTicketLock(ctx context.Context, ticketId strin
 	return result.(int64) == 1, nil
 }
 
+// 整体写入某车次某天开行的全部座位(防雪崩)
+// 车次缓存只能整体写入：删除旧缓存与写入全部座位在同一事务中完成，读到的缓存总是完整的
+func (repo *RedisRepository) LoadRunToCache(ctx context.Context, tickettag string, runDate string, tickets []*model.Ticket) error {
+	fields := make([]interface{}, 0, 2*len(tickets))
+	for _, ticket := range tickets {
+		jsonData, err := json.Marshal(ticket)
+		if err != nil {
+			return fmt.Errorf("序列化票务数据失败: %v", err)
+		}
+		fields = append(fields, ticket.TicketId, jsonData)
+	}
+
+	key := TicketCacheKey(tickettag, runDate)
+	protector := utils.GetCacheProtector()
+	pipe := repo.Rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	if len(fields) > 0 {
+		pipe.HSet(ctx, key, fields...)
+		// 防雪崩：使用随机过期时间
+		pipe.Expire(ctx, key, protector.GetRandomExpiration(30*time.Minute))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("更新Redis缓存失败: %v", err)
+	}
+
+	protector.RemoveNull(key)
+	bloomFilter.Add(tickettag)
+	return nil
+}
+
 // 同步票务信息到缓存(防雪崩)
+// 只更新已整体写入的车次缓存；缓存不存在时不写入，避免只含部分座位的缓存被当作整个车次，下次读取时从数据库整体加载
 func (repo *RedisRepository) SyncTicketToCache(ctx context.Context, ticket *model.Ticket) error {
 	jsonData, err := json.Marshal(ticket)
 	if err != nil {
 		return fmt.Errorf("序列化票务数据失败: %v", err)
 	}
 
-	key := string(ticket.TicketTag)
-	pipe := repo.Rdb.Pipeline()
-	pipe.HSet(ctx, key, ticket.TicketId, jsonData)
-
+	script := `
+		if redis.call("exists", KEYS[1]) == 1 then
+			redis.call("hset", KEYS[1], ARGV[1], ARGV[2])
+			redis.call("expire", KEYS[1], ARGV[3])
+			return 1
+		end
+		return 0
+	`
+	key := TicketCacheKey(string(ticket.TicketTag), ticket.RunDate)
 	// 防雪崩：使用随机过期时间
 	protector := utils.GetCacheProtector()
 	randomExpiration := protector.GetRandomExpiration(30 * time.Minute)
-	pipe.Expire(ctx, key, randomExpiration)
-
-	//执行批量操作
-	_, err = pipe.Exec(ctx)
-	if err != nil {
+	if err := repo.Rdb.Eval(ctx, script, []string{key}, ticket.TicketId, jsonData, int(randomExpiration.Seconds())).Err(); err != nil {
 		return fmt.Errorf("更新Redis缓存失败: %v", err)
 	}
 
-	// 添加到布隆过滤器
-	bloomFilter.Add(key)
+	// 清除空值缓存并添加到布隆过滤器
+	protector.RemoveNull(key)
+	bloomFilter.Add(string(ticket.TicketTag))
 
 	return nil
 }
 
+// 座位删除后从车次缓存中移除
+func (repo *RedisRepository) RemoveTicketFromCache(ctx context.Context, ticket *model.Ticket) error {
+	key := TicketCacheKey(string(ticket.TicketTag), ticket.RunDate)
+	if err := repo.Rdb.HDel(ctx, key, ticket.TicketId).Err(); err != nil {
+		return fmt.Errorf("删除Redis缓存失败: %v", err)
+	}
+	return nil
+}
+
 // // 使票务缓存失效
 // func (repo *RedisRepository) InvalidateTicketCache(ctx context.Context, ticketTag string) error {
 // 	// 删除整个车次的缓存，强制重新加载
 // 	return repo.Rdb.Del(ctx, ticketTag).Err()
 // }
 
-// 通过redis获取所有同车次票 (防击穿、防穿透、防雪崩)
-func (repo *RedisRepository) GetByTicketTag(ctx context.Context, tickettag string) ([]*model.Ticket, error) {
+// 通过redis获取某车次某天开行的所有票 (防击穿、防穿透、防雪崩)
+func (repo *RedisRepository) GetByTicketTag(ctx context.Context, tickettag string, runDate string) ([]*model.Ticket, error) {
 	// 限流检查
 	if !rateLimiter.Allow() {
 		return nil, fmt.Errorf("系统繁忙，请稍后重试")
@@ -209,25 +304,26 @@ func (repo *RedisRepository) GetByTicketTag(ctx context.Context, tickettag strin
 	}
 
 	// 防穿透：检查空值缓存
+	key := TicketCacheKey(tickettag, runDate)
 	protector := utils.GetCacheProtector()
-	if protector.IsNullCached(tickettag) {
+	if protector.IsNullCached(key) {
 		return nil, fmt.Errorf("车次暂无票务信息")
 	}
 
 	// 防击穿：获取互斥锁
-	mutex := protector.GetMutex(tickettag)
+	mutex := protector.GetMutex(key)
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	// 标记热点数据
-	protector.MarkHotKey(tickettag)
+	protector.MarkHotKey(key)
 
 	TicketList := []*model.Ticket{}
-	Ticketid := repo.Rdb.HGetAll(ctx, tickettag).Val()
+	Ticketid := repo.Rdb.HGetAll(ctx, key).Val()
 
 	if len(Ticketid) == 0 {
 		// 缓存空值，防止穿透
-		protector.CacheNull(tickettag, 5*time.Minute)
+		protector.CacheNull(key, 5*time.Minute)
 		return nil, fmt.Errorf("车次暂无票务信息")
 	}
 
@@ -303,10 +399,18 @@ func (repo *RedisRepository) GetLockStats(ctx context.Context) (map[string]inter
 	return stats, nil
 }
 
+// 分布式锁，获取成功后自动续期直到释放
+type DistributedLock interface {
+	Acquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+var _ DistributedLock = (*SafeDistributedLock)(nil)
+
 // 安全的分布式锁包装器 防止用户多次购票
 type SafeDistributedLock struct {
 	repo       *RedisRepository
-	ticketId   string
+	lockKey    string
 	lockValue  string
 	expireTime time.Duration
 	renewCtx   context.Context
@@ -317,10 +421,14 @@ type SafeDistributedLock struct {
 }
 
 // 创建安全的分布式锁
-func (repo *RedisRepository) NewSafeDistributedLock(ticketId string, expireTime time.Duration) *SafeDistributedLock {
+func (repo *RedisRepository) NewSafeDistributedLock(ticketId string, expireTime time.Duration) DistributedLock {
+	return repo.NewSafeLock(ticketLockKey(ticketId), expireTime)
+}
+
+func (repo *RedisRepository) NewSafeLock(lockKey string, expireTime time.Duration) DistributedLock {
 	return &SafeDistributedLock{
 		repo:       repo,
-		ticketId:   ticketId,
+		lockKey:    lockKey,
 		expireTime: expireTime,
 		stopRenew:  make(chan struct{}),
 	}
@@ -335,7 +443,7 @@ func (lock *SafeDistributedLock) Acquire(ctx context.Context) (bool, error) {
 	// 	return false, errors.New("锁已被释放")
 	// }
 
-	acquired, lockValue, err := lock.repo.AcquireTicketLock(ctx, lock.ticketId, lock.expireTime, 3, 100*time.Millisecond)
+	acquired, lockValue, err := lock.repo.acquireLock(ctx, lock.lockKey, lock.expireTime, 3, 100*time.Millisecond)
 	if err != nil {
 		return false, err
 	}
@@ -371,7 +479,7 @@ func (lock *SafeDistributedLock) startRenewal() {
 				return
 			}
 
-			renewed, err := lock.repo.RenewTicketLock(lock.renewCtx, lock.ticketId, lock.lockValue, lock.expireTime)
+			renewed, err := lock.repo.renewLock(lock.renewCtx, lock.lockKey, lock.lockValue, lock.expireTime)
 			lock.mu.Unlock()
 
 			if err != nil || !renewed {
@@ -401,7 +509,7 @@ func (lock *SafeDistributedLock) Release(ctx context.Context) error {
 	time.Sleep(100 * time.Millisecond)
 
 	// 释放锁
-	released, err := lock.repo.ReleaseTicketLock(ctx, lock.ticketId, lock.lockValue)
+	released, err := lock.repo.releaseLock(ctx, lock.lockKey, lock.lockValue)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type RouteRepository struct {
+	DB *gorm.DB
+}
+
+type RouteRepoInterface interface {
+	Get(ctx context.Context, route *model.Route) (*model.Route, error)
+	GetByTicketTag(ctx context.Context, ticketTag enum.TicketTag) (*model.Route, error)
+	Exist(ctx context.Context, route model.Route) (bool, error)
+	CreateRoute(ctx context.Context, route *model.Route) (*model.Route, error)
+	ReplaceStops(ctx context.Context, routeId string, stops []model.RouteStop) error
+	Delete(ctx context.Context, route *model.Route) (bool, error)
+}
+
+var _ RouteRepoInterface = (*RouteRepository)(nil)
+
+// 停靠站按顺序预加载
+func preloadStops(db *gorm.DB) *gorm.DB {
+	return db.Order("seq asc")
+}
+
+func (repo *RouteRepository) Get(ctx context.Context, route *model.Route) (*model.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Route := model.Route{}
+	err := db.Preload("Stops", preloadStops).Where("route_id=?", route.RouteId).First(&Route).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Route, nil
+}
+
+func (repo *RouteRepository) GetByTicketTag(ctx context.Context, ticketTag enum.TicketTag) (*model.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Route := model.Route{}
+	err := db.Preload("Stops", preloadStops).Where("ticket_tag=?", ticketTag).First(&Route).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Route, nil
+}
+
+func (repo *RouteRepository) Exist(ctx context.Context, route model.Route) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.Route{}).Where("route_id=? OR ticket_tag=?", route.RouteId, route.TicketTag).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// 创建线路及其停靠站
+func (repo *RouteRepository) CreateRoute(ctx context.Context, route *model.Route) (*model.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	err := db.Create(route).Error
+	if err != nil {
+		return nil, err
+	}
+	return route, nil
+}
+
+// 整体替换线路停靠站
+func (repo *RouteRepository) ReplaceStops(ctx context.Context, routeId string, stops []model.RouteStop) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("route_id=?", routeId).Delete(&model.RouteStop{}).Error; err != nil {
+			return err
+		}
+		if len(stops) > 0 {
+			if err := tx.Create(&stops).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.Route{}).Where("route_id=?", routeId).Update("update_at", time.Now()).Error
+	})
+}
+
+func (repo *RouteRepository) Delete(ctx context.Context, route *model.Route) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("route_id=?", route.RouteId).Delete(&model.RouteStop{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("route_id=?", route.RouteId).Delete(&model.Route{}).Error
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
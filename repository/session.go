@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"12305/model"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+func sessionKey(sessionId string) string {
+	return fmt.Sprintf("auth_session_%s", sessionId)
+}
+
+// 用户的全部会话ID，用于修改密码后注销所有登录
+func userSessionsKey(userId string) string {
+	return fmt.Sprintf("auth_user_sessions_%s", userId)
+}
+
+// 保存会话，ttl 为刷新令牌的有效期
+func (repo *RedisRepository) SaveSession(ctx context.Context, session *model.Session, ttl time.Duration) error {
+	key := sessionKey(session.SessionId)
+	userKey := userSessionsKey(session.UserId)
+	pipe := repo.Rdb.TxPipeline()
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"user_id":    session.UserId,
+		"refresh_id": session.RefreshId,
+		"create_at":  session.CreateTime.Unix(),
+	})
+	pipe.Expire(ctx, key, ttl)
+	pipe.SAdd(ctx, userKey, session.SessionId)
+	pipe.Expire(ctx, userKey, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// 会话不存在或已注销时返回 nil
+func (repo *RedisRepository) GetSession(ctx context.Context, sessionId string) (*model.Session, error) {
+	values, err := repo.Rdb.HGetAll(ctx, sessionKey(sessionId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(values) == 0 {
+		return nil, nil
+	}
+	createAt, _ := strconv.ParseInt(values["create_at"], 10, 64)
+	return &model.Session{
+		SessionId:  sessionId,
+		UserId:     values["user_id"],
+		RefreshId:  values["refresh_id"],
+		CreateTime: time.Unix(createAt, 0),
+	}, nil
+}
+
+// 刷新令牌轮换：仅当会话当前的刷新令牌ID为 oldRefreshId 时替换为 newRefreshId，
+// 并同时延长会话和用户会话索引的有效期，避免索引先于会话过期导致无法按用户注销
+func (repo *RedisRepository) RotateSessionRefresh(ctx context.Context, session *model.Session, oldRefreshId string, newRefreshId string, ttl time.Duration) (bool, error) {
+	script := `
+		if redis.call("hget", KEYS[1], "refresh_id") ~= ARGV[1] then
+			return 0
+		end
+		redis.call("hset", KEYS[1], "refresh_id", ARGV[2])
+		redis.call("pexpire", KEYS[1], ARGV[3])
+		redis.call("pexpire", KEYS[2], ARGV[3])
+		return 1
+	`
+	result, err := repo.Rdb.Eval(ctx, script, []string{sessionKey(session.SessionId), userSessionsKey(session.UserId)},
+		oldRefreshId, newRefreshId, ttl.Milliseconds()).Result()
+	if err != nil {
+		return false, err
+	}
+	return result.(int64) == 1, nil
+}
+
+func (repo *RedisRepository) DeleteSession(ctx context.Context, session *model.Session) error {
+	pipe := repo.Rdb.TxPipeline()
+	pipe.Del(ctx, sessionKey(session.SessionId))
+	pipe.SRem(ctx, userSessionsKey(session.UserId), session.SessionId)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// 注销用户的全部会话
+func (repo *RedisRepository) DeleteUserSessions(ctx context.Context, userId string) error {
+	userKey := userSessionsKey(userId)
+	sessionIds, err := repo.Rdb.SMembers(ctx, userKey).Result()
+	if err != nil {
+		return err
+	}
+	keys := []string{userKey}
+	for _, sessionId := range sessionIds {
+		keys = append(keys, sessionKey(sessionId))
+	}
+	return repo.Rdb.Del(ctx, keys...).Err()
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// 短信验证码校验结果
+type SmsCodeCheck int
+
+const (
+	SmsCodeMatched   SmsCodeCheck = iota //验证码正确，已作废
+	SmsCodeMismatch                      //验证码错误，仍可重试
+	SmsCodeExpired                       //验证码不存在或已过期
+	SmsCodeExhausted                     //错误次数达到上限，验证码已作废
+)
+
+func smsCodeKey(scene string, phone string) string {
+	return fmt.Sprintf("sms_code_%s_%s", scene, phone)
+}
+
+// 发送频率计数，subject 为手机号或IP
+func smsLimitKey(kind string, subject string) string {
+	return fmt.Sprintf("sms_limit_%s_%s", kind, subject)
+}
+
+// 保存验证码，覆盖同一用途未使用的旧验证码并重置错误次数
+func (repo *RedisRepository) SaveSmsCode(ctx context.Context, scene string, phone string, code string, ttl time.Duration) error {
+	key := smsCodeKey(scene, phone)
+	pipe := repo.Rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.HSet(ctx, key, map[string]interface{}{
+		"code":     code,
+		"attempts": 0,
+	})
+	pipe.Expire(ctx, key, ttl)
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// 校验验证码：正确时作废；错误时累计次数，达到 maxAttempts 次后作废
+func (repo *RedisRepository) CheckSmsCode(ctx context.Context, scene string, phone string, code string, maxAttempts int) (SmsCodeCheck, error) {
+	script := `
+		local saved = redis.call("hget", KEYS[1], "code")
+		if not saved then
+			return 2
+		end
+		if saved == ARGV[1] then
+			redis.call("del", KEYS[1])
+			return 0
+		end
+		local attempts = redis.call("hincrby", KEYS[1], "attempts", 1)
+		if attempts >= tonumber(ARGV[2]) then
+			redis.call("del", KEYS[1])
+			return 3
+		end
+		return 1
+	`
+	result, err := repo.Rdb.Eval(ctx, script, []string{smsCodeKey(scene, phone)}, code, maxAttempts).Result()
+	if err != nil {
+		return SmsCodeExpired, err
+	}
+	return SmsCodeCheck(result.(int64)), nil
+}
+
+// 固定窗口计数：返回窗口内的第几次，窗口从第一次计数开始
+func (repo *RedisRepository) IncrSmsLimit(ctx context.Context, kind string, subject string, window time.Duration) (int64, error) {
+	script := `
+		local count = redis.call("incr", KEYS[1])
+		if count == 1 then
+			redis.call("pexpire", KEYS[1], ARGV[1])
+		end
+		return count
+	`
+	result, err := repo.Rdb.Eval(ctx, script, []string{smsLimitKey(kind, subject)}, window.Milliseconds()).Result()
+	if err != nil {
+		return 0, err
+	}
+	return result.(int64), nil
+}
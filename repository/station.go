@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"12305/model"
+	"12305/query"
+	"12305/utils"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type StationRepository struct {
+	DB *gorm.DB
+}
+
+type StationRepoInterface interface {
+	List(ctx context.Context, req *query.ListQuery) ([]*model.Station, error)
+	Get(ctx context.Context, station *model.Station) (*model.Station, error)
+	GetByStationIds(ctx context.Context, stationIds []string) ([]*model.Station, error)
+	Exist(ctx context.Context, station model.Station) (bool, error)
+	CreateStation(ctx context.Context, station *model.Station) (*model.Station, error)
+	Edit(ctx context.Context, station *model.Station) (bool, error)
+	Delete(ctx context.Context, station *model.Station) (bool, error)
+}
+
+var _ StationRepoInterface = (*StationRepository)(nil)
+
+func (repo *StationRepository) List(ctx context.Context, req *query.ListQuery) ([]*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	limit, offset := utils.GetLimitAndOffset(req.Page, req.PageSize)
+	var stations []*model.Station
+	err := db.Order("station_code asc").Limit(limit).Offset(offset).Find(&stations).Error
+	if err != nil {
+		return nil, err
+	}
+	return stations, nil
+}
+
+func (repo *StationRepository) Get(ctx context.Context, station *model.Station) (*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Station := model.Station{}
+	err := db.Where("station_id=?", station.StationId).First(&Station).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Station, nil
+}
+
+func (repo *StationRepository) GetByStationIds(ctx context.Context, stationIds []string) ([]*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var stations []*model.Station
+	err := db.Where("station_id IN ?", stationIds).Find(&stations).Error
+	if err != nil {
+		return nil, err
+	}
+	return stations, nil
+}
+
+func (repo *StationRepository) Exist(ctx context.Context, station model.Station) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	if station.StationId == "" {
+		return false, nil
+	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.Station{}).Where("station_id=?", station.StationId).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (repo *StationRepository) CreateStation(ctx context.Context, station *model.Station) (*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	err := db.Create(station).Error
+	if err != nil {
+		return nil, err
+	}
+	return station, nil
+}
+
+func (repo *StationRepository) Edit(ctx context.Context, station *model.Station) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	err := db.Model(&model.Station{}).Where("station_id=?", station.StationId).Updates(map[string]interface{}{
+		"station_name": station.StationName,
+		"station_code": station.StationCode,
+		"city":         station.City,
+		"update_at":    time.Now(),
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (repo *StationRepository) Delete(ctx context.Context, station *model.Station) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	err := db.Where("station_id=?", station.StationId).Delete(&model.Station{}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
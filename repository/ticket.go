@@ -23,22 +23,36 @@ type TicketRepoInterface interface {
 	List(ctx context.Context, req *query.ListQuery) ([]*model.Ticket, error)
 	// GetTotal(req *query.ListQuery) (int64, error)
 	Get(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error)
-	GetByTicketTag(ctx context.Context, TicketTag enum.TicketTag) ([]*model.Ticket, error)
+	GetByTicketTag(ctx context.Context, TicketTag []enum.TicketTag) ([]*model.Ticket, error)
+	// 获取某车次某天开行的全部座位
+	GetByRun(ctx context.Context, ticketTag enum.TicketTag, runDate string) ([]*model.Ticket, error)
 	GetByTicketNumber(ctx context.Context, seat int) (*model.Ticket, error)
 	Exist(ctx context.Context, ticket model.Ticket) (bool, error)
+	// 车次是否有座位已售出或锁定区间
+	ExistSold(ctx context.Context, ticketTag enum.TicketTag) (bool, error)
 	CreateTicket(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error)
 	Edit(ctx context.Context, ticket *model.Ticket) (bool, error)
 	Delete(ctx context.Context, ticket *model.Ticket) (bool, error)
-	//开启事务
-	ExecuteTransaction(fn func(r *TicketRepository) error) error
+	//开启事务，事务内通过WithDB(tx)取得绑定事务的仓储
+	ExecuteTransaction(fn func(tx *gorm.DB) error) error
+	// 使用指定连接（通常为事务）的仓储
+	WithDB(db *gorm.DB) TicketRepoInterface
 	//乐观锁扣减库存
 	DecreaseStockWithOptimisticLock(ctx context.Context, ticketId string, version int64) (bool, error)
 	// 乐观锁更新票务状态
 	UpdateTicketStatusWithOptimisticLock(ctx context.Context, ticketId string, oldVersion int64, newStatus enum.TicketStatus) (bool, error)
 	// 带重试的乐观锁更新票务状态
 	UpdateTicketStatusWithOptimisticLockRetry(ctx context.Context, ticketId string, newStatus enum.TicketStatus, maxRetries int) (bool, error)
+	// 乐观锁占用座位区间
+	OccupySegmentWithOptimisticLock(ctx context.Context, ticket *model.Ticket, seg *model.Segment) (bool, error)
+	// 带重试的乐观锁占用座位区间
+	OccupySegmentWithOptimisticLockRetry(ctx context.Context, ticketId string, seg *model.Segment, maxRetries int) (*model.Ticket, error)
+	// 带重试的乐观锁释放座位区间，用于超时未支付、退票等
+	ReleaseSegmentWithOptimisticLockRetry(ctx context.Context, ticketId string, mask int64, maxRetries int) (*model.Ticket, error)
 }
 
+var _ TicketRepoInterface = (*TicketRepository)(nil)
+
 func (repo *TicketRepository) List(ctx context.Context, req *query.ListQuery) ([]*model.Ticket, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -82,8 +96,25 @@ func (repo *TicketRepository) GetByTicketTag(ctx context.Context, TicketTag []en
 	}
 	db := repo.DB
 	var tickets []*model.Ticket
-	for i := range TicketTag {
-		db.Where("TicketTag=?", TicketTag[i]).Find(&tickets)
+	if len(TicketTag) == 0 {
+		return tickets, nil
+	}
+	err := db.Where("ticket_tag IN ?", TicketTag).Find(&tickets).Error
+	if err != nil {
+		return nil, err
+	}
+	return tickets, nil
+}
+
+func (repo *TicketRepository) GetByRun(ctx context.Context, ticketTag enum.TicketTag, runDate string) ([]*model.Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var tickets []*model.Ticket
+	err := db.Where("ticket_tag=? AND run_date=?", ticketTag, runDate).Order("ticket_number asc").Find(&tickets).Error
+	if err != nil {
+		return nil, err
 	}
 	return tickets, nil
 }
@@ -105,15 +136,29 @@ func (repo *TicketRepository) Exist(ctx context.Context, ticket model.Ticket) (b
 	if err := ctx.Err(); err != nil {
 		return false, err
 	}
-	db := repo.DB
-	err := db.Where("ticket_id=?", ticket.TicketId).First(&ticket).Error
 	if ticket.TicketId == "" {
 		return false, nil
 	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.Ticket{}).Where("ticket_id=?", ticket.TicketId).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return count > 0, nil
+}
+
+func (repo *TicketRepository) ExistSold(ctx context.Context, ticketTag enum.TicketTag) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.Ticket{}).Where("ticket_tag=? AND sold_mask<>0", ticketTag).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
 }
 
 func (repo *TicketRepository) CreateTicket(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error) {
@@ -134,10 +179,18 @@ func (repo *TicketRepository) Edit(ctx context.Context, ticket *model.Ticket) (b
 	}
 	db := repo.DB
 	err := db.Model(&ticket).Where("ticket_id=?", ticket.TicketId).Updates(map[string]interface{}{
-		"ticket_Tag":   ticket.TicketTag,
-		"ticket_price": ticket.TicketPrice,
-		"status":       ticket.TicketStatus,
-		"update_time":  time.Now(),
+		"ticket_tag":    ticket.TicketTag,
+		"run_id":        ticket.RunId,
+		"run_date":      ticket.RunDate,
+		"ticket_number": ticket.TicketNumber,
+		"carriage_no":   ticket.CarriageNo,
+		"seat_class":    ticket.SeatClass,
+		"seat_row":      ticket.SeatRow,
+		"seat_letter":   ticket.SeatLetter,
+		"seat_position": ticket.SeatPosition,
+		"ticket_price":  ticket.TicketPrice,
+		"status":        ticket.TicketStatus,
+		"update_at":     time.Now(),
 	}).Error
 	if err != nil {
 		return false, err
@@ -157,20 +210,21 @@ func (repo *TicketRepository) Delete(ctx context.Context, ticket *model.Ticket)
 	return true, nil
 }
 
-func (repo *TicketRepository) ExecuteTransaction(fn func(r *TicketRepository) error) error {
-	return repo.DB.Transaction(func(tx *gorm.DB) error {
-		txTicketRepo := &TicketRepository{DB: tx}
-		return fn(txTicketRepo)
-	})
+func (repo *TicketRepository) ExecuteTransaction(fn func(tx *gorm.DB) error) error {
+	return repo.DB.Transaction(fn)
+}
+
+func (repo *TicketRepository) WithDB(db *gorm.DB) TicketRepoInterface {
+	return &TicketRepository{DB: db, Rdb: repo.Rdb}
 }
 
 func (repo *TicketRepository) DecreaseStockWithOptimisticLock(ctx context.Context, ticketId string, version int64) (bool, error) {
 	result := repo.DB.Model(&model.Ticket{}).
 		Where("ticket_id = ? AND version = ? AND status = ?", ticketId, version, enum.TicketStatusNormal).
 		Updates(map[string]interface{}{
-			"status":      enum.TicketStatusSold,
-			"version":     version + 1,
-			"update_time": time.Now(),
+			"status":    enum.TicketStatusSold,
+			"version":   version + 1,
+			"update_at": time.Now(),
 		})
 
 	if result.Error != nil {
@@ -195,9 +249,9 @@ func (repo *TicketRepository) UpdateTicketStatusWithOptimisticLock(ctx context.C
 	result := repo.DB.Model(&model.Ticket{}).
 		Where("ticket_id = ? AND version = ? AND status = ?", ticketId, oldVersion, enum.TicketStatusNormal).
 		Updates(map[string]interface{}{
-			"status":      newStatus,
-			"version":     oldVersion + 1,
-			"update_time": time.Now(),
+			"status":    newStatus,
+			"version":   oldVersion + 1,
+			"update_at": time.Now(),
 		})
 
 	if result.Error != nil {
@@ -267,3 +321,171 @@ func (repo *TicketRepository) UpdateTicketStatusWithOptimisticLockRetry(ctx cont
 
 	return false, nil
 }
+
+// OccupySegmentWithOptimisticLock 使用乐观锁占用座位的一个乘车区间，区间全部售出时座位状态置为已售
+func (repo *TicketRepository) OccupySegmentWithOptimisticLock(ctx context.Context, ticket *model.Ticket, seg *model.Segment) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	newMask := ticket.SoldMask | seg.Mask
+	newStatus := enum.TicketStatusNormal
+	if newMask&seg.FullMask == seg.FullMask {
+		newStatus = enum.TicketStatusSold
+	}
+
+	result := repo.DB.Model(&model.Ticket{}).
+		Where("ticket_id = ? AND version = ? AND sold_mask = ?", ticket.TicketId, ticket.Version, ticket.SoldMask).
+		Updates(map[string]interface{}{
+			"sold_mask": newMask,
+			"status":    newStatus,
+			"version":   ticket.Version + 1,
+			"update_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	ticket.SoldMask = newMask
+	ticket.TicketStatus = newStatus
+	ticket.Version++
+	return true, nil
+}
+
+// OccupySegmentWithOptimisticLockRetry 带重试的乐观锁区间占用，成功时返回更新后的票务信息
+func (repo *TicketRepository) OccupySegmentWithOptimisticLockRetry(ctx context.Context, ticketId string, seg *model.Segment, maxRetries int) (*model.Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if maxRetries <= 0 {
+		maxRetries = 3 // 默认重试3次
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		currentTicket, err := repo.Get(ctx, &model.Ticket{TicketId: ticketId})
+		if err != nil {
+			if i == maxRetries-1 {
+				return nil, fmt.Errorf("获取票务信息失败: %v", err)
+			}
+			continue
+		}
+
+		if currentTicket.TicketStatus == enum.TicketStatusDeleted {
+			return nil, errors.New("票已删除或不可用")
+		}
+		if !currentTicket.IsSegmentFree(seg) {
+			return nil, errors.New("该区间座位已售出")
+		}
+
+		success, err := repo.OccupySegmentWithOptimisticLock(ctx, currentTicket, seg)
+		if err != nil {
+			if i == maxRetries-1 {
+				return nil, err
+			}
+			continue
+		}
+
+		if success {
+			currentTicket.UpdateTime = time.Now()
+			return currentTicket, nil
+		}
+
+		if i < maxRetries-1 {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// ReleaseSegmentWithOptimisticLock 乐观锁释放区间，释放后座位至少有一个区间空闲，状态恢复为未售
+func (repo *TicketRepository) ReleaseSegmentWithOptimisticLock(ctx context.Context, ticket *model.Ticket, mask int64) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+
+	newMask := ticket.SoldMask &^ mask
+	newStatus := enum.TicketStatusNormal
+	if ticket.TicketStatus == enum.TicketStatusDeleted {
+		newStatus = enum.TicketStatusDeleted
+	}
+
+	result := repo.DB.Model(&model.Ticket{}).
+		Where("ticket_id = ? AND version = ? AND sold_mask = ?", ticket.TicketId, ticket.Version, ticket.SoldMask).
+		Updates(map[string]interface{}{
+			"sold_mask": newMask,
+			"status":    newStatus,
+			"version":   ticket.Version + 1,
+			"update_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return false, nil
+	}
+
+	ticket.SoldMask = newMask
+	ticket.TicketStatus = newStatus
+	ticket.Version++
+	return true, nil
+}
+
+// ReleaseSegmentWithOptimisticLockRetry 带重试的乐观锁区间释放，成功时返回更新后的票务信息
+func (repo *TicketRepository) ReleaseSegmentWithOptimisticLockRetry(ctx context.Context, ticketId string, mask int64, maxRetries int) (*model.Ticket, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	if maxRetries <= 0 {
+		maxRetries = 3 // 默认重试3次
+	}
+
+	for i := 0; i < maxRetries; i++ {
+		currentTicket, err := repo.Get(ctx, &model.Ticket{TicketId: ticketId})
+		if err != nil {
+			if i == maxRetries-1 {
+				return nil, fmt.Errorf("获取票务信息失败: %v", err)
+			}
+			continue
+		}
+
+		// 区间已经是空闲的，无需释放
+		if currentTicket.SoldMask&mask == 0 {
+			return currentTicket, nil
+		}
+
+		success, err := repo.ReleaseSegmentWithOptimisticLock(ctx, currentTicket, mask)
+		if err != nil {
+			if i == maxRetries-1 {
+				return nil, err
+			}
+			continue
+		}
+
+		if success {
+			currentTicket.UpdateTime = time.Now()
+			return currentTicket, nil
+		}
+
+		if i < maxRetries-1 {
+			select {
+			case <-time.After(10 * time.Millisecond):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/utils"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type TrainRepository struct {
+	DB *gorm.DB
+}
+
+type TrainRepoInterface interface {
+	List(ctx context.Context, req *query.ListQuery) ([]*model.Train, error)
+	ListActive(ctx context.Context) ([]*model.Train, error)
+	Get(ctx context.Context, train *model.Train) (*model.Train, error)
+	GetByTicketTag(ctx context.Context, ticketTag enum.TicketTag) (*model.Train, error)
+	Exist(ctx context.Context, train model.Train) (bool, error)
+	CreateTrain(ctx context.Context, train *model.Train) (*model.Train, error)
+	Edit(ctx context.Context, train *model.Train) (bool, error)
+	UpdateStatus(ctx context.Context, trainId string, status enum.TrainStatus) (bool, error)
+}
+
+var _ TrainRepoInterface = (*TrainRepository)(nil)
+
+func (repo *TrainRepository) List(ctx context.Context, req *query.ListQuery) ([]*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	limit, offset := utils.GetLimitAndOffset(req.Page, req.PageSize)
+	var trains []*model.Train
+	err := db.Order("ticket_tag asc").Limit(limit).Offset(offset).Find(&trains).Error
+	if err != nil {
+		return nil, err
+	}
+	return trains, nil
+}
+
+// 获取所有运营中的车次
+func (repo *TrainRepository) ListActive(ctx context.Context) ([]*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var trains []*model.Train
+	err := db.Where("train_status=?", enum.TrainStatusActive).Order("ticket_tag asc").Find(&trains).Error
+	if err != nil {
+		return nil, err
+	}
+	return trains, nil
+}
+
+func (repo *TrainRepository) Get(ctx context.Context, train *model.Train) (*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Train := model.Train{}
+	err := db.Where("train_id=?", train.TrainId).First(&Train).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Train, nil
+}
+
+func (repo *TrainRepository) GetByTicketTag(ctx context.Context, ticketTag enum.TicketTag) (*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Train := model.Train{}
+	err := db.Where("ticket_tag=?", ticketTag).First(&Train).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Train, nil
+}
+
+func (repo *TrainRepository) Exist(ctx context.Context, train model.Train) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.Train{}).Where("train_id=? OR ticket_tag=?", train.TrainId, train.TicketTag).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (repo *TrainRepository) CreateTrain(ctx context.Context, train *model.Train) (*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	err := db.Create(train).Error
+	if err != nil {
+		return nil, err
+	}
+	return train, nil
+}
+
+func (repo *TrainRepository) Edit(ctx context.Context, train *model.Train) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	err := db.Model(&model.Train{}).Where("train_id=?", train.TrainId).Updates(map[string]interface{}{
+		"train_type":         train.TrainType,
+		"operator":           train.Operator,
+		"carriage_count":     train.CarriageCount,
+		"seats_per_carriage": train.SeatsPerCarriage,
+		"base_price":         train.BasePrice,
+		"update_at":          time.Now(),
+	}).Error
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (repo *TrainRepository) UpdateStatus(ctx context.Context, trainId string, status enum.TrainStatus) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	result := db.Model(&model.Train{}).Where("train_id=?", trainId).Updates(map[string]interface{}{
+		"train_status": status,
+		"update_at":    time.Now(),
+	})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+type TrainRunRepository struct {
+	DB *gorm.DB
+}
+
+type TrainRunRepoInterface interface {
+	Get(ctx context.Context, run *model.TrainRun) (*model.TrainRun, error)
+	GetByTicketTagAndDate(ctx context.Context, ticketTag enum.TicketTag, runDate string) (*model.TrainRun, error)
+	ListFromDate(ctx context.Context, ticketTag enum.TicketTag, fromDate string) ([]*model.TrainRun, error)
+	Exist(ctx context.Context, ticketTag enum.TicketTag, runDate string) (bool, error)
+	// 在同一事务中创建开行计划及其座位库存
+	CreateRunWithTickets(ctx context.Context, run *model.TrainRun, tickets []*model.Ticket) error
+}
+
+var _ TrainRunRepoInterface = (*TrainRunRepository)(nil)
+
+// 车次+日期组成的缓存键，保证不同日期的开行计划互不干扰
+func TicketCacheKey(ticketTag string, runDate string) string {
+	return fmt.Sprintf("%s_%s", ticketTag, runDate)
+}
+
+func (repo *TrainRunRepository) Get(ctx context.Context, run *model.TrainRun) (*model.TrainRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	TrainRun := model.TrainRun{}
+	err := db.Where("run_id=?", run.RunId).First(&TrainRun).Error
+	if err != nil {
+		return nil, err
+	}
+	return &TrainRun, nil
+}
+
+func (repo *TrainRunRepository) GetByTicketTagAndDate(ctx context.Context, ticketTag enum.TicketTag, runDate string) (*model.TrainRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	TrainRun := model.TrainRun{}
+	err := db.Where("ticket_tag=? AND run_date=?", ticketTag, runDate).First(&TrainRun).Error
+	if err != nil {
+		return nil, err
+	}
+	return &TrainRun, nil
+}
+
+// 获取某车次从指定日期起的所有开行计划
+func (repo *TrainRunRepository) ListFromDate(ctx context.Context, ticketTag enum.TicketTag, fromDate string) ([]*model.TrainRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var runs []*model.TrainRun
+	err := db.Where("ticket_tag=? AND run_date>=?", ticketTag, fromDate).Order("run_date asc").Find(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (repo *TrainRunRepository) Exist(ctx context.Context, ticketTag enum.TicketTag, runDate string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.TrainRun{}).Where("ticket_tag=? AND run_date=?", ticketTag, runDate).Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (repo *TrainRunRepository) CreateRunWithTickets(ctx context.Context, run *model.TrainRun, tickets []*model.Ticket) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(run).Error; err != nil {
+			return err
+		}
+		if len(tickets) == 0 {
+			return nil
+		}
+		return tx.CreateInBatches(tickets, 200).Error
+	})
+}
@@ -1,6 +1,7 @@
 package repository
 
 import (
+	"12305/enum"
 	"12305/model"
 	"12305/query"
 	"12305/utils"
@@ -24,11 +25,22 @@ type UserRepoInterface interface {
 	Exist(ctx context.Context, user *model.User) (bool, error)
 	ExistByUserIdentity(ctx context.Context, userIdentity string) (bool, error)
 	ExistByUserPhone(ctx context.Context, phone string) (bool, error)
-	CreateUser(ctx context.Context, user *model.User) error
+	CreateUser(ctx context.Context, user *model.User) (*model.User, error)
 	Edit(ctx context.Context, user *model.User) (bool, error)
+	UpdatePassword(ctx context.Context, userId string, password string) error
+	// 更新实名信息与核验状态
+	UpdateIdentity(ctx context.Context, user *model.User) error
+	// 证件是否已被其他账号核验，excludeUserId用于排除自身
+	ExistVerifiedIdentity(ctx context.Context, idType enum.IdType, idNumber string, excludeUserId string) (bool, error)
 	Delete(ctx context.Context, user *model.User) (bool, error)
+	// 用户被授予的角色，不含默认的旅客角色
+	GetRoles(ctx context.Context, userId string) ([]enum.Role, error)
+	// 覆盖用户被授予的角色
+	SetRoles(ctx context.Context, userId string, roles []enum.Role) error
 }
 
+var _ UserRepoInterface = (*UserRepository)(nil)
+
 func (repo *UserRepository) List(ctx context.Context, req *query.ListQuery) (users []*model.User, err error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -36,7 +48,7 @@ func (repo *UserRepository) List(ctx context.Context, req *query.ListQuery) (use
 	fmt.Println(req)
 	db := repo.DB
 	limit, offset := utils.GetLimitAndOffset(req.Page, req.PageSize)
-	err = db.Order("id desc").Limit(limit).Offset(offset).Find(&users).Error
+	err = db.Order("create_at desc").Limit(limit).Offset(offset).Find(&users).Error
 	return users, err
 }
 
@@ -98,15 +110,12 @@ func (repo *UserRepository) Exist(ctx context.Context, user *model.User) (bool,
 		return false, err
 	}
 	db := repo.DB
-
-	err := db.Where("user_id=?", user.UserId).First(&user).Error
-	if user.UserId == "" {
-		return false, nil
-	}
+	var count int64
+	err := db.Model(&model.User{}).Where("user_id=?", user.UserId).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return count > 0, nil
 }
 
 func (repo *UserRepository) ExistByUserIdentity(ctx context.Context, userIdentity string) (bool, error) {
@@ -114,13 +123,12 @@ func (repo *UserRepository) ExistByUserIdentity(ctx context.Context, userIdentit
 		return false, err
 	}
 	db := repo.DB
-	var user model.User
-
-	err := db.Where("user_identity=?", userIdentity).First(&user).Error
+	var count int64
+	err := db.Model(&model.User{}).Where("user_identity=?", userIdentity).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return count > 0, nil
 }
 
 func (repo *UserRepository) ExistByUserPhone(ctx context.Context, phone string) (bool, error) {
@@ -128,12 +136,12 @@ func (repo *UserRepository) ExistByUserPhone(ctx context.Context, phone string)
 		return false, err
 	}
 	db := repo.DB
-	var user model.User
-	err := db.Where("user_phone=?", phone).First(&user).Error
+	var count int64
+	err := db.Model(&model.User{}).Where("user_phone=?", phone).Count(&count).Error
 	if err != nil {
 		return false, err
 	}
-	return true, nil
+	return count > 0, nil
 }
 
 func (repo *UserRepository) CreateUser(ctx context.Context, user *model.User) (*model.User, error) {
@@ -164,10 +172,10 @@ func (repo *UserRepository) Edit(ctx context.Context, user *model.User) (bool, e
 	}
 	db := repo.DB
 	err := db.Model(&user).Where("user_id=?", user.UserId).Updates(map[string]interface{}{
-		"user_name":   user.UserName,
-		"user_pwd":    user.UserPwd,
-		"user_phone":  user.UserPhone,
-		"update_time": time.Now(),
+		"user_name":  user.UserName,
+		"user_pwd":   user.UserPwd,
+		"user_phone": user.UserPhone,
+		"update_at":  time.Now(),
 	}).Error
 	if err != nil {
 		return false, err
@@ -175,14 +183,94 @@ func (repo *UserRepository) Edit(ctx context.Context, user *model.User) (bool, e
 	return true, nil
 }
 
+// 只更新密码，password 为密码哈希
+func (repo *UserRepository) UpdatePassword(ctx context.Context, userId string, password string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Model(&model.User{}).Where("user_id=?", userId).Updates(map[string]interface{}{
+		"user_pwd":  password,
+		"update_at": time.Now(),
+	}).Error
+}
+
+func (repo *UserRepository) UpdateIdentity(ctx context.Context, user *model.User) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Model(&model.User{}).Where("user_id=?", user.UserId).Updates(map[string]interface{}{
+		"user_name":     user.UserName,
+		"id_type":       user.IdType,
+		"user_identity": user.UserIdentity,
+		"verify_status": user.VerifyStatus,
+		"verify_at":     user.VerifyTime,
+		"update_at":     time.Now(),
+	}).Error
+}
+
+func (repo *UserRepository) ExistVerifiedIdentity(ctx context.Context, idType enum.IdType, idNumber string, excludeUserId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	var count int64
+	err := repo.DB.Model(&model.User{}).
+		Where("id_type=? AND user_identity=? AND verify_status=? AND user_id<>?", idType, idNumber, enum.VerifyStatusVerified, excludeUserId).
+		Count(&count).Error
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
 func (repo *UserRepository) Delete(ctx context.Context, user *model.User) (bool, error) {
 	if err := ctx.Err(); err != nil {
 		return false, err
 	}
-	db := repo.DB
-	err := db.Model(&user).Where("user_id=?", user.UserId).Delete(&user).Error
+	// 角色随用户一并删除
+	err := repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=?", user.UserId).Delete(&model.UserRole{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Where("user_id=?", user.UserId).Delete(&user).Error
+	})
 	if err != nil {
 		return false, err
 	}
 	return true, nil
 }
+
+func (repo *UserRepository) GetRoles(ctx context.Context, userId string) ([]enum.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var roles []enum.Role
+	err := repo.DB.Model(&model.UserRole{}).Where("user_id=?", userId).Order("role").Pluck("role", &roles).Error
+	if err != nil {
+		return nil, err
+	}
+	return roles, nil
+}
+
+func (repo *UserRepository) SetRoles(ctx context.Context, userId string, roles []enum.Role) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return repo.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id=?", userId).Delete(&model.UserRole{}).Error; err != nil {
+			return err
+		}
+		if len(roles) == 0 {
+			return nil
+		}
+		now := time.Now()
+		userRoles := make([]model.UserRole, 0, len(roles))
+		for _, role := range roles {
+			userRoles = append(userRoles, model.UserRole{
+				UserId:     userId,
+				Role:       role,
+				CreateTime: now,
+			})
+		}
+		return tx.Create(&userRoles).Error
+	})
+}
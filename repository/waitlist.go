@@ -0,0 +1,165 @@
+package repository
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type WaitlistRepository struct {
+	DB *gorm.DB
+}
+
+// 有候补需求的开行计划
+type WaitlistRun struct {
+	TicketTag enum.TicketTag
+	RunDate   string
+}
+
+type WaitlistRepoInterface interface {
+	Get(ctx context.Context, waitlist *model.Waitlist) (*model.Waitlist, error)
+	ListByUserId(ctx context.Context, userId string) ([]*model.Waitlist, error)
+	// 按登记顺序列出某开行计划的候补订单
+	ListWaiting(ctx context.Context, ticketTag enum.TicketTag, runDate string) ([]*model.Waitlist, error)
+	// 列出所有有候补需求的开行计划
+	ListWaitingRuns(ctx context.Context) ([]WaitlistRun, error)
+	// 排在该候补订单之前的同车次、同日期、同席别候补数
+	CountAhead(ctx context.Context, waitlist *model.Waitlist) (int64, error)
+	CreateWaitlist(ctx context.Context, waitlist *model.Waitlist) (*model.Waitlist, error)
+	// 仅当候补订单处于from中的某个状态时更新状态，orderId不为空时同时记录兑现的订单，返回是否更新成功
+	UpdateStatus(ctx context.Context, waitlistId string, from []enum.WaitlistStatus, to enum.WaitlistStatus, orderId string) (bool, error)
+	// 截止时间已过、仍待支付或候补中的候补订单
+	ListExpiring(ctx context.Context, deadline time.Time) ([]*model.Waitlist, error)
+	// 使用指定连接（通常为事务）的仓储
+	WithDB(db *gorm.DB) WaitlistRepoInterface
+}
+
+var _ WaitlistRepoInterface = (*WaitlistRepository)(nil)
+
+func (repo *WaitlistRepository) Get(ctx context.Context, waitlist *model.Waitlist) (*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	Waitlist := model.Waitlist{}
+	err := db.Preload("Passengers").Where("waitlist_id=?", waitlist.WaitlistId).First(&Waitlist).Error
+	if err != nil {
+		return nil, err
+	}
+	return &Waitlist, nil
+}
+
+func (repo *WaitlistRepository) ListByUserId(ctx context.Context, userId string) ([]*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var waitlists []*model.Waitlist
+	err := db.Preload("Passengers").Where("user_id=?", userId).Order("create_at desc").Find(&waitlists).Error
+	if err != nil {
+		return nil, err
+	}
+	return waitlists, nil
+}
+
+func (repo *WaitlistRepository) ListWaiting(ctx context.Context, ticketTag enum.TicketTag, runDate string) ([]*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var waitlists []*model.Waitlist
+	err := db.Preload("Passengers").
+		Where("ticket_tag=? AND run_date=? AND status=?", ticketTag, runDate, enum.WaitlistStatusWaiting).
+		Order("create_at asc").Order("waitlist_id asc").
+		Find(&waitlists).Error
+	if err != nil {
+		return nil, err
+	}
+	return waitlists, nil
+}
+
+func (repo *WaitlistRepository) ListWaitingRuns(ctx context.Context) ([]WaitlistRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var runs []WaitlistRun
+	err := db.Model(&model.Waitlist{}).
+		Select("DISTINCT ticket_tag, run_date").
+		Where("status=?", enum.WaitlistStatusWaiting).
+		Scan(&runs).Error
+	if err != nil {
+		return nil, err
+	}
+	return runs, nil
+}
+
+func (repo *WaitlistRepository) CountAhead(ctx context.Context, waitlist *model.Waitlist) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	db := repo.DB
+	var count int64
+	err := db.Model(&model.Waitlist{}).
+		Where("ticket_tag=? AND run_date=? AND seat_class=? AND status=?", waitlist.TicketTag, waitlist.RunDate, waitlist.SeatClass, enum.WaitlistStatusWaiting).
+		Where("(create_at<? OR (create_at=? AND waitlist_id<?))", waitlist.CreateTime, waitlist.CreateTime, waitlist.WaitlistId).
+		Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (repo *WaitlistRepository) CreateWaitlist(ctx context.Context, waitlist *model.Waitlist) (*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	// 候补乘车人随候补订单一起写入
+	if err := db.Create(waitlist).Error; err != nil {
+		return nil, err
+	}
+	return waitlist, nil
+}
+
+func (repo *WaitlistRepository) UpdateStatus(ctx context.Context, waitlistId string, from []enum.WaitlistStatus, to enum.WaitlistStatus, orderId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	db := repo.DB
+	updates := map[string]interface{}{
+		"status":    to,
+		"update_at": time.Now(),
+	}
+	if orderId != "" {
+		updates["order_id"] = orderId
+	}
+	result := db.Model(&model.Waitlist{}).
+		Where("waitlist_id=? AND status IN ?", waitlistId, from).
+		Updates(updates)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+func (repo *WaitlistRepository) ListExpiring(ctx context.Context, deadline time.Time) ([]*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	db := repo.DB
+	var waitlists []*model.Waitlist
+	err := db.Where("status IN ? AND deadline<?", []enum.WaitlistStatus{enum.WaitlistStatusPending, enum.WaitlistStatusWaiting}, deadline).
+		Find(&waitlists).Error
+	if err != nil {
+		return nil, err
+	}
+	return waitlists, nil
+}
+
+func (repo *WaitlistRepository) WithDB(db *gorm.DB) WaitlistRepoInterface {
+	return &WaitlistRepository{DB: db}
+}
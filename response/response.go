@@ -6,15 +6,17 @@ import (
 )
 
 type User struct {
-	ID           string    `json:"id"`
-	Key          string    `json:"key"`
-	UserId       string    `json:"user_id"`
-	UserIdentity string    `json:"user_identity"`
-	UserPhone    string    `json:"user_phone"`
-	UserName     string    `json:"user_name"`
-	UserPwd      string    `json:"user_pwd"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
+	ID           string            `json:"id"`
+	Key          string            `json:"key"`
+	UserId       string            `json:"user_id"`
+	UserIdentity string            `json:"user_identity"`
+	IdType       enum.IdType       `json:"id_type"`
+	VerifyStatus enum.VerifyStatus `json:"verify_status"` //实名核验状态
+	UserPhone    string            `json:"user_phone"`
+	UserName     string            `json:"user_name"`
+	Roles        []string          `json:"roles,omitempty"` //角色英文名
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
 }
 
 type Ticket struct {
@@ -23,6 +25,11 @@ type Ticket struct {
 	TicketId     string            `json:"ticket_id"`
 	TicketNumber int               `json:"ticket_number"`
 	TicketTag    string            `json:"ticket_tag"`
+	RunDate      string            `json:"run_date"`
+	CarriageNo   int               `json:"carriage_no"`
+	SeatClass    enum.SeatClass    `json:"seat_class"`
+	SeatRow      int               `json:"seat_row"`
+	SeatLetter   string            `json:"seat_letter"`
 	TicketPrice  float64           `json:"ticket_price"`
 	TicketStatus enum.TicketStatus `json:"ticket_status"`
 	CreateTime   time.Time         `json:"create_time"`
@@ -30,18 +37,119 @@ type Ticket struct {
 	DeleteTime   time.Time         `json:"delete_time"`
 }
 
+// 座位图中的一个座位
+type SeatMapSeat struct {
+	TicketId     string            `json:"ticket_id"`
+	TicketNumber int               `json:"ticket_number"`
+	SeatRow      int               `json:"seat_row"`
+	SeatLetter   string            `json:"seat_letter"`
+	SeatPosition enum.SeatPosition `json:"seat_position"`
+	TicketPrice  float64           `json:"ticket_price"`
+	Available    bool              `json:"available"` //在查询区间内是否可售
+}
+
+// 座位图中的一节车厢
+type SeatMapCarriage struct {
+	CarriageNo    int            `json:"carriage_no"`
+	SeatClass     enum.SeatClass `json:"seat_class"`
+	SeatClassName string         `json:"seat_class_name"`
+	Available     int            `json:"available"` //可售座位数
+	Seats         []SeatMapSeat  `json:"seats"`
+}
+
 type Order struct {
 	ID          string           `json:"id"`
 	Key         string           `json:"key"`
 	OrderId     string           `json:"order_id"`
-	User        User             `json:"user"`
-	Ticket      Ticket           `json:"ticket"`
+	UserId      string           `json:"user_id"`
+	User        *User            `json:"user,omitempty"` //下单账号，仅订单详情返回
+	Items       []OrderItem      `json:"items"`
+	Changes     []OrderChange    `json:"changes"`
+	Events      []OrderEvent     `json:"events"`
+	Version     int64            `json:"version"`
 	TotalPrice  float64          `json:"total_price"`
 	OrderStatus enum.OrderStatus `json:"order_status"`
+	ExpireAt    time.Time        `json:"expire_at"`
 	CreatedAt   time.Time        `json:"created_at"`
 	UpdatedAt   time.Time        `json:"updated_at"`
 }
 
+// 订单明细，即一名乘车人分配到的座位
+type OrderItem struct {
+	OrderItemId   string             `json:"order_item_id"`
+	TicketId      string             `json:"ticket_id"`
+	PassengerId   string             `json:"passenger_id"`
+	PassengerName string             `json:"passenger_name"`
+	PassengerType enum.PassengerType `json:"passenger_type"`
+	TicketTag     string             `json:"ticket_tag"`
+	RunDate       string             `json:"run_date"`
+	CarriageNo    int                `json:"carriage_no"`
+	SeatClass     enum.SeatClass     `json:"seat_class"`
+	SeatRow       int                `json:"seat_row"`
+	SeatLetter    string             `json:"seat_letter"`
+	FromStation   string             `json:"from_station"`
+	ToStation     string             `json:"to_station"`
+	DepartureTime time.Time          `json:"departure_time"`
+	ArrivalTime   time.Time          `json:"arrival_time"`
+	UnitPrice     float64            `json:"unit_price"`
+	ItemPrice     float64            `json:"item_price"`
+	ItemStatus    enum.TicketStatus  `json:"item_status"`
+	Ticket        *Ticket            `json:"ticket,omitempty"` //座位当前信息，仅订单详情返回
+}
+
+// 改签记录
+type OrderChange struct {
+	ChangeNo       string            `json:"change_no"`
+	OrderItemId    string            `json:"order_item_id"`
+	PassengerName  string            `json:"passenger_name"`
+	OldTicketTag   string            `json:"old_ticket_tag"`
+	OldRunDate     string            `json:"old_run_date"`
+	OldFromStation string            `json:"old_from_station"`
+	OldToStation   string            `json:"old_to_station"`
+	NewTicketTag   string            `json:"new_ticket_tag"`
+	NewRunDate     string            `json:"new_run_date"`
+	NewFromStation string            `json:"new_from_station"`
+	NewToStation   string            `json:"new_to_station"`
+	PriceDiff      float64           `json:"price_diff"`
+	ChangeStatus   enum.ChangeStatus `json:"change_status"`
+	PaymentNo      string            `json:"payment_no"`
+	ChangedAt      time.Time         `json:"changed_at"`
+}
+
+// 订单分页结果，next_cursor为空表示没有更多
+type OrderPage struct {
+	Orders     []Order `json:"orders"`
+	NextCursor string  `json:"next_cursor"`
+}
+
+// 订单事件，订单时间线中的一条
+type OrderEvent struct {
+	EventType  string           `json:"event_type"`
+	FromStatus enum.OrderStatus `json:"from_status"`
+	ToStatus   enum.OrderStatus `json:"to_status"`
+	Version    int64            `json:"version"`
+	Remark     string           `json:"remark"`
+	CreatedAt  time.Time        `json:"created_at"`
+}
+
+// 退票结果，订单可能有多笔支付（含改签补差价），按支付流水分别原路退款
+type OrderRefund struct {
+	OrderId      string   `json:"order_id"`
+	RefundFee    float64  `json:"refund_fee"`
+	RefundAmount float64  `json:"refund_amount"`
+	RefundNos    []string `json:"refund_nos"`
+}
+
+// 登录或刷新令牌的结果，访问令牌放在请求头 Authorization: Bearer <access_token> 中
+type Token struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`         //访问令牌有效期(秒)
+	RefreshExpiresIn int64  `json:"refresh_expires_in"` //刷新令牌有效期(秒)
+	User             *User  `json:"user,omitempty"`
+}
+
 type Entity struct {
 	Code      int         `json:"code"`
 	Msg       string      `json:"msg"`
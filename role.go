@@ -0,0 +1,82 @@
+package main
+
+import (
+	"12305/db"
+	"12305/enum"
+	"12305/repository"
+	"12305/service"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+const roleUsage = `用法: 12305 role <list|grant|revoke> <手机号> [角色]
+  list   <手机号>         查看用户的角色
+  grant  <手机号> <角色>  授予角色
+  revoke <手机号> <角色>  撤销角色
+角色: station_agent 车站售票员, operator 运营人员, admin 管理员`
+
+// 用户角色管理命令，用于授予第一个管理员，返回进程退出码
+func runRole(args []string) int {
+	if len(args) < 2 {
+		fmt.Println(roleUsage)
+		return 2
+	}
+	ctx := context.Background()
+	userService := &service.UserService{UserRepo: &repository.UserRepository{DB: db.DB}}
+	user, err := userService.GetByUserPhone(ctx, args[1])
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Println("用户不存在:", args[1])
+			return 1
+		}
+		fmt.Println(err)
+		return 1
+	}
+	roles, err := userService.GetRoles(ctx, user.UserId)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	switch args[0] {
+	case "list":
+	case "grant", "revoke":
+		if len(args) < 3 {
+			fmt.Println(roleUsage)
+			return 2
+		}
+		role, ok := enum.ParseRole(args[2])
+		if !ok || role == enum.RolePassenger {
+			fmt.Println("无效的角色:", args[2])
+			return 2
+		}
+		next := make([]enum.Role, 0, len(roles)+1)
+		for _, r := range roles {
+			if r != role {
+				next = append(next, r)
+			}
+		}
+		if args[0] == "grant" {
+			next = append(next, role)
+		}
+		roles, err = userService.SetRoles(ctx, user.UserId, next)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	default:
+		fmt.Println(roleUsage)
+		return 2
+	}
+
+	names := make([]string, 0, len(roles))
+	for _, r := range roles {
+		names = append(names, r.Name())
+	}
+	fmt.Printf("%s\t%s\t%s\n", user.UserPhone, user.UserId, strings.Join(names, ","))
+	return 0
+}
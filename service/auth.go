@@ -0,0 +1,283 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/repository"
+	"12305/response"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
+
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 7 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("令牌无效或已过期")
+	ErrTokenRevoked = errors.New("登录已失效，请重新登录")
+)
+
+// 令牌载荷：访问令牌与刷新令牌共用，通过 TokenType 区分；ID 为令牌ID
+type TokenClaims struct {
+	UserId    string `json:"uid"`
+	SessionId string `json:"sid"`
+	TokenType string `json:"typ"`
+	jwt.RegisteredClaims
+}
+
+// 已登录的请求主体，由访问令牌解析得到
+type Principal struct {
+	UserId    string
+	SessionId string
+	Roles     []enum.Role
+	User      *model.User
+}
+
+func (p *Principal) HasRole(role enum.Role) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// 任一角色拥有该权限即可
+func (p *Principal) Can(permission enum.Permission) bool {
+	for _, r := range p.Roles {
+		if r.HasPermission(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// 登录会话与令牌签发：访问令牌短期有效，刷新令牌每次使用后轮换；
+// 会话保存在 Redis 中，退出登录或修改密码时删除会话，已签发的令牌随之失效
+type AuthService struct {
+	UserRepo  repository.UserRepoInterface
+	RedisRepo repository.RedisRepoInterface
+	// HS256 签名密钥
+	Secret []byte
+	// 令牌有效期，为空时使用默认值
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+}
+
+type AuthSrv interface {
+	// 为登录成功的用户创建会话并签发令牌
+	IssueTokens(ctx context.Context, user *model.User) (*response.Token, error)
+	// 使用刷新令牌换取新的访问令牌和刷新令牌，旧刷新令牌作废
+	Refresh(ctx context.Context, refreshToken string) (*response.Token, error)
+	// 校验访问令牌，会话已注销时返回 ErrTokenRevoked
+	ParseAccessToken(ctx context.Context, accessToken string) (*TokenClaims, error)
+	// 校验访问令牌并加载用户，用户已删除时返回 ErrTokenRevoked
+	Authenticate(ctx context.Context, accessToken string) (*Principal, error)
+	// 注销令牌所属的会话，token 可以是访问令牌或刷新令牌
+	Logout(ctx context.Context, token string) error
+	// 注销用户的全部会话
+	RevokeUserSessions(ctx context.Context, userId string) error
+}
+
+var _ AuthSrv = (*AuthService)(nil)
+
+func (s *AuthService) accessTokenTTL() time.Duration {
+	if s.AccessTokenTTL <= 0 {
+		return defaultAccessTokenTTL
+	}
+	return s.AccessTokenTTL
+}
+
+func (s *AuthService) refreshTokenTTL() time.Duration {
+	if s.RefreshTokenTTL <= 0 {
+		return defaultRefreshTokenTTL
+	}
+	return s.RefreshTokenTTL
+}
+
+func (s *AuthService) IssueTokens(ctx context.Context, user *model.User) (*response.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	session := &model.Session{
+		SessionId:  utils.GetUUID(),
+		UserId:     user.UserId,
+		RefreshId:  utils.GetUUID(),
+		CreateTime: time.Now(),
+	}
+	if err := s.RedisRepo.SaveSession(ctx, session, s.refreshTokenTTL()); err != nil {
+		return nil, fmt.Errorf("保存登录会话失败: %v", err)
+	}
+	return s.signTokens(session)
+}
+
+func (s *AuthService) Refresh(ctx context.Context, refreshToken string) (*response.Token, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	claims, err := s.parse(refreshToken, TokenTypeRefresh)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.RedisRepo.GetSession(ctx, claims.SessionId)
+	if err != nil {
+		return nil, fmt.Errorf("查询登录会话失败: %v", err)
+	}
+	if session == nil || session.UserId != claims.UserId {
+		return nil, ErrTokenRevoked
+	}
+
+	newRefreshId := utils.GetUUID()
+	rotated, err := s.RedisRepo.RotateSessionRefresh(ctx, session, claims.ID, newRefreshId, s.refreshTokenTTL())
+	if err != nil {
+		return nil, fmt.Errorf("更新登录会话失败: %v", err)
+	}
+	if !rotated {
+		// 已轮换过的刷新令牌被再次使用，令牌可能已泄露，注销整个会话
+		fmt.Printf("会话 %s 的刷新令牌被重复使用，注销会话\n", session.SessionId)
+		if err := s.RedisRepo.DeleteSession(ctx, session); err != nil {
+			fmt.Printf("注销会话失败: %v\n", err)
+		}
+		return nil, ErrTokenRevoked
+	}
+	session.RefreshId = newRefreshId
+	return s.signTokens(session)
+}
+
+func (s *AuthService) ParseAccessToken(ctx context.Context, accessToken string) (*TokenClaims, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	claims, err := s.parse(accessToken, TokenTypeAccess)
+	if err != nil {
+		return nil, err
+	}
+	session, err := s.RedisRepo.GetSession(ctx, claims.SessionId)
+	if err != nil {
+		return nil, fmt.Errorf("查询登录会话失败: %v", err)
+	}
+	if session == nil || session.UserId != claims.UserId {
+		return nil, ErrTokenRevoked
+	}
+	return claims, nil
+}
+
+func (s *AuthService) Authenticate(ctx context.Context, accessToken string) (*Principal, error) {
+	claims, err := s.ParseAccessToken(ctx, accessToken)
+	if err != nil {
+		return nil, err
+	}
+	user, err := s.UserRepo.Get(ctx, &model.User{UserId: claims.UserId})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTokenRevoked
+		}
+		return nil, fmt.Errorf("查询用户失败: %v", err)
+	}
+	// 角色每次请求重新加载，撤销授权后立即生效
+	granted, err := s.UserRepo.GetRoles(ctx, user.UserId)
+	if err != nil {
+		return nil, fmt.Errorf("查询用户角色失败: %v", err)
+	}
+	return &Principal{
+		UserId:    user.UserId,
+		SessionId: claims.SessionId,
+		Roles:     append([]enum.Role{enum.RolePassenger}, granted...),
+		User:      user,
+	}, nil
+}
+
+func (s *AuthService) Logout(ctx context.Context, token string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	claims, err := s.parse(token, "")
+	if err != nil {
+		return err
+	}
+	return s.RedisRepo.DeleteSession(ctx, &model.Session{
+		SessionId: claims.SessionId,
+		UserId:    claims.UserId,
+	})
+}
+
+func (s *AuthService) RevokeUserSessions(ctx context.Context, userId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return s.RedisRepo.DeleteUserSessions(ctx, userId)
+}
+
+// 签发会话的访问令牌与当前刷新令牌
+func (s *AuthService) signTokens(session *model.Session) (*response.Token, error) {
+	now := time.Now()
+	accessToken, err := s.sign(session, TokenTypeAccess, utils.GetUUID(), now, s.accessTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+	refreshToken, err := s.sign(session, TokenTypeRefresh, session.RefreshId, now, s.refreshTokenTTL())
+	if err != nil {
+		return nil, err
+	}
+	return &response.Token{
+		AccessToken:      accessToken,
+		RefreshToken:     refreshToken,
+		TokenType:        "Bearer",
+		ExpiresIn:        int64(s.accessTokenTTL().Seconds()),
+		RefreshExpiresIn: int64(s.refreshTokenTTL().Seconds()),
+	}, nil
+}
+
+func (s *AuthService) sign(session *model.Session, tokenType string, tokenId string, now time.Time, ttl time.Duration) (string, error) {
+	claims := TokenClaims{
+		UserId:    session.UserId,
+		SessionId: session.SessionId,
+		TokenType: tokenType,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Subject:   session.UserId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.Secret)
+	if err != nil {
+		return "", fmt.Errorf("签发令牌失败: %v", err)
+	}
+	return token, nil
+}
+
+// 校验签名与有效期，tokenType 为空时不限令牌类型
+func (s *AuthService) parse(token string, tokenType string) (*TokenClaims, error) {
+	if token == "" {
+		return nil, ErrInvalidToken
+	}
+	claims := &TokenClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("不支持的签名算法: %v", t.Header["alg"])
+		}
+		return s.Secret, nil
+	})
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.SessionId == "" || claims.UserId == "" {
+		return nil, ErrInvalidToken
+	}
+	if tokenType != "" && claims.TokenType != tokenType {
+		return nil, ErrInvalidToken
+	}
+	return claims, nil
+}
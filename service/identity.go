@@ -0,0 +1,36 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/identity"
+	"context"
+	"fmt"
+	"time"
+)
+
+// 实名核验结果
+type verification struct {
+	Status enum.VerifyStatus
+	Time   *time.Time //核验通过时间
+	Reason string     //核验未通过的原因
+}
+
+// 通过核验渠道核对姓名与证件号码，核验服务不可用时返回 error；verifier 为空时使用离线模拟核验
+func verifyIdentity(ctx context.Context, verifier identity.Verifier, name string, idType enum.IdType, idNumber string) (*verification, error) {
+	if verifier == nil {
+		verifier = identity.NewFakeVerifier()
+	}
+	result, err := verifier.Verify(ctx, identity.VerifyRequest{
+		Name:     name,
+		IdType:   idType,
+		IdNumber: idNumber,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("实名核验服务暂不可用: %v", err)
+	}
+	if !result.Matched {
+		return &verification{Status: enum.VerifyStatusFailed, Reason: result.Reason}, nil
+	}
+	now := time.Now()
+	return &verification{Status: enum.VerifyStatusVerified, Time: &now}, nil
+}
@@ -7,17 +7,23 @@ import (
 	"12305/repository"
 	"12305/utils"
 	"context"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type OrderService struct {
-	OrderRepo repository.OrderRepository
+	OrderRepo repository.OrderRepoInterface
 }
 
 type OrderSrv interface {
-	List(ctx context.Context, req *query.ListQuery) ([]*model.Order, error)
-	GetTotal(ctx context.Context, req *query.ListQuery) (int64, error)
+	// 当前用户的订单列表，返回订单、符合条件的总数及下一页游标（没有更多时为空）
+	List(ctx context.Context, userId string, req *query.OrderListQuery) ([]*model.Order, int64, string, error)
+	// 后台跨用户搜索订单
+	Search(ctx context.Context, req *query.OrderSearchQuery) ([]*model.Order, int64, string, error)
 	Get(ctx context.Context, order *model.Order) (*model.Order, error)
 	Exist(ctx context.Context, order *model.Order) (bool, error)
 	Create(ctx context.Context, order *model.Order) (*model.Order, error)
@@ -26,14 +32,123 @@ type OrderSrv interface {
 	// 处理消息队列相关业务逻辑
 	ProcessOrderFromMQ(ctx context.Context, order *model.Order) error
 	ValidateOrderFromMQ(ctx context.Context, order *model.Order) error
+	// 订单事件时间线
+	ListEvents(ctx context.Context, orderId string) ([]*model.OrderEvent, error)
+	// 定时将全部乘车人已到站的已支付订单置为已出行
+	StartTravelCompleteJob(ctx context.Context, interval time.Duration)
 }
 
-func (s *OrderService) List(ctx context.Context, req *query.ListQuery) ([]*model.Order, error) {
-	return s.OrderRepo.List(ctx, req)
+var _ OrderSrv = (*OrderService)(nil)
+
+const (
+	// 每次扫描最多处理的已出行订单数
+	travelCompleteBatch = 100
+	// 订单列表默认及最大每页条数
+	defaultOrderPageSize = 10
+	maxOrderPageSize     = 50
+)
+
+func (s *OrderService) List(ctx context.Context, userId string, req *query.OrderListQuery) ([]*model.Order, int64, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, "", err
+	}
+	if userId == "" {
+		return nil, 0, "", errors.New("用户ID不能为空")
+	}
+	filter := &query.OrderFilter{
+		UserId:         userId,
+		ExcludeDeleted: true,
+		TicketTag:      req.TicketTag,
+		Passenger:      req.Passenger,
+	}
+	if req.Status != nil {
+		filter.Statuses = []int{*req.Status}
+	}
+	if req.TravelFrom != "" {
+		from, err := time.ParseInLocation(utils.DateLayout, req.TravelFrom, time.Local)
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("乘车日期格式错误: %s", req.TravelFrom)
+		}
+		filter.TravelFrom = from
+	}
+	if req.TravelTo != "" {
+		to, err := time.ParseInLocation(utils.DateLayout, req.TravelTo, time.Local)
+		if err != nil {
+			return nil, 0, "", fmt.Errorf("乘车日期格式错误: %s", req.TravelTo)
+		}
+		filter.TravelTo = to.AddDate(0, 0, 1)
+	}
+	return s.page(ctx, filter, req.Cursor, req.PageSize)
+}
+
+func (s *OrderService) Search(ctx context.Context, req *query.OrderSearchQuery) ([]*model.Order, int64, string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, "", err
+	}
+	if req.OrderId == "" && req.Phone == "" && req.IdNumber == "" {
+		return nil, 0, "", errors.New("订单号、手机号、证件号码至少填写一项")
+	}
+	filter := &query.OrderFilter{
+		OrderId:  req.OrderId,
+		Phone:    req.Phone,
+		IdNumber: req.IdNumber,
+	}
+	return s.page(ctx, filter, req.Cursor, req.PageSize)
+}
+
+// 按游标分页查询，多取一条判断是否还有下一页
+func (s *OrderService) page(ctx context.Context, filter *query.OrderFilter, cursor string, pageSize int) ([]*model.Order, int64, string, error) {
+	if pageSize <= 0 {
+		pageSize = defaultOrderPageSize
+	}
+	if pageSize > maxOrderPageSize {
+		pageSize = maxOrderPageSize
+	}
+	if cursor != "" {
+		cursorTime, cursorId, err := decodeOrderCursor(cursor)
+		if err != nil {
+			return nil, 0, "", err
+		}
+		filter.CursorTime, filter.CursorId = cursorTime, cursorId
+	}
+	filter.Limit = pageSize + 1
+
+	orders, err := s.OrderRepo.List(ctx, filter)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("查询订单失败: %v", err)
+	}
+	total, err := s.OrderRepo.GetTotal(ctx, filter)
+	if err != nil {
+		return nil, 0, "", fmt.Errorf("统计订单失败: %v", err)
+	}
+	next := ""
+	if len(orders) > pageSize {
+		orders = orders[:pageSize]
+		next = encodeOrderCursor(orders[pageSize-1])
+	}
+	return orders, total, next, nil
 }
 
-func (s *OrderService) GetTotal(ctx context.Context, req *query.ListQuery) (int64, error) {
-	return s.OrderRepo.GetTotal(ctx, req)
+// 游标为上一页最后一个订单的下单时间和订单ID
+func encodeOrderCursor(order *model.Order) string {
+	raw := fmt.Sprintf("%d|%s", order.CreateTime.UnixNano(), order.OrderId)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeOrderCursor(cursor string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, "", errors.New("无效的分页游标")
+	}
+	parts := strings.SplitN(string(raw), "|", 2)
+	if len(parts) != 2 {
+		return time.Time{}, "", errors.New("无效的分页游标")
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", errors.New("无效的分页游标")
+	}
+	return time.Unix(0, nanos), parts[1], nil
 }
 
 func (s *OrderService) Get(ctx context.Context, order *model.Order) (*model.Order, error) {
@@ -82,16 +197,14 @@ func (s *OrderService) Edit(ctx context.Context, order *model.Order) (bool, erro
 	return s.OrderRepo.Edit(ctx, order)
 }
 
+// 删除订单：只有已出行、已退、已取消的订单可以删除，保留订单及事件记录
 func (s *OrderService) Delete(ctx context.Context, order *model.Order) (bool, error) {
-	exist, err := s.OrderRepo.Exist(ctx, order)
+	current, err := s.OrderRepo.Get(ctx, *order)
 	if err != nil {
-		return false, err
-	}
-	if !exist {
 		fmt.Println("订单不存在")
-		return false, nil
+		return false, err
 	}
-	return s.OrderRepo.Delete(ctx, order)
+	return s.OrderRepo.TransitionWithOptimisticLock(ctx, current, enum.OrderStatusDeleted, enum.TicketStatusDeleted, enum.OrderEventDeleted, "")
 }
 
 // ProcessOrderFromMQ 处理来自消息队列的订单（包含业务逻辑验证）
@@ -118,9 +231,9 @@ func (s *OrderService) ValidateOrderFromMQ(ctx context.Context, order *model.Ord
 		return fmt.Errorf("订单ID不能为空")
 	}
 
-	// 验证订单状态
-	if order.OrderStatus == 0 {
-		order.OrderStatus = enum.OrderStatusNormal
+	// 验证订单状态：新订单以未支付状态落库，之后只能通过状态机变更
+	if order.OrderStatus != enum.OrderStatusNormal {
+		return fmt.Errorf("新订单状态必须为%s，实际为%s", enum.OrderStatusNormal, order.OrderStatus)
 	}
 
 	// 验证价格
@@ -129,14 +242,54 @@ func (s *OrderService) ValidateOrderFromMQ(ctx context.Context, order *model.Ord
 	}
 
 	// 验证用户信息
-	if order.User.UserId == "" {
+	if order.UserId == "" {
 		return fmt.Errorf("用户ID不能为空")
 	}
 
-	// 验证票务信息
-	if order.Ticket.TicketId == "" {
-		return fmt.Errorf("票务ID不能为空")
+	// 验证订单明细
+	if len(order.Items) == 0 {
+		return fmt.Errorf("订单明细不能为空")
+	}
+	for _, item := range order.Items {
+		if item.TicketId == "" {
+			return fmt.Errorf("票务ID不能为空")
+		}
 	}
 
 	return nil
 }
+
+func (s *OrderService) ListEvents(ctx context.Context, orderId string) ([]*model.OrderEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.OrderRepo.ListEvents(ctx, orderId)
+}
+
+func (s *OrderService) StartTravelCompleteJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 10 * time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("已出行订单处理任务已停止")
+			return
+		case <-ticker.C:
+		}
+
+		orderIds, err := s.OrderRepo.ListPaidArrivedBefore(ctx, time.Now(), travelCompleteBatch)
+		if err != nil {
+			fmt.Printf("扫描已出行订单失败: %v\n", err)
+			continue
+		}
+		for _, orderId := range orderIds {
+			if _, err := s.OrderRepo.TransitionWithOptimisticLockRetry(ctx, orderId, enum.OrderStatusPaid, enum.OrderStatusUsed, enum.TicketStatusUsed, enum.OrderEventUsed, "", 3); err != nil {
+				fmt.Printf("订单 %s 置为已出行失败: %v\n", orderId, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/identity"
+	"12305/model"
+	"12305/repository"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 每个账号最多保存的常用乘车人数
+const maxPassengersPerUser = 15
+
+type PassengerService struct {
+	PassengerRepo repository.PassengerRepoInterface
+	Verifier      identity.Verifier //实名核验渠道
+}
+
+type PassengerSrv interface {
+	List(ctx context.Context, userId string) ([]*model.Passenger, error)
+	Create(ctx context.Context, userId string, passenger *model.Passenger) (*model.Passenger, error)
+	// 修改、删除只允许操作本账号下的乘车人
+	Edit(ctx context.Context, userId string, passenger *model.Passenger) (bool, error)
+	Delete(ctx context.Context, userId string, passengerId string) (bool, error)
+	// 重新核验乘车人，用于核验服务不可用时未完成的核验
+	Verify(ctx context.Context, userId string, passengerId string) (*model.Passenger, error)
+}
+
+var _ PassengerSrv = (*PassengerService)(nil)
+
+func (s *PassengerService) List(ctx context.Context, userId string) ([]*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.PassengerRepo.ListByUserId(ctx, userId)
+}
+
+func (s *PassengerService) Create(ctx context.Context, userId string, passenger *model.Passenger) (*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := validatePassenger(passenger); err != nil {
+		return nil, err
+	}
+	passengers, err := s.PassengerRepo.ListByUserId(ctx, userId)
+	if err != nil {
+		fmt.Println("查询乘车人失败", err)
+		return nil, err
+	}
+	if len(passengers) >= maxPassengersPerUser {
+		return nil, fmt.Errorf("每个账号最多保存%d名乘车人", maxPassengersPerUser)
+	}
+	exist, err := s.PassengerRepo.ExistByDocument(ctx, userId, passenger.IdType, passenger.IdNumber, "")
+	if err != nil {
+		fmt.Println("查询乘车人是否存在失败", err)
+		return nil, err
+	}
+	if exist {
+		fmt.Println("乘车人已存在")
+		return nil, nil
+	}
+
+	// 添加时即核验，核验服务不可用时保存为未核验，之后可重新核验
+	passenger.VerifyStatus = enum.VerifyStatusUnverified
+	passenger.VerifyTime = nil
+	if result, err := verifyIdentity(ctx, s.Verifier, passenger.PassengerName, passenger.IdType, passenger.IdNumber); err != nil {
+		fmt.Println(err)
+	} else {
+		passenger.VerifyStatus = result.Status
+		passenger.VerifyTime = result.Time
+	}
+
+	passenger.PassengerId = utils.GetUUID()
+	passenger.UserId = userId
+	passenger.CreateTime = time.Now()
+	passenger.UpdateTime = time.Now()
+	return s.PassengerRepo.CreatePassenger(ctx, passenger)
+}
+
+func (s *PassengerService) Edit(ctx context.Context, userId string, passenger *model.Passenger) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.getOwned(ctx, userId, passenger.PassengerId)
+	if err != nil {
+		return false, err
+	}
+	if err := validatePassenger(passenger); err != nil {
+		return false, err
+	}
+	duplicated, err := s.PassengerRepo.ExistByDocument(ctx, userId, passenger.IdType, passenger.IdNumber, passenger.PassengerId)
+	if err != nil {
+		fmt.Println("查询乘车人是否存在失败", err)
+		return false, err
+	}
+	if duplicated {
+		return false, errors.New("该证件已登记为其他乘车人")
+	}
+	// 姓名或证件变更后需重新核验
+	passenger.VerifyStatus = exist.VerifyStatus
+	passenger.VerifyTime = exist.VerifyTime
+	if passenger.PassengerName != exist.PassengerName || passenger.IdType != exist.IdType || passenger.IdNumber != exist.IdNumber {
+		passenger.VerifyStatus = enum.VerifyStatusUnverified
+		passenger.VerifyTime = nil
+		if result, err := verifyIdentity(ctx, s.Verifier, passenger.PassengerName, passenger.IdType, passenger.IdNumber); err != nil {
+			fmt.Println(err)
+		} else {
+			passenger.VerifyStatus = result.Status
+			passenger.VerifyTime = result.Time
+		}
+	}
+	return s.PassengerRepo.Edit(ctx, passenger)
+}
+
+func (s *PassengerService) Verify(ctx context.Context, userId string, passengerId string) (*model.Passenger, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	passenger, err := s.getOwned(ctx, userId, passengerId)
+	if err != nil {
+		return nil, err
+	}
+	if passenger.VerifyStatus == enum.VerifyStatusVerified {
+		return passenger, nil
+	}
+	result, err := verifyIdentity(ctx, s.Verifier, passenger.PassengerName, passenger.IdType, passenger.IdNumber)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.PassengerRepo.UpdateVerifyStatus(ctx, passenger.PassengerId, result.Status, result.Time); err != nil {
+		return nil, fmt.Errorf("更新核验状态失败: %v", err)
+	}
+	passenger.VerifyStatus = result.Status
+	passenger.VerifyTime = result.Time
+	if result.Status != enum.VerifyStatusVerified {
+		return passenger, fmt.Errorf("实名核验未通过: %s", result.Reason)
+	}
+	return passenger, nil
+}
+
+func (s *PassengerService) Delete(ctx context.Context, userId string, passengerId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	passenger, err := s.getOwned(ctx, userId, passengerId)
+	if err != nil {
+		return false, err
+	}
+	return s.PassengerRepo.Delete(ctx, passenger)
+}
+
+// 查询乘车人并校验归属
+func (s *PassengerService) getOwned(ctx context.Context, userId string, passengerId string) (*model.Passenger, error) {
+	if passengerId == "" {
+		return nil, errors.New("乘车人ID不能为空")
+	}
+	passenger, err := s.PassengerRepo.Get(ctx, &model.Passenger{PassengerId: passengerId})
+	if err != nil {
+		fmt.Println("查询乘车人失败", err)
+		return nil, err
+	}
+	if passenger.UserId != userId {
+		return nil, errors.New("乘车人不属于当前账号")
+	}
+	return passenger, nil
+}
+
+func validatePassenger(passenger *model.Passenger) error {
+	if passenger.PassengerName == "" {
+		return errors.New("乘车人姓名不能为空")
+	}
+	if !passenger.IdType.IsValid() {
+		return fmt.Errorf("无效的证件类型: %d", passenger.IdType)
+	}
+	passenger.IdNumber = identity.Normalize(passenger.IdNumber)
+	if err := identity.Validate(passenger.IdType, passenger.IdNumber); err != nil {
+		return err
+	}
+	if !passenger.PassengerType.IsValid() {
+		return fmt.Errorf("无效的乘车人类型: %d", passenger.PassengerType)
+	}
+	return nil
+}
@@ -0,0 +1,633 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/payment"
+	"12305/repository"
+	"12305/response"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrPaymentNotOwned = errors.New("支付流水不属于当前账号")
+
+type PaymentService struct {
+	PaymentRepo  repository.PaymentRepoInterface
+	OrderRepo    repository.OrderRepoInterface
+	WaitlistRepo repository.WaitlistRepoInterface
+	RedisRepo    repository.RedisRepoInterface
+	Gateway      payment.PaymentGateway
+	// 候补预付款支付后立即尝试兑现，可为空
+	WaitlistListener SeatReleaseListener
+	// 补差价支付后完成改签换座，可为空，由改签到期任务兜底
+	ChangeListener ChangePaidListener
+}
+
+// 补差价支付成功通知，完成改签换座
+type ChangePaidListener interface {
+	OnChangePaid(ctx context.Context, changeNo string)
+}
+
+type PaymentSrv interface {
+	// 为未支付订单发起支付，已有待支付流水时直接返回
+	Pay(ctx context.Context, userId string, orderId string) (*model.Payment, error)
+	// 处理支付渠道回调，重复或乱序的回调只会使订单支付成功一次
+	HandleCallback(ctx context.Context, payload payment.CallbackPayload) error
+	// 主动向支付渠道查询支付结果，用于补偿丢失的回调
+	Query(ctx context.Context, userId string, paymentNo string) (*model.Payment, error)
+	// 退票：按订单已支付金额和手续费率rate计算手续费，支付成功的流水置为退款中，并关闭未支付的补差价流水；
+	// 须在退票事务内调用，提交后由ProcessRefunds调用支付渠道退款
+	PrepareRefund(ctx context.Context, orderId string, rate float64) (*response.OrderRefund, error)
+	// 对订单退款中的流水和部分退款记录调用支付渠道原路退款，重复调用不会重复退款
+	ProcessRefunds(ctx context.Context, orderId string) error
+	// 定时重试退款中的流水和部分退款记录，兜底事务提交后渠道退款失败的情况
+	StartRefundJob(ctx context.Context, interval time.Duration)
+	// 改签退还差价、候补退还多余预付款时登记部分退款：从订单最近支付成功的流水中扣减可退金额并记录退款中的退款单；
+	// 须在业务事务内调用，提交后由ProcessRefunds调用支付渠道退款
+	PrepareRefundDiff(ctx context.Context, orderId string, amount float64, reason string) error
+	// 改签补差价，为改签批次创建待支付流水
+	ChargeDiff(ctx context.Context, userId string, orderId string, changeNo string, amount float64) (*model.Payment, error)
+	// 候补预付款，为候补订单创建待支付流水
+	ChargePrepayment(ctx context.Context, userId string, waitlistId string, amount float64) (*model.Payment, error)
+	// 候补兑现时预付款转为订单的支付，须在兑现事务内调用
+	ApplyPrepayment(ctx context.Context, paymentNo string, orderId string) error
+	// 候补取消、过期或无需预付款时，关闭未支付的预付款流水或原路全额退款
+	RefundPrepayment(ctx context.Context, paymentNo string, reason string) error
+	// 关闭待支付或支付失败的流水，之后到账的支付原路退款
+	ClosePayment(ctx context.Context, paymentNo string) error
+	// 模拟支付渠道完成支付并回调，仅模拟渠道可用
+	MockComplete(ctx context.Context, userId string, paymentNo string, status string, sign string) error
+	// 使用调用方的事务读写支付流水，与订单、座位的变更一并提交或回滚
+	WithDB(db *gorm.DB) PaymentSrv
+}
+
+var _ PaymentSrv = (*PaymentService)(nil)
+
+func (s *PaymentService) WithDB(db *gorm.DB) PaymentSrv {
+	txService := *s
+	txService.PaymentRepo = s.PaymentRepo.WithDB(db)
+	txService.OrderRepo = s.OrderRepo.WithDB(db)
+	if s.WaitlistRepo != nil {
+		txService.WaitlistRepo = s.WaitlistRepo.WithDB(db)
+	}
+	return &txService
+}
+
+func (s *PaymentService) Pay(ctx context.Context, userId string, orderId string) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	order, err := s.OrderRepo.Get(ctx, model.Order{OrderId: orderId})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("订单不存在")
+		}
+		return nil, fmt.Errorf("查询订单失败: %v", err)
+	}
+	if order.UserId != userId {
+		return nil, errors.New("订单不属于当前账号")
+	}
+	switch {
+	case order.OrderStatus == enum.OrderStatusPaid:
+		return nil, errors.New("订单已支付")
+	case order.OrderStatus != enum.OrderStatusNormal:
+		return nil, fmt.Errorf("订单%s，不能支付", order.OrderStatus)
+	case !order.ExpireTime.IsZero() && order.ExpireTime.Before(time.Now()):
+		return nil, errors.New("订单已超过支付时限")
+	}
+
+	existing, err := s.PaymentRepo.GetActiveByOrderId(ctx, orderId)
+	if err == nil {
+		if existing.PaymentStatus == enum.PaymentStatusSucceeded {
+			return nil, errors.New("订单已支付")
+		}
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("查询支付流水失败: %v", err)
+	}
+
+	now := time.Now()
+	p := &model.Payment{
+		PaymentId:     utils.GetUUID(),
+		PaymentNo:     utils.GetUUID(),
+		OrderId:       orderId,
+		UserId:        userId,
+		Amount:        order.TotalPrice,
+		Channel:       s.Gateway.Name(),
+		PaymentStatus: enum.PaymentStatusCreated,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	result, err := s.Gateway.CreatePayment(ctx, payment.CreateRequest{
+		PaymentNo: p.PaymentNo,
+		OrderId:   orderId,
+		Amount:    p.Amount,
+		Subject:   fmt.Sprintf("火车票订单 %s", orderId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("发起支付失败: %v", err)
+	}
+	p.TradeNo = result.TradeNo
+	p.PayUrl = result.PayUrl
+	return s.PaymentRepo.CreatePayment(ctx, p)
+}
+
+func (s *PaymentService) HandleCallback(ctx context.Context, payload payment.CallbackPayload) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := s.Gateway.VerifyCallback(ctx, payload); err != nil {
+		return err
+	}
+	p, err := s.PaymentRepo.GetByPaymentNo(ctx, payload.PaymentNo)
+	if err != nil {
+		return fmt.Errorf("查询支付流水失败: %v", err)
+	}
+	if math.Abs(p.Amount-payload.Amount) > 0.005 {
+		return fmt.Errorf("支付金额不符: 应付 %.2f，实付 %.2f", p.Amount, payload.Amount)
+	}
+
+	switch payload.Status {
+	case payment.TradeStatusSuccess:
+		return s.markPaid(ctx, p, payload.TradeNo)
+	case payment.TradeStatusFailed:
+		// 只有待支付的流水会被置为失败，晚到的失败回调不会覆盖已成功的支付
+		_, err := s.PaymentRepo.UpdateStatus(ctx, p.PaymentNo, []enum.PaymentStatus{enum.PaymentStatusCreated}, enum.PaymentStatusFailed, payload.TradeNo)
+		return err
+	case payment.TradeStatusClosed:
+		_, err := s.PaymentRepo.UpdateStatus(ctx, p.PaymentNo, []enum.PaymentStatus{enum.PaymentStatusCreated}, enum.PaymentStatusClosed, payload.TradeNo)
+		return err
+	default:
+		return nil
+	}
+}
+
+func (s *PaymentService) Query(ctx context.Context, userId string, paymentNo string) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	p, err := s.getOwned(ctx, userId, paymentNo)
+	if err != nil {
+		return nil, err
+	}
+	if p.PaymentStatus != enum.PaymentStatusCreated {
+		return p, nil
+	}
+
+	result, err := s.Gateway.QueryPayment(ctx, paymentNo)
+	if err != nil {
+		return nil, fmt.Errorf("查询支付渠道失败: %v", err)
+	}
+	if result.Status == payment.TradeStatusSuccess {
+		if err := s.markPaid(ctx, p, result.TradeNo); err != nil {
+			return nil, err
+		}
+	}
+	return s.PaymentRepo.GetByPaymentNo(ctx, paymentNo)
+}
+
+func (s *PaymentService) MockComplete(ctx context.Context, userId string, paymentNo string, status string, sign string) error {
+	mock, ok := s.Gateway.(*payment.MockGateway)
+	if !ok {
+		return errors.New("当前支付渠道不支持模拟支付")
+	}
+	if _, err := s.getOwned(ctx, userId, paymentNo); err != nil {
+		return err
+	}
+	payload, err := mock.Complete(paymentNo, status, sign)
+	if err != nil {
+		return err
+	}
+	return s.HandleCallback(ctx, *payload)
+}
+
+// 查询支付流水并校验归属：订单支付核对订单所属账号，候补预付款核对付款账号
+func (s *PaymentService) getOwned(ctx context.Context, userId string, paymentNo string) (*model.Payment, error) {
+	p, err := s.PaymentRepo.GetByPaymentNo(ctx, paymentNo)
+	if err != nil {
+		return nil, fmt.Errorf("查询支付流水失败: %v", err)
+	}
+	owner := p.UserId
+	if p.OrderId != "" {
+		order, err := s.OrderRepo.Get(ctx, model.Order{OrderId: p.OrderId})
+		if err != nil {
+			return nil, fmt.Errorf("查询订单失败: %v", err)
+		}
+		owner = order.UserId
+	}
+	if owner != userId {
+		return nil, ErrPaymentNotOwned
+	}
+	return p, nil
+}
+
+// 支付成功：支付流水和订单状态（补差价时为改签状态）在同一事务中各自条件更新，保证只成功一次；
+// 订单已超时取消、已由其他流水支付或流水已关闭时，对本次支付原路退款
+func (s *PaymentService) markPaid(ctx context.Context, p *model.Payment, tradeNo string) error {
+	paymentUpdated, orderPaid := false, false
+	err := s.PaymentRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.PaymentRepo.WithDB(tx)
+		ok, err := r.UpdateStatus(ctx, p.PaymentNo, []enum.PaymentStatus{enum.PaymentStatusCreated, enum.PaymentStatusFailed, enum.PaymentStatusClosed}, enum.PaymentStatusSucceeded, tradeNo)
+		if err != nil {
+			return fmt.Errorf("更新支付流水失败: %v", err)
+		}
+		if !ok {
+			// 重复回调
+			return nil
+		}
+		paymentUpdated = true
+
+		orderRepo := s.OrderRepo.WithDB(tx)
+		switch {
+		case p.ChangeNo != "":
+			// 改签已超时撤销时退款
+			orderPaid, err = orderRepo.UpdateChangeStatus(ctx, p.ChangeNo, enum.ChangeStatusAwaitingPayment, enum.ChangeStatusPaid)
+		case p.WaitlistId != "":
+			// 预付款支付后进入候补队列，候补已取消或过期时退款
+			orderPaid, err = s.WaitlistRepo.WithDB(tx).UpdateStatus(ctx, p.WaitlistId, []enum.WaitlistStatus{enum.WaitlistStatusPending}, enum.WaitlistStatusWaiting, "")
+		default:
+			orderPaid, err = orderRepo.TransitionWithOptimisticLockRetry(ctx, p.OrderId, enum.OrderStatusNormal, enum.OrderStatusPaid, enum.TicketStatusSold, enum.OrderEventPaid, "支付流水 "+p.PaymentNo, 3)
+		}
+		if err != nil {
+			return fmt.Errorf("更新订单状态失败: %v", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !paymentUpdated {
+		return nil
+	}
+
+	if orderPaid && p.ChangeNo != "" {
+		fmt.Printf("订单 %s 改签 %s 差价已补齐\n", p.OrderId, p.ChangeNo)
+		if s.ChangeListener != nil {
+			s.ChangeListener.OnChangePaid(ctx, p.ChangeNo)
+		}
+		return nil
+	}
+	if orderPaid && p.WaitlistId != "" {
+		fmt.Printf("候补订单 %s 预付款已支付\n", p.WaitlistId)
+		s.notifyWaitlist(ctx, p.WaitlistId)
+		return nil
+	}
+	if orderPaid {
+		if err := s.RedisRepo.RemoveOrderHold(ctx, p.OrderId); err != nil {
+			fmt.Printf("移除订单支付时限失败: %v\n", err)
+		}
+		fmt.Printf("订单 %s 支付成功\n", p.OrderId)
+		return nil
+	}
+	return s.refundOrphan(ctx, p)
+}
+
+// 预付款支付后按候补车次触发兑现
+func (s *PaymentService) notifyWaitlist(ctx context.Context, waitlistId string) {
+	if s.WaitlistListener == nil {
+		return
+	}
+	waitlist, err := s.WaitlistRepo.Get(ctx, &model.Waitlist{WaitlistId: waitlistId})
+	if err != nil {
+		fmt.Printf("查询候补订单 %s 失败: %v\n", waitlistId, err)
+		return
+	}
+	go s.WaitlistListener.OnSeatReleased(context.Background(), string(waitlist.TicketTag), waitlist.RunDate)
+}
+
+// 对没有对应待支付订单的支付成功流水全额退款
+func (s *PaymentService) refundOrphan(ctx context.Context, p *model.Payment) error {
+	fmt.Printf("订单 %s 已不可支付，支付流水 %s 原路退款\n", p.OrderId, p.PaymentNo)
+	_, _, err := s.refundRemaining(ctx, p, 0, "订单已取消")
+	return err
+}
+
+func (s *PaymentService) PrepareRefund(ctx context.Context, orderId string, rate float64) (*response.OrderRefund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	payments, err := s.PaymentRepo.ListSucceededByOrderId(ctx, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("查询支付流水失败: %v", err)
+	}
+	if len(payments) == 0 {
+		return nil, errors.New("订单没有支付成功的记录")
+	}
+
+	// 手续费按实际已支付金额计算，未支付的改签差价不计入；依次从各笔支付中扣除
+	paid := 0.0
+	for _, p := range payments {
+		paid += p.Amount - p.RefundAmount
+	}
+	paid = math.Round(paid*100) / 100
+	fee := math.Round(paid*rate*100) / 100
+	result := &response.OrderRefund{OrderId: orderId, RefundFee: fee}
+	remainingFee := fee
+	for _, p := range payments {
+		remaining := math.Round((p.Amount-p.RefundAmount)*100) / 100
+		part := math.Min(remainingFee, remaining)
+		remainingFee = math.Round((remainingFee-part)*100) / 100
+		refundNo := ""
+		if remaining-part > 0 {
+			refundNo = utils.GetUUID()
+			result.RefundNos = append(result.RefundNos, refundNo)
+		}
+		ok, err := s.PaymentRepo.MarkRefunding(ctx, p.PaymentNo, refundNo, p.RefundFee+part)
+		if err != nil {
+			return nil, fmt.Errorf("登记退款失败: %v", err)
+		}
+		if !ok {
+			return nil, fmt.Errorf("支付流水 %s 已退款", p.PaymentNo)
+		}
+	}
+	result.RefundAmount = math.Round((paid-fee)*100) / 100
+	if err := s.PaymentRepo.CloseUnpaid(ctx, orderId); err != nil {
+		return nil, fmt.Errorf("关闭待支付流水失败: %v", err)
+	}
+	return result, nil
+}
+
+func (s *PaymentService) ProcessRefunds(ctx context.Context, orderId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	refunds, err := s.PaymentRepo.ListPendingRefunds(ctx, orderId, 0)
+	if err != nil {
+		return fmt.Errorf("查询退款中的退款单失败: %v", err)
+	}
+	for _, r := range refunds {
+		if err := s.settlePartialRefund(ctx, r); err != nil {
+			return err
+		}
+	}
+	payments, err := s.PaymentRepo.ListRefunding(ctx, orderId, 0)
+	if err != nil {
+		return fmt.Errorf("查询退款中的支付流水失败: %v", err)
+	}
+	for _, p := range payments {
+		if err := s.settleRefund(ctx, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *PaymentService) StartRefundJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("退款重试任务已停止")
+			return
+		case <-ticker.C:
+		}
+
+		refunds, err := s.PaymentRepo.ListPendingRefunds(ctx, "", refundRetryBatch)
+		if err != nil {
+			fmt.Printf("查询退款中的退款单失败: %v\n", err)
+		}
+		for _, r := range refunds {
+			if err := s.settlePartialRefund(ctx, r); err != nil {
+				fmt.Printf("退款单 %s 退款失败，稍后重试: %v\n", r.RefundNo, err)
+			}
+		}
+		payments, err := s.PaymentRepo.ListRefunding(ctx, "", refundRetryBatch)
+		if err != nil {
+			fmt.Printf("查询退款中的支付流水失败: %v\n", err)
+			continue
+		}
+		for _, p := range payments {
+			if err := s.settleRefund(ctx, p); err != nil {
+				fmt.Printf("支付流水 %s 退款失败，稍后重试: %v\n", p.PaymentNo, err)
+			}
+		}
+	}
+}
+
+// 每轮重试的退款流水数量
+const refundRetryBatch = 100
+
+// 按退票时登记的退款单号和手续费调用渠道退款，渠道按退款单号去重，重试不会重复退款
+func (s *PaymentService) settleRefund(ctx context.Context, p *model.Payment) error {
+	amount := math.Round((p.Amount-p.RefundAmount-p.RefundFee)*100) / 100
+	if amount > 0 {
+		if _, err := s.Gateway.Refund(ctx, payment.RefundRequest{
+			PaymentNo: p.PaymentNo,
+			RefundNo:  p.RefundNo,
+			Amount:    amount,
+			Reason:    "退票",
+		}); err != nil {
+			return fmt.Errorf("退款失败: %v", err)
+		}
+	} else {
+		amount = 0
+	}
+	if _, err := s.PaymentRepo.MarkRefunded(ctx, p.PaymentNo, p.RefundNo, p.RefundAmount+amount, p.RefundFee); err != nil {
+		return fmt.Errorf("登记退款失败: %v", err)
+	}
+	return nil
+}
+
+// 按登记的退款单号调用渠道退款，渠道按退款单号去重，重试不会重复退款
+func (s *PaymentService) settlePartialRefund(ctx context.Context, r *model.PaymentRefund) error {
+	if _, err := s.Gateway.Refund(ctx, payment.RefundRequest{
+		PaymentNo: r.PaymentNo,
+		RefundNo:  r.RefundNo,
+		Amount:    r.Amount,
+		Reason:    r.Reason,
+	}); err != nil {
+		return fmt.Errorf("退款失败: %v", err)
+	}
+	if _, err := s.PaymentRepo.MarkRefundSettled(ctx, r.RefundNo); err != nil {
+		return fmt.Errorf("登记退款失败: %v", err)
+	}
+	return nil
+}
+
+func (s *PaymentService) PrepareRefundDiff(ctx context.Context, orderId string, amount float64, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	payments, err := s.PaymentRepo.ListSucceededByOrderId(ctx, orderId)
+	if err != nil {
+		return fmt.Errorf("查询支付流水失败: %v", err)
+	}
+	// 从最近的支付开始退还，可退金额在登记时扣减，避免并发登记超退
+	remaining := math.Round(amount*100) / 100
+	now := time.Now()
+	for i := len(payments) - 1; i >= 0 && remaining > 0; i-- {
+		p := payments[i]
+		part := math.Min(remaining, math.Round((p.Amount-p.RefundAmount)*100)/100)
+		if part <= 0 {
+			continue
+		}
+		ok, err := s.PaymentRepo.AddRefund(ctx, p.PaymentNo, part)
+		if err != nil {
+			return fmt.Errorf("登记退款失败: %v", err)
+		}
+		if !ok {
+			return fmt.Errorf("支付流水 %s 可退金额不足", p.PaymentNo)
+		}
+		if err := s.PaymentRepo.CreateRefund(ctx, &model.PaymentRefund{
+			RefundId:     utils.GetUUID(),
+			RefundNo:     utils.GetUUID(),
+			PaymentNo:    p.PaymentNo,
+			OrderId:      orderId,
+			Amount:       part,
+			Reason:       reason,
+			RefundStatus: enum.PaymentStatusRefunding,
+			CreateTime:   now,
+			UpdateTime:   now,
+		}); err != nil {
+			return fmt.Errorf("登记退款失败: %v", err)
+		}
+		remaining = math.Round((remaining-part)*100) / 100
+	}
+	if remaining > 0 {
+		return fmt.Errorf("可退金额不足，差 %.2f", remaining)
+	}
+	return nil
+}
+
+func (s *PaymentService) ChargeDiff(ctx context.Context, userId string, orderId string, changeNo string, amount float64) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	p := &model.Payment{
+		PaymentId:     utils.GetUUID(),
+		PaymentNo:     utils.GetUUID(),
+		OrderId:       orderId,
+		ChangeNo:      changeNo,
+		UserId:        userId,
+		Amount:        math.Round(amount*100) / 100,
+		Channel:       s.Gateway.Name(),
+		PaymentStatus: enum.PaymentStatusCreated,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	result, err := s.Gateway.CreatePayment(ctx, payment.CreateRequest{
+		PaymentNo: p.PaymentNo,
+		OrderId:   orderId,
+		Amount:    p.Amount,
+		Subject:   fmt.Sprintf("火车票订单 %s 改签差价", orderId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("发起补差价支付失败: %v", err)
+	}
+	p.TradeNo = result.TradeNo
+	p.PayUrl = result.PayUrl
+	return s.PaymentRepo.CreatePayment(ctx, p)
+}
+
+func (s *PaymentService) ChargePrepayment(ctx context.Context, userId string, waitlistId string, amount float64) (*model.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	p := &model.Payment{
+		PaymentId:     utils.GetUUID(),
+		PaymentNo:     utils.GetUUID(),
+		WaitlistId:    waitlistId,
+		UserId:        userId,
+		Amount:        math.Round(amount*100) / 100,
+		Channel:       s.Gateway.Name(),
+		PaymentStatus: enum.PaymentStatusCreated,
+		CreateTime:    now,
+		UpdateTime:    now,
+	}
+	result, err := s.Gateway.CreatePayment(ctx, payment.CreateRequest{
+		PaymentNo: p.PaymentNo,
+		OrderId:   waitlistId,
+		Amount:    p.Amount,
+		Subject:   fmt.Sprintf("候补订单 %s 预付款", waitlistId),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("发起预付款支付失败: %v", err)
+	}
+	p.TradeNo = result.TradeNo
+	p.PayUrl = result.PayUrl
+	return s.PaymentRepo.CreatePayment(ctx, p)
+}
+
+func (s *PaymentService) ApplyPrepayment(ctx context.Context, paymentNo string, orderId string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	ok, err := s.PaymentRepo.AttachOrder(ctx, paymentNo, orderId)
+	if err != nil {
+		return fmt.Errorf("关联预付款失败: %v", err)
+	}
+	if !ok {
+		return fmt.Errorf("预付款 %s 未支付或已使用", paymentNo)
+	}
+	return nil
+}
+
+func (s *PaymentService) ClosePayment(ctx context.Context, paymentNo string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	_, err := s.PaymentRepo.UpdateStatus(ctx, paymentNo, []enum.PaymentStatus{enum.PaymentStatusCreated, enum.PaymentStatusFailed}, enum.PaymentStatusClosed, "")
+	return err
+}
+
+func (s *PaymentService) RefundPrepayment(ctx context.Context, paymentNo string, reason string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	p, err := s.PaymentRepo.GetByPaymentNo(ctx, paymentNo)
+	if err != nil {
+		return fmt.Errorf("查询支付流水失败: %v", err)
+	}
+	switch p.PaymentStatus {
+	case enum.PaymentStatusCreated, enum.PaymentStatusFailed:
+		// 关闭后晚到的支付成功回调找不到待支付的候补，由markPaid原路退款
+		return s.ClosePayment(ctx, paymentNo)
+	case enum.PaymentStatusSucceeded:
+		_, _, err := s.refundRemaining(ctx, p, 0, reason)
+		return err
+	default:
+		return nil
+	}
+}
+
+// 退还支付流水剩余可退金额中扣除手续费fee后的部分，并将流水置为已退款；返回退款单号和退款金额
+func (s *PaymentService) refundRemaining(ctx context.Context, p *model.Payment, fee float64, reason string) (string, float64, error) {
+	remaining := math.Round((p.Amount-p.RefundAmount)*100) / 100
+	fee = math.Min(math.Max(fee, 0), remaining)
+	amount := math.Round((remaining-fee)*100) / 100
+	refundNo := ""
+	if amount > 0 {
+		refundNo = utils.GetUUID()
+		if _, err := s.Gateway.Refund(ctx, payment.RefundRequest{
+			PaymentNo: p.PaymentNo,
+			RefundNo:  refundNo,
+			Amount:    amount,
+			Reason:    reason,
+		}); err != nil {
+			return "", 0, fmt.Errorf("退款失败: %v", err)
+		}
+	}
+	ok, err := s.PaymentRepo.MarkRefunded(ctx, p.PaymentNo, refundNo, p.RefundAmount+amount, p.RefundFee+fee)
+	if err != nil {
+		return "", 0, fmt.Errorf("登记退款失败: %v", err)
+	}
+	if !ok {
+		return "", 0, fmt.Errorf("支付流水 %s 已退款", p.PaymentNo)
+	}
+	return refundNo, amount, nil
+}
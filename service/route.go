@@ -0,0 +1,263 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/repository"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 区间位图使用int64存储，最多支持63个区间
+const maxRouteStops = 64
+
+type RouteService struct {
+	RouteRepo   repository.RouteRepoInterface
+	StationRepo repository.StationRepoInterface
+	// 已售座位的区间位图依赖停靠顺序，有售出时不能修改或删除线路
+	TicketRepo repository.TicketRepoInterface
+}
+
+type RouteSrv interface {
+	Get(ctx context.Context, route *model.Route) (*model.Route, error)
+	GetByTicketTag(ctx context.Context, ticketTag string) (*model.Route, error)
+	// 根据上下车站计算乘车区间
+	GetSegment(ctx context.Context, ticketTag string, fromStation string, toStation string) (*model.Segment, error)
+	Create(ctx context.Context, route *model.Route) (*model.Route, error)
+	EditStops(ctx context.Context, route *model.Route) (bool, error)
+	Delete(ctx context.Context, route *model.Route) (bool, error)
+}
+
+var _ RouteSrv = (*RouteService)(nil)
+
+func (s *RouteService) Get(ctx context.Context, route *model.Route) (*model.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.RouteRepo.Get(ctx, route)
+}
+
+func (s *RouteService) GetByTicketTag(ctx context.Context, ticketTag string) (*model.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.RouteRepo.GetByTicketTag(ctx, enum.TicketTag(ticketTag))
+}
+
+func (s *RouteService) GetSegment(ctx context.Context, ticketTag string, fromStation string, toStation string) (*model.Segment, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return loadSegment(ctx, s.RouteRepo, enum.TicketTag(ticketTag), fromStation, toStation)
+}
+
+func (s *RouteService) Create(ctx context.Context, route *model.Route) (*model.Route, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	exist, err := s.RouteRepo.Exist(ctx, *route)
+	if err != nil {
+		fmt.Println("查询线路是否存在失败", err)
+		return nil, err
+	}
+	if exist {
+		fmt.Println("线路已存在")
+		return nil, nil
+	}
+	// 没有线路的车次按单区间售票，新增线路后已售座位只占第一个区间，其余区间会被重复售出
+	if err := s.checkNoSold(ctx, route.TicketTag); err != nil {
+		return nil, err
+	}
+	if route.RouteId == "" {
+		route.RouteId = utils.GetUUID()
+	}
+	if err := s.validateStops(ctx, route.RouteId, route.Stops); err != nil {
+		return nil, err
+	}
+	route.CreateTime = time.Now()
+	route.UpdateTime = time.Now()
+	return s.RouteRepo.CreateRoute(ctx, route)
+}
+
+// 修改线路停靠站，已售出的区间位图依赖停靠顺序，只能在车次没有座位售出时调整
+func (s *RouteService) EditStops(ctx context.Context, route *model.Route) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.RouteRepo.Get(ctx, route)
+	if err != nil {
+		fmt.Println("查询线路失败", err)
+		return false, err
+	}
+	if err := s.checkNoSold(ctx, exist.TicketTag); err != nil {
+		return false, err
+	}
+	if err := s.validateStops(ctx, exist.RouteId, route.Stops); err != nil {
+		return false, err
+	}
+	if err := s.RouteRepo.ReplaceStops(ctx, exist.RouteId, route.Stops); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (s *RouteService) Delete(ctx context.Context, route *model.Route) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.RouteRepo.Exist(ctx, *route)
+	if err != nil {
+		fmt.Println("查询线路是否存在失败", err)
+		return false, err
+	}
+	if !exist {
+		fmt.Println("线路不存在")
+		return false, nil
+	}
+	current, err := s.RouteRepo.Get(ctx, route)
+	if err != nil {
+		fmt.Println("查询线路失败", err)
+		return false, err
+	}
+	if err := s.checkNoSold(ctx, current.TicketTag); err != nil {
+		return false, err
+	}
+	return s.RouteRepo.Delete(ctx, route)
+}
+
+// 车次已有座位售出或锁定时，区间位图按现有停靠顺序记录，不能再调整线路
+func (s *RouteService) checkNoSold(ctx context.Context, ticketTag enum.TicketTag) error {
+	sold, err := s.TicketRepo.ExistSold(ctx, ticketTag)
+	if err != nil {
+		return fmt.Errorf("查询车次售票情况失败: %v", err)
+	}
+	if sold {
+		return fmt.Errorf("车次 %s 已有座位售出，不能修改线路", ticketTag)
+	}
+	return nil
+}
+
+// 校验停靠站：至少两站、车站存在且不重复，并按顺序重新编号
+func (s *RouteService) validateStops(ctx context.Context, routeId string, stops []model.RouteStop) error {
+	if len(stops) < 2 {
+		return errors.New("线路至少需要两个停靠站")
+	}
+	if len(stops) > maxRouteStops {
+		return fmt.Errorf("线路停靠站不能超过%d个", maxRouteStops)
+	}
+
+	stationIds := make([]string, 0, len(stops))
+	seen := make(map[string]bool, len(stops))
+	for _, stop := range stops {
+		if !validClock(stop.ArriveTime) || !validClock(stop.DepartTime) {
+			return fmt.Errorf("停靠站 %s 时刻格式应为 HH:MM", stop.StationId)
+		}
+		if seen[stop.StationId] {
+			return fmt.Errorf("停靠站 %s 重复", stop.StationId)
+		}
+		seen[stop.StationId] = true
+		stationIds = append(stationIds, stop.StationId)
+	}
+	stations, err := s.StationRepo.GetByStationIds(ctx, stationIds)
+	if err != nil {
+		return fmt.Errorf("查询车站失败: %v", err)
+	}
+	if len(stations) != len(stationIds) {
+		return errors.New("存在未登记的车站")
+	}
+
+	for i := range stops {
+		if stops[i].RouteStopId == "" {
+			stops[i].RouteStopId = utils.GetUUID()
+		}
+		stops[i].RouteId = routeId
+		stops[i].Seq = i
+	}
+	return nil
+}
+
+// 加载车次线路并计算乘车区间；车次未配置线路时视为单区间，整座出售
+func loadSegment(ctx context.Context, routeRepo repository.RouteRepoInterface, ticketTag enum.TicketTag, fromStation string, toStation string) (*model.Segment, error) {
+	route, err := routeRepo.GetByTicketTag(ctx, ticketTag)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			if fromStation != "" || toStation != "" {
+				return nil, fmt.Errorf("车次 %s 未配置线路", ticketTag)
+			}
+			return &model.Segment{FromSeq: 0, ToSeq: 1, Mask: 1, FullMask: 1}, nil
+		}
+		return nil, fmt.Errorf("查询车次线路失败: %v", err)
+	}
+	return resolveSegment(route, fromStation, toStation)
+}
+
+// 根据线路停靠站计算 [上车站, 下车站) 之间的区间位
+func resolveSegment(route *model.Route, fromStation string, toStation string) (*model.Segment, error) {
+	if len(route.Stops) < 2 {
+		return nil, fmt.Errorf("车次 %s 线路停靠站不完整", route.TicketTag)
+	}
+	last := len(route.Stops) - 1
+	fromSeq, toSeq := 0, last
+	if fromStation != "" {
+		fromSeq = -1
+	}
+	if toStation != "" {
+		toSeq = -1
+	}
+	for i, stop := range route.Stops {
+		if stop.StationId == fromStation {
+			fromSeq = i
+		}
+		if stop.StationId == toStation {
+			toSeq = i
+		}
+	}
+	if fromSeq < 0 || toSeq < 0 {
+		return nil, fmt.Errorf("车次 %s 不经停该车站", route.TicketTag)
+	}
+	if fromSeq >= toSeq {
+		return nil, errors.New("上车站必须在下车站之前")
+	}
+	return &model.Segment{
+		FromStation: route.Stops[fromSeq].StationId,
+		ToStation:   route.Stops[toSeq].StationId,
+		FromSeq:     fromSeq,
+		ToSeq:       toSeq,
+		Mask:        model.SegmentMask(fromSeq, toSeq),
+		FullMask:    model.SegmentMask(0, last),
+		DepartTime:  route.Stops[fromSeq].DepartTime,
+		DepartDay:   route.Stops[fromSeq].DayOffset,
+		ArriveTime:  route.Stops[toSeq].ArriveTime,
+		ArriveDay:   route.Stops[toSeq].DayOffset,
+	}, nil
+}
+
+// 按始发日期和停靠站时刻计算具体时间。未配置时刻（车次没有线路，或停靠站未填写时刻）时
+// 无法确定具体时刻，取当天最后一刻：当天的车票在当天结束前仍可购买、退票和改签，
+// 按乘车日期查询订单时也仍归入当天
+func scheduleTime(runDate string, clock string, dayOffset int) time.Time {
+	day, err := time.ParseInLocation(utils.DateLayout, runDate, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	day = day.AddDate(0, 0, dayOffset)
+	t, err := time.ParseInLocation("15:04", clock, time.Local)
+	if clock == "" || err != nil {
+		return day.AddDate(0, 0, 1).Add(-time.Second)
+	}
+	return day.Add(time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute)
+}
+
+// 停靠站时刻为空或 HH:MM
+func validClock(clock string) bool {
+	if clock == "" {
+		return true
+	}
+	_, err := time.ParseInLocation("15:04", clock, time.Local)
+	return err == nil
+}
@@ -0,0 +1,56 @@
+package service_test
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"testing"
+	"time"
+)
+
+// 没有线路的车次按单区间售票，已有座位售出后不能再新增线路
+func TestCreateRouteRejectsSoldTrain(t *testing.T) {
+	const ticketTag = "T9101"
+	env := newTestEnv(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	ticket := &model.Ticket{
+		TicketId:     ticketTag + "_001",
+		TicketNumber: 1,
+		CarriageNo:   1,
+		SeatClass:    enum.SeatClassSecond,
+		SeatRow:      1,
+		SeatLetter:   "A",
+		SeatPosition: enum.SeatClassSecond.SeatPositionOf("A"),
+		TicketTag:    enum.TicketTag(ticketTag),
+		RunDate:      tomorrow(),
+		TicketPrice:  100,
+		TicketStatus: enum.TicketStatusNormal,
+		SoldMask:     1,
+		CreateTime:   now,
+		UpdateTime:   now,
+	}
+	if err := env.db.Create(ticket).Error; err != nil {
+		t.Fatalf("生成座位失败: %v", err)
+	}
+
+	route := &model.Route{
+		TicketTag: enum.TicketTag(ticketTag),
+		Stops: []model.RouteStop{
+			{StationId: "S1", DepartTime: "08:00"},
+			{StationId: "S2", ArriveTime: "09:00", DepartTime: "09:05"},
+			{StationId: "S3", ArriveTime: "10:00"},
+		},
+	}
+	if _, err := env.app.Services.Route.Create(ctx, route); err == nil {
+		t.Fatal("车次已有座位售出时新增线路成功")
+	}
+	var count int64
+	if err := env.db.Model(&model.Route{}).Where("ticket_tag=?", ticketTag).Count(&count).Error; err != nil {
+		t.Fatalf("查询线路失败: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("车次 %s 有 %d 条线路，应为 0 条", ticketTag, count)
+	}
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"errors"
+	"math/bits"
+	"sort"
+)
+
+// 余票不足以分配
+var errNoSeatsAvailable = errors.New("余票不足")
+
+// 选座请求：每名乘车人一个座位位置偏好，SeatPositionNone 表示不限
+type SeatRequest struct {
+	SeatClass   enum.SeatClass
+	Preferences []enum.SeatPosition
+}
+
+// 选座策略，candidates 均为该席别在乘车区间内全程空闲的座位；
+// 返回的座位与 Preferences 一一对应
+type SeatAllocator interface {
+	Allocate(candidates []*model.Ticket, seg *model.Segment, req SeatRequest) ([]*model.Ticket, error)
+}
+
+// 按名称创建选座策略，未知名称使用默认的同排相邻策略
+func NewSeatAllocator(name string) SeatAllocator {
+	switch name {
+	case "best_fit":
+		return &BestFitSeatAllocator{}
+	default:
+		return &AdjacentSeatAllocator{}
+	}
+}
+
+// 同排相邻策略：多人优先分配同一排连续的座位，其次同一车厢，兼顾靠窗/过道偏好
+type AdjacentSeatAllocator struct{}
+
+func (a *AdjacentSeatAllocator) Allocate(candidates []*model.Ticket, seg *model.Segment, req SeatRequest) ([]*model.Ticket, error) {
+	count := len(req.Preferences)
+	if count == 0 || len(candidates) < count {
+		return nil, errNoSeatsAvailable
+	}
+	seats := sortedSeats(candidates)
+	if count == 1 {
+		return []*model.Ticket{pickPreferred(seats, req.Preferences[0])}, nil
+	}
+
+	// 同一排连续的座位，选满足偏好最多的一组
+	var best []*model.Ticket
+	bestScore := -1
+	for _, row := range groupSeats(seats, func(t *model.Ticket) [2]int { return [2]int{t.CarriageNo, t.SeatRow} }) {
+		for i := 0; i+count <= len(row); i++ {
+			window := row[i : i+count]
+			if !isContiguous(window, req.SeatClass) {
+				continue
+			}
+			if score := preferenceScore(window, req.Preferences); score > bestScore {
+				best, bestScore = window, score
+			}
+		}
+	}
+	if best != nil {
+		return matchPreferences(best, req.Preferences), nil
+	}
+
+	// 同一车厢内座位号最接近的一组
+	for _, carriage := range groupSeats(seats, func(t *model.Ticket) [2]int { return [2]int{t.CarriageNo, 0} }) {
+		if len(carriage) >= count {
+			return matchPreferences(carriage[:count], req.Preferences), nil
+		}
+	}
+	return matchPreferences(seats[:count], req.Preferences), nil
+}
+
+// 最小碎片策略：区间售票时优先使用已部分售出、且与本区间首尾相接的座位，
+// 把全程空闲的座位留给长途旅客；不保证多人相邻
+type BestFitSeatAllocator struct{}
+
+func (a *BestFitSeatAllocator) Allocate(candidates []*model.Ticket, seg *model.Segment, req SeatRequest) ([]*model.Ticket, error) {
+	count := len(req.Preferences)
+	if count == 0 || len(candidates) < count {
+		return nil, errNoSeatsAvailable
+	}
+	seats := sortedSeats(candidates)
+	sort.SliceStable(seats, func(i, j int) bool {
+		return fragmentScore(seats[i], seg) > fragmentScore(seats[j], seg)
+	})
+
+	result := make([]*model.Ticket, 0, count)
+	for _, preference := range req.Preferences {
+		seat := pickPreferred(seats, preference)
+		result = append(result, seat)
+		seats = removeSeat(seats, seat)
+	}
+	return result, nil
+}
+
+// 与本区间首尾相接的已售区间数加上已售区间总数，越大越能减少碎片
+func fragmentScore(ticket *model.Ticket, seg *model.Segment) int {
+	score := bits.OnesCount64(uint64(ticket.SoldMask))
+	if seg.FromSeq > 0 && ticket.SoldMask&(1<<uint(seg.FromSeq-1)) != 0 {
+		score += 64
+	}
+	if ticket.SoldMask&(1<<uint(seg.ToSeq)) != 0 {
+		score += 64
+	}
+	return score
+}
+
+// 按车厢、排、座位号排序
+func sortedSeats(candidates []*model.Ticket) []*model.Ticket {
+	seats := append([]*model.Ticket(nil), candidates...)
+	sort.SliceStable(seats, func(i, j int) bool {
+		if seats[i].CarriageNo != seats[j].CarriageNo {
+			return seats[i].CarriageNo < seats[j].CarriageNo
+		}
+		return seats[i].TicketNumber < seats[j].TicketNumber
+	})
+	return seats
+}
+
+// 按key分组，保持原有顺序
+func groupSeats(seats []*model.Ticket, key func(t *model.Ticket) [2]int) [][]*model.Ticket {
+	var groups [][]*model.Ticket
+	index := make(map[[2]int]int)
+	for _, seat := range seats {
+		k := key(seat)
+		i, ok := index[k]
+		if !ok {
+			i = len(groups)
+			index[k] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], seat)
+	}
+	return groups
+}
+
+// 同一排座位号在该席别的排列中是否连续
+func isContiguous(row []*model.Ticket, class enum.SeatClass) bool {
+	letters := class.SeatLetters()
+	position := make(map[string]int, len(letters))
+	for i, letter := range letters {
+		position[letter] = i
+	}
+	for i := 1; i < len(row); i++ {
+		if position[row[i].SeatLetter] != position[row[i-1].SeatLetter]+1 {
+			return false
+		}
+	}
+	return true
+}
+
+// 满足偏好的乘车人数
+func preferenceScore(seats []*model.Ticket, preferences []enum.SeatPosition) int {
+	score := 0
+	for i, seat := range matchPreferences(seats, preferences) {
+		if preferences[i] != enum.SeatPositionNone && seat.SeatPosition == preferences[i] {
+			score++
+		}
+	}
+	return score
+}
+
+// 将一组座位分配给乘车人：有偏好的乘车人先挑，其余按顺序分配
+func matchPreferences(seats []*model.Ticket, preferences []enum.SeatPosition) []*model.Ticket {
+	result := make([]*model.Ticket, len(preferences))
+	remaining := append([]*model.Ticket(nil), seats...)
+	for i, preference := range preferences {
+		if preference == enum.SeatPositionNone {
+			continue
+		}
+		for _, seat := range remaining {
+			if seat.SeatPosition == preference {
+				result[i] = seat
+				remaining = removeSeat(remaining, seat)
+				break
+			}
+		}
+	}
+	for i := range result {
+		if result[i] == nil {
+			result[i] = remaining[0]
+			remaining = remaining[1:]
+		}
+	}
+	return result
+}
+
+// 优先选择满足偏好的座位，没有则取第一个
+func pickPreferred(seats []*model.Ticket, preference enum.SeatPosition) *model.Ticket {
+	if preference != enum.SeatPositionNone {
+		for _, seat := range seats {
+			if seat.SeatPosition == preference {
+				return seat
+			}
+		}
+	}
+	return seats[0]
+}
+
+func removeSeat(seats []*model.Ticket, target *model.Ticket) []*model.Ticket {
+	for i, seat := range seats {
+		if seat == target {
+			return append(seats[:i:i], seats[i+1:]...)
+		}
+	}
+	return seats
+}
@@ -0,0 +1,185 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/repository"
+	"12305/sms"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"time"
+)
+
+var (
+	ErrSmsCodeInvalid   = errors.New("验证码错误")
+	ErrSmsCodeExpired   = errors.New("验证码已过期，请重新获取")
+	ErrSmsCodeExhausted = errors.New("验证码错误次数过多，请重新获取")
+	ErrSmsTooFrequent   = errors.New("验证码发送过于频繁，请稍后再试")
+)
+
+// 中国大陆手机号
+var phonePattern = regexp.MustCompile(`^1[3-9][0-9]{9}$`)
+
+// 验证码有效期、错误次数与发送频率限制，为空时使用默认值
+type SmsPolicy struct {
+	CodeTTL         time.Duration
+	MaxAttempts     int
+	ResendInterval  time.Duration
+	PhoneDailyLimit int64
+	IPHourlyLimit   int64
+}
+
+var defaultSmsPolicy = SmsPolicy{
+	CodeTTL:         5 * time.Minute,
+	MaxAttempts:     5,
+	ResendInterval:  time.Minute,
+	PhoneDailyLimit: 10,
+	IPHourlyLimit:   20,
+}
+
+// 补齐未配置的限制
+func (p SmsPolicy) withDefaults() SmsPolicy {
+	if p.CodeTTL <= 0 {
+		p.CodeTTL = defaultSmsPolicy.CodeTTL
+	}
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = defaultSmsPolicy.MaxAttempts
+	}
+	if p.ResendInterval <= 0 {
+		p.ResendInterval = defaultSmsPolicy.ResendInterval
+	}
+	if p.PhoneDailyLimit <= 0 {
+		p.PhoneDailyLimit = defaultSmsPolicy.PhoneDailyLimit
+	}
+	if p.IPHourlyLimit <= 0 {
+		p.IPHourlyLimit = defaultSmsPolicy.IPHourlyLimit
+	}
+	return p
+}
+
+// 短信验证码：验证码保存在 Redis 中，按用途区分，校验通过或错误次数过多后作废
+type SmsService struct {
+	RedisRepo repository.RedisRepoInterface
+	UserRepo  repository.UserRepoInterface
+	Sender    sms.SMSSender
+	Policy    SmsPolicy
+}
+
+type SmsSrv interface {
+	// 发送验证码，ip 为请求来源，用于限制同一来源的发送频率
+	SendCode(ctx context.Context, scene enum.SmsScene, phone string, ip string) error
+	// 校验验证码，通过后验证码作废
+	VerifyCode(ctx context.Context, scene enum.SmsScene, phone string, code string) error
+}
+
+var _ SmsSrv = (*SmsService)(nil)
+
+// 校验手机号格式
+func ValidatePhone(phone string) error {
+	if !phonePattern.MatchString(phone) {
+		return errors.New("手机号格式错误")
+	}
+	return nil
+}
+
+func (s *SmsService) SendCode(ctx context.Context, scene enum.SmsScene, phone string, ip string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !scene.IsValid() {
+		return fmt.Errorf("无效的验证码用途: %s", string(scene))
+	}
+	if err := ValidatePhone(phone); err != nil {
+		return err
+	}
+	policy := s.Policy.withDefaults()
+	if err := s.throttle(ctx, policy, phone, ip); err != nil {
+		return err
+	}
+
+	registered, err := s.UserRepo.ExistByUserPhone(ctx, phone)
+	if err != nil {
+		return fmt.Errorf("查询用户失败: %v", err)
+	}
+	// 已注册的手机号不发送注册、更换手机号验证码，未注册的不发送登录、重置密码验证码，
+	// 均与正常发送返回相同结果，避免探测手机号是否注册
+	if registered == scene.ForNewPhone() {
+		return nil
+	}
+
+	code, err := randomCode()
+	if err != nil {
+		return err
+	}
+	if err := s.RedisRepo.SaveSmsCode(ctx, string(scene), phone, code, policy.CodeTTL); err != nil {
+		return fmt.Errorf("保存验证码失败: %v", err)
+	}
+	content := fmt.Sprintf("【12305】您的%s验证码为 %s，%d分钟内有效，请勿泄露给他人。", scene, code, int(policy.CodeTTL.Minutes()))
+	if err := s.Sender.Send(ctx, phone, content); err != nil {
+		return fmt.Errorf("发送短信失败: %v", err)
+	}
+	return nil
+}
+
+// 同一手机号发送间隔与每日上限、同一来源每小时上限
+func (s *SmsService) throttle(ctx context.Context, policy SmsPolicy, phone string, ip string) error {
+	limits := []struct {
+		kind    string
+		subject string
+		window  time.Duration
+		max     int64
+	}{
+		{"phone_interval", phone, policy.ResendInterval, 1},
+		{"phone_daily", phone, 24 * time.Hour, policy.PhoneDailyLimit},
+		{"ip_hourly", ip, time.Hour, policy.IPHourlyLimit},
+	}
+	for _, limit := range limits {
+		if limit.subject == "" {
+			continue
+		}
+		count, err := s.RedisRepo.IncrSmsLimit(ctx, limit.kind, limit.subject, limit.window)
+		if err != nil {
+			return fmt.Errorf("检查发送频率失败: %v", err)
+		}
+		if count > limit.max {
+			return ErrSmsTooFrequent
+		}
+	}
+	return nil
+}
+
+func (s *SmsService) VerifyCode(ctx context.Context, scene enum.SmsScene, phone string, code string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if code == "" {
+		return ErrSmsCodeInvalid
+	}
+	policy := s.Policy.withDefaults()
+	result, err := s.RedisRepo.CheckSmsCode(ctx, string(scene), phone, code, policy.MaxAttempts)
+	if err != nil {
+		return fmt.Errorf("校验验证码失败: %v", err)
+	}
+	switch result {
+	case repository.SmsCodeMatched:
+		return nil
+	case repository.SmsCodeMismatch:
+		return ErrSmsCodeInvalid
+	case repository.SmsCodeExhausted:
+		return ErrSmsCodeExhausted
+	default:
+		return ErrSmsCodeExpired
+	}
+}
+
+// 6位数字验证码
+func randomCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", fmt.Errorf("生成验证码失败: %v", err)
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"12305/config"
+	"12305/model"
+	"12305/query"
+	"12305/repository"
+	"12305/utils"
+	"context"
+	"fmt"
+	"time"
+)
+
+type StationService struct {
+	StationRepo repository.StationRepoInterface
+}
+
+type StationSrv interface {
+	List(ctx context.Context, req *query.ListQuery) ([]*model.Station, error)
+	Get(ctx context.Context, station *model.Station) (*model.Station, error)
+	Create(ctx context.Context, station *model.Station) (*model.Station, error)
+	Edit(ctx context.Context, station *model.Station) (bool, error)
+	Delete(ctx context.Context, station *model.Station) (bool, error)
+}
+
+var _ StationSrv = (*StationService)(nil)
+
+func (s *StationService) List(ctx context.Context, req *query.ListQuery) ([]*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.PageSize <= 1 {
+		req.PageSize = config.PageSize
+	}
+	return s.StationRepo.List(ctx, req)
+}
+
+func (s *StationService) Get(ctx context.Context, station *model.Station) (*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.StationRepo.Get(ctx, station)
+}
+
+func (s *StationService) Create(ctx context.Context, station *model.Station) (*model.Station, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	exist, err := s.StationRepo.Exist(ctx, *station)
+	if err != nil {
+		fmt.Println("查询车站是否存在失败", err)
+		return nil, err
+	}
+	if exist {
+		fmt.Println("车站已存在")
+		return nil, nil
+	}
+	if station.StationName == "" {
+		return nil, fmt.Errorf("站名不能为空")
+	}
+	if station.StationId == "" {
+		station.StationId = utils.GetUUID()
+	}
+	station.CreateTime = time.Now()
+	station.UpdateTime = time.Now()
+	return s.StationRepo.CreateStation(ctx, station)
+}
+
+func (s *StationService) Edit(ctx context.Context, station *model.Station) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.StationRepo.Exist(ctx, *station)
+	if err != nil {
+		fmt.Println("查询车站是否存在失败", err)
+		return false, err
+	}
+	if !exist {
+		fmt.Println("车站不存在")
+		return false, nil
+	}
+	return s.StationRepo.Edit(ctx, station)
+}
+
+func (s *StationService) Delete(ctx context.Context, station *model.Station) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.StationRepo.Exist(ctx, *station)
+	if err != nil {
+		fmt.Println("查询车站是否存在失败", err)
+		return false, err
+	}
+	if !exist {
+		fmt.Println("车站不存在")
+		return false, nil
+	}
+	return s.StationRepo.Delete(ctx, station)
+}
@@ -2,39 +2,109 @@ package service
 
 import (
 	"12305/enum"
+	"12305/identity"
 	"12305/model"
 	"12305/mq/sender"
+	"12305/query"
 	"12305/repository"
 	"12305/response"
 	"12305/utils"
 	"context"
 	"errors"
 	"fmt"
+	"math"
+	"sort"
 	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 一个订单最多购买的座位数
+	maxOrderItems = 5
+	// 服务端选座时座位被抢走后最多重新选座的次数
+	maxAllocateAttempts = 3
 )
 
+// 座位已被占用或正被其他请求锁定，服务端选座时可换座重试
+var errSeatTaken = errors.New("座位已被占用")
+
+// 乘车人原因导致的购票失败（不存在、未核验、行程冲突），重试也不会成功；
+// 候补兑现据此放弃该候补订单，而不是阻塞排在后面的候补
+type passengerError struct {
+	msg string
+}
+
+func (e *passengerError) Error() string {
+	return e.msg
+}
+
+func passengerErrorf(format string, args ...interface{}) error {
+	return &passengerError{msg: fmt.Sprintf(format, args...)}
+}
+
+func isPassengerError(err error) bool {
+	var e *passengerError
+	return errors.As(err, &e)
+}
+
 type TicketService struct {
-	TicketRepo   repository.TicketRepository
-	RedisRepo    repository.RedisRepository
-	LocalRepo    repository.LocalRepository
-	RabbitmqRepo sender.SenderStruct
+	TicketRepo    repository.TicketRepoInterface
+	RedisRepo     repository.RedisRepoInterface
+	LocalRepo     repository.LocalRepoInterface
+	RouteRepo     repository.RouteRepoInterface
+	TrainRepo     repository.TrainRepoInterface
+	TrainRunRepo  repository.TrainRunRepoInterface
+	PassengerRepo repository.PassengerRepoInterface
+	OrderRepo     repository.OrderRepoInterface
+	// 兑现候补时在购票事务中更新候补状态
+	WaitlistRepo repository.WaitlistRepoInterface
+	RabbitmqRepo sender.Sender
+	// 服务端选座策略，为空时使用同排相邻策略
+	Allocator SeatAllocator
+	// 座位释放后通知候补兑现，可为空
+	ReleaseListener SeatReleaseListener
+	// 订单支付时限，为空时使用默认值
+	PaymentWindow time.Duration
+	// 退票时通过支付服务原路退款
+	PaymentService PaymentSrv
+	// 退票手续费档位，为空时使用默认档位
+	RefundFeeTiers []RefundFeeTier
+	// 直接填写的乘车人购票时实名核验，为空时使用离线模拟核验
+	Verifier identity.Verifier
 }
 
 type TicketSrv interface {
 	//ListByTicketTag(ctx context.Context, trainnumber interface{}) ([]*model.Ticket, error)
 	// GetTotal(ctx context.Context, req *query.ListQuery) (int64, error)
 	Get(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error)
-	//缓存穿透模式
-	ListByTicketTagReadThrough(ctx context.Context, tickettag string) ([]*model.Ticket, error)
-	BuyTicketWriteThrough(ctx context.Context, ticket *model.Ticket, user response.User) (bool, error)
+	//缓存穿透模式，仅返回指定日期开行、在 [上车站, 下车站) 全程空闲的座位
+	ListByTicketTagReadThrough(ctx context.Context, tickettag string, runDate string, fromStation string, toStation string) ([]*model.Ticket, error)
+	// 为多名乘车人购票，全部座位购买成功或全部失败
+	BuyTicketWriteThrough(ctx context.Context, req *query.BuyTicketQuery, user response.User) (*model.Order, error)
+	// 兑现候补订单：由服务端按席别选座，候补状态与座位在同一事务中更新，预付款足够时订单直接支付
+	BuyForWaitlist(ctx context.Context, waitlist *model.Waitlist) (*model.Order, error)
 	Create(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error)
 	Edit(ctx context.Context, ticket *model.Ticket) (bool, error)
 	Delete(ctx context.Context, ticket *model.Ticket) (bool, error)
+	// 退票：按距发车时间收取手续费后原路退款，座位恢复可售
+	RefundOrder(ctx context.Context, userId string, orderId string) (*response.OrderRefund, error)
+	// 改签：原座位释放与新座位售出在同一事务中完成，差价原路退还或生成补差价支付
+	ChangeTicket(ctx context.Context, userId string, req *query.ChangeTicketQuery) (*model.Order, error)
+	// 座位图：按车厢返回座位布局及在区间内的可售状态
+	GetSeatMap(ctx context.Context, tickettag string, runDate string, fromStation string, toStation string) ([]*response.SeatMapCarriage, error)
+	// 释放超时未支付的订单：取消订单并将座位恢复为可售，返回是否释放
+	ReleaseHeldOrder(ctx context.Context, orderId string) (bool, error)
+	// 定时扫描到期的待支付订单并释放
+	StartHoldReleaseJob(ctx context.Context, interval time.Duration)
 	// 新增：缓存管理
 	WarmUpCache(ctx context.Context) error
 	GetCacheStats(ctx context.Context) (map[string]interface{}, error)
 }
 
+var _ TicketSrv = (*TicketService)(nil)
+var _ ChangePaidListener = (*TicketService)(nil)
+
 func (s *TicketService) Get(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -42,91 +112,471 @@ func (s *TicketService) Get(ctx context.Context, ticket *model.Ticket) (*model.T
 	return s.TicketRepo.Get(ctx, ticket)
 }
 
-// WriteThrough模式
-func (s *TicketService) BuyTicketWriteThrough(ctx context.Context, ticket *model.Ticket, user response.User) (bool, error) {
-	// 创建安全分布式锁
-	safeLock := s.RedisRepo.NewSafeDistributedLock(ticket.TicketId, 10*time.Second)
+// WriteThrough模式，按乘车区间为多名乘车人购票，座位由客户端指定或服务端按席别分配：
+// 所有座位按TicketId顺序加分布式锁，在同一事务中以乐观锁占用区间，任一座位失败则整单回滚
+func (s *TicketService) BuyTicketWriteThrough(ctx context.Context, req *query.BuyTicketQuery, user response.User) (*model.Order, error) {
+	if err := checkAccountVerified(user, "购票"); err != nil {
+		return nil, err
+	}
+	return s.buy(ctx, req, user, nil)
+}
+
+var ErrAccountNotVerified = errors.New("当前账号未通过实名核验")
+
+// 购票账号本人须已通过实名核验，action 为被拒绝的操作名称
+func checkAccountVerified(user response.User, action string) error {
+	if user.VerifyStatus != enum.VerifyStatusVerified {
+		return fmt.Errorf("%w（%s），不能%s，请先完成实名核验", ErrAccountNotVerified, user.VerifyStatus, action)
+	}
+	return nil
+}
+
+func (s *TicketService) BuyForWaitlist(ctx context.Context, waitlist *model.Waitlist) (*model.Order, error) {
+	req := &query.BuyTicketQuery{
+		TicketTag:   string(waitlist.TicketTag),
+		RunDate:     waitlist.RunDate,
+		FromStation: waitlist.FromStation,
+		ToStation:   waitlist.ToStation,
+		SeatClass:   int(waitlist.SeatClass),
+	}
+	for _, passenger := range waitlist.Passengers {
+		req.Items = append(req.Items, query.BuyTicketItemQuery{PassengerId: passenger.PassengerId})
+	}
+	return s.buy(ctx, req, response.User{UserId: waitlist.UserId}, waitlist)
+}
 
-	// 获取锁
-	acquired, err := safeLock.Acquire(ctx)
+// 购票，waitlist不为空时为兑现该候补订单
+func (s *TicketService) buy(ctx context.Context, req *query.BuyTicketQuery, user response.User, waitlist *model.Waitlist) (*model.Order, error) {
+	items, err := s.buyItemsOf(ctx, req, user)
 	if err != nil {
-		return false, fmt.Errorf("获取分布式锁失败: %v", err)
+		return nil, err
 	}
-	if !acquired {
-		return false, errors.New("票务繁忙，请稍后重试")
+	runDate := req.RunDate
+	if runDate == "" {
+		runDate = time.Now().Format(utils.DateLayout)
+	}
+	if runDate < time.Now().Format(utils.DateLayout) {
+		return nil, errors.New("该车次已发车")
 	}
 
-	// 确保锁会被释放
-	defer func() {
-		if err := safeLock.Release(ctx); err != nil {
-			fmt.Printf("释放分布式锁失败: %v\n", err)
-		}
-	}()
+	// 计算乘车区间
+	seg, err := loadSegment(ctx, s.RouteRepo, enum.TicketTag(req.TicketTag), req.FromStation, req.ToStation)
+	if err != nil {
+		return nil, err
+	}
+	// 当天的车次以上车站发车时间为准
+	if !scheduleTime(runDate, seg.DepartTime, seg.DepartDay).After(time.Now()) {
+		return nil, errors.New("该车次已发车")
+	}
+	if items[0].TicketId != "" {
+		return s.sellSeats(ctx, req.TicketTag, runDate, seg, items, user, waitlist)
+	}
+	return s.allocateAndSell(ctx, req, runDate, seg, items, user, waitlist)
+}
 
-	// 执行业务逻辑（事务 + 乐观锁）
-	err = s.TicketRepo.ExecuteTransaction(func(r *repository.TicketRepository) error {
-		// 获取当前票务信息
-		currentTicket, err := r.Get(ctx, ticket)
+// 服务端选座后购票；选中的座位被并发抢走时排除这些座位重新选座
+func (s *TicketService) allocateAndSell(ctx context.Context, req *query.BuyTicketQuery, runDate string, seg *model.Segment, items []buyItem, user response.User, waitlist *model.Waitlist) (*model.Order, error) {
+	class := enum.SeatClass(req.SeatClass)
+	if !class.IsValid() {
+		return nil, fmt.Errorf("无效的席别: %d", req.SeatClass)
+	}
+	seatReq := SeatRequest{SeatClass: class}
+	for _, item := range items {
+		seatReq.Preferences = append(seatReq.Preferences, item.Preference)
+	}
+
+	excluded := make(map[string]bool)
+	for attempt := 1; attempt <= maxAllocateAttempts; attempt++ {
+		candidates, err := s.freeSeats(ctx, req.TicketTag, runDate, class, seg, excluded)
 		if err != nil {
-			return fmt.Errorf("获取票务信息失败: %v", err)
+			return nil, err
+		}
+		seats, err := s.seatAllocator().Allocate(candidates, seg, seatReq)
+		if err != nil {
+			return nil, fmt.Errorf("%s%w", class, err)
+		}
+		for i := range items {
+			items[i].TicketId = seats[i].TicketId
+			excluded[seats[i].TicketId] = true
 		}
 
-		// 验证票务状态
-		if currentTicket.TicketStatus != enum.TicketStatusNormal {
-			return errors.New("票已售出或不可用")
+		order, err := s.sellSeats(ctx, req.TicketTag, runDate, seg, items, user, waitlist)
+		if err == nil || !errors.Is(err, errSeatTaken) {
+			return order, err
 		}
+		fmt.Printf("第 %d 次选座冲突，重新选座: %v\n", attempt, err)
+	}
+	return nil, fmt.Errorf("选座失败，请稍后重试: %w", errSeatTaken)
+}
 
-		// 使用带重试的乐观锁更新数据库
-		success, err := r.UpdateTicketStatusWithOptimisticLockRetry(ctx, ticket.TicketId, enum.TicketStatusSold, 3)
-		if err != nil {
-			return fmt.Errorf("更新票务状态失败: %v", err)
+// 该席别在乘车区间内全程空闲的座位，不含excluded中的座位
+func (s *TicketService) freeSeats(ctx context.Context, ticketTag string, runDate string, class enum.SeatClass, seg *model.Segment, excluded map[string]bool) ([]*model.Ticket, error) {
+	tickets, err := s.listByTicketTagReadThrough(ctx, ticketTag, runDate)
+	if err != nil {
+		return nil, err
+	}
+	candidates := make([]*model.Ticket, 0, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.SeatClass == class && ticket.TicketStatus == enum.TicketStatusNormal &&
+			ticket.IsSegmentFree(seg) && !excluded[ticket.TicketId] {
+			candidates = append(candidates, ticket)
 		}
+	}
+	return candidates, nil
+}
 
-		if !success {
-			return errors.New("抢票失败，票已被其他用户购买")
+func (s *TicketService) seatAllocator() SeatAllocator {
+	if s.Allocator == nil {
+		return &AdjacentSeatAllocator{}
+	}
+	return s.Allocator
+}
+
+// 锁定并售出指定座位，全部成功或全部失败
+func (s *TicketService) sellSeats(ctx context.Context, ticketTag string, runDate string, seg *model.Segment, items []buyItem, user response.User, waitlist *model.Waitlist) (*model.Order, error) {
+	ticketIds := make([]string, 0, len(items))
+	for _, item := range items {
+		ticketIds = append(ticketIds, item.TicketId)
+	}
+	// 获取全部座位的锁，确保锁会被释放
+	locks, err := s.acquireTicketLocks(ctx, ticketIds)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseTicketLocks(ctx, locks)
+
+	var order *model.Order
+	var soldTickets []*model.Ticket
+	prepaid := false
+	// 执行业务逻辑（事务 + 乐观锁）
+	err = s.TicketRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.TicketRepo.WithDB(tx)
+		now := time.Now()
+		// 座位先锁定，支付时限内未支付则自动取消订单并释放座位
+		order = &model.Order{
+			OrderId:     utils.GetUUID(),
+			UserId:      user.UserId,
+			OrderStatus: enum.OrderStatusNormal,
+			ExpireTime:  now.Add(s.paymentWindow()),
+			CreateTime:  now,
+			UpdateTime:  now,
 		}
+		soldTickets = soldTickets[:0]
+		var totalPrice float64
+		orderRepo := s.OrderRepo.WithDB(tx)
+		for _, item := range items {
+			// 同一证件在同一开行计划上不能持有区间重叠的两个座位，与座位一起在事务内占用
+			if err := claimTrip(ctx, orderRepo, &item.Passenger, enum.TicketTag(ticketTag), runDate, seg.Mask); err != nil {
+				return err
+			}
 
-		// 更新票务状态（用于缓存同步）
-		currentTicket.TicketStatus = enum.TicketStatusSold
-		currentTicket.Version++
-		currentTicket.UpdateTime = time.Now()
+			// 获取当前票务信息
+			currentTicket, err := r.Get(ctx, &model.Ticket{TicketId: item.TicketId})
+			if err != nil {
+				return fmt.Errorf("获取票务信息失败: %v", err)
+			}
+
+			// 验证票务状态、车次及乘车日期
+			if currentTicket.TicketStatus != enum.TicketStatusNormal {
+				return fmt.Errorf("座位 %s 已售出或不可用: %w", item.TicketId, errSeatTaken)
+			}
+			if string(currentTicket.TicketTag) != ticketTag || currentTicket.RunDate != runDate {
+				return fmt.Errorf("座位 %s 与车次或乘车日期不符", item.TicketId)
+			}
+			if !currentTicket.IsSegmentFree(seg) {
+				return fmt.Errorf("座位 %s 在该区间已售出: %w", item.TicketId, errSeatTaken)
+			}
 
-		// 同步更新Redis缓存
-		if err := s.RedisRepo.SyncTicketToCache(ctx, currentTicket); err != nil {
-			return fmt.Errorf("更新Redis缓存失败: %v", err)
+			// 使用带重试的乐观锁占用区间
+			soldTicket, err := r.OccupySegmentWithOptimisticLockRetry(ctx, item.TicketId, seg, 3)
+			if err != nil {
+				return fmt.Errorf("更新票务状态失败: %v", err)
+			}
+			if soldTicket == nil {
+				return fmt.Errorf("抢票失败，票已被其他用户购买: %w", errSeatTaken)
+			}
+			soldTickets = append(soldTickets, soldTicket)
+
+			order.Items = append(order.Items, model.OrderItem{
+				OrderItemId:       utils.GetUUID(),
+				OrderId:           order.OrderId,
+				TicketId:          soldTicket.TicketId,
+				PassengerSnapshot: model.NewPassengerSnapshot(&item.Passenger),
+				TicketTag:         soldTicket.TicketTag,
+				RunDate:           soldTicket.RunDate,
+				CarriageNo:        soldTicket.CarriageNo,
+				SeatClass:         soldTicket.SeatClass,
+				SeatRow:           soldTicket.SeatRow,
+				SeatLetter:        soldTicket.SeatLetter,
+				SegmentMask:       seg.Mask,
+				ItemStatus:        enum.TicketStatusHeld,
+				PriceSnapshot:     model.NewPriceSnapshot(soldTicket.TicketPrice),
+				Departure:         seg.FromStation,
+				Destination:       seg.ToStation,
+				DepartureTime:     scheduleTime(runDate, seg.DepartTime, seg.DepartDay),
+				ArrivalTime:       scheduleTime(runDate, seg.ArriveTime, seg.ArriveDay),
+				CreateTime:        now,
+				UpdateTime:        now,
+			})
+			totalPrice += soldTicket.TicketPrice
 		}
+		order.TotalPrice = math.Round(totalPrice*100) / 100
 
-		// 创建订单
-		order := &model.Order{
-			OrderId:     utils.GetUUID(),
-			OrderStatus: enum.OrderStatusPending,
-			TotalPrice:  currentTicket.TicketPrice,
-			CreateTime:  time.Now(),
-			UpdateTime:  time.Now(),
-			User:        user,
-			Ticket:      *currentTicket,
+		if waitlist != nil {
+			var err error
+			if prepaid, err = s.fulfilWaitlist(ctx, tx, waitlist, order); err != nil {
+				return err
+			}
 		}
 
-		// 发送订单到消息队列
+		// 发送订单到消息队列，发送失败时整单回滚
 		if err := s.RabbitmqRepo.SendOrder(ctx, *order); err != nil {
 			return fmt.Errorf("发送订单到消息队列失败: %v", err)
 		}
-
-		fmt.Printf("安全锁模式: 已同时更新数据库和缓存\n")
 		return nil
 	})
 
 	if err != nil {
 		fmt.Printf("抢票失败: %v\n", err)
+		return nil, err
+	}
+
+	// 事务提交后再同步缓存，避免回滚后缓存中残留已售状态
+	s.syncTicketCaches(ctx, ticketTag, runDate, soldTickets)
+	if waitlist != nil {
+		s.settlePrepayment(ctx, waitlist, order, prepaid)
+	}
+	if !prepaid {
+		if err := s.RedisRepo.AddOrderHold(ctx, order.OrderId, order.ExpireTime); err != nil {
+			fmt.Printf("登记订单支付时限失败: %v\n", err)
+		}
+	}
+	fmt.Printf("抢票成功，订单 %s 共 %d 个座位\n", order.OrderId, len(order.Items))
+	return order, nil
+}
+
+// 在购票事务中将候补订单置为已兑现并记录订单，兑现后不会重复下单；
+// 预付款足以支付订单时转为订单的支付，订单直接置为已支付，返回是否已支付
+func (s *TicketService) fulfilWaitlist(ctx context.Context, tx *gorm.DB, waitlist *model.Waitlist, order *model.Order) (bool, error) {
+	ok, err := s.WaitlistRepo.WithDB(tx).UpdateStatus(ctx, waitlist.WaitlistId, []enum.WaitlistStatus{enum.WaitlistStatusWaiting}, enum.WaitlistStatusFulfilled, order.OrderId)
+	if err != nil {
+		return false, fmt.Errorf("更新候补订单状态失败: %v", err)
+	}
+	if !ok {
+		return false, errors.New("候补订单已不在候补中")
+	}
+	if waitlist.PaymentNo == "" || order.TotalPrice > waitlist.Prepayment+0.005 {
+		return false, nil
+	}
+	paymentSrv := s.PaymentService.WithDB(tx)
+	if err := paymentSrv.ApplyPrepayment(ctx, waitlist.PaymentNo, order.OrderId); err != nil {
 		return false, err
 	}
+	// 多出的预付款在同一事务中登记为退款中，提交后退还，失败由退款重试任务补偿
+	if excess := math.Round((waitlist.Prepayment-order.TotalPrice)*100) / 100; excess > 0 {
+		if err := paymentSrv.PrepareRefundDiff(ctx, order.OrderId, excess, "候补预付款退还多余部分"); err != nil {
+			return false, err
+		}
+	}
+	order.OrderStatus = enum.OrderStatusPaid
+	order.ExpireTime = time.Time{}
+	for i := range order.Items {
+		order.Items[i].ItemStatus = enum.TicketStatusSold
+	}
+	return true, nil
+}
+
+// 兑现提交后结算预付款：已支付的订单退还兑现事务中登记的多余预付款；票价高于预付款时全额退还预付款，订单按普通订单支付
+func (s *TicketService) settlePrepayment(ctx context.Context, waitlist *model.Waitlist, order *model.Order, prepaid bool) {
+	if waitlist.PaymentNo == "" {
+		return
+	}
+	if !prepaid {
+		if err := s.PaymentService.RefundPrepayment(ctx, waitlist.PaymentNo, "候补兑现票价高于预付款，订单需另行支付"); err != nil {
+			fmt.Printf("退还候补订单 %s 预付款失败: %v\n", waitlist.WaitlistId, err)
+		}
+		return
+	}
+	if err := s.PaymentService.ProcessRefunds(ctx, order.OrderId); err != nil {
+		fmt.Printf("退还候补订单 %s 多余预付款失败，稍后重试: %v\n", waitlist.WaitlistId, err)
+	}
+}
+
+// 购票明细：座位及乘车人
+type buyItem struct {
+	TicketId   string
+	Passenger  model.Passenger
+	Preference enum.SeatPosition //服务端选座时的座位位置偏好
+}
+
+// 整理购票明细：引用的常用乘车人须属于当前账号；未指定明细时为当前用户购买ticket_id对应的座位；
+// 明细均未指定ticket_id时由服务端选座
+func (s *TicketService) buyItemsOf(ctx context.Context, req *query.BuyTicketQuery, user response.User) ([]buyItem, error) {
+	if req.TicketTag == "" {
+		return nil, errors.New("车次不能为空")
+	}
+	reqItems := req.Items
+	if len(reqItems) == 0 && req.TicketId != "" {
+		reqItems = []query.BuyTicketItemQuery{{
+			TicketId:          req.TicketId,
+			PassengerName:     user.UserName,
+			IdType:            int(user.IdType),
+			PassengerIdentity: user.UserIdentity,
+		}}
+	}
+	if len(reqItems) == 0 {
+		return nil, errors.New("购票明细不能为空")
+	}
+	if len(reqItems) > maxOrderItems {
+		return nil, fmt.Errorf("一个订单最多购买%d张票", maxOrderItems)
+	}
+
+	// 批量加载引用的常用乘车人
+	var passengerIds []string
+	for _, item := range reqItems {
+		if item.PassengerId != "" {
+			passengerIds = append(passengerIds, item.PassengerId)
+		}
+	}
+	saved := make(map[string]*model.Passenger, len(passengerIds))
+	if len(passengerIds) > 0 {
+		passengers, err := s.PassengerRepo.GetByPassengerIds(ctx, user.UserId, passengerIds)
+		if err != nil {
+			return nil, fmt.Errorf("查询乘车人失败: %v", err)
+		}
+		for _, passenger := range passengers {
+			saved[passenger.PassengerId] = passenger
+		}
+	}
+
+	// 要么全部指定座位，要么全部由服务端选座
+	allocate := reqItems[0].TicketId == ""
+	items := make([]buyItem, 0, len(reqItems))
+	seenTickets := make(map[string]bool, len(reqItems))
+	seenDocuments := make(map[string]bool, len(reqItems))
+	for _, reqItem := range reqItems {
+		if (reqItem.TicketId == "") != allocate {
+			return nil, errors.New("同一订单不能同时指定座位和自动选座")
+		}
+		if !allocate && seenTickets[reqItem.TicketId] {
+			return nil, fmt.Errorf("座位 %s 重复", reqItem.TicketId)
+		}
+		seenTickets[reqItem.TicketId] = true
+
+		var passenger model.Passenger
+		if reqItem.PassengerId != "" {
+			p, ok := saved[reqItem.PassengerId]
+			if !ok {
+				return nil, passengerErrorf("乘车人 %s 不存在或不属于当前账号", reqItem.PassengerId)
+			}
+			// 常用乘车人须已通过实名核验
+			if p.VerifyStatus != enum.VerifyStatusVerified {
+				return nil, passengerErrorf("乘车人 %s %s，不能购票", p.PassengerName, p.VerifyStatus)
+			}
+			passenger = *p
+		} else {
+			passenger = model.Passenger{
+				PassengerName: reqItem.PassengerName,
+				IdType:        enum.IdType(reqItem.IdType),
+				IdNumber:      reqItem.PassengerIdentity,
+				PassengerType: enum.PassengerType(reqItem.PassengerType),
+			}
+			if passenger.IdType == 0 {
+				passenger.IdType = enum.IdTypeResidentCard
+			}
+			if passenger.PassengerType == 0 {
+				passenger.PassengerType = enum.PassengerTypeAdult
+			}
+			if err := validatePassenger(&passenger); err != nil {
+				return nil, err
+			}
+			// 直接填写的乘车人在购票时核验
+			result, err := verifyIdentity(ctx, s.Verifier, passenger.PassengerName, passenger.IdType, passenger.IdNumber)
+			if err != nil {
+				return nil, err
+			}
+			if result.Status != enum.VerifyStatusVerified {
+				return nil, passengerErrorf("乘车人 %s 实名核验未通过: %s", passenger.PassengerName, result.Reason)
+			}
+			passenger.VerifyStatus = result.Status
+			passenger.VerifyTime = result.Time
+		}
+
+		document := fmt.Sprintf("%d_%s", passenger.IdType, passenger.IdNumber)
+		if seenDocuments[document] {
+			return nil, fmt.Errorf("乘车人 %s 在同一订单中重复", passenger.PassengerName)
+		}
+		seenDocuments[document] = true
+		items = append(items, buyItem{
+			TicketId:   reqItem.TicketId,
+			Passenger:  passenger,
+			Preference: enum.SeatPosition(reqItem.SeatPreference),
+		})
+	}
+	return items, nil
+}
 
-	// 使本地缓存失效，强制重新加载
-	if err := s.LocalRepo.InvalidateCache(ctx, string(ticket.TicketTag)); err != nil {
+// 占用乘车人在开行计划上的区间，已持有重叠区间的车票时返回错误
+func claimTrip(ctx context.Context, orderRepo repository.OrderRepoInterface, passenger *model.Passenger, ticketTag enum.TicketTag, runDate string, mask int64) error {
+	ok, err := orderRepo.ClaimTrip(ctx, passenger.IdType, passenger.IdNumber, ticketTag, runDate, mask)
+	if err != nil {
+		return fmt.Errorf("占用乘车人行程失败: %v", err)
+	}
+	if !ok {
+		return passengerErrorf("乘车人 %s 在该车次已有行程冲突的车票", passenger.PassengerName)
+	}
+	return nil
+}
+
+// 释放订单明细占用的乘车人行程
+func releaseTrip(ctx context.Context, orderRepo repository.OrderRepoInterface, item *model.OrderItem) error {
+	if err := orderRepo.ReleaseTrip(ctx, item.IdType, item.PassengerIdentity, item.TicketTag, item.RunDate, item.SegmentMask); err != nil {
+		return fmt.Errorf("释放乘车人 %s 的行程失败: %v", item.PassengerName, err)
+	}
+	return nil
+}
+
+// 座位状态变化后同步Redis缓存，并使本地缓存失效强制重新加载
+func (s *TicketService) syncTicketCaches(ctx context.Context, ticketTag string, runDate string, tickets []*model.Ticket) {
+	for _, ticket := range tickets {
+		if err := s.RedisRepo.SyncTicketToCache(ctx, ticket); err != nil {
+			fmt.Printf("更新Redis缓存失败: %v\n", err)
+		}
+	}
+	if err := s.LocalRepo.InvalidateCache(ctx, ticketTag, runDate); err != nil {
 		fmt.Printf("使本地缓存失效失败: %v\n", err)
 	}
-	fmt.Println("抢票成功")
-	return true, nil
+}
+
+// 按TicketId排序后依次加锁，保证多个请求间加锁顺序一致，避免死锁；任一失败则释放已获取的锁
+func (s *TicketService) acquireTicketLocks(ctx context.Context, ticketIds []string) ([]repository.DistributedLock, error) {
+	sorted := append([]string(nil), ticketIds...)
+	sort.Strings(sorted)
+
+	locks := make([]repository.DistributedLock, 0, len(sorted))
+	for _, ticketId := range sorted {
+		lock := s.RedisRepo.NewSafeDistributedLock(ticketId, 10*time.Second)
+		acquired, err := lock.Acquire(ctx)
+		if err != nil {
+			s.releaseTicketLocks(ctx, locks)
+			return nil, fmt.Errorf("获取分布式锁失败: %v", err)
+		}
+		if !acquired {
+			s.releaseTicketLocks(ctx, locks)
+			return nil, fmt.Errorf("票务繁忙，请稍后重试: %w", errSeatTaken)
+		}
+		locks = append(locks, lock)
+	}
+	return locks, nil
+}
+
+// 按加锁的逆序释放
+func (s *TicketService) releaseTicketLocks(ctx context.Context, locks []repository.DistributedLock) {
+	for i := len(locks) - 1; i >= 0; i-- {
+		if err := locks[i].Release(ctx); err != nil {
+			fmt.Printf("释放分布式锁失败: %v\n", err)
+		}
+	}
 }
 
 func (s *TicketService) Create(ctx context.Context, ticket *model.Ticket) (*model.Ticket, error) {
@@ -142,11 +592,25 @@ func (s *TicketService) Create(ctx context.Context, ticket *model.Ticket) (*mode
 		fmt.Println("车票已存在")
 		return nil, nil
 	}
-	Ticket, err := s.TicketRepo.Get(ctx, ticket)
+	// 车次必须已在登记表中且在运营
+	train, err := checkTrainActive(ctx, s.TrainRepo, ticket.TicketTag)
 	if err != nil {
-		fmt.Println("获取车票失败", err)
 		return nil, err
 	}
+	if !ticket.SeatClass.IsValid() {
+		return nil, fmt.Errorf("无效的席别: %d", ticket.SeatClass)
+	}
+	// 座位必须属于某一天的开行计划
+	run, err := s.TrainRunRepo.GetByTicketTagAndDate(ctx, ticket.TicketTag, ticket.RunDate)
+	if err != nil {
+		return nil, fmt.Errorf("车次 %s 在 %s 没有开行计划: %v", ticket.TicketTag, ticket.RunDate, err)
+	}
+	Ticket := &model.Ticket{
+		TicketId:     ticket.TicketId,
+		RunId:        run.RunId,
+		RunDate:      run.RunDate,
+		TicketStatus: enum.TicketStatusNormal,
+	}
 	if Ticket.TicketId == "" {
 		Ticket.TicketId = utils.GetUUID()
 	}
@@ -154,11 +618,21 @@ func (s *TicketService) Create(ctx context.Context, ticket *model.Ticket) (*mode
 	Ticket.UpdateTime = time.Now()
 	Ticket.TicketTag = ticket.TicketTag
 	Ticket.TicketNumber = ticket.TicketNumber
-	Ticket.TicketPrice = ticket.TicketPrice
-	if Ticket.TicketPrice == 0 {
-		Ticket.TicketPrice = 999.999
+	Ticket.CarriageNo = ticket.CarriageNo
+	Ticket.SeatClass = ticket.SeatClass
+	Ticket.SeatRow = ticket.SeatRow
+	Ticket.SeatLetter = ticket.SeatLetter
+	Ticket.SeatPosition = ticket.SeatClass.SeatPositionOf(ticket.SeatLetter)
+	// 票价由席别决定
+	Ticket.TicketPrice = seatClassPrice(train, ticket.SeatClass)
+	created, err := s.TicketRepo.CreateTicket(ctx, Ticket)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.RedisRepo.SyncTicketToCache(ctx, created); err != nil {
+		fmt.Printf("更新Redis缓存失败: %v\n", err)
 	}
-	return s.TicketRepo.CreateTicket(ctx, Ticket)
+	return created, nil
 }
 
 func (s *TicketService) Edit(ctx context.Context, ticket *model.Ticket) (bool, error) {
@@ -179,11 +653,56 @@ func (s *TicketService) Edit(ctx context.Context, ticket *model.Ticket) (bool, e
 		fmt.Println("获取车票失败", err)
 		return false, err
 	}
+	train, err := checkTrainActive(ctx, s.TrainRepo, ticket.TicketTag)
+	if err != nil {
+		return false, err
+	}
+	if !ticket.SeatClass.IsValid() {
+		return false, fmt.Errorf("无效的席别: %d", ticket.SeatClass)
+	}
+	previous := *Ticket
+	if ticket.TicketTag != previous.TicketTag {
+		// 座位改到其他车次时归入该车次同一天的开行计划，已有区间售出的座位不能改
+		if previous.SoldMask != 0 {
+			return false, errors.New("座位已有区间售出，不能修改车次")
+		}
+		run, err := s.TrainRunRepo.GetByTicketTagAndDate(ctx, ticket.TicketTag, previous.RunDate)
+		if err != nil {
+			return false, fmt.Errorf("车次 %s 在 %s 没有开行计划: %v", ticket.TicketTag, previous.RunDate, err)
+		}
+		Ticket.RunId = run.RunId
+		Ticket.RunDate = run.RunDate
+	}
+	// 订单明细不记录车厢与座位号，已有区间售出的座位改动位置会让乘客的座位随之变化
+	moved := ticket.CarriageNo != previous.CarriageNo || ticket.SeatRow != previous.SeatRow || ticket.SeatLetter != previous.SeatLetter
+	if moved && previous.SoldMask != 0 {
+		return false, errors.New("座位已有区间售出，不能修改车厢或座位号")
+	}
 	Ticket.TicketTag = ticket.TicketTag
 	Ticket.TicketNumber = ticket.TicketNumber
-	Ticket.TicketPrice = ticket.TicketPrice
+	Ticket.CarriageNo = ticket.CarriageNo
+	Ticket.SeatClass = ticket.SeatClass
+	Ticket.SeatRow = ticket.SeatRow
+	Ticket.SeatLetter = ticket.SeatLetter
+	// 与新增座位一致，靠窗/过道由席别和座位号决定
+	Ticket.SeatPosition = ticket.SeatClass.SeatPositionOf(ticket.SeatLetter)
+	Ticket.TicketPrice = seatClassPrice(train, ticket.SeatClass)
 	Ticket.UpdateTime = time.Now()
-	return s.TicketRepo.Edit(ctx, Ticket)
+	ok, err := s.TicketRepo.Edit(ctx, Ticket)
+	if err != nil || !ok {
+		return ok, err
+	}
+	// 车次变更时从原车次的缓存中移除，避免原车次继续展示该座位
+	if previous.TicketTag != Ticket.TicketTag {
+		if err := s.RedisRepo.RemoveTicketFromCache(ctx, &previous); err != nil {
+			fmt.Printf("删除Redis缓存失败: %v\n", err)
+		}
+		if err := s.LocalRepo.InvalidateCache(ctx, string(previous.TicketTag), previous.RunDate); err != nil {
+			fmt.Printf("使本地缓存失效失败: %v\n", err)
+		}
+	}
+	s.syncTicketCaches(ctx, string(Ticket.TicketTag), Ticket.RunDate, []*model.Ticket{Ticket})
+	return true, nil
 }
 
 func (s *TicketService) Delete(ctx context.Context, ticket *model.Ticket) (bool, error) {
@@ -199,7 +718,23 @@ func (s *TicketService) Delete(ctx context.Context, ticket *model.Ticket) (bool,
 		fmt.Println("车票不存在")
 		return false, nil
 	}
-	return s.TicketRepo.Delete(ctx, ticket)
+	Ticket, err := s.TicketRepo.Get(ctx, ticket)
+	if err != nil {
+		fmt.Println("获取车票失败", err)
+		return false, err
+	}
+	// 已有区间售出的座位不能删除，需先退票
+	if Ticket.SoldMask != 0 {
+		return false, errors.New("座位已有区间售出，不能删除")
+	}
+	ok, err := s.TicketRepo.Delete(ctx, Ticket)
+	if err != nil || !ok {
+		return ok, err
+	}
+	if err := s.RedisRepo.RemoveTicketFromCache(ctx, Ticket); err != nil {
+		fmt.Printf("删除Redis缓存失败: %v\n", err)
+	}
+	return true, nil
 }
 
 // 获取缓存统计信息
@@ -245,9 +780,89 @@ func (s *TicketService) GetCacheStats(ctx context.Context) (map[string]interface
 	return stats, nil
 }
 
+// 按开行日期和乘车区间过滤余票
+func (s *TicketService) ListByTicketTagReadThrough(ctx context.Context, tickettag string, runDate string, fromStation string, toStation string) ([]*model.Ticket, error) {
+	if runDate == "" {
+		runDate = time.Now().Format(utils.DateLayout)
+	}
+	seg, err := loadSegment(ctx, s.RouteRepo, enum.TicketTag(tickettag), fromStation, toStation)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets, err := s.listByTicketTagReadThrough(ctx, tickettag, runDate)
+	if err != nil {
+		return nil, err
+	}
+
+	available := make([]*model.Ticket, 0, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.TicketStatus == enum.TicketStatusDeleted || !ticket.IsSegmentFree(seg) {
+			continue
+		}
+		available = append(available, ticket)
+	}
+	return available, nil
+}
+
+func (s *TicketService) GetSeatMap(ctx context.Context, tickettag string, runDate string, fromStation string, toStation string) ([]*response.SeatMapCarriage, error) {
+	if runDate == "" {
+		runDate = time.Now().Format(utils.DateLayout)
+	}
+	seg, err := loadSegment(ctx, s.RouteRepo, enum.TicketTag(tickettag), fromStation, toStation)
+	if err != nil {
+		return nil, err
+	}
+
+	tickets, err := s.listByTicketTagReadThrough(ctx, tickettag, runDate)
+	if err != nil {
+		return nil, err
+	}
+
+	sorted := make([]*model.Ticket, 0, len(tickets))
+	for _, ticket := range tickets {
+		if ticket.TicketStatus != enum.TicketStatusDeleted {
+			sorted = append(sorted, ticket)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].TicketNumber < sorted[j].TicketNumber
+	})
+
+	carriages := make([]*response.SeatMapCarriage, 0)
+	index := make(map[int]*response.SeatMapCarriage)
+	for _, ticket := range sorted {
+		carriage, ok := index[ticket.CarriageNo]
+		if !ok {
+			carriage = &response.SeatMapCarriage{
+				CarriageNo:    ticket.CarriageNo,
+				SeatClass:     ticket.SeatClass,
+				SeatClassName: ticket.SeatClass.String(),
+			}
+			index[ticket.CarriageNo] = carriage
+			carriages = append(carriages, carriage)
+		}
+		available := ticket.IsSegmentFree(seg)
+		if available {
+			carriage.Available++
+		}
+		carriage.Seats = append(carriage.Seats, response.SeatMapSeat{
+			TicketId:     ticket.TicketId,
+			TicketNumber: ticket.TicketNumber,
+			SeatRow:      ticket.SeatRow,
+			SeatLetter:   ticket.SeatLetter,
+			SeatPosition: ticket.SeatPosition,
+			TicketPrice:  ticket.TicketPrice,
+			Available:    available,
+		})
+	}
+	return carriages, nil
+}
+
 // 实现Read-Through模式
-func (s *TicketService) ListByTicketTagReadThrough(ctx context.Context, tickettag string) ([]*model.Ticket, error) {
-	tickets, err := s.LocalRepo.Get(ctx, tickettag)
+func (s *TicketService) listByTicketTagReadThrough(ctx context.Context, tickettag string, runDate string) ([]*model.Ticket, error) {
+	key := repository.TicketCacheKey(tickettag, runDate)
+	tickets, err := s.LocalRepo.Get(ctx, key)
 	if err == nil && len(tickets) > 0 {
 		fmt.Printf("Read-Through: 从本地缓存获取到 %d 张票\n", len(tickets))
 		return tickets, nil
@@ -257,50 +872,48 @@ func (s *TicketService) ListByTicketTagReadThrough(ctx context.Context, ticketta
 	}
 
 	// 尝试从Redis缓存读取（Read-Through的核心）
-	tickets, err = s.RedisRepo.GetByTicketTag(ctx, tickettag)
+	tickets, err = s.RedisRepo.GetByTicketTag(ctx, tickettag, runDate)
 	if err == nil && len(tickets) > 0 {
 		fmt.Printf("Read-Through: 从Redis缓存获取到 %d 张票\n", len(tickets))
 		return tickets, nil
 	}
 
-	// 防击穿：使用互斥锁保护数据库访问
+	// 防击穿：使用互斥锁保护数据库访问（与Redis读取使用的锁区分，避免重入死锁）
 	protector := utils.GetCacheProtector()
-	mutex := protector.GetMutex(tickettag)
+	mutex := protector.GetMutex("db_" + key)
 	mutex.Lock()
 	defer mutex.Unlock()
 
 	// 双重检查：再次尝试从缓存读取
-	tickets, err = s.RedisRepo.GetByTicketTag(ctx, tickettag)
+	tickets, err = s.RedisRepo.GetByTicketTag(ctx, tickettag, runDate)
 	if err == nil && len(tickets) > 0 {
 		fmt.Printf("Read-Through: 双重检查从Redis缓存获取到 %d 张票\n", len(tickets))
 		return tickets, nil
 	}
 
 	// 缓存未命中，从数据库读取
-	fmt.Printf("Read-Through: Redis缓存未命中，从数据库加载车次 %s 的票务信息\n", tickettag)
-	tickets, err = s.TicketRepo.GetByTicketTag(ctx, []enum.TicketTag{enum.TicketTag(tickettag)})
+	fmt.Printf("Read-Through: Redis缓存未命中，从数据库加载车次 %s (%s) 的票务信息\n", tickettag, runDate)
+	tickets, err = s.TicketRepo.GetByRun(ctx, enum.TicketTag(tickettag), runDate)
 	if err != nil {
 		return nil, fmt.Errorf("从数据库加载票务信息失败: %v", err)
 	}
 
 	// 将数据写入缓存
 	if len(tickets) > 0 {
-		// 批量更新Redis缓存
-		for _, ticket := range tickets {
-			if err := s.RedisRepo.SyncTicketToCache(ctx, ticket); err != nil {
-				fmt.Printf("Read-Through: 更新Redis缓存失败: %v\n", err)
-			}
+		// 整体写入Redis缓存
+		if err := s.RedisRepo.LoadRunToCache(ctx, tickettag, runDate, tickets); err != nil {
+			fmt.Printf("Read-Through: 更新Redis缓存失败: %v\n", err)
 		}
 
 		// 更新本地缓存
-		if err := s.LocalRepo.RefreshCache(ctx, tickettag); err != nil {
+		if err := s.LocalRepo.RefreshCache(ctx, tickettag, runDate); err != nil {
 			fmt.Printf("Read-Through: 更新本地缓存失败: %v\n", err)
 		}
 
 		fmt.Printf("Read-Through: 已将 %d 张票加载到缓存\n", len(tickets))
 	} else {
 		// 防穿透：缓存空结果
-		protector.CacheNull(tickettag, 5*time.Minute)
+		protector.CacheNull(key, 5*time.Minute)
 	}
 	return tickets, nil
 }
@@ -317,35 +930,44 @@ func (s *TicketService) WarmUpCache(ctx context.Context) error {
 
 	// 2. 预热Redis缓存
 	fmt.Println("开始预热Redis缓存...")
-	// 定义热门车次标签
-	popularTags := []enum.TicketTag{
-		"G101", "G102", "G103", "G104", "G105",
-		"D101", "D102", "D103", "D104", "D105",
-		"K101", "K102", "K103", "K104", "K105",
+	// 从车次登记表获取运营中的车次
+	trains, err := s.TrainRepo.ListActive(ctx)
+	if err != nil {
+		fmt.Printf("获取运营车次失败: %v\n", err)
+		return err
 	}
 
-	for _, tag := range popularTags {
-		// 从数据库获取该车次的所有票务信息
-		tickets, err := s.TicketRepo.GetByTicketTag(ctx, []enum.TicketTag{tag})
+	today := time.Now().Format(utils.DateLayout)
+	for _, train := range trains {
+		tag := train.TicketTag
+		// 预热该车次今天及以后已生成的开行计划
+		runs, err := s.TrainRunRepo.ListFromDate(ctx, tag, today)
 		if err != nil {
 			fmt.Printf("预热车次 %s 失败: %v\n", tag, err)
 			continue
 		}
 
-		// 批量更新Redis缓存
-		for _, ticket := range tickets {
-			if err := s.RedisRepo.SyncTicketToCache(ctx, ticket); err != nil {
-				fmt.Printf("预热票务 %s 到Redis失败: %v\n", ticket.TicketId, err)
+		for _, run := range runs {
+			// 从数据库获取该开行计划的所有票务信息
+			tickets, err := s.TicketRepo.GetByRun(ctx, tag, run.RunDate)
+			if err != nil {
+				fmt.Printf("预热车次 %s (%s) 失败: %v\n", tag, run.RunDate, err)
 				continue
 			}
-		}
 
-		// 预热本地缓存
-		if err := s.LocalRepo.RefreshCache(ctx, string(tag)); err != nil {
-			fmt.Printf("预热车次 %s 到本地缓存失败: %v\n", tag, err)
-		}
+			// 整体写入Redis缓存
+			if err := s.RedisRepo.LoadRunToCache(ctx, string(tag), run.RunDate, tickets); err != nil {
+				fmt.Printf("预热车次 %s (%s) 到Redis失败: %v\n", tag, run.RunDate, err)
+				continue
+			}
 
-		fmt.Printf("车次 %s 预热完成，共 %d 张票\n", tag, len(tickets))
+			// 预热本地缓存
+			if err := s.LocalRepo.RefreshCache(ctx, string(tag), run.RunDate); err != nil {
+				fmt.Printf("预热车次 %s (%s) 到本地缓存失败: %v\n", tag, run.RunDate, err)
+			}
+
+			fmt.Printf("车次 %s (%s) 预热完成，共 %d 张票\n", tag, run.RunDate, len(tickets))
+		}
 	}
 
 	fmt.Println("缓存预热完成")
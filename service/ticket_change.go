@@ -0,0 +1,633 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 改签明细：原订单明细及改签后的座位
+type changeItem struct {
+	Old        model.OrderItem
+	TicketId   string
+	Preference enum.SeatPosition //服务端选座时的座位位置偏好
+}
+
+func (s *TicketService) ChangeTicket(ctx context.Context, userId string, req *query.ChangeTicketQuery) (*model.Order, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.PaymentService == nil {
+		return nil, errors.New("未配置支付服务")
+	}
+	order, err := s.OrderRepo.Get(ctx, model.Order{OrderId: req.OrderId})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("订单不存在")
+		}
+		return nil, fmt.Errorf("查询订单失败: %v", err)
+	}
+	if err := checkOrderOwner(userId, order); err != nil {
+		return nil, err
+	}
+	if order.OrderStatus != enum.OrderStatusPaid {
+		return nil, fmt.Errorf("订单%s，不能改签", order.OrderStatus)
+	}
+	if hasPendingChange(order) {
+		return nil, errors.New("订单有待补差价的改签，请先完成支付或等待超时撤销")
+	}
+	items, err := changeItemsOf(order, req)
+	if err != nil {
+		return nil, err
+	}
+
+	// 车次、日期、区间、席别为空时沿用原车票
+	first := items[0].Old
+	ticketTag, runDate := req.TicketTag, req.RunDate
+	fromStation, toStation := req.FromStation, req.ToStation
+	class := enum.SeatClass(req.SeatClass)
+	if ticketTag == "" {
+		ticketTag = string(first.TicketTag)
+	}
+	if runDate == "" {
+		runDate = first.RunDate
+	}
+	if fromStation == "" {
+		fromStation = first.Departure
+	}
+	if toStation == "" {
+		toStation = first.Destination
+	}
+	if class == 0 {
+		class = first.SeatClass
+	}
+	if runDate < time.Now().Format(utils.DateLayout) {
+		return nil, errors.New("改签车次已发车")
+	}
+	train, err := checkTrainActive(ctx, s.TrainRepo, enum.TicketTag(ticketTag))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.TrainRunRepo.GetByTicketTagAndDate(ctx, train.TicketTag, runDate); err != nil {
+		return nil, fmt.Errorf("车次 %s 在 %s 没有开行计划: %v", ticketTag, runDate, err)
+	}
+	seg, err := loadSegment(ctx, s.RouteRepo, train.TicketTag, fromStation, toStation)
+	if err != nil {
+		return nil, err
+	}
+	if !scheduleTime(runDate, seg.DepartTime, seg.DepartDay).After(time.Now()) {
+		return nil, errors.New("改签车次已发车")
+	}
+
+	if items[0].TicketId != "" {
+		return s.swapSeats(ctx, userId, order, ticketTag, runDate, seg, items)
+	}
+
+	// 服务端选座，选中的座位被并发抢走时排除这些座位重新选座
+	if !class.IsValid() {
+		return nil, fmt.Errorf("无效的席别: %d", class)
+	}
+	seatReq := SeatRequest{SeatClass: class}
+	for _, item := range items {
+		seatReq.Preferences = append(seatReq.Preferences, item.Preference)
+	}
+	excluded := make(map[string]bool)
+	for attempt := 1; attempt <= maxAllocateAttempts; attempt++ {
+		candidates, err := s.freeSeats(ctx, ticketTag, runDate, class, seg, excluded)
+		if err != nil {
+			return nil, err
+		}
+		seats, err := s.seatAllocator().Allocate(candidates, seg, seatReq)
+		if err != nil {
+			return nil, fmt.Errorf("%s%w", class, err)
+		}
+		for i := range items {
+			items[i].TicketId = seats[i].TicketId
+			excluded[seats[i].TicketId] = true
+		}
+
+		changed, err := s.swapSeats(ctx, userId, order, ticketTag, runDate, seg, items)
+		if err == nil || !errors.Is(err, errSeatTaken) {
+			return changed, err
+		}
+		fmt.Printf("第 %d 次改签选座冲突，重新选座: %v\n", attempt, err)
+	}
+	return nil, errors.New("选座失败，请稍后重试")
+}
+
+// 整理改签明细：未指定明细时改签订单全部已售车票；原车票须未发车
+func changeItemsOf(order *model.Order, req *query.ChangeTicketQuery) ([]changeItem, error) {
+	var items []changeItem
+	if len(req.Items) == 0 {
+		for _, item := range order.Items {
+			if item.ItemStatus == enum.TicketStatusSold {
+				items = append(items, changeItem{Old: item})
+			}
+		}
+	} else {
+		owned := make(map[string]model.OrderItem, len(order.Items))
+		for _, item := range order.Items {
+			owned[item.OrderItemId] = item
+		}
+		allocate := req.Items[0].TicketId == ""
+		seenItems := make(map[string]bool, len(req.Items))
+		seenTickets := make(map[string]bool, len(req.Items))
+		for _, reqItem := range req.Items {
+			old, ok := owned[reqItem.OrderItemId]
+			if !ok {
+				return nil, fmt.Errorf("订单明细 %s 不存在", reqItem.OrderItemId)
+			}
+			if old.ItemStatus != enum.TicketStatusSold {
+				return nil, fmt.Errorf("乘车人 %s 的车票%s，不能改签", old.PassengerName, old.ItemStatus)
+			}
+			if seenItems[reqItem.OrderItemId] {
+				return nil, fmt.Errorf("订单明细 %s 重复", reqItem.OrderItemId)
+			}
+			seenItems[reqItem.OrderItemId] = true
+			if (reqItem.TicketId == "") != allocate {
+				return nil, errors.New("同一次改签不能同时指定座位和自动选座")
+			}
+			if !allocate && seenTickets[reqItem.TicketId] {
+				return nil, fmt.Errorf("座位 %s 重复", reqItem.TicketId)
+			}
+			seenTickets[reqItem.TicketId] = true
+			items = append(items, changeItem{
+				Old:        old,
+				TicketId:   reqItem.TicketId,
+				Preference: enum.SeatPosition(reqItem.SeatPreference),
+			})
+		}
+	}
+	if len(items) == 0 {
+		return nil, errors.New("没有可改签的车票")
+	}
+	for _, item := range items {
+		if !item.Old.DepartureTime.After(time.Now()) {
+			return nil, fmt.Errorf("乘车人 %s 的原车票已发车，不能改签", item.Old.PassengerName)
+		}
+	}
+	return items, nil
+}
+
+// 原座位和新座位一起按TicketId顺序加锁，加锁后读取新座位算出差价：
+// 差价不为正时在同一事务中先释放原区间再占用新区间，更新订单明细并登记改签记录，差价为负时原路退还；
+// 差价为正时保留原座位，只占用新座位并生成补差价支付，支付成功后再换座，超时未支付则撤销改签并释放新座位
+func (s *TicketService) swapSeats(ctx context.Context, userId string, order *model.Order, ticketTag string, runDate string, seg *model.Segment, items []changeItem) (*model.Order, error) {
+	ticketIds := make([]string, 0, 2*len(items))
+	seen := make(map[string]bool, 2*len(items))
+	for _, item := range items {
+		for _, ticketId := range []string{item.Old.TicketId, item.TicketId} {
+			if !seen[ticketId] {
+				seen[ticketId] = true
+				ticketIds = append(ticketIds, ticketId)
+			}
+		}
+	}
+	locks, err := s.acquireTicketLocks(ctx, ticketIds)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseTicketLocks(ctx, locks)
+
+	changeNo := utils.GetUUID()
+	held := false
+	var releasedTickets, soldTickets []*model.Ticket
+	err = s.TicketRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.TicketRepo.WithDB(tx)
+		orderRepo := s.OrderRepo.WithDB(tx)
+		var diff float64
+		for _, item := range items {
+			ticket, err := r.Get(ctx, &model.Ticket{TicketId: item.TicketId})
+			if err != nil {
+				return fmt.Errorf("获取票务信息失败: %v", err)
+			}
+			diff += ticket.TicketPrice - item.Old.TotalPrice
+		}
+		diff = math.Round(diff*100) / 100
+		held = diff > 0
+
+		releasedTickets = releasedTickets[:0]
+		if !held {
+			// 先释放原座位和原行程，改签到同一座位或同一车次的重叠区间时才能重新占用
+			for _, item := range items {
+				if err := releaseTrip(ctx, orderRepo, &item.Old); err != nil {
+					return err
+				}
+				ticket, err := r.ReleaseSegmentWithOptimisticLockRetry(ctx, item.Old.TicketId, item.Old.SegmentMask, 3)
+				if err != nil {
+					return fmt.Errorf("释放座位 %s 失败: %v", item.Old.TicketId, err)
+				}
+				if ticket == nil {
+					return fmt.Errorf("释放座位 %s 失败，请稍后重试", item.Old.TicketId)
+				}
+				releasedTickets = append(releasedTickets, ticket)
+			}
+		}
+
+		now := time.Now()
+		soldTickets = soldTickets[:0]
+		updated := make([]model.OrderItem, 0, len(items))
+		changes := make([]model.OrderChange, 0, len(items))
+		for _, item := range items {
+			// 补差价前原座位和原行程仍然保留，只占用新区间中原车票未覆盖的部分
+			occupy := *seg
+			tripMask := seg.Mask
+			if held {
+				if string(item.Old.TicketTag) == ticketTag && item.Old.RunDate == runDate {
+					tripMask &^= item.Old.SegmentMask
+				}
+				if item.TicketId == item.Old.TicketId {
+					occupy.Mask &^= item.Old.SegmentMask
+				}
+			}
+			// 同一证件不能持有区间重叠的两个座位
+			if tripMask != 0 {
+				passenger := model.Passenger{PassengerName: item.Old.PassengerName, IdType: item.Old.IdType, IdNumber: item.Old.PassengerIdentity}
+				if err := claimTrip(ctx, orderRepo, &passenger, enum.TicketTag(ticketTag), runDate, tripMask); err != nil {
+					return err
+				}
+			}
+			currentTicket, err := r.Get(ctx, &model.Ticket{TicketId: item.TicketId})
+			if err != nil {
+				return fmt.Errorf("获取票务信息失败: %v", err)
+			}
+			if currentTicket.TicketStatus != enum.TicketStatusNormal {
+				return fmt.Errorf("座位 %s 已售出或不可用: %w", item.TicketId, errSeatTaken)
+			}
+			if string(currentTicket.TicketTag) != ticketTag || currentTicket.RunDate != runDate {
+				return fmt.Errorf("座位 %s 与车次或乘车日期不符", item.TicketId)
+			}
+			if occupy.Mask != 0 {
+				if !currentTicket.IsSegmentFree(&occupy) {
+					return fmt.Errorf("座位 %s 在该区间已售出: %w", item.TicketId, errSeatTaken)
+				}
+				soldTicket, err := r.OccupySegmentWithOptimisticLockRetry(ctx, item.TicketId, &occupy, 3)
+				if err != nil {
+					return fmt.Errorf("更新票务状态失败: %v", err)
+				}
+				if soldTicket == nil {
+					return fmt.Errorf("抢票失败，票已被其他用户购买: %w", errSeatTaken)
+				}
+				soldTickets = append(soldTickets, soldTicket)
+				currentTicket = soldTicket
+			}
+
+			newItem := changedItem(item.Old, currentTicket, seg, now)
+			updated = append(updated, newItem)
+			changes = append(changes, model.OrderChange{
+				ChangeId:       utils.GetUUID(),
+				ChangeNo:       changeNo,
+				OrderId:        order.OrderId,
+				OrderItemId:    item.Old.OrderItemId,
+				PassengerName:  item.Old.PassengerName,
+				OldTicketId:    item.Old.TicketId,
+				OldTicketTag:   item.Old.TicketTag,
+				OldRunDate:     item.Old.RunDate,
+				OldDeparture:   item.Old.Departure,
+				OldDestination: item.Old.Destination,
+				OldPrice:       item.Old.TotalPrice,
+				NewTicketId:    newItem.TicketId,
+				NewTicketTag:   newItem.TicketTag,
+				NewRunDate:     newItem.RunDate,
+				NewDeparture:   newItem.Departure,
+				NewDestination: newItem.Destination,
+				NewPrice:       newItem.TotalPrice,
+				PriceDiff:      math.Round((newItem.TotalPrice-item.Old.TotalPrice)*100) / 100,
+				ChangeStatus:   enum.ChangeStatusCompleted,
+				CreateTime:     now,
+				UpdateTime:     now,
+			})
+		}
+
+		// 新票价更高时生成补差价支付，改签记录待补差价，订单明细和总价在支付成功换座时再更新
+		totalPrice := math.Round((order.TotalPrice+diff)*100) / 100
+		if held {
+			charge, err := s.PaymentService.WithDB(tx).ChargeDiff(ctx, userId, order.OrderId, changeNo, diff)
+			if err != nil {
+				return err
+			}
+			for i := range changes {
+				changes[i].ChangeStatus = enum.ChangeStatusAwaitingPayment
+				changes[i].PaymentNo = charge.PaymentNo
+			}
+			updated = nil
+			totalPrice = order.TotalPrice
+		}
+
+		// 以读取订单时的版本号条件更新，并发的退票或改签只有一个能成功
+		ok, err := orderRepo.ChangeItems(ctx, order.OrderId, order.Version, updated, changes, totalPrice)
+		if err != nil {
+			return fmt.Errorf("更新订单失败: %v", err)
+		}
+		if !ok {
+			return errors.New("订单状态已变更，不能改签")
+		}
+
+		// 退还差价在事务中登记为退款中，提交后再调用支付渠道，改签回滚时不会退款
+		if diff < 0 {
+			return s.PaymentService.WithDB(tx).PrepareRefundDiff(ctx, order.OrderId, -diff, "改签退还差价")
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Printf("改签失败: %v\n", err)
+		return nil, err
+	}
+
+	// 事务提交后同步原车次与新车次的缓存，同一座位的新状态后同步
+	oldTag, oldRunDate := string(items[0].Old.TicketTag), items[0].Old.RunDate
+	if held {
+		s.syncTicketCaches(ctx, ticketTag, runDate, soldTickets)
+		if err := s.RedisRepo.AddChangeHold(ctx, changeNo, time.Now().Add(s.paymentWindow())); err != nil {
+			fmt.Printf("登记改签支付时限失败: %v\n", err)
+		}
+		fmt.Printf("订单 %s 改签待补差价，已占用 %s (%s) 的 %d 个座位\n", order.OrderId, ticketTag, runDate, len(items))
+		return s.OrderRepo.Get(ctx, model.Order{OrderId: order.OrderId})
+	}
+	s.syncTicketCaches(ctx, oldTag, oldRunDate, releasedTickets)
+	s.syncTicketCaches(ctx, ticketTag, runDate, soldTickets)
+	if s.ReleaseListener != nil {
+		go s.ReleaseListener.OnSeatReleased(context.Background(), oldTag, oldRunDate)
+	}
+	// 差价退款失败不影响改签结果，由退款重试任务补偿
+	if err := s.PaymentService.ProcessRefunds(ctx, order.OrderId); err != nil {
+		fmt.Printf("订单 %s 改签差价退款失败，稍后重试: %v\n", order.OrderId, err)
+	}
+	fmt.Printf("订单 %s 改签成功，%d 名乘车人改至 %s (%s)\n", order.OrderId, len(items), ticketTag, runDate)
+	return s.OrderRepo.Get(ctx, model.Order{OrderId: order.OrderId})
+}
+
+func (s *TicketService) OnChangePaid(ctx context.Context, changeNo string) {
+	if err := s.finishChange(ctx, changeNo); err != nil {
+		// 改签仍登记在支付时限中，到期后由释放任务重试换座
+		fmt.Printf("改签 %s 补差价后换座失败，稍后重试: %v\n", changeNo, err)
+	}
+}
+
+// 改签支付时限到期：已补差价的完成换座，仍未补差价的撤销
+func (s *TicketService) ExpireChange(ctx context.Context, changeNo string) error {
+	reverted, err := s.revertChange(ctx, changeNo)
+	if err != nil || reverted {
+		return err
+	}
+	return s.finishChange(ctx, changeNo)
+}
+
+// 补差价后换座：释放原座位和原行程中新车票未覆盖的部分，订单明细改为新座位，总价加上差价
+func (s *TicketService) finishChange(ctx context.Context, changeNo string) error {
+	pending, err := s.loadPendingChange(ctx, changeNo, enum.ChangeStatusPaid)
+	if err != nil || pending == nil {
+		return err
+	}
+	locks, err := s.acquireTicketLocks(ctx, pending.ticketIds())
+	if err != nil {
+		return err
+	}
+	defer s.releaseTicketLocks(ctx, locks)
+
+	completed := false
+	var releasedTickets []*model.Ticket
+	err = s.TicketRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.TicketRepo.WithDB(tx)
+		orderRepo := s.OrderRepo.WithDB(tx)
+		now := time.Now()
+		releasedTickets = releasedTickets[:0]
+		updated := make([]model.OrderItem, 0, len(pending.changes))
+		var diff float64
+		for i, change := range pending.changes {
+			old := pending.items[i]
+			trip := old
+			if old.TicketTag == change.NewTicketTag && old.RunDate == change.NewRunDate {
+				trip.SegmentMask &^= pending.seg.Mask
+			}
+			if trip.SegmentMask != 0 {
+				if err := releaseTrip(ctx, orderRepo, &trip); err != nil {
+					return err
+				}
+			}
+			seatMask := old.SegmentMask
+			if old.TicketId == change.NewTicketId {
+				seatMask &^= pending.seg.Mask
+			}
+			if seatMask != 0 {
+				ticket, err := r.ReleaseSegmentWithOptimisticLockRetry(ctx, old.TicketId, seatMask, 3)
+				if err != nil {
+					return fmt.Errorf("释放座位 %s 失败: %v", old.TicketId, err)
+				}
+				if ticket == nil {
+					return fmt.Errorf("释放座位 %s 失败，请稍后重试", old.TicketId)
+				}
+				releasedTickets = append(releasedTickets, ticket)
+			}
+			newTicket, err := r.Get(ctx, &model.Ticket{TicketId: change.NewTicketId})
+			if err != nil {
+				return fmt.Errorf("获取票务信息失败: %v", err)
+			}
+			updated = append(updated, changedItem(old, newTicket, pending.seg, now))
+			diff += change.PriceDiff
+		}
+		var err error
+		completed, err = orderRepo.CompleteChange(ctx, pending.order.OrderId, changeNo, updated, math.Round(diff*100)/100)
+		if err != nil {
+			return fmt.Errorf("完成改签失败: %v", err)
+		}
+		if !completed {
+			// 已由其他实例完成，回滚本次释放
+			return errChangeSettled
+		}
+		return nil
+	})
+	if errors.Is(err, errChangeSettled) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	oldTag, oldRunDate := string(pending.items[0].TicketTag), pending.items[0].RunDate
+	s.syncTicketCaches(ctx, oldTag, oldRunDate, releasedTickets)
+	if err := s.RedisRepo.RemoveChangeHold(ctx, changeNo); err != nil {
+		fmt.Printf("移除改签支付时限失败: %v\n", err)
+	}
+	if s.ReleaseListener != nil {
+		go s.ReleaseListener.OnSeatReleased(context.Background(), oldTag, oldRunDate)
+	}
+	fmt.Printf("订单 %s 改签 %s 补差价后已换座\n", pending.order.OrderId, changeNo)
+	return nil
+}
+
+// 撤销超时未补差价的改签：释放新座位和新行程中原车票未覆盖的部分，关闭补差价支付；返回是否已撤销
+func (s *TicketService) revertChange(ctx context.Context, changeNo string) (bool, error) {
+	pending, err := s.loadPendingChange(ctx, changeNo, enum.ChangeStatusAwaitingPayment)
+	if err != nil || pending == nil {
+		return false, err
+	}
+	locks, err := s.acquireTicketLocks(ctx, pending.ticketIds())
+	if err != nil {
+		return false, err
+	}
+	defer s.releaseTicketLocks(ctx, locks)
+
+	reverted := false
+	var releasedTickets []*model.Ticket
+	err = s.TicketRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.TicketRepo.WithDB(tx)
+		orderRepo := s.OrderRepo.WithDB(tx)
+		// 与补差价支付回调以改签状态仲裁，只有仍待补差价的改签才能撤销
+		ok, err := orderRepo.UpdateChangeStatus(ctx, changeNo, enum.ChangeStatusAwaitingPayment, enum.ChangeStatusReverted)
+		if err != nil {
+			return fmt.Errorf("撤销改签失败: %v", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		releasedTickets = releasedTickets[:0]
+		for i, change := range pending.changes {
+			old := pending.items[i]
+			trip := old
+			trip.TicketTag, trip.RunDate, trip.SegmentMask = change.NewTicketTag, change.NewRunDate, pending.seg.Mask
+			if old.TicketTag == change.NewTicketTag && old.RunDate == change.NewRunDate {
+				trip.SegmentMask &^= old.SegmentMask
+			}
+			if trip.SegmentMask != 0 {
+				if err := releaseTrip(ctx, orderRepo, &trip); err != nil {
+					return err
+				}
+			}
+			seatMask := pending.seg.Mask
+			if old.TicketId == change.NewTicketId {
+				seatMask &^= old.SegmentMask
+			}
+			if seatMask != 0 {
+				ticket, err := r.ReleaseSegmentWithOptimisticLockRetry(ctx, change.NewTicketId, seatMask, 3)
+				if err != nil {
+					return fmt.Errorf("释放座位 %s 失败: %v", change.NewTicketId, err)
+				}
+				if ticket == nil {
+					return fmt.Errorf("释放座位 %s 失败，请稍后重试", change.NewTicketId)
+				}
+				releasedTickets = append(releasedTickets, ticket)
+			}
+		}
+		// 关闭后晚到的补差价支付找不到待补差价的改签，由支付服务原路退款
+		if err := s.PaymentService.WithDB(tx).ClosePayment(ctx, pending.changes[0].PaymentNo); err != nil {
+			return fmt.Errorf("关闭补差价支付失败: %v", err)
+		}
+		reverted = true
+		return nil
+	})
+	if err != nil || !reverted {
+		return false, err
+	}
+
+	newTag, newRunDate := string(pending.changes[0].NewTicketTag), pending.changes[0].NewRunDate
+	s.syncTicketCaches(ctx, newTag, newRunDate, releasedTickets)
+	if err := s.RedisRepo.RemoveChangeHold(ctx, changeNo); err != nil {
+		fmt.Printf("移除改签支付时限失败: %v\n", err)
+	}
+	if s.ReleaseListener != nil {
+		go s.ReleaseListener.OnSeatReleased(context.Background(), newTag, newRunDate)
+	}
+	fmt.Printf("订单 %s 改签 %s 超时未补差价，已撤销\n", pending.order.OrderId, changeNo)
+	return true, nil
+}
+
+// 改签已由其他实例完成或撤销
+var errChangeSettled = errors.New("改签已处理")
+
+// 待换座或待撤销的改签：改签记录与对应的原订单明细一一对应
+type pendingChange struct {
+	order   *model.Order
+	changes []*model.OrderChange
+	items   []model.OrderItem
+	seg     *model.Segment //改签后的区间
+}
+
+// 原座位和新座位，加锁用
+func (p *pendingChange) ticketIds() []string {
+	ticketIds := make([]string, 0, 2*len(p.changes))
+	seen := make(map[string]bool, 2*len(p.changes))
+	for i, change := range p.changes {
+		for _, ticketId := range []string{p.items[i].TicketId, change.NewTicketId} {
+			if !seen[ticketId] {
+				seen[ticketId] = true
+				ticketIds = append(ticketIds, ticketId)
+			}
+		}
+	}
+	return ticketIds
+}
+
+// 读取处于status状态的改签，不处于该状态时返回nil
+func (s *TicketService) loadPendingChange(ctx context.Context, changeNo string, status enum.ChangeStatus) (*pendingChange, error) {
+	changes, err := s.OrderRepo.ListChanges(ctx, changeNo)
+	if err != nil {
+		return nil, fmt.Errorf("查询改签记录失败: %v", err)
+	}
+	if len(changes) == 0 || changes[0].ChangeStatus != status {
+		return nil, nil
+	}
+	order, err := s.OrderRepo.Get(ctx, model.Order{OrderId: changes[0].OrderId})
+	if err != nil {
+		return nil, fmt.Errorf("查询订单失败: %v", err)
+	}
+	owned := make(map[string]model.OrderItem, len(order.Items))
+	for _, item := range order.Items {
+		owned[item.OrderItemId] = item
+	}
+	pending := &pendingChange{order: order, changes: changes}
+	for _, change := range changes {
+		item, ok := owned[change.OrderItemId]
+		if !ok {
+			return nil, fmt.Errorf("订单明细 %s 不存在", change.OrderItemId)
+		}
+		pending.items = append(pending.items, item)
+	}
+	first := changes[0]
+	pending.seg, err = loadSegment(ctx, s.RouteRepo, first.NewTicketTag, first.NewDeparture, first.NewDestination)
+	if err != nil {
+		return nil, err
+	}
+	return pending, nil
+}
+
+// 订单有待补差价或已补差价待换座的改签
+func hasPendingChange(order *model.Order) bool {
+	for _, change := range order.Changes {
+		if change.ChangeStatus == enum.ChangeStatusAwaitingPayment || change.ChangeStatus == enum.ChangeStatusPaid {
+			return true
+		}
+	}
+	return false
+}
+
+// 原订单明细改为新座位和新区间
+func changedItem(old model.OrderItem, ticket *model.Ticket, seg *model.Segment, now time.Time) model.OrderItem {
+	item := old
+	item.TicketId = ticket.TicketId
+	item.TicketTag = ticket.TicketTag
+	item.RunDate = ticket.RunDate
+	item.CarriageNo = ticket.CarriageNo
+	item.SeatClass = ticket.SeatClass
+	item.SeatRow = ticket.SeatRow
+	item.SeatLetter = ticket.SeatLetter
+	item.SegmentMask = seg.Mask
+	item.UnitPrice = ticket.TicketPrice
+	item.TotalPrice = ticket.TicketPrice
+	item.Ticket = ticket
+	item.Departure = seg.FromStation
+	item.Destination = seg.ToStation
+	item.DepartureTime = scheduleTime(ticket.RunDate, seg.DepartTime, seg.DepartDay)
+	item.ArrivalTime = scheduleTime(ticket.RunDate, seg.ArriveTime, seg.ArriveDay)
+	item.UpdateTime = now
+	return item
+}
@@ -0,0 +1,518 @@
+package service_test
+
+import (
+	"12305/app"
+	"12305/db"
+	"12305/db/migration"
+	"12305/enum"
+	"12305/model"
+	"12305/mq"
+	"12305/payment"
+	"12305/query"
+	"12305/repository"
+	"12305/response"
+	"12305/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/bits"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+// 并发购票测试：数据库使用临时 SQLite 文件，Redis 与订单消息队列使用进程内实现，
+// 通过 app.New 组装与线上相同的服务，验证高并发下不超卖、缓存与数据库一致、分布式锁不泄漏。
+// 本地缓存、布隆过滤器和限流器是包级单例，各用例使用不同的车次避免互相影响
+
+type testEnv struct {
+	app   *app.App
+	db    *gorm.DB
+	redis *redis.Client
+}
+
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+	gdb, err := db.OpenDatabase(&model.DBConf{
+		Driver: db.DriverSQLite,
+		DBName: filepath.Join(t.TempDir(), "12305.db"),
+	})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	sqlDB, err := gdb.DB()
+	if err != nil {
+		t.Fatalf("获取数据库连接失败: %v", err)
+	}
+	// SQLite 只允许一个写事务，限制连接数避免数千个请求同时打开连接
+	sqlDB.SetMaxOpenConns(16)
+	t.Cleanup(func() { sqlDB.Close() })
+	if _, err := migration.NewMigrator(gdb).Up(); err != nil {
+		t.Fatalf("执行迁移失败: %v", err)
+	}
+
+	rdb, server, err := db.NewEmbeddedRedis()
+	if err != nil {
+		t.Fatalf("启动进程内 Redis 失败: %v", err)
+	}
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { rdb.Close() })
+
+	queue := mq.NewMemoryQueue(0)
+	infra := app.Infra{DB: gdb, Redis: rdb, Queue: queue}
+	application := app.New(app.NewRepositories(infra), app.Options{
+		PaymentWindow: 15 * time.Minute,
+		Gateway:       payment.NewMockGateway("test"),
+	})
+
+	// 订单消息落库
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		// 用例很快结束时队列可能在消费者订阅前已关闭
+		err := application.OrderReceiver(infra).StartOrderConsumer(ctx)
+		if err != nil && !errors.Is(err, mq.ErrQueueClosed) {
+			t.Errorf("订单消费者异常退出: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		queue.Close()
+		<-done
+	})
+
+	return &testEnv{app: application, db: gdb, redis: rdb}
+}
+
+// 登记车次线路并为指定日期生成 seats 个二等座，座位同步到 Redis 缓存
+func (env *testEnv) seedRun(t *testing.T, ticketTag string, runDate string, stations []string, seats int) []*model.Ticket {
+	t.Helper()
+	ctx := context.Background()
+	now := time.Now()
+
+	route := &model.Route{
+		RouteId:    "route_" + ticketTag,
+		TicketTag:  enum.TicketTag(ticketTag),
+		CreateTime: now,
+		UpdateTime: now,
+	}
+	for i, station := range stations {
+		stop := model.RouteStop{
+			RouteStopId: fmt.Sprintf("%s_%d", route.RouteId, i),
+			RouteId:     route.RouteId,
+			StationId:   station,
+			Seq:         i,
+			Distance:    i * 100,
+		}
+		if i > 0 {
+			stop.ArriveTime = fmt.Sprintf("%02d:00", 8+i)
+		}
+		if i < len(stations)-1 {
+			stop.DepartTime = fmt.Sprintf("%02d:05", 8+i)
+		}
+		route.Stops = append(route.Stops, stop)
+	}
+	if err := env.db.Create(route).Error; err != nil {
+		t.Fatalf("登记线路失败: %v", err)
+	}
+
+	letters := []string{"A", "B", "C", "D", "F"}
+	tickets := make([]*model.Ticket, 0, seats)
+	for i := 0; i < seats; i++ {
+		letter := letters[i%len(letters)]
+		tickets = append(tickets, &model.Ticket{
+			TicketId:     fmt.Sprintf("%s_%s_%03d", ticketTag, runDate, i),
+			TicketNumber: i + 1,
+			CarriageNo:   1,
+			SeatClass:    enum.SeatClassSecond,
+			SeatRow:      i/len(letters) + 1,
+			SeatLetter:   letter,
+			SeatPosition: enum.SeatClassSecond.SeatPositionOf(letter),
+			TicketTag:    enum.TicketTag(ticketTag),
+			RunDate:      runDate,
+			TicketPrice:  100,
+			TicketStatus: enum.TicketStatusNormal,
+			CreateTime:   now,
+			UpdateTime:   now,
+		})
+	}
+	if err := env.db.Create(&tickets).Error; err != nil {
+		t.Fatalf("生成座位失败: %v", err)
+	}
+	if err := env.app.Repos.Redis.LoadRunToCache(ctx, ticketTag, runDate, tickets); err != nil {
+		t.Fatalf("同步座位缓存失败: %v", err)
+	}
+	// 本地缓存是包级单例，-count 多次运行时清掉上一次运行留下的座位
+	if err := env.app.Repos.Local.InvalidateCache(ctx, ticketTag, runDate); err != nil {
+		t.Fatalf("清除本地缓存失败: %v", err)
+	}
+	return tickets
+}
+
+// 以 n 个不同用户并发购票，返回成功的订单
+func (env *testEnv) buyConcurrently(n int, reqOf func(i int) *query.BuyTicketQuery) []*model.Order {
+	var (
+		mu     sync.Mutex
+		orders []*model.Order
+		wg     sync.WaitGroup
+	)
+	start := make(chan struct{})
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			user := response.User{
+				UserId:       fmt.Sprintf("user_%05d", i),
+				UserName:     fmt.Sprintf("乘客%05d", i),
+				UserIdentity: residentId(i),
+				VerifyStatus: enum.VerifyStatusVerified,
+			}
+			req := reqOf(i)
+			<-start
+			order, err := env.app.Services.Ticket.BuyTicketWriteThrough(context.Background(), req, user)
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			orders = append(orders, order)
+			mu.Unlock()
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	return orders
+}
+
+// 生成校验位正确的18位居民身份证号，不同的 n 生成不同的号码
+func residentId(n int) string {
+	birth := time.Date(1990, 1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, n/1000)
+	body := fmt.Sprintf("110101%s%03d", birth.Format("20060102"), n%1000)
+	weights := []int{7, 9, 10, 5, 8, 4, 2, 1, 6, 3, 7, 9, 10, 5, 8, 4, 2}
+	sum := 0
+	for i, c := range body {
+		sum += int(c-'0') * weights[i]
+	}
+	return body + string("10X98765432"[sum%11])
+}
+
+// 等待订单消息全部落库
+func (env *testEnv) waitOrdersPersisted(t *testing.T, orders []*model.Order) {
+	t.Helper()
+	orderIds := make([]string, 0, len(orders))
+	for _, order := range orders {
+		orderIds = append(orderIds, order.OrderId)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		var count int64
+		if len(orderIds) > 0 {
+			if err := env.db.Model(&model.Order{}).Where("order_id IN ?", orderIds).Count(&count).Error; err != nil {
+				t.Fatalf("查询订单失败: %v", err)
+			}
+		}
+		if int(count) == len(orderIds) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("订单落库超时: 已落库 %d 个，成功下单 %d 个", count, len(orderIds))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// 校验并发购票结束后的不变量，返回已售出的区间数
+func (env *testEnv) checkInvariants(t *testing.T, ticketTag string, runDate string, orders []*model.Order) int {
+	t.Helper()
+	ctx := context.Background()
+	env.waitOrdersPersisted(t, orders)
+
+	var tickets []*model.Ticket
+	if err := env.db.Where("ticket_tag = ? AND run_date = ?", ticketTag, runDate).Find(&tickets).Error; err != nil {
+		t.Fatalf("查询座位失败: %v", err)
+	}
+	dbTickets := make(map[string]*model.Ticket, len(tickets))
+	for _, ticket := range tickets {
+		dbTickets[ticket.TicketId] = ticket
+	}
+
+	// 每个座位的每个区间至多售出一次，且座位的占用位图恰好等于各订单明细区间的并集
+	var items []model.OrderItem
+	if err := env.db.Where("ticket_tag = ? AND run_date = ?", ticketTag, runDate).Find(&items).Error; err != nil {
+		t.Fatalf("查询订单明细失败: %v", err)
+	}
+	soldMasks := make(map[string]int64)
+	for _, item := range items {
+		if soldMasks[item.TicketId]&item.SegmentMask != 0 {
+			t.Errorf("座位 %s 的区间 %b 被重复售出", item.TicketId, item.SegmentMask)
+		}
+		soldMasks[item.TicketId] |= item.SegmentMask
+	}
+	for _, ticket := range tickets {
+		if ticket.SoldMask != soldMasks[ticket.TicketId] {
+			t.Errorf("座位 %s 占用位图为 %b，订单明细占用 %b", ticket.TicketId, ticket.SoldMask, soldMasks[ticket.TicketId])
+		}
+	}
+
+	// 售出的座位数等于成功订单的明细数，每个成功订单都完整落库
+	soldItems := 0
+	for _, order := range orders {
+		soldItems += len(order.Items)
+		var persisted int64
+		if err := env.db.Model(&model.OrderItem{}).Where("order_id = ?", order.OrderId).Count(&persisted).Error; err != nil {
+			t.Fatalf("查询订单明细失败: %v", err)
+		}
+		if int(persisted) != len(order.Items) {
+			t.Errorf("订单 %s 有 %d 个座位，落库 %d 个明细", order.OrderId, len(order.Items), persisted)
+		}
+	}
+	if soldItems != len(items) {
+		t.Errorf("成功订单共 %d 个座位，数据库中有 %d 个订单明细", soldItems, len(items))
+	}
+	holds, err := env.redis.ZCard(ctx, "order_hold_expiry").Result()
+	if err != nil {
+		t.Fatalf("查询待支付订单失败: %v", err)
+	}
+	if int(holds) != len(orders) {
+		t.Errorf("成功订单 %d 个，登记支付时限的订单 %d 个", len(orders), holds)
+	}
+
+	// Redis 缓存与数据库一致
+	cached, err := env.redis.HGetAll(ctx, repository.TicketCacheKey(ticketTag, runDate)).Result()
+	if err != nil {
+		t.Fatalf("读取座位缓存失败: %v", err)
+	}
+	if len(cached) != len(tickets) {
+		t.Errorf("缓存中有 %d 个座位，数据库中有 %d 个", len(cached), len(tickets))
+	}
+	for ticketId, value := range cached {
+		var ticket model.Ticket
+		if err := json.Unmarshal([]byte(value), &ticket); err != nil {
+			t.Fatalf("解析座位缓存失败: %v", err)
+		}
+		dbTicket, ok := dbTickets[ticketId]
+		if !ok {
+			t.Errorf("缓存中的座位 %s 在数据库中不存在", ticketId)
+			continue
+		}
+		if ticket.SoldMask != dbTicket.SoldMask || ticket.TicketStatus != dbTicket.TicketStatus || ticket.Version != dbTicket.Version {
+			t.Errorf("座位 %s 缓存为 (位图 %b, 状态 %d, 版本 %d)，数据库为 (位图 %b, 状态 %d, 版本 %d)", ticketId,
+				ticket.SoldMask, ticket.TicketStatus, ticket.Version, dbTicket.SoldMask, dbTicket.TicketStatus, dbTicket.Version)
+		}
+	}
+
+	// 全部请求结束后不残留分布式锁
+	locks, err := env.redis.Keys(ctx, "ticket_lock_*").Result()
+	if err != nil {
+		t.Fatalf("查询分布式锁失败: %v", err)
+	}
+	if len(locks) > 0 {
+		t.Errorf("残留 %d 个分布式锁: %v", len(locks), locks)
+	}
+	return len(items)
+}
+
+// 数据库中座位占用位图的已售区间位数
+func (env *testEnv) soldBits(t *testing.T, ticketTag string, runDate string) (int, int) {
+	t.Helper()
+	var tickets []*model.Ticket
+	if err := env.db.Where("ticket_tag = ? AND run_date = ?", ticketTag, runDate).Find(&tickets).Error; err != nil {
+		t.Fatalf("查询座位失败: %v", err)
+	}
+	soldBits, soldSeats := 0, 0
+	for _, ticket := range tickets {
+		soldBits += bits.OnesCount64(uint64(ticket.SoldMask))
+		if ticket.SoldMask != 0 {
+			soldSeats++
+		}
+	}
+	return soldBits, soldSeats
+}
+
+// 成功订单明细占用的区间位数
+func orderBits(orders []*model.Order) int {
+	n := 0
+	for _, order := range orders {
+		for _, item := range order.Items {
+			n += bits.OnesCount64(uint64(item.SegmentMask))
+		}
+	}
+	return n
+}
+
+func tomorrow() string {
+	return time.Now().AddDate(0, 0, 1).Format(utils.DateLayout)
+}
+
+// 数千个请求争抢少量指定座位：每个座位至多售出一次
+func TestBuyTicketConcurrentSameSeats(t *testing.T) {
+	const (
+		ticketTag = "T9001"
+		seats     = 20
+		buyers    = 2000
+	)
+	env := newTestEnv(t)
+	runDate := tomorrow()
+	tickets := env.seedRun(t, ticketTag, runDate, []string{"S1", "S2", "S3"}, seats)
+
+	orders := env.buyConcurrently(buyers, func(i int) *query.BuyTicketQuery {
+		return &query.BuyTicketQuery{
+			TicketId:  tickets[i%seats].TicketId,
+			TicketTag: ticketTag,
+			RunDate:   runDate,
+		}
+	})
+
+	// 每个座位第一个拿到锁的请求必然成功，其余请求失败
+	if len(orders) != seats {
+		t.Errorf("%d 个座位成功下单 %d 个，应为 %d 个", seats, len(orders), seats)
+	}
+	sold := env.checkInvariants(t, ticketTag, runDate, orders)
+	if sold != seats {
+		t.Errorf("成功下单 %d 个，售出 %d 个座位", len(orders), sold)
+	}
+	for _, order := range orders {
+		if len(order.Items) != 1 {
+			t.Errorf("订单 %s 有 %d 个座位，应为 1 个", order.OrderId, len(order.Items))
+		}
+	}
+	// 全程票占满每个座位的全部区间位
+	soldBits, soldSeats := env.soldBits(t, ticketTag, runDate)
+	if soldSeats != seats || soldBits != seats*2 || soldBits != orderBits(orders) {
+		t.Errorf("售出 %d 个座位、%d 个区间位，订单占用 %d 个区间位，应为 %d 个座位、%d 个区间位", soldSeats, soldBits, orderBits(orders), seats, seats*2)
+	}
+}
+
+// 同一座位的不同区间可以分别售出，重叠区间不能重复售出
+func TestBuyTicketConcurrentSegments(t *testing.T) {
+	const (
+		ticketTag = "T9002"
+		seats     = 10
+		buyers    = 1500
+	)
+	env := newTestEnv(t)
+	runDate := tomorrow()
+	stations := []string{"S1", "S2", "S3"}
+	tickets := env.seedRun(t, ticketTag, runDate, stations, seats)
+	segments := [][2]string{{"S1", "S2"}, {"S2", "S3"}, {"S1", "S3"}}
+
+	orders := env.buyConcurrently(buyers, func(i int) *query.BuyTicketQuery {
+		seg := segments[i%len(segments)]
+		return &query.BuyTicketQuery{
+			TicketId:    tickets[i%seats].TicketId,
+			TicketTag:   ticketTag,
+			RunDate:     runDate,
+			FromStation: seg[0],
+			ToStation:   seg[1],
+		}
+	})
+
+	// 每个座位至少售出一次：全程票一张，或两个半程各一张，或只售出一个半程
+	sold := env.checkInvariants(t, ticketTag, runDate, orders)
+	if sold != len(orders) {
+		t.Errorf("成功下单 %d 个，售出 %d 个区间", len(orders), sold)
+	}
+	soldBits, soldSeats := env.soldBits(t, ticketTag, runDate)
+	if soldSeats != seats {
+		t.Errorf("%d 个座位中售出 %d 个，每个座位都应售出", seats, soldSeats)
+	}
+	if soldBits != orderBits(orders) {
+		t.Errorf("座位占用 %d 个区间位，成功订单占用 %d 个", soldBits, orderBits(orders))
+	}
+	if len(orders) < seats || len(orders) > soldBits {
+		t.Errorf("%d 个座位、%d 个已售区间位成功下单 %d 个", seats, soldBits, len(orders))
+	}
+}
+
+// 服务端选座的多人订单：全部座位售出或全部失败，座位不被重复分配
+func TestBuyTicketConcurrentAllocate(t *testing.T) {
+	const (
+		ticketTag  = "T9003"
+		seats      = 10
+		buyers     = 300
+		passengers = 2
+	)
+	env := newTestEnv(t)
+	runDate := tomorrow()
+	env.seedRun(t, ticketTag, runDate, []string{"S1", "S2"}, seats)
+
+	orders := env.buyConcurrently(buyers, func(i int) *query.BuyTicketQuery {
+		req := &query.BuyTicketQuery{
+			TicketTag: ticketTag,
+			RunDate:   runDate,
+			SeatClass: int(enum.SeatClassSecond),
+		}
+		for p := 0; p < passengers; p++ {
+			n := buyers + i*passengers + p
+			req.Items = append(req.Items, query.BuyTicketItemQuery{
+				PassengerName:     fmt.Sprintf("乘客%05d", n),
+				PassengerIdentity: residentId(n),
+			})
+		}
+		return req
+	})
+
+	// 请求数远多于座位，选座冲突时重新选座，座位全部售出
+	if len(orders) != seats/passengers {
+		t.Errorf("%d 个座位成功下单 %d 个 %d 人订单，应为 %d 个", seats, len(orders), passengers, seats/passengers)
+	}
+	for _, order := range orders {
+		if len(order.Items) != passengers {
+			t.Errorf("订单 %s 有 %d 个座位，应为 %d 个", order.OrderId, len(order.Items), passengers)
+		}
+	}
+	sold := env.checkInvariants(t, ticketTag, runDate, orders)
+	if sold != seats {
+		t.Errorf("成功下单 %d 个，售出 %d 个座位，应为 %d 个", len(orders), sold, seats)
+	}
+	soldBits, soldSeats := env.soldBits(t, ticketTag, runDate)
+	if soldSeats != seats || soldBits != seats || soldBits != orderBits(orders) {
+		t.Errorf("售出 %d 个座位、%d 个区间位，订单占用 %d 个区间位，应为 %d 个", soldSeats, soldBits, orderBits(orders), seats)
+	}
+}
+
+// 同一证件并发购买同一开行计划的不同座位：区间重叠的车票至多持有一张
+func TestBuyTicketConcurrentSamePassenger(t *testing.T) {
+	const (
+		ticketTag = "T9004"
+		seats     = 20
+		buyers    = 200
+	)
+	env := newTestEnv(t)
+	runDate := tomorrow()
+	tickets := env.seedRun(t, ticketTag, runDate, []string{"S1", "S2", "S3"}, seats)
+	reqOf := func(i int) *query.BuyTicketQuery {
+		return &query.BuyTicketQuery{
+			TicketTag: ticketTag,
+			RunDate:   runDate,
+			Items: []query.BuyTicketItemQuery{{
+				TicketId:          tickets[i%seats].TicketId,
+				PassengerName:     "同一乘客",
+				PassengerIdentity: residentId(99999),
+			}},
+		}
+	}
+
+	orders := env.buyConcurrently(buyers, reqOf)
+	if len(orders) != 1 {
+		t.Fatalf("同一乘车人并发购票成功 %d 次，应为 1 次", len(orders))
+	}
+	if sold := env.checkInvariants(t, ticketTag, runDate, orders); sold != 1 {
+		t.Errorf("售出 %d 个座位，应为 1 个", sold)
+	}
+	if soldBits, soldSeats := env.soldBits(t, ticketTag, runDate); soldSeats != 1 || soldBits != orderBits(orders) {
+		t.Errorf("售出 %d 个座位、%d 个区间位，订单占用 %d 个区间位", soldSeats, soldBits, orderBits(orders))
+	}
+
+	// 订单落库前后再次购买都会因行程冲突失败
+	user := response.User{UserId: "user_again", VerifyStatus: enum.VerifyStatusVerified}
+	if _, err := env.app.Services.Ticket.BuyTicketWriteThrough(context.Background(), reqOf(1), user); err == nil {
+		t.Error("同一乘车人再次购买重叠区间的车票成功")
+	}
+
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	// 默认支付时限
+	defaultPaymentWindow = 30 * time.Minute
+	// 每次扫描最多释放的订单数
+	holdReleaseBatch = 100
+)
+
+// 订单仍在消息队列中尚未落库，稍后重试
+var errOrderNotPersisted = errors.New("订单尚未落库")
+
+func (s *TicketService) paymentWindow() time.Duration {
+	if s.PaymentWindow <= 0 {
+		return defaultPaymentWindow
+	}
+	return s.PaymentWindow
+}
+
+func (s *TicketService) ReleaseHeldOrder(ctx context.Context, orderId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	order, err := s.OrderRepo.Get(ctx, model.Order{OrderId: orderId})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, errOrderNotPersisted
+		}
+		return false, fmt.Errorf("查询订单失败: %v", err)
+	}
+	// 已支付或已取消的订单无需释放
+	if order.OrderStatus != enum.OrderStatusNormal || len(order.Items) == 0 {
+		return false, nil
+	}
+
+	ticketIds := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		ticketIds = append(ticketIds, item.TicketId)
+	}
+	locks, err := s.acquireTicketLocks(ctx, ticketIds)
+	if err != nil {
+		return false, err
+	}
+	defer s.releaseTicketLocks(ctx, locks)
+
+	released := false
+	var releasedTickets []*model.Ticket
+	err = s.TicketRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.TicketRepo.WithDB(tx)
+		// 以订单状态作为并发支付与超时释放的仲裁：只有仍未支付的订单才能取消
+		orderRepo := s.OrderRepo.WithDB(tx)
+		ok, err := orderRepo.TransitionWithOptimisticLockRetry(ctx, orderId, enum.OrderStatusNormal, enum.OrderStatusCancelled, enum.TicketStatusReleased, enum.OrderEventTimeout, "超时未支付", 3)
+		if err != nil {
+			return fmt.Errorf("取消订单失败: %v", err)
+		}
+		if !ok {
+			return nil
+		}
+
+		releasedTickets = releasedTickets[:0]
+		for _, item := range order.Items {
+			if item.ItemStatus != enum.TicketStatusHeld {
+				continue
+			}
+			ticket, err := r.ReleaseSegmentWithOptimisticLockRetry(ctx, item.TicketId, item.SegmentMask, 3)
+			if err != nil {
+				return fmt.Errorf("释放座位 %s 失败: %v", item.TicketId, err)
+			}
+			if ticket == nil {
+				return fmt.Errorf("释放座位 %s 失败，请稍后重试", item.TicketId)
+			}
+			if err := releaseTrip(ctx, orderRepo, &item); err != nil {
+				return err
+			}
+			releasedTickets = append(releasedTickets, ticket)
+		}
+		released = true
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+	if !released {
+		return false, nil
+	}
+
+	ticketTag, runDate := string(order.Items[0].TicketTag), order.Items[0].RunDate
+	s.syncTicketCaches(ctx, ticketTag, runDate, releasedTickets)
+	if err := s.RedisRepo.RemoveOrderHold(ctx, orderId); err != nil {
+		fmt.Printf("移除订单支付时限失败: %v\n", err)
+	}
+	if s.ReleaseListener != nil {
+		go s.ReleaseListener.OnSeatReleased(context.Background(), ticketTag, runDate)
+	}
+	fmt.Printf("订单 %s 超时未支付，已取消并释放 %d 个座位\n", orderId, len(releasedTickets))
+	return true, nil
+}
+
+func (s *TicketService) StartHoldReleaseJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("待支付订单释放任务已停止")
+			return
+		case <-ticker.C:
+		}
+
+		orderIds, err := s.RedisRepo.PopExpiredOrderHolds(ctx, time.Now(), holdReleaseBatch)
+		if err != nil {
+			fmt.Printf("扫描到期订单失败: %v\n", err)
+		}
+		for _, orderId := range orderIds {
+			if _, err := s.ReleaseHeldOrder(ctx, orderId); err != nil {
+				// 释放失败的订单稍后重新扫描
+				fmt.Printf("释放订单 %s 失败: %v\n", orderId, err)
+				if err := s.RedisRepo.AddOrderHold(ctx, orderId, time.Now().Add(time.Minute)); err != nil {
+					fmt.Printf("重新登记订单支付时限失败: %v\n", err)
+				}
+			}
+		}
+
+		// 待补差价的改签到期：已补差价的完成换座，未补差价的撤销
+		changeNos, err := s.RedisRepo.PopExpiredChangeHolds(ctx, time.Now(), holdReleaseBatch)
+		if err != nil {
+			fmt.Printf("扫描到期改签失败: %v\n", err)
+		}
+		for _, changeNo := range changeNos {
+			if err := s.ExpireChange(ctx, changeNo); err != nil {
+				fmt.Printf("处理到期改签 %s 失败: %v\n", changeNo, err)
+				if err := s.RedisRepo.AddChangeHold(ctx, changeNo, time.Now().Add(time.Minute)); err != nil {
+					fmt.Printf("重新登记改签支付时限失败: %v\n", err)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/response"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// 退票手续费档位：距发车时间超过 BeforeHours 小时按 Rate 收取
+type RefundFeeTier struct {
+	BeforeHours float64 `mapstructure:"before_hours"`
+	Rate        float64 `mapstructure:"rate"`
+}
+
+// 默认手续费：8天以上免费，48小时以上5%，24小时以上10%，其余20%
+var defaultRefundFeeTiers = []RefundFeeTier{
+	{BeforeHours: 192, Rate: 0},
+	{BeforeHours: 48, Rate: 0.05},
+	{BeforeHours: 24, Rate: 0.10},
+	{BeforeHours: 0, Rate: 0.20},
+}
+
+// 按距发车时间计算手续费率，档位按 BeforeHours 从大到小匹配
+func (s *TicketService) refundFeeRate(untilDeparture time.Duration) float64 {
+	tiers := s.RefundFeeTiers
+	if len(tiers) == 0 {
+		tiers = defaultRefundFeeTiers
+	}
+	sorted := append([]RefundFeeTier(nil), tiers...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].BeforeHours > sorted[j].BeforeHours })
+
+	hours := untilDeparture.Hours()
+	for _, tier := range sorted {
+		if hours > tier.BeforeHours {
+			return tier.Rate
+		}
+	}
+	return sorted[len(sorted)-1].Rate
+}
+
+func (s *TicketService) RefundOrder(ctx context.Context, userId string, orderId string) (*response.OrderRefund, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if s.PaymentService == nil {
+		return nil, errors.New("未配置支付服务")
+	}
+	// 加锁前读取订单仅用于校验归属和确定要加锁的座位，状态和明细在加锁后的事务中重新读取
+	order, err := s.OrderRepo.Get(ctx, model.Order{OrderId: orderId})
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, errors.New("订单不存在")
+		}
+		return nil, fmt.Errorf("查询订单失败: %v", err)
+	}
+	if err := checkOrderOwner(userId, order); err != nil {
+		return nil, err
+	}
+	if order.OrderStatus != enum.OrderStatusPaid || len(order.Items) == 0 {
+		return nil, fmt.Errorf("订单%s，不能退票", order.OrderStatus)
+	}
+
+	locked := make(map[string]bool, len(order.Items))
+	ticketIds := make([]string, 0, len(order.Items))
+	for _, item := range order.Items {
+		locked[item.TicketId] = true
+		ticketIds = append(ticketIds, item.TicketId)
+	}
+	locks, err := s.acquireTicketLocks(ctx, ticketIds)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseTicketLocks(ctx, locks)
+
+	var refunded *response.OrderRefund
+	var releasedTickets []*model.Ticket
+	var current *model.Order
+	err = s.TicketRepo.ExecuteTransaction(func(tx *gorm.DB) error {
+		r := s.TicketRepo.WithDB(tx)
+		orderRepo := s.OrderRepo.WithDB(tx)
+		var err error
+		current, err = orderRepo.Get(ctx, model.Order{OrderId: orderId})
+		if err != nil {
+			return fmt.Errorf("查询订单失败: %v", err)
+		}
+		if current.OrderStatus != enum.OrderStatusPaid || len(current.Items) == 0 {
+			return fmt.Errorf("订单%s，不能退票", current.OrderStatus)
+		}
+		if hasPendingChange(current) {
+			return errors.New("订单有待补差价的改签，请先完成支付或等待超时撤销")
+		}
+		// 加锁期间座位可能已被改签换成其他座位，未加锁的座位不能释放
+		for _, item := range current.Items {
+			if !locked[item.TicketId] {
+				return errors.New("订单座位已变更，请重试")
+			}
+		}
+
+		// 同一订单的座位属于同一区间，以上车站发车时间判断是否可退
+		untilDeparture := time.Until(current.Items[0].DepartureTime)
+		if untilDeparture <= 0 {
+			return errors.New("列车已发车，不能退票")
+		}
+		rate := s.refundFeeRate(untilDeparture)
+
+		// 订单状态条件更新，重复退票请求只有一个能成功
+		ok, err := orderRepo.TransitionWithOptimisticLockRetry(ctx, orderId, enum.OrderStatusPaid, enum.OrderStatusRefunded, enum.TicketStatusRefund, enum.OrderEventRefunded, fmt.Sprintf("手续费率 %.0f%%", rate*100), 3)
+		if err != nil {
+			return fmt.Errorf("更新订单状态失败: %v", err)
+		}
+		if !ok {
+			return errors.New("订单已退票或状态已变更")
+		}
+
+		releasedTickets = releasedTickets[:0]
+		for _, item := range current.Items {
+			if item.ItemStatus != enum.TicketStatusSold {
+				continue
+			}
+			ticket, err := r.ReleaseSegmentWithOptimisticLockRetry(ctx, item.TicketId, item.SegmentMask, 3)
+			if err != nil {
+				return fmt.Errorf("释放座位 %s 失败: %v", item.TicketId, err)
+			}
+			if ticket == nil {
+				return fmt.Errorf("释放座位 %s 失败，请稍后重试", item.TicketId)
+			}
+			if err := releaseTrip(ctx, orderRepo, &item); err != nil {
+				return err
+			}
+			releasedTickets = append(releasedTickets, ticket)
+		}
+
+		// 事务内只登记待退款，支付渠道退款在提交后进行
+		refunded, err = s.PaymentService.WithDB(tx).PrepareRefund(ctx, orderId, rate)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ticketTag, runDate := string(current.Items[0].TicketTag), current.Items[0].RunDate
+	s.syncTicketCaches(ctx, ticketTag, runDate, releasedTickets)
+	if s.ReleaseListener != nil {
+		go s.ReleaseListener.OnSeatReleased(context.Background(), ticketTag, runDate)
+	}
+	// 渠道退款失败时流水保持退款中，由退款重试任务继续处理
+	if err := s.PaymentService.ProcessRefunds(ctx, orderId); err != nil {
+		fmt.Printf("订单 %s 渠道退款失败，稍后重试: %v\n", orderId, err)
+	}
+	fmt.Printf("订单 %s 已退票，手续费 %.2f，退款 %.2f\n", orderId, refunded.RefundFee, refunded.RefundAmount)
+	return refunded, nil
+}
+
+// 订单归属以下单账号为准
+func checkOrderOwner(userId string, order *model.Order) error {
+	if order.UserId != userId {
+		return errors.New("订单不属于当前账号")
+	}
+	return nil
+}
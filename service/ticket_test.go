@@ -0,0 +1,122 @@
+package service_test
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/repository"
+	"12305/response"
+	"12305/service"
+	"context"
+	"errors"
+	"testing"
+)
+
+// 账号本人未实名核验时不能购票，同一乘车人由已核验的账号购买可以成功
+func TestBuyTicketRequiresVerifiedAccount(t *testing.T) {
+	const ticketTag = "T9005"
+	env := newTestEnv(t)
+	runDate := tomorrow()
+	tickets := env.seedRun(t, ticketTag, runDate, []string{"S1", "S2", "S3"}, 5)
+	req := &query.BuyTicketQuery{
+		TicketTag: ticketTag,
+		RunDate:   runDate,
+		Items: []query.BuyTicketItemQuery{{
+			TicketId:          tickets[0].TicketId,
+			PassengerName:     "新乘客",
+			PassengerIdentity: residentId(500),
+		}},
+	}
+	ctx := context.Background()
+
+	for _, status := range []enum.VerifyStatus{enum.VerifyStatusUnverified, enum.VerifyStatusFailed} {
+		user := response.User{UserId: "user_unverified", VerifyStatus: status}
+		_, err := env.app.Services.Ticket.BuyTicketWriteThrough(ctx, req, user)
+		if !errors.Is(err, service.ErrAccountNotVerified) {
+			t.Errorf("账号%s时购票返回 %v，应为 %v", status, err, service.ErrAccountNotVerified)
+		}
+	}
+	if _, soldSeats := env.soldBits(t, ticketTag, runDate); soldSeats != 0 {
+		t.Errorf("未核验的账号购票后售出 %d 个座位，应为 0 个", soldSeats)
+	}
+
+	user := response.User{UserId: "user_verified", VerifyStatus: enum.VerifyStatusVerified}
+	order, err := env.app.Services.Ticket.BuyTicketWriteThrough(ctx, req, user)
+	if err != nil {
+		t.Fatalf("已核验的账号购票失败: %v", err)
+	}
+	if sold := env.checkInvariants(t, ticketTag, runDate, []*model.Order{order}); sold != 1 {
+		t.Errorf("售出 %d 个座位，应为 1 个", sold)
+	}
+}
+
+// 车次缓存过期后单个座位的同步不能生成只含部分座位的缓存，查询时从数据库整体加载
+func TestSyncTicketDoesNotCreatePartialRunCache(t *testing.T) {
+	const ticketTag = "T9006"
+	env := newTestEnv(t)
+	ctx := context.Background()
+	runDate := tomorrow()
+	tickets := env.seedRun(t, ticketTag, runDate, []string{"S1", "S2", "S3"}, 4)
+
+	key := repository.TicketCacheKey(ticketTag, runDate)
+	if err := env.redis.Del(ctx, key).Err(); err != nil {
+		t.Fatalf("清除车次缓存失败: %v", err)
+	}
+	if err := env.app.Repos.Redis.SyncTicketToCache(ctx, tickets[0]); err != nil {
+		t.Fatalf("同步座位缓存失败: %v", err)
+	}
+	if exists, _ := env.redis.Exists(ctx, key).Result(); exists != 0 {
+		t.Fatal("车次缓存不存在时同步单个座位生成了缓存")
+	}
+
+	available, err := env.app.Services.Ticket.ListByTicketTagReadThrough(ctx, ticketTag, runDate, "S1", "S3")
+	if err != nil {
+		t.Fatalf("查询余票失败: %v", err)
+	}
+	if len(available) != len(tickets) {
+		t.Errorf("余票 %d 张，应为 %d 张", len(available), len(tickets))
+	}
+	if cached, _ := env.redis.HLen(ctx, key).Result(); cached != int64(len(tickets)) {
+		t.Errorf("车次缓存 %d 个座位，应为 %d 个", cached, len(tickets))
+	}
+}
+
+// 修改座位号时按席别重新计算靠窗/过道；已有区间售出的座位不能改动位置
+func TestEditTicketRecomputesSeatPosition(t *testing.T) {
+	const ticketTag = "T9007"
+	env := newTestEnv(t)
+	ctx := context.Background()
+	runDate := tomorrow()
+	tickets := env.seedRun(t, ticketTag, runDate, []string{"S1", "S2", "S3"}, 2)
+	train := &model.Train{
+		TrainId:     "train_" + ticketTag,
+		TicketTag:   enum.TicketTag(ticketTag),
+		BasePrice:   100,
+		TrainStatus: enum.TrainStatusActive,
+	}
+	if err := env.db.Create(train).Error; err != nil {
+		t.Fatalf("登记车次失败: %v", err)
+	}
+
+	edited := *tickets[0]
+	edited.SeatLetter = "C"
+	if _, err := env.app.Services.Ticket.Edit(ctx, &edited); err != nil {
+		t.Fatalf("修改座位失败: %v", err)
+	}
+	var saved model.Ticket
+	if err := env.db.Where("ticket_id=?", edited.TicketId).First(&saved).Error; err != nil {
+		t.Fatalf("查询座位失败: %v", err)
+	}
+	if saved.SeatLetter != "C" || saved.SeatPosition != enum.SeatClassSecond.SeatPositionOf("C") {
+		t.Errorf("座位号 %s 位置为 %d，应为 C 与 %d", saved.SeatLetter, saved.SeatPosition, enum.SeatClassSecond.SeatPositionOf("C"))
+	}
+
+	if err := env.db.Model(&model.Ticket{}).Where("ticket_id=?", tickets[1].TicketId).Update("sold_mask", 1).Error; err != nil {
+		t.Fatalf("售出座位失败: %v", err)
+	}
+	sold := *tickets[1]
+	sold.SeatRow++
+	if _, err := env.app.Services.Ticket.Edit(ctx, &sold); err == nil {
+		t.Error("已售出的座位修改排号成功")
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"12305/config"
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/repository"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+type TrainService struct {
+	TrainRepo    repository.TrainRepoInterface
+	CarriageRepo repository.CarriageRepoInterface
+	RedisRepo    repository.RedisRepoInterface
+}
+
+type TrainSrv interface {
+	List(ctx context.Context, req *query.ListQuery) ([]*model.Train, error)
+	Get(ctx context.Context, train *model.Train) (*model.Train, error)
+	GetByTicketTag(ctx context.Context, ticketTag string) (*model.Train, error)
+	Create(ctx context.Context, train *model.Train) (*model.Train, error)
+	Edit(ctx context.Context, train *model.Train) (bool, error)
+	// 停运车次，停运后不再预热缓存也不能新建车票
+	Retire(ctx context.Context, train *model.Train) (bool, error)
+	// 查询/设置车次编组，新生成的开行计划按编组生成座位
+	GetConsist(ctx context.Context, ticketTag string) ([]*model.Carriage, error)
+	SetConsist(ctx context.Context, ticketTag string, carriages []*model.Carriage) error
+}
+
+var _ TrainSrv = (*TrainService)(nil)
+
+func (s *TrainService) List(ctx context.Context, req *query.ListQuery) ([]*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if req.PageSize <= 1 {
+		req.PageSize = config.PageSize
+	}
+	return s.TrainRepo.List(ctx, req)
+}
+
+func (s *TrainService) Get(ctx context.Context, train *model.Train) (*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.TrainRepo.Get(ctx, train)
+}
+
+func (s *TrainService) GetByTicketTag(ctx context.Context, ticketTag string) (*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.TrainRepo.GetByTicketTag(ctx, enum.TicketTag(ticketTag))
+}
+
+func (s *TrainService) Create(ctx context.Context, train *model.Train) (*model.Train, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := validateTrain(train); err != nil {
+		return nil, err
+	}
+	exist, err := s.TrainRepo.Exist(ctx, *train)
+	if err != nil {
+		fmt.Println("查询车次是否存在失败", err)
+		return nil, err
+	}
+	if exist {
+		fmt.Println("车次已存在")
+		return nil, nil
+	}
+	if train.TrainId == "" {
+		train.TrainId = utils.GetUUID()
+	}
+	train.TrainStatus = enum.TrainStatusActive
+	train.CreateTime = time.Now()
+	train.UpdateTime = time.Now()
+	created, err := s.TrainRepo.CreateTrain(ctx, train)
+	if err != nil {
+		return nil, err
+	}
+	s.RedisRepo.AddToBloomFilter(string(created.TicketTag))
+	return created, nil
+}
+
+func (s *TrainService) Edit(ctx context.Context, train *model.Train) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.TrainRepo.Get(ctx, train)
+	if err != nil {
+		fmt.Println("查询车次失败", err)
+		return false, err
+	}
+	// 车次tag作为票务与缓存的键，不允许修改
+	train.TicketTag = exist.TicketTag
+	if err := validateTrain(train); err != nil {
+		return false, err
+	}
+	return s.TrainRepo.Edit(ctx, train)
+}
+
+func (s *TrainService) Retire(ctx context.Context, train *model.Train) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	exist, err := s.TrainRepo.Get(ctx, train)
+	if err != nil {
+		fmt.Println("查询车次失败", err)
+		return false, err
+	}
+	if exist.TrainStatus == enum.TrainStatusRetired {
+		fmt.Println("车次已停运")
+		return false, nil
+	}
+	return s.TrainRepo.UpdateStatus(ctx, exist.TrainId, enum.TrainStatusRetired)
+}
+
+func (s *TrainService) GetConsist(ctx context.Context, ticketTag string) ([]*model.Carriage, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	train, err := s.TrainRepo.GetByTicketTag(ctx, enum.TicketTag(ticketTag))
+	if err != nil {
+		return nil, err
+	}
+	carriages, err := s.CarriageRepo.ListByTicketTag(ctx, train.TicketTag)
+	if err != nil {
+		return nil, err
+	}
+	return consistOf(train, carriages), nil
+}
+
+func (s *TrainService) SetConsist(ctx context.Context, ticketTag string, carriages []*model.Carriage) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	train, err := s.TrainRepo.GetByTicketTag(ctx, enum.TicketTag(ticketTag))
+	if err != nil {
+		return err
+	}
+	if len(carriages) == 0 {
+		return errors.New("编组至少需要一节车厢")
+	}
+	now := time.Now()
+	seen := make(map[int]bool, len(carriages))
+	for i, carriage := range carriages {
+		if carriage.CarriageNo == 0 {
+			carriage.CarriageNo = i + 1
+		}
+		if seen[carriage.CarriageNo] {
+			return fmt.Errorf("车厢号 %d 重复", carriage.CarriageNo)
+		}
+		seen[carriage.CarriageNo] = true
+		if !carriage.SeatClass.IsValid() {
+			return fmt.Errorf("车厢 %d 席别无效", carriage.CarriageNo)
+		}
+		if carriage.RowCount <= 0 {
+			return fmt.Errorf("车厢 %d 排数必须大于0", carriage.CarriageNo)
+		}
+		carriage.CarriageId = utils.GetUUID()
+		carriage.TicketTag = train.TicketTag
+		carriage.CreateTime = now
+		carriage.UpdateTime = now
+	}
+	return s.CarriageRepo.ReplaceByTicketTag(ctx, train.TicketTag, carriages)
+}
+
+// 车次未配置编组时，按默认车厢数生成二等座车厢
+func consistOf(train *model.Train, carriages []*model.Carriage) []*model.Carriage {
+	if len(carriages) > 0 {
+		return carriages
+	}
+	rows := train.SeatsPerCarriage / len(enum.SeatClassSecond.SeatLetters())
+	if rows <= 0 {
+		rows = 1
+	}
+	consist := make([]*model.Carriage, 0, train.CarriageCount)
+	for i := 1; i <= train.CarriageCount; i++ {
+		consist = append(consist, &model.Carriage{
+			TicketTag:  train.TicketTag,
+			CarriageNo: i,
+			SeatClass:  enum.SeatClassSecond,
+			RowCount:   rows,
+		})
+	}
+	return consist
+}
+
+// 席别票价 = 车次基础票价 * 席别倍率，保留两位小数
+func seatClassPrice(train *model.Train, class enum.SeatClass) float64 {
+	return math.Round(train.BasePrice*class.PriceRate()*100) / 100
+}
+
+// 校验车次类型与车次tag前缀一致，以及默认编组
+func validateTrain(train *model.Train) error {
+	if train.TicketTag == "" {
+		return errors.New("车次不能为空")
+	}
+	if !train.TrainType.IsValid() {
+		return fmt.Errorf("无效的车次类型: %s", train.TrainType)
+	}
+	if !strings.HasPrefix(string(train.TicketTag), string(train.TrainType)) {
+		return fmt.Errorf("车次 %s 与类型 %s 不匹配", train.TicketTag, train.TrainType)
+	}
+	if train.CarriageCount <= 0 || train.SeatsPerCarriage <= 0 {
+		return errors.New("默认编组车厢数和每节座位数必须大于0")
+	}
+	if train.BasePrice <= 0 {
+		return errors.New("基础票价必须大于0")
+	}
+	return nil
+}
+
+// 校验车次已登记且在运营中
+func checkTrainActive(ctx context.Context, trainRepo repository.TrainRepoInterface, ticketTag enum.TicketTag) (*model.Train, error) {
+	train, err := trainRepo.GetByTicketTag(ctx, ticketTag)
+	if err != nil {
+		return nil, fmt.Errorf("车次 %s 未登记: %v", ticketTag, err)
+	}
+	if train.TrainStatus != enum.TrainStatusActive {
+		return nil, fmt.Errorf("车次 %s 已停运", ticketTag)
+	}
+	return train, nil
+}
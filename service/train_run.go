@@ -0,0 +1,149 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/repository"
+	"12305/utils"
+	"context"
+	"fmt"
+	"time"
+)
+
+// 默认提前生成开行计划的天数
+const defaultAdvanceDays = 15
+
+type TrainRunService struct {
+	TrainRunRepo repository.TrainRunRepoInterface
+	TrainRepo    repository.TrainRepoInterface
+	CarriageRepo repository.CarriageRepoInterface
+}
+
+type TrainRunSrv interface {
+	ListFromDate(ctx context.Context, ticketTag string, fromDate string) ([]*model.TrainRun, error)
+	// 按车次编组为未来days天生成开行计划及座位库存，已存在的日期跳过
+	MaterializeRuns(ctx context.Context, days int) (int, error)
+	// 定时生成库存的后台任务，启动时立即执行一次
+	StartInventoryJob(ctx context.Context, days int, interval time.Duration)
+}
+
+var _ TrainRunSrv = (*TrainRunService)(nil)
+
+func (s *TrainRunService) ListFromDate(ctx context.Context, ticketTag string, fromDate string) ([]*model.TrainRun, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if fromDate == "" {
+		fromDate = time.Now().Format(utils.DateLayout)
+	}
+	return s.TrainRunRepo.ListFromDate(ctx, enum.TicketTag(ticketTag), fromDate)
+}
+
+func (s *TrainRunService) MaterializeRuns(ctx context.Context, days int) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	if days <= 0 {
+		days = defaultAdvanceDays
+	}
+
+	trains, err := s.TrainRepo.ListActive(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("获取运营车次失败: %v", err)
+	}
+
+	created := 0
+	today := time.Now()
+	for _, train := range trains {
+		carriages, err := s.CarriageRepo.ListByTicketTag(ctx, train.TicketTag)
+		if err != nil {
+			return created, fmt.Errorf("获取车次 %s 编组失败: %v", train.TicketTag, err)
+		}
+		consist := consistOf(train, carriages)
+
+		for i := 0; i < days; i++ {
+			runDate := today.AddDate(0, 0, i).Format(utils.DateLayout)
+			exist, err := s.TrainRunRepo.Exist(ctx, train.TicketTag, runDate)
+			if err != nil {
+				return created, fmt.Errorf("查询开行计划失败: %v", err)
+			}
+			if exist {
+				continue
+			}
+
+			run, tickets := buildRunInventory(train, consist, runDate)
+			if err := s.TrainRunRepo.CreateRunWithTickets(ctx, run, tickets); err != nil {
+				fmt.Printf("生成车次 %s (%s) 开行计划失败: %v\n", train.TicketTag, runDate, err)
+				continue
+			}
+			created++
+			fmt.Printf("已生成车次 %s (%s) 开行计划，共 %d 个座位\n", train.TicketTag, runDate, len(tickets))
+		}
+	}
+	return created, nil
+}
+
+func (s *TrainRunService) StartInventoryJob(ctx context.Context, days int, interval time.Duration) {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if created, err := s.MaterializeRuns(ctx, days); err != nil {
+			fmt.Printf("生成开行计划失败: %v\n", err)
+		} else {
+			fmt.Printf("开行计划生成完成，新增 %d 个\n", created)
+		}
+
+		select {
+		case <-ctx.Done():
+			fmt.Println("开行计划生成任务已停止")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// 按车次编组生成一天的开行计划和座位，票价由席别决定
+func buildRunInventory(train *model.Train, consist []*model.Carriage, runDate string) (*model.TrainRun, []*model.Ticket) {
+	now := time.Now()
+	run := &model.TrainRun{
+		RunId:      utils.GetUUID(),
+		TicketTag:  train.TicketTag,
+		RunDate:    runDate,
+		RunStatus:  enum.RunStatusScheduled,
+		CreateTime: now,
+		UpdateTime: now,
+	}
+
+	var tickets []*model.Ticket
+	number := 0
+	for _, carriage := range consist {
+		price := seatClassPrice(train, carriage.SeatClass)
+		for row := 1; row <= carriage.RowCount; row++ {
+			for _, letter := range carriage.SeatClass.SeatLetters() {
+				number++
+				tickets = append(tickets, &model.Ticket{
+					TicketId:     utils.GetUUID(),
+					TicketNumber: number,
+					CarriageNo:   carriage.CarriageNo,
+					SeatClass:    carriage.SeatClass,
+					SeatRow:      row,
+					SeatLetter:   letter,
+					SeatPosition: carriage.SeatClass.SeatPositionOf(letter),
+					TicketTag:    train.TicketTag,
+					RunId:        run.RunId,
+					RunDate:      runDate,
+					TicketPrice:  price,
+					TicketStatus: enum.TicketStatusNormal,
+					CreateTime:   now,
+					UpdateTime:   now,
+				})
+			}
+		}
+	}
+	run.SeatCount = len(tickets)
+	return run, tickets
+}
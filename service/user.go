@@ -2,18 +2,24 @@ package service
 
 import (
 	"12305/config"
+	"12305/enum"
+	"12305/identity"
 	"12305/model"
 	"12305/repository"
 	"12305/utils"
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
 	"12305/query"
+
+	"gorm.io/gorm"
 )
 
 type UserService struct {
-	UserRepo repository.UserRepository
+	UserRepo repository.UserRepoInterface
+	Verifier identity.Verifier //实名核验渠道
 }
 
 type UserSrv interface {
@@ -21,13 +27,25 @@ type UserSrv interface {
 	GetTotal(ctx context.Context, req *query.ListQuery) (int, error)
 	Get(ctx context.Context, user *model.User) (*model.User, error)
 	GetByUserIdentity(ctx context.Context, userIdentity string) (*model.User, error)
+	GetByUserPhone(ctx context.Context, userPhone string) (*model.User, error)
 	Exist(ctx context.Context, user *model.User) (bool, error)
 	Create(ctx context.Context, user *model.User) (*model.User, error)
 	Login(ctx context.Context, user *model.User) (*model.User, error)
-	Edit(ctx context.Context, user *model.User) (bool, error)
+	// 修改账号信息，修改密码时oldPassword须与原密码一致；更换手机号前调用方须已校验新手机号的验证码
+	Edit(ctx context.Context, user *model.User, oldPassword string) (bool, error)
+	// 按手机号重置密码，调用方需先校验短信验证码
+	ResetPassword(ctx context.Context, phone string, password string) (*model.User, error)
+	// 账号实名核验：核对姓名与证件，通过后姓名与证件不能再修改
+	Verify(ctx context.Context, userId string, name string, idType enum.IdType, idNumber string) (*model.User, error)
 	Delete(ctx context.Context, user *model.User) (*model.User, error)
+	// 用户拥有的全部角色，注册用户均为旅客
+	GetRoles(ctx context.Context, userId string) ([]enum.Role, error)
+	// 设置用户的角色，旅客角色不需要授予
+	SetRoles(ctx context.Context, userId string, roles []enum.Role) ([]enum.Role, error)
 }
 
+var _ UserSrv = (*UserService)(nil)
+
 func (s *UserService) List(ctx context.Context, req *query.ListQuery) ([]*model.User, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -60,7 +78,7 @@ func (s *UserService) GetByUserIdentity(ctx context.Context, userIdentity string
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	User, err := s.UserRepo.GetByUserIdentity(ctx, userIdentity)
+	User, err := s.UserRepo.GetByUserIdentity(ctx, identity.Normalize(userIdentity))
 	if err != nil {
 		fmt.Println("查询用户失败", err)
 		return nil, err
@@ -72,6 +90,13 @@ func (s *UserService) GetByUserIdentity(ctx context.Context, userIdentity string
 	return User, nil
 }
 
+func (s *UserService) GetByUserPhone(ctx context.Context, userPhone string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.UserRepo.GetByUserPhone(ctx, userPhone)
+}
+
 func (s *UserService) Exist(ctx context.Context, user *model.User) (bool, error) {
 	if err := ctx.Err(); err != nil {
 		return false, err
@@ -83,16 +108,42 @@ func (s *UserService) Create(ctx context.Context, user *model.User) (*model.User
 	if err := ctx.Err(); err != nil {
 		return nil, err
 	}
-	result, err := s.UserRepo.Exist(ctx, user)
+	if err := ValidatePhone(user.UserPhone); err != nil {
+		return nil, err
+	}
+	// 手机号作为登录账号，不能重复注册
+	result, err := s.UserRepo.ExistByUserPhone(ctx, user.UserPhone)
 	if err != nil {
 		fmt.Println("查询用户是否存在失败", err)
 		return nil, err
 	}
 	if result {
-		fmt.Println("用户已存在")
-		return nil, nil
+		return nil, errors.New("该手机号已注册")
+	}
+	if err := utils.ValidatePassword(user.UserPwd); err != nil {
+		return nil, err
 	}
+	// 注册时只校验证件格式，通过 Verify 完成实名核验
+	if user.UserIdentity != "" {
+		if user.IdType == 0 {
+			user.IdType = enum.IdTypeResidentCard
+		}
+		user.UserIdentity = identity.Normalize(user.UserIdentity)
+		if err := identity.Validate(user.IdType, user.UserIdentity); err != nil {
+			return nil, err
+		}
+	}
+	user.VerifyStatus = enum.VerifyStatusUnverified
+	user.VerifyTime = nil
+	hash, err := utils.HashPassword(user.UserPwd)
+	if err != nil {
+		return nil, fmt.Errorf("密码加密失败: %v", err)
+	}
+	now := time.Now()
 	user.UserId = utils.GetUUID()
+	user.UserPwd = hash
+	user.CreateTime = now
+	user.UpdateTime = now
 	return s.UserRepo.CreateUser(ctx, user)
 }
 
@@ -102,17 +153,32 @@ func (s *UserService) Login(ctx context.Context, user *model.User) (*model.User,
 	}
 	User, err := s.UserRepo.GetByUserPhone(ctx, user.UserPhone)
 	if err != nil {
-		fmt.Println("用户账号不存在", err)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			fmt.Println("用户账号不存在")
+			return nil, nil
+		}
 		return nil, err
 	}
-	if User.UserPwd != user.UserPwd {
+	if user.UserPwd == "" || !utils.CheckPassword(User.UserPwd, user.UserPwd) {
 		fmt.Println("密码错误")
 		return nil, nil
 	}
+	// 早期注册的用户密码为明文，登录成功后改为哈希保存
+	if !utils.IsPasswordHash(User.UserPwd) {
+		hash, err := utils.HashPassword(user.UserPwd)
+		if err == nil {
+			err = s.UserRepo.UpdatePassword(ctx, User.UserId, hash)
+		}
+		if err != nil {
+			fmt.Printf("用户 %s 密码升级失败: %v\n", User.UserId, err)
+		} else {
+			User.UserPwd = hash
+		}
+	}
 	return User, nil
 }
 
-func (s *UserService) Edit(ctx context.Context, user *model.User) (bool, error) {
+func (s *UserService) Edit(ctx context.Context, user *model.User, oldPassword string) (bool, error) {
 	if err := ctx.Err(); err != nil {
 		return false, err
 	}
@@ -134,14 +200,117 @@ func (s *UserService) Edit(ctx context.Context, user *model.User) (bool, error)
 		fmt.Println("用户不存在")
 		return false, nil
 	}
-	exist.UserName = user.UserName
-	exist.UserPhone = user.UserPhone
+	// 为空的字段不修改
+	if user.UserName != "" && user.UserName != exist.UserName {
+		if exist.VerifyStatus == enum.VerifyStatusVerified {
+			return false, errors.New("已实名核验的账号不能修改姓名")
+		}
+		exist.UserName = user.UserName
+	}
+	if user.UserPhone != "" && user.UserPhone != exist.UserPhone {
+		if err := ValidatePhone(user.UserPhone); err != nil {
+			return false, err
+		}
+		taken, err := s.UserRepo.ExistByUserPhone(ctx, user.UserPhone)
+		if err != nil {
+			return false, err
+		}
+		if taken {
+			return false, errors.New("该手机号已注册")
+		}
+		exist.UserPhone = user.UserPhone
+	}
 	exist.UpdateTime = time.Now()
-	exist.UserPwd = user.UserPwd
+	// 密码为空时不修改，修改时须提供原密码
+	if user.UserPwd != "" {
+		if oldPassword == "" || !utils.CheckPassword(exist.UserPwd, oldPassword) {
+			return false, errors.New("原密码错误")
+		}
+		if err := utils.ValidatePassword(user.UserPwd); err != nil {
+			return false, err
+		}
+		hash, err := utils.HashPassword(user.UserPwd)
+		if err != nil {
+			return false, fmt.Errorf("密码加密失败: %v", err)
+		}
+		exist.UserPwd = hash
+	}
 
 	return s.UserRepo.Edit(ctx, exist)
 }
 
+func (s *UserService) ResetPassword(ctx context.Context, phone string, password string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := utils.ValidatePassword(password); err != nil {
+		return nil, err
+	}
+	user, err := s.UserRepo.GetByUserPhone(ctx, phone)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return nil, fmt.Errorf("密码加密失败: %v", err)
+	}
+	if err := s.UserRepo.UpdatePassword(ctx, user.UserId, hash); err != nil {
+		return nil, fmt.Errorf("重置密码失败: %v", err)
+	}
+	return user, nil
+}
+
+func (s *UserService) Verify(ctx context.Context, userId string, name string, idType enum.IdType, idNumber string) (*model.User, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	user, err := s.UserRepo.Get(ctx, &model.User{UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	if user.VerifyStatus == enum.VerifyStatusVerified {
+		return nil, errors.New("账号已通过实名核验")
+	}
+	if name == "" {
+		return nil, errors.New("姓名不能为空")
+	}
+	if idType == 0 {
+		idType = enum.IdTypeResidentCard
+	}
+	if !idType.IsValid() {
+		return nil, fmt.Errorf("无效的证件类型: %d", idType)
+	}
+	idNumber = identity.Normalize(idNumber)
+	if err := identity.Validate(idType, idNumber); err != nil {
+		return nil, err
+	}
+	// 一个证件只能核验一个账号
+	taken, err := s.UserRepo.ExistVerifiedIdentity(ctx, idType, idNumber, userId)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, errors.New("该证件已被其他账号核验")
+	}
+
+	result, err := verifyIdentity(ctx, s.Verifier, name, idType, idNumber)
+	if err != nil {
+		return nil, err
+	}
+	user.UserName = name
+	user.IdType = idType
+	user.UserIdentity = idNumber
+	user.VerifyStatus = result.Status
+	user.VerifyTime = result.Time
+	if err := s.UserRepo.UpdateIdentity(ctx, user); err != nil {
+		return nil, fmt.Errorf("更新实名信息失败: %v", err)
+	}
+	if result.Status != enum.VerifyStatusVerified {
+		return user, fmt.Errorf("实名核验未通过: %s", result.Reason)
+	}
+	return user, nil
+}
+
 func (s *UserService) Delete(ctx context.Context, user *model.User) (*model.User, error) {
 	if err := ctx.Err(); err != nil {
 		return nil, err
@@ -178,3 +347,43 @@ func (s *UserService) Delete(ctx context.Context, user *model.User) (*model.User
 
 	return deletedUser, nil
 }
+
+func (s *UserService) GetRoles(ctx context.Context, userId string) ([]enum.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	granted, err := s.UserRepo.GetRoles(ctx, userId)
+	if err != nil {
+		return nil, err
+	}
+	return append([]enum.Role{enum.RolePassenger}, granted...), nil
+}
+
+func (s *UserService) SetRoles(ctx context.Context, userId string, roles []enum.Role) ([]enum.Role, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	exist, err := s.UserRepo.Exist(ctx, &model.User{UserId: userId})
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, errors.New("用户不存在")
+	}
+	granted := make([]enum.Role, 0, len(roles))
+	seen := make(map[enum.Role]bool)
+	for _, role := range roles {
+		if !role.IsValid() {
+			return nil, fmt.Errorf("无效的角色: %d", role)
+		}
+		if role == enum.RolePassenger || seen[role] {
+			continue
+		}
+		seen[role] = true
+		granted = append(granted, role)
+	}
+	if err := s.UserRepo.SetRoles(ctx, userId, granted); err != nil {
+		return nil, fmt.Errorf("设置角色失败: %v", err)
+	}
+	return s.GetRoles(ctx, userId)
+}
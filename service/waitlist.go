@@ -0,0 +1,394 @@
+package service
+
+import (
+	"12305/enum"
+	"12305/model"
+	"12305/query"
+	"12305/repository"
+	"12305/response"
+	"12305/utils"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// 座位释放通知，退票、超时释放、取消订单后调用
+type SeatReleaseListener interface {
+	OnSeatReleased(ctx context.Context, ticketTag string, runDate string)
+}
+
+type WaitlistService struct {
+	WaitlistRepo  repository.WaitlistRepoInterface
+	PassengerRepo repository.PassengerRepoInterface
+	RouteRepo     repository.RouteRepoInterface
+	TrainRepo     repository.TrainRepoInterface
+	TrainRunRepo  repository.TrainRunRepoInterface
+	RedisRepo     repository.RedisRepoInterface
+	// 兑现候补时通过正常购票流程下单
+	TicketService TicketSrv
+	// 登记时收取预付款，取消或过期时退还
+	PaymentService PaymentSrv
+}
+
+type WaitlistSrv interface {
+	Create(ctx context.Context, user response.User, req *query.WaitlistQuery) (*model.Waitlist, error)
+	List(ctx context.Context, userId string) ([]*model.Waitlist, error)
+	// 查询候补排名，从1开始；非候补中的订单返回0
+	Position(ctx context.Context, userId string, waitlistId string) (*model.Waitlist, int64, error)
+	Cancel(ctx context.Context, userId string, waitlistId string) (bool, error)
+	// 按登记顺序兑现某开行计划的候补订单，返回兑现数量
+	MatchRun(ctx context.Context, ticketTag string, runDate string) (int, error)
+	OnSeatReleased(ctx context.Context, ticketTag string, runDate string)
+	// 定时兑现所有开行计划的候补订单，兜底未触发通知的座位释放
+	StartMatcherJob(ctx context.Context, interval time.Duration)
+}
+
+var _ WaitlistSrv = (*WaitlistService)(nil)
+var _ SeatReleaseListener = (*WaitlistService)(nil)
+
+func (s *WaitlistService) Create(ctx context.Context, user response.User, req *query.WaitlistQuery) (*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if err := checkAccountVerified(user, "候补"); err != nil {
+		return nil, err
+	}
+	if req.RunDate < time.Now().Format(utils.DateLayout) {
+		return nil, errors.New("该车次已发车")
+	}
+	train, err := checkTrainActive(ctx, s.TrainRepo, enum.TicketTag(req.TicketTag))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := s.TrainRunRepo.GetByTicketTagAndDate(ctx, train.TicketTag, req.RunDate); err != nil {
+		return nil, fmt.Errorf("车次 %s 在 %s 没有开行计划: %v", req.TicketTag, req.RunDate, err)
+	}
+	class := enum.SeatClass(req.SeatClass)
+	if !class.IsValid() {
+		return nil, fmt.Errorf("无效的席别: %d", req.SeatClass)
+	}
+
+	// 截止时间不能晚于上车站发车时间，为空时取发车时间
+	seg, err := loadSegment(ctx, s.RouteRepo, train.TicketTag, req.FromStation, req.ToStation)
+	if err != nil {
+		return nil, err
+	}
+	departure := scheduleTime(req.RunDate, seg.DepartTime, seg.DepartDay)
+	deadline := req.Deadline
+	if deadline.IsZero() || deadline.After(departure) {
+		deadline = departure
+	}
+	if !deadline.After(time.Now()) {
+		return nil, errors.New("候补截止时间已过")
+	}
+
+	if len(req.PassengerIds) == 0 {
+		return nil, errors.New("候补乘车人不能为空")
+	}
+	if len(req.PassengerIds) > maxOrderItems {
+		return nil, fmt.Errorf("一个候补订单最多%d名乘车人", maxOrderItems)
+	}
+	passengers, err := s.PassengerRepo.GetByPassengerIds(ctx, user.UserId, req.PassengerIds)
+	if err != nil {
+		return nil, fmt.Errorf("查询乘车人失败: %v", err)
+	}
+	if len(passengers) != len(req.PassengerIds) {
+		return nil, errors.New("乘车人不存在或不属于当前账号")
+	}
+	for _, passenger := range passengers {
+		if passenger.VerifyStatus != enum.VerifyStatusVerified {
+			return nil, fmt.Errorf("乘车人 %s %s，不能候补", passenger.PassengerName, passenger.VerifyStatus)
+		}
+	}
+
+	now := time.Now()
+	waitlist := &model.Waitlist{
+		WaitlistId:     utils.GetUUID(),
+		UserId:         user.UserId,
+		TicketTag:      train.TicketTag,
+		RunDate:        req.RunDate,
+		FromStation:    seg.FromStation,
+		ToStation:      seg.ToStation,
+		SeatClass:      class,
+		Deadline:       deadline,
+		Prepayment:     math.Round(seatClassPrice(train, class)*float64(len(passengers))*100) / 100,
+		WaitlistStatus: enum.WaitlistStatusPending,
+		CreateTime:     now,
+		UpdateTime:     now,
+	}
+	for _, passenger := range passengers {
+		waitlist.Passengers = append(waitlist.Passengers, model.WaitlistPassenger{
+			WaitlistPassengerId: utils.GetUUID(),
+			WaitlistId:          waitlist.WaitlistId,
+			PassengerId:         passenger.PassengerId,
+			PassengerName:       passenger.PassengerName,
+		})
+	}
+	// 预付款支付成功后候补订单才进入候补队列，并立即尝试兑现
+	prepayment, err := s.PaymentService.ChargePrepayment(ctx, user.UserId, waitlist.WaitlistId, waitlist.Prepayment)
+	if err != nil {
+		return nil, err
+	}
+	waitlist.PaymentNo = prepayment.PaymentNo
+	result, err := s.WaitlistRepo.CreateWaitlist(ctx, waitlist)
+	if err != nil {
+		if refundErr := s.PaymentService.RefundPrepayment(ctx, prepayment.PaymentNo, "候补订单登记失败"); refundErr != nil {
+			fmt.Printf("关闭候补预付款 %s 失败: %v\n", prepayment.PaymentNo, refundErr)
+		}
+		return nil, err
+	}
+	result.Payment = prepayment
+	return result, nil
+}
+
+func (s *WaitlistService) List(ctx context.Context, userId string) ([]*model.Waitlist, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return s.WaitlistRepo.ListByUserId(ctx, userId)
+}
+
+func (s *WaitlistService) Position(ctx context.Context, userId string, waitlistId string) (*model.Waitlist, int64, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	waitlist, err := s.getOwned(ctx, userId, waitlistId)
+	if err != nil {
+		return nil, 0, err
+	}
+	if waitlist.WaitlistStatus != enum.WaitlistStatusWaiting {
+		return waitlist, 0, nil
+	}
+	ahead, err := s.WaitlistRepo.CountAhead(ctx, waitlist)
+	if err != nil {
+		return nil, 0, err
+	}
+	return waitlist, ahead + 1, nil
+}
+
+func (s *WaitlistService) Cancel(ctx context.Context, userId string, waitlistId string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	waitlist, err := s.getOwned(ctx, userId, waitlistId)
+	if err != nil {
+		return false, err
+	}
+	// 与兑现使用同一把锁，避免取消的同时被兑现
+	lock := s.RedisRepo.NewSafeLock(waitlistLockKey(waitlistId), 10*time.Second)
+	acquired, err := lock.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("获取分布式锁失败: %v", err)
+	}
+	if !acquired {
+		return false, errors.New("候补订单正在兑现，请稍后重试")
+	}
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			fmt.Printf("释放分布式锁失败: %v\n", err)
+		}
+	}()
+	ok, err := s.WaitlistRepo.UpdateStatus(ctx, waitlistId, []enum.WaitlistStatus{enum.WaitlistStatusPending, enum.WaitlistStatusWaiting}, enum.WaitlistStatusCancelled, "")
+	if err != nil || !ok {
+		return ok, err
+	}
+	s.refundPrepayment(ctx, waitlist, "候补订单已取消")
+	return true, nil
+}
+
+func (s *WaitlistService) MatchRun(ctx context.Context, ticketTag string, runDate string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	// 同一开行计划同时只有一个兑现任务
+	runLock := s.RedisRepo.NewSafeLock(waitlistRunLockKey(ticketTag, runDate), 30*time.Second)
+	acquired, err := runLock.Acquire(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("获取分布式锁失败: %v", err)
+	}
+	if !acquired {
+		return 0, nil
+	}
+	defer func() {
+		if err := runLock.Release(ctx); err != nil {
+			fmt.Printf("释放分布式锁失败: %v\n", err)
+		}
+	}()
+
+	s.expireDue(ctx)
+
+	waitlists, err := s.WaitlistRepo.ListWaiting(ctx, enum.TicketTag(ticketTag), runDate)
+	if err != nil {
+		return 0, fmt.Errorf("查询候补订单失败: %v", err)
+	}
+	fulfilled := 0
+	// 同一席别、同一区间严格按登记顺序兑现：排在前面的候补未兑现时，后面的不能越过它；
+	// 不同席别或区间的候补互不影响
+	blocked := make(map[string]bool)
+	for _, waitlist := range waitlists {
+		if err := ctx.Err(); err != nil {
+			return fulfilled, err
+		}
+		queue := fmt.Sprintf("%d_%s_%s", waitlist.SeatClass, waitlist.FromStation, waitlist.ToStation)
+		if blocked[queue] {
+			continue
+		}
+		err := s.fulfil(ctx, waitlist)
+		switch {
+		case err == nil:
+			fulfilled++
+		case errors.Is(err, errNoSeatsAvailable) || errors.Is(err, errSeatTaken):
+			// 余票不足时后面的候补也不能越过它，等下次释放座位再兑现
+			fmt.Printf("候补订单 %s 暂未兑现: %v\n", waitlist.WaitlistId, err)
+			blocked[queue] = true
+		default:
+			// 乘车人原因的失败已在fulfil中放弃该候补，其他错误保留候补下次重试，均不阻塞后面的候补
+			fmt.Printf("候补订单 %s 兑现失败: %v\n", waitlist.WaitlistId, err)
+		}
+	}
+	return fulfilled, nil
+}
+
+func (s *WaitlistService) OnSeatReleased(ctx context.Context, ticketTag string, runDate string) {
+	fulfilled, err := s.MatchRun(ctx, ticketTag, runDate)
+	if err != nil {
+		fmt.Printf("兑现车次 %s (%s) 候补订单失败: %v\n", ticketTag, runDate, err)
+		return
+	}
+	if fulfilled > 0 {
+		fmt.Printf("车次 %s (%s) 兑现 %d 个候补订单\n", ticketTag, runDate, fulfilled)
+	}
+}
+
+func (s *WaitlistService) StartMatcherJob(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Println("候补兑现任务已停止")
+			return
+		case <-ticker.C:
+		}
+
+		runs, err := s.WaitlistRepo.ListWaitingRuns(ctx)
+		if err != nil {
+			fmt.Printf("查询候补开行计划失败: %v\n", err)
+			continue
+		}
+		for _, run := range runs {
+			s.OnSeatReleased(ctx, string(run.TicketTag), run.RunDate)
+		}
+	}
+}
+
+// 通过正常购票流程为候补订单下单，由服务端按席别选座
+func (s *WaitlistService) fulfil(ctx context.Context, waitlist *model.Waitlist) error {
+	lock := s.RedisRepo.NewSafeLock(waitlistLockKey(waitlist.WaitlistId), 30*time.Second)
+	acquired, err := lock.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("获取分布式锁失败: %v", err)
+	}
+	if !acquired {
+		return errors.New("候补订单正在处理")
+	}
+	defer func() {
+		if err := lock.Release(ctx); err != nil {
+			fmt.Printf("释放分布式锁失败: %v\n", err)
+		}
+	}()
+
+	// 加锁后重新读取，可能已被取消
+	current, err := s.WaitlistRepo.Get(ctx, waitlist)
+	if err != nil {
+		return err
+	}
+	if current.WaitlistStatus != enum.WaitlistStatusWaiting {
+		return errors.New("候补订单已不在候补中")
+	}
+
+	// 候补状态在购票事务中更新，兑现成功即不会再次下单
+	order, err := s.TicketService.BuyForWaitlist(ctx, current)
+	if err != nil {
+		if isPassengerError(err) {
+			s.abandon(ctx, current, err)
+		}
+		return err
+	}
+	fmt.Printf("候补订单 %s 已兑现，订单 %s\n", current.WaitlistId, order.OrderId)
+	return nil
+}
+
+// 截止时间已过的候补订单置为过期并退还预付款
+func (s *WaitlistService) expireDue(ctx context.Context) {
+	waitlists, err := s.WaitlistRepo.ListExpiring(ctx, time.Now())
+	if err != nil {
+		fmt.Printf("候补订单过期处理失败: %v\n", err)
+		return
+	}
+	for _, waitlist := range waitlists {
+		ok, err := s.WaitlistRepo.UpdateStatus(ctx, waitlist.WaitlistId, []enum.WaitlistStatus{enum.WaitlistStatusPending, enum.WaitlistStatusWaiting}, enum.WaitlistStatusExpired, "")
+		if err != nil {
+			fmt.Printf("候补订单 %s 过期处理失败: %v\n", waitlist.WaitlistId, err)
+			continue
+		}
+		if ok {
+			fmt.Printf("候补订单 %s 已过期\n", waitlist.WaitlistId)
+			s.refundPrepayment(ctx, waitlist, "候补订单已过期")
+		}
+	}
+}
+
+// 乘车人已删除、未核验或行程冲突的候补订单无法兑现，置为过期并退还预付款
+func (s *WaitlistService) abandon(ctx context.Context, waitlist *model.Waitlist, cause error) {
+	ok, err := s.WaitlistRepo.UpdateStatus(ctx, waitlist.WaitlistId, []enum.WaitlistStatus{enum.WaitlistStatusWaiting}, enum.WaitlistStatusExpired, "")
+	if err != nil {
+		fmt.Printf("候补订单 %s 置为过期失败: %v\n", waitlist.WaitlistId, err)
+		return
+	}
+	if ok {
+		fmt.Printf("候补订单 %s 无法兑现，已置为过期: %v\n", waitlist.WaitlistId, cause)
+		s.refundPrepayment(ctx, waitlist, "候补订单无法兑现")
+	}
+}
+
+// 退还未兑现候补订单的预付款
+func (s *WaitlistService) refundPrepayment(ctx context.Context, waitlist *model.Waitlist, reason string) {
+	if waitlist.PaymentNo == "" {
+		return
+	}
+	if err := s.PaymentService.RefundPrepayment(ctx, waitlist.PaymentNo, reason); err != nil {
+		fmt.Printf("退还候补订单 %s 预付款失败: %v\n", waitlist.WaitlistId, err)
+	}
+}
+
+// 查询候补订单并校验归属
+func (s *WaitlistService) getOwned(ctx context.Context, userId string, waitlistId string) (*model.Waitlist, error) {
+	if waitlistId == "" {
+		return nil, errors.New("候补订单ID不能为空")
+	}
+	waitlist, err := s.WaitlistRepo.Get(ctx, &model.Waitlist{WaitlistId: waitlistId})
+	if err != nil {
+		fmt.Println("查询候补订单失败", err)
+		return nil, err
+	}
+	if waitlist.UserId != userId {
+		return nil, errors.New("候补订单不属于当前账号")
+	}
+	return waitlist, nil
+}
+
+// 候补使用独立的锁键前缀，不计入票务锁统计
+func waitlistLockKey(waitlistId string) string {
+	return "waitlist_lock_" + waitlistId
+}
+
+func waitlistRunLockKey(ticketTag string, runDate string) string {
+	return "waitlist_run_lock_" + repository.TicketCacheKey(ticketTag, runDate)
+}
@@ -0,0 +1,111 @@
+package service_test
+
+import (
+	"12305/enum"
+	"12305/model"
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// 队首候补因乘车人原因无法兑现时置为过期，不阻塞后面的候补；余票不足时后面的候补不能越过前面的
+func TestMatchRunSkipsUnfulfillableHead(t *testing.T) {
+	const ticketTag = "T9201"
+	env := newTestEnv(t)
+	ctx := context.Background()
+	runDate := tomorrow()
+	env.seedRun(t, ticketTag, runDate, []string{"S1", "S2", "S3"}, 1)
+
+	now := time.Now()
+	verified := now
+	passengerOf := func(i int) string {
+		if i == 0 {
+			return "passenger_deleted" // 登记后被删除的常用乘车人
+		}
+		passenger := &model.Passenger{
+			PassengerId:   fmt.Sprintf("passenger_%d", i),
+			UserId:        "waitlist_user",
+			PassengerName: fmt.Sprintf("候补乘客%d", i),
+			IdType:        enum.IdTypeResidentCard,
+			IdNumber:      residentId(700 + i),
+			PassengerType: enum.PassengerTypeAdult,
+			VerifyStatus:  enum.VerifyStatusVerified,
+			VerifyTime:    &verified,
+			CreateTime:    now,
+			UpdateTime:    now,
+		}
+		if err := env.db.Create(passenger).Error; err != nil {
+			t.Fatalf("添加乘车人失败: %v", err)
+		}
+		return passenger.PassengerId
+	}
+
+	const entries = 4
+	ids := make([]string, entries)
+	for i := 0; i < entries; i++ {
+		ids[i] = fmt.Sprintf("waitlist_%d", i)
+		waitlist := &model.Waitlist{
+			WaitlistId:     ids[i],
+			UserId:         "waitlist_user",
+			TicketTag:      enum.TicketTag(ticketTag),
+			RunDate:        runDate,
+			FromStation:    "S1",
+			ToStation:      "S3",
+			SeatClass:      enum.SeatClassSecond,
+			Deadline:       now.Add(time.Hour),
+			WaitlistStatus: enum.WaitlistStatusWaiting,
+			Passengers: []model.WaitlistPassenger{{
+				WaitlistPassengerId: ids[i] + "_p",
+				PassengerId:         passengerOf(i),
+			}},
+			CreateTime: now.Add(time.Duration(i) * time.Second),
+			UpdateTime: now,
+		}
+		if err := env.db.Create(waitlist).Error; err != nil {
+			t.Fatalf("登记候补订单失败: %v", err)
+		}
+	}
+
+	fulfilled, err := env.app.Services.Waitlist.MatchRun(ctx, ticketTag, runDate)
+	if err != nil {
+		t.Fatalf("兑现候补订单失败: %v", err)
+	}
+	if fulfilled != 1 {
+		t.Errorf("兑现 %d 个候补订单，应为 1 个", fulfilled)
+	}
+
+	// 队首乘车人已删除，置为过期；第二个兑现唯一的座位；之后余票不足，后面的候补保持候补中
+	want := []enum.WaitlistStatus{
+		enum.WaitlistStatusExpired,
+		enum.WaitlistStatusFulfilled,
+		enum.WaitlistStatusWaiting,
+		enum.WaitlistStatusWaiting,
+	}
+	for i, id := range ids {
+		var waitlist model.Waitlist
+		if err := env.db.Where("waitlist_id=?", id).First(&waitlist).Error; err != nil {
+			t.Fatalf("查询候补订单失败: %v", err)
+		}
+		if waitlist.WaitlistStatus != want[i] {
+			t.Errorf("候补订单 %s 为%s，应为%s", id, waitlist.WaitlistStatus, want[i])
+		}
+		if (waitlist.OrderId != "") != (want[i] == enum.WaitlistStatusFulfilled) {
+			t.Errorf("候补订单 %s 关联订单 %q", id, waitlist.OrderId)
+		}
+	}
+	if _, soldSeats := env.soldBits(t, ticketTag, runDate); soldSeats != 1 {
+		t.Errorf("售出 %d 个座位，应为 1 个", soldSeats)
+	}
+
+	// 候补锁使用独立前缀，不混入票务锁；匹配结束后也不残留
+	for _, pattern := range []string{"ticket_lock_*", "waitlist_*"} {
+		locks, err := env.redis.Keys(ctx, pattern).Result()
+		if err != nil {
+			t.Fatalf("查询分布式锁失败: %v", err)
+		}
+		if len(locks) > 0 {
+			t.Errorf("残留 %d 个分布式锁: %v", len(locks), locks)
+		}
+	}
+}
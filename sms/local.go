@@ -0,0 +1,62 @@
+package sms
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 本地开发使用：短信内容输出到日志
+type ConsoleSender struct{}
+
+func (s *ConsoleSender) Name() string {
+	return "console"
+}
+
+func (s *ConsoleSender) Send(ctx context.Context, phone string, content string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	log.Printf("[短信] %s: %s", phone, content)
+	return nil
+}
+
+// 本地联调使用：短信内容逐行追加到文件，便于脚本读取验证码
+type FileSender struct {
+	Path string
+	mu   sync.Mutex
+}
+
+func NewFileSender(path string) *FileSender {
+	if path == "" {
+		path = "data/sms.log"
+	}
+	return &FileSender{Path: path}
+}
+
+func (s *FileSender) Name() string {
+	return "file"
+}
+
+func (s *FileSender) Send(ctx context.Context, phone string, content string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0o755); err != nil {
+		return fmt.Errorf("创建短信文件目录失败: %v", err)
+	}
+	f, err := os.OpenFile(s.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("打开短信文件失败: %v", err)
+	}
+	defer f.Close()
+	_, err = fmt.Fprintf(f, "%s\t%s\t%s\n", time.Now().Format("2006-01-02 15:04:05"), phone, content)
+	return err
+}
@@ -0,0 +1,28 @@
+package sms
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// 短信发送渠道，新增渠道实现该接口即可
+type SMSSender interface {
+	Name() string
+	Send(ctx context.Context, phone string, content string) error
+}
+
+// 按名称创建发送渠道：console 输出到日志，file 追加写入 path 指定的文件；
+// 名称为空或不支持时返回错误，避免配置写错时验证码只输出到日志而发不到手机
+func NewSender(name string, path string) (SMSSender, error) {
+	switch name {
+	case "file":
+		return NewFileSender(path), nil
+	case "console":
+		return &ConsoleSender{}, nil
+	case "":
+		return nil, errors.New("未配置短信渠道")
+	default:
+		return nil, fmt.Errorf("不支持的短信渠道: %s", name)
+	}
+}
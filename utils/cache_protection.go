@@ -46,6 +46,11 @@ func (cp *CacheProtector) CacheNull(key string, duration time.Duration) {
 	}()
 }
 
+// 防穿透：数据写入缓存后清除空值标记
+func (cp *CacheProtector) RemoveNull(key string) {
+	cp.nullCache.Delete(key)
+}
+
 // 防雪崩：生成随机过期时间
 func (cp *CacheProtector) GetRandomExpiration(baseDuration time.Duration) time.Duration {
 	randomFactor := 1 + rand.Float64()*0.3
@@ -77,6 +82,7 @@ func (cp *CacheProtector) GetHotKeysStats() map[string]interface{} {
 
 // 布隆
 type BloomFilter struct {
+	mu     sync.RWMutex
 	bitmap []bool
 	size   int
 	hashes int
@@ -90,12 +96,16 @@ func NewBloomFilter(size, hashes int) *BloomFilter {
 	}
 }
 func (bf *BloomFilter) Add(key string) {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
 	for i := 0; i < bf.hashes; i++ {
 		hash := bf.hash(key, i)
 		bf.bitmap[hash%bf.size] = true
 	}
 }
 func (bf *BloomFilter) MayContain(key string) bool {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
 	for i := 0; i < bf.hashes; i++ {
 		hash := bf.hash(key, i)
 		if !bf.bitmap[hash%bf.size] {
@@ -116,6 +126,8 @@ func (bf *BloomFilter) hash(key string, seed int) int {
 
 // 获取布隆过滤器统计信息
 func (bf *BloomFilter) GetStats() map[string]interface{} {
+	bf.mu.RLock()
+	defer bf.mu.RUnlock()
 	stats := make(map[string]interface{})
 
 	totalBits := len(bf.bitmap)
@@ -0,0 +1,47 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 密码长度限制，bcrypt 只使用前72字节
+const (
+	MinPasswordLen = 6
+	MaxPasswordLen = 72
+)
+
+func ValidatePassword(password string) error {
+	if len(password) < MinPasswordLen {
+		return errors.New("密码长度不能少于6位")
+	}
+	if len(password) > MaxPasswordLen {
+		return errors.New("密码长度不能超过72位")
+	}
+	return nil
+}
+
+// 使用 bcrypt 生成密码哈希
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// 是否为 bcrypt 哈希，早期注册的用户密码为明文
+func IsPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") || strings.HasPrefix(stored, "$2b$") || strings.HasPrefix(stored, "$2y$")
+}
+
+// 校验密码，stored 为明文时按常量时间比较
+func CheckPassword(stored string, password string) bool {
+	if IsPasswordHash(stored) {
+		return bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+}
@@ -30,6 +30,9 @@ func GetLimitAndOffset(page, pageSize int) (limit, offset int) {
 // 时间
 const TimeLayout = "2006-01-02 15:04:05"
 
+// 日期，用于开行计划
+const DateLayout = "2006-01-02"
+
 var (
 	local, _ = time.LoadLocation("Asia/beijing")
 )
@@ -67,7 +70,7 @@ var DB *gorm.DB
 
 func QueryAllTicketsForToday() ([]*model.Ticket, error) {
 	var tickets []*model.Ticket
-	err := DB.Where("date = ?", time.Now().Format("2006-01-02")).Find(&tickets).Error
+	err := DB.Where("run_date = ?", time.Now().Format(DateLayout)).Find(&tickets).Error
 	if err != nil {
 		return nil, err
 	}